@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/app"
+	"github.com/vhPedroGitHub/firewall/internal/policy"
+)
+
+var (
+	applyFile   string
+	applyPrune  bool
+	applyDryRun bool
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Converge rules and profiles on a declarative policy file",
+	Long: `Read a YAML or JSON policy document listing rules and profiles, validate it,
+print the plan against the stored rules and profiles and apply it in one
+transaction. Rules and profiles in the file are created or updated; with
+--prune, stored rules missing from the file are deleted. Profiles missing from
+the file are kept. Use "-" to read the document from standard input, and run
+"platform sync" afterwards to update the OS firewall.
+
+Example document:
+
+  version: 1
+  rules:
+    - name: web
+      application: any
+      ports: [80, 443]
+  profiles:
+    - name: work
+      description: Work
+      rules: [web]`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil || profileStore == nil {
+			return errors.New("store not initialized")
+		}
+		if applyFile == "" {
+			return errors.New("--file is required")
+		}
+		var data []byte
+		var err error
+		if applyFile == "-" {
+			data, err = io.ReadAll(cmd.InOrStdin())
+		} else {
+			data, err = os.ReadFile(applyFile)
+		}
+		if err != nil {
+			return err
+		}
+		doc, err := policy.Parse(data)
+		if err != nil {
+			return err
+		}
+		uow := app.UnitOfWork{DB: db, Rules: ruleStore, Profiles: profileStore}
+		plan, err := uow.ApplyPolicy(cmd.Context(), doc, applyPrune, applyDryRun)
+		if err != nil {
+			return err
+		}
+		printPolicyPlan(cmd.OutOrStdout(), plan)
+		switch {
+		case plan.Empty():
+		case applyDryRun:
+			fmt.Fprintln(cmd.OutOrStdout(), "dry run: nothing changed")
+		default:
+			fmt.Fprintln(cmd.OutOrStdout(), "policy applied")
+		}
+		return nil
+	},
+}
+
+// printPolicyPlan writes a human-readable summary of a policy plan.
+func printPolicyPlan(w io.Writer, plan *policy.Plan) {
+	if plan.Empty() {
+		fmt.Fprintf(w, "up to date (%d unchanged)\n", plan.Count(policy.Unchanged))
+		return
+	}
+	marks := map[policy.Action]string{policy.Create: "+", policy.Update: "~", policy.Delete: "-"}
+	for _, c := range plan.Changes {
+		if mark, ok := marks[c.Action]; ok {
+			fmt.Fprintf(w, "%s %s %s\n", mark, c.Kind, c.Name)
+		}
+	}
+	fmt.Fprintf(w, "%d to create, %d to update, %d to delete, %d unchanged\n",
+		plan.Count(policy.Create), plan.Count(policy.Update), plan.Count(policy.Delete), plan.Count(policy.Unchanged))
+}
+
+func init() {
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "policy document to apply, or - for standard input (required)")
+	applyCmd.Flags().BoolVar(&applyPrune, "prune", false, "delete stored rules the document does not declare")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "print the plan without applying it")
+	_ = applyCmd.MarkFlagRequired("file")
+
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/config"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and upgrade the database schema",
+	// Opening the stores would migrate the database before these commands
+	// get to look at it, so only the handle is opened here.
+	PersistentPreRunE: ensureDB,
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending schema migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		applied, pending, err := storage.Status(db)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		version := 0
+		if n := len(applied); n > 0 {
+			version = applied[n-1].Version
+		}
+		fmt.Fprintf(out, "schema version %d (latest %d)\n", version, version+len(pending))
+		for _, a := range applied {
+			fmt.Fprintf(out, "  %04d_%s applied %s\n", a.Version, a.Name, a.AppliedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		for _, m := range pending {
+			fmt.Fprintf(out, "  %04d_%s pending\n", m.Version, m.Name)
+		}
+		return nil
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Long:  `Apply every pending schema migration in order. A database that already holds data is first copied to <db>.v<version>-<timestamp>.bak. The stores also migrate automatically when they open the database.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		res, err := storage.Migrate(db)
+		out := cmd.OutOrStdout()
+		if res.Backup != "" {
+			fmt.Fprintf(out, "backup written to %s\n", res.Backup)
+		}
+		for _, m := range res.Applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(res.Applied) == 0 {
+			fmt.Fprintf(out, "database already up to date (version %d)\n", res.To)
+			return nil
+		}
+		fmt.Fprintf(out, "schema version %d\n", res.To)
+		return nil
+	},
+}
+
+// ensureDB opens the database handle without the rule and profile stores.
+func ensureDB(cmd *cobra.Command, args []string) error {
+	if db != nil {
+		return nil
+	}
+	cfg, _ := config.Load(cfgPath)
+	if dbPath == "firewall.db" { // Use config if flag not overridden
+		dbPath = cfg.DBPath
+	}
+	if err := initLogging(cfg); err != nil {
+		return err
+	}
+	handle, err := storage.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	db = handle
+	return nil
+}
+
+func init() {
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+
+	rootCmd.AddCommand(dbCmd)
+}
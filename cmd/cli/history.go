@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/app"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+var (
+	historyName  string
+	historyLimit int
+	revertTo     int64
+	revertNoSync bool
+)
+
+var rulesHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the audit trail of rule changes",
+	Long:  `List recorded rule changes, newest first, with who made them and from where (cli, gui or monitor). Pass a revision to "rules revert --to" to undo the changes made after it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		list, err := ruleStore.History(cmd.Context(), historyName, historyLimit)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "no recorded changes")
+			return nil
+		}
+		for _, c := range list {
+			printChange(cmd.OutOrStdout(), c)
+		}
+		return nil
+	},
+}
+
+var rulesRevertCmd = &cobra.Command{
+	Use:   "revert",
+	Short: "Restore the rules as they were at a revision",
+	Long: `Undo every rule change recorded after --to, newest first, in one
+transaction, then reconcile the OS firewall with the result. The undo steps are
+recorded in the history too, so a revert can itself be reverted. Rules restored
+after a deletion are not put back into the profiles that listed them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		undone, err := svc.RevertRules(cmd.Context(), revertTo)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if len(undone) == 0 {
+			fmt.Fprintf(out, "nothing to revert after revision %d\n", revertTo)
+			return nil
+		}
+		for _, c := range undone {
+			fmt.Fprint(out, "undid ")
+			printChange(out, c)
+		}
+		if revertNoSync {
+			return nil
+		}
+		plan, err := svc.Sync()
+		if err != nil {
+			return fmt.Errorf("rules reverted but platform sync failed: %w", err)
+		}
+		printPlan(out, plan)
+		return nil
+	},
+}
+
+// printChange prints one history entry on a line.
+func printChange(w io.Writer, c rules.Change) {
+	subject := c.Rule
+	if c.Operation == rules.OpRename && c.Old != nil {
+		subject = fmt.Sprintf("%s -> %s", c.Old.Name, c.Rule)
+	}
+	fmt.Fprintf(w, "#%d %s %s %s by %s (%s)", c.Revision, c.At.Local().Format("2006-01-02 15:04:05"), c.Operation, subject, c.Actor, c.Source)
+	if c.Operation == rules.OpUpdate && c.Old != nil && c.New != nil {
+		if fields := changedFields(*c.Old, *c.New); len(fields) > 0 {
+			fmt.Fprintf(w, ": %s", strings.Join(fields, ", "))
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// changedFields describes the rule fields an update changed.
+func changedFields(old, new rules.Rule) []string {
+	var out []string
+	diff := func(name string, a, b string) {
+		if a != b {
+			out = append(out, fmt.Sprintf("%s %q -> %q", name, a, b))
+		}
+	}
+	diff("application", old.Application, new.Application)
+	diff("action", old.Action, new.Action)
+	diff("protocol", old.Protocol, new.Protocol)
+	diff("direction", old.Direction, new.Direction)
+	diff("ports", fmt.Sprint(old.Ports), fmt.Sprint(new.Ports))
+	diff("local ports", strings.Join(old.LocalPorts, ","), strings.Join(new.LocalPorts, ","))
+	diff("remote ports", strings.Join(old.RemotePorts, ","), strings.Join(new.RemotePorts, ","))
+	diff("local", strings.Join(old.LocalAddresses, ","), strings.Join(new.LocalAddresses, ","))
+	diff("remote", strings.Join(old.RemoteAddresses, ","), strings.Join(new.RemoteAddresses, ","))
+	diff("user", old.User, new.User)
+	diff("group", old.Group, new.Group)
+	diff("priority", fmt.Sprint(old.Priority), fmt.Sprint(new.Priority))
+	diff("sha256", old.SHA256, new.SHA256)
+	diff("package", old.Package, new.Package)
+	diff("expires", formatExpiry(old), formatExpiry(new))
+	diff("session", fmt.Sprint(old.Session), fmt.Sprint(new.Session))
+	diff("schedule", scheduleText(old.Schedule), scheduleText(new.Schedule))
+	return out
+}
+
+func formatExpiry(r rules.Rule) string {
+	if r.ExpiresAt.IsZero() {
+		return ""
+	}
+	return r.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+}
+
+func scheduleText(s *rules.Schedule) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
+
+func init() {
+	rulesCmd.AddCommand(rulesHistoryCmd)
+	rulesCmd.AddCommand(rulesRevertCmd)
+
+	rulesHistoryCmd.Flags().StringVar(&historyName, "name", "", "only show changes to this rule")
+	rulesHistoryCmd.Flags().IntVar(&historyLimit, "limit", 0, "show at most this many entries (default all)")
+
+	rulesRevertCmd.Flags().Int64Var(&revertTo, "to", 0, "revision to restore; 0 undoes the whole history (required)")
+	rulesRevertCmd.Flags().BoolVar(&revertNoSync, "no-sync", false, "only restore the stored rules, leaving the OS firewall as it is")
+	_ = rulesRevertCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/app"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+var lintProfile string
+
+var rulesLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Report shadowed, redundant, contradictory and dead rules",
+	Long: `Analyse the rules in evaluation order and report problems:
+
+  shadowed       an earlier rule with the opposite action matches all its connections
+  redundant      an earlier rule with the same action already matches all its connections
+  contradictory  another rule matches the same connections with the opposite action
+  dead           the rule expired or its application does not exist
+
+With --profile only the rules that profile enforces are analysed. The command
+fails when any finding has error severity.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		findings, err := svc.LintRules(lintProfile)
+		if err != nil {
+			return err
+		}
+		if len(findings) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "no problems found")
+			return nil
+		}
+		counts := make(map[string]int)
+		for _, f := range findings {
+			counts[f.Severity]++
+			fmt.Fprintf(cmd.OutOrStdout(), "%-7s %-13s %s: %s\n", f.Severity, f.Kind, f.Rule, f.Message)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d error(s), %d warning(s), %d info\n",
+			counts[rules.SeverityError], counts[rules.SeverityWarning], counts[rules.SeverityInfo])
+		if counts[rules.SeverityError] > 0 {
+			return fmt.Errorf("%d rule error(s) found", counts[rules.SeverityError])
+		}
+		return nil
+	},
+}
+
+func init() {
+	rulesCmd.AddCommand(rulesLintCmd)
+
+	rulesLintCmd.Flags().StringVar(&lintProfile, "profile", "", "only analyse the rules this profile enforces")
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
+	"github.com/vhPedroGitHub/firewall/internal/app"
 	"github.com/vhPedroGitHub/firewall/internal/monitor"
 )
 
@@ -31,14 +35,40 @@ var monitorStartCmd = &cobra.Command{
 			}
 		}
 
+		// The monitor runs one firewall session: clear session rules a previous
+		// run left behind, expire temporary rules and apply schedules while it runs
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		if _, err := svc.EndSession(); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "warning: failed to clear previous session rules: %v\n", err)
+		}
+		stopJanitor := svc.StartJanitor(app.JanitorInterval)
+		defer stopJanitor()
+		stopSchedule := app.NewScheduler(&svc).Start()
+		defer stopSchedule()
+
+		// Only the active profile's rules decide connections. Binding them
+		// tells the platform which applications new processes belong to.
+		monitorSvc.SetScope(&svc)
+		if _, err := svc.BindApplications(); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "warning: failed to bind application processes: %v\n", err)
+		}
 		if err := monitorSvc.Start(); err != nil {
 			return fmt.Errorf("failed to start monitoring: %w", err)
 		}
 
 		fmt.Println("Connection monitoring started. Press Ctrl+C to stop.")
 
-		// Keep the program running
-		select {}
+		// Keep the program running until interrupted, then end the session
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+
+		_ = monitorSvc.Stop()
+		if _, err := svc.EndSession(); err != nil {
+			return fmt.Errorf("failed to remove session rules: %w", err)
+		}
+		fmt.Println("Connection monitoring stopped.")
+		return nil
 	},
 }
 
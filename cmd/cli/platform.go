@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/app"
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/platform"
+)
+
+var (
+	syncDryRun bool
+)
+
+var platformCmd = &cobra.Command{
+	Use:   "platform",
+	Short: "Manage rules installed in the OS firewall",
+}
+
+var platformSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Reconcile the OS firewall with the stored rules",
+	Long:  `Compare the desired rule set (the active profile, or all rules when no profile is active) with the rules installed in the OS firewall and apply the difference in one atomic batch. Use --dry-run to review the plan first.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+
+		var plan *platform.Plan
+		var err error
+		if syncDryRun {
+			plan, err = svc.PlanSync()
+		} else {
+			plan, err = svc.Sync()
+		}
+		if err != nil {
+			return err
+		}
+
+		printPlan(cmd.OutOrStdout(), plan)
+		if syncDryRun {
+			fmt.Fprintln(cmd.OutOrStdout(), "dry run: no changes applied")
+		}
+		return nil
+	},
+}
+
+var platformInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the managed firewall chains",
+	Long:  `Create the FIREWALL-IN and FIREWALL-OUT chains and hook them into the built-in input/output chains. Safe to run repeatedly.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := platform.Init(); err != nil {
+			return err
+		}
+		logging.LogEvent("info", "platform-init", "Managed chains initialized", nil)
+		fmt.Fprintln(cmd.OutOrStdout(), "managed chains initialized")
+		return nil
+	},
+}
+
+var platformTeardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "Remove every rule and chain installed by this tool",
+	Long:  `Remove the jump hooks, the managed chains and every tagged rule from the OS firewall. Stored rules are kept; run "platform sync" to reinstall them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := platform.Teardown(); err != nil {
+			return err
+		}
+		logging.LogEvent("info", "platform-teardown", "Managed chains removed", nil)
+		fmt.Fprintln(cmd.OutOrStdout(), "managed chains removed")
+		return nil
+	},
+}
+
+// printPlan writes a human-readable summary of a reconciliation plan.
+func printPlan(w io.Writer, plan *platform.Plan) {
+	fmt.Fprintf(w, "backend: %s\n", plan.Backend)
+	if plan.Empty() {
+		fmt.Fprintf(w, "in sync (%d rules)\n", len(plan.Unchanged))
+		return
+	}
+	for _, r := range plan.Add {
+		fmt.Fprintf(w, "+ %s\n", r.Name)
+	}
+	for _, r := range plan.Update {
+		fmt.Fprintf(w, "~ %s\n", r.Name)
+	}
+	for _, name := range plan.Remove {
+		fmt.Fprintf(w, "- %s\n", name)
+	}
+	fmt.Fprintf(w, "%d to add, %d to update, %d to remove, %d unchanged\n",
+		len(plan.Add), len(plan.Update), len(plan.Remove), len(plan.Unchanged))
+	if verbose {
+		fmt.Fprintf(w, "\n%s", plan.Script)
+		if plan.Script6 != "" {
+			fmt.Fprintf(w, "\n# IPv6\n%s", plan.Script6)
+		}
+	}
+}
+
+func init() {
+	platformCmd.AddCommand(platformSyncCmd)
+	platformCmd.AddCommand(platformInitCmd)
+	platformCmd.AddCommand(platformTeardownCmd)
+
+	platformSyncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "print the plan without applying it")
+
+	rootCmd.AddCommand(platformCmd)
+}
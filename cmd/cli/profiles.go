@@ -1,14 +1,18 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/vhPedroGitHub/firewall/internal/app"
 	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
 var (
@@ -16,6 +20,14 @@ var (
 	profileDescription string
 	profileExportPath  string
 	profileImportPath  string
+	profileSchedule    string
+	profileRule        string
+	profileRules       string
+	profileExtends     string
+	profileExclude     string
+	profileStrategy    string
+	profileDryRun      bool
+	profilePolicy      string
 )
 
 var profilesCmd = &cobra.Command{
@@ -30,11 +42,21 @@ var profilesListCmd = &cobra.Command{
 		if profileStore == nil {
 			return errors.New("profile store not initialized")
 		}
-		list, err := profileStore.ListProfiles()
+		var list []profiles.Profile
+		var err error
+		if profileRule != "" {
+			list, err = profileStore.FindProfilesContainingRule(cmd.Context(), profileRule)
+		} else {
+			list, err = profileStore.ListProfiles()
+		}
 		if err != nil {
 			return err
 		}
 		if len(list) == 0 {
+			if profileRule != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "no profiles contain rule %q\n", profileRule)
+				return nil
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), "no profiles configured")
 			return nil
 		}
@@ -43,7 +65,21 @@ var profilesListCmd = &cobra.Command{
 			if p.Active {
 				active = " (active)"
 			}
-			fmt.Fprintf(cmd.OutOrStdout(), "- %s%s: %s [%d rules]\n", p.Name, active, p.Description, len(p.Rules))
+			schedule := ""
+			if p.Schedule != nil {
+				schedule = fmt.Sprintf(" schedule=%q", p.Schedule.String())
+			}
+			inherits := ""
+			if len(p.Extends) > 0 {
+				inherits = fmt.Sprintf(" extends=%s", strings.Join(p.Extends, ","))
+			}
+			if len(p.Exclude) > 0 {
+				inherits += fmt.Sprintf(" excludes=%s", strings.Join(p.Exclude, ","))
+			}
+			if !p.DefaultPolicy.IsZero() {
+				inherits += fmt.Sprintf(" default-policy=%s", p.DefaultPolicy)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "- %s%s: %s [%d rules]%s%s\n", p.Name, active, p.Description, len(p.Rules), inherits, schedule)
 		}
 		return nil
 	},
@@ -52,6 +88,15 @@ var profilesListCmd = &cobra.Command{
 var profilesCreateCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new profile",
+	Long: `Create a profile from a list of rules. With --extends the profile also
+inherits the effective rules of one or more parent profiles, minus any named in
+--exclude; "profiles effective" shows the resolved set.
+
+--default-policy decides connections none of the profile's rules match while it
+is active, e.g. "inbound=deny,outbound=prompt" or just "deny" for both
+directions: prompt asks the user (and denies when prompts are off), allow and
+deny are also installed as a final catch-all in the OS firewall. Directions
+left unset are inherited from the parents, then from the configuration.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if profileStore == nil {
 			return errors.New("profile store not initialized")
@@ -59,8 +104,25 @@ var profilesCreateCmd = &cobra.Command{
 		p := profiles.Profile{
 			Name:        profileName,
 			Description: profileDescription,
-			Rules:       []string{},
+			Rules:       parseListFlag(profileRules),
+			Extends:     parseListFlag(profileExtends),
+			Exclude:     parseListFlag(profileExclude),
+		}
+		if p.Rules == nil {
+			p.Rules = []string{}
+		}
+		if profileSchedule != "" {
+			sched, err := rules.ParseSchedule(profileSchedule)
+			if err != nil {
+				return err
+			}
+			p.Schedule = sched
 		}
+		policy, err := rules.ParseDefaultPolicy(profilePolicy)
+		if err != nil {
+			return err
+		}
+		p.DefaultPolicy = policy
 		if err := profileStore.SaveProfile(p); err != nil {
 			return err
 		}
@@ -72,6 +134,7 @@ var profilesCreateCmd = &cobra.Command{
 var profilesActivateCmd = &cobra.Command{
 	Use:   "activate",
 	Short: "Activate a profile",
+	Long:  `Make a profile active and reconcile the OS firewall so exactly its rules are installed; the monitor then only consults those rules. If the firewall cannot be updated the previously active profile is restored.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if profileStore == nil {
 			return errors.New("profile store not initialized")
@@ -79,29 +142,71 @@ var profilesActivateCmd = &cobra.Command{
 		if profileName == "" {
 			return errors.New("--name is required")
 		}
-		if err := profileStore.SetActiveProfile(profileName); err != nil {
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		plan, err := svc.ActivateProfile(profileName)
+		if err != nil {
 			return err
 		}
+		printPlan(cmd.OutOrStdout(), plan)
 		fmt.Fprintf(cmd.OutOrStdout(), "profile %q activated\n", profileName)
 		return nil
 	},
 }
 
+var profilesEffectiveCmd = &cobra.Command{
+	Use:   "effective",
+	Short: "Show the rules a profile enforces, inherited ones included",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if profileStore == nil {
+			return errors.New("profile store not initialized")
+		}
+		list, err := profileStore.EffectiveRules(cmd.Context(), profileName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("profile %q not found", profileName)
+		}
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "profile %q enforces no rules\n", profileName)
+		}
+		for _, r := range list {
+			if r.From == profileName {
+				fmt.Fprintf(cmd.OutOrStdout(), "- %s\n", r.Name)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "- %s (from %s)\n", r.Name, r.From)
+			}
+		}
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		policy, err := svc.ProfilePolicy(profileName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "default policy: %s\n", policy)
+		return nil
+	},
+}
+
 var profilesExportCmd = &cobra.Command{
 	Use:   "export",
-	Short: "Export a profile to JSON",
+	Short: "Export profiles to a self-contained bundle",
+	Long: `Export one or more profiles as a versioned JSON bundle. The bundle also
+holds the profiles they extend and the full definition of every rule they use,
+plus a checksum, so it can be imported on another machine as is.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if profileStore == nil {
 			return errors.New("profile store not initialized")
 		}
-		if profileName == "" {
+		names := parseListFlag(profileName)
+		if len(names) == 0 {
 			return errors.New("--name is required")
 		}
-		p, err := profileStore.GetProfile(profileName)
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		bundle, err := svc.ExportBundle(names)
 		if err != nil {
 			return err
 		}
-		data, err := json.MarshalIndent(p, "", "  ")
+		data, err := json.MarshalIndent(bundle, "", "  ")
 		if err != nil {
 			return err
 		}
@@ -111,7 +216,7 @@ var profilesExportCmd = &cobra.Command{
 			if err := os.WriteFile(profileExportPath, data, 0644); err != nil {
 				return err
 			}
-			fmt.Fprintf(cmd.OutOrStdout(), "profile %q exported to %s\n", profileName, profileExportPath)
+			fmt.Fprintf(cmd.OutOrStdout(), "%d profile(s) and %d rule(s) exported to %s\n", len(bundle.Profiles), len(bundle.Rules), profileExportPath)
 		}
 		return nil
 	},
@@ -119,7 +224,12 @@ var profilesExportCmd = &cobra.Command{
 
 var profilesImportCmd = &cobra.Command{
 	Use:   "import",
-	Short: "Import a profile from JSON",
+	Short: "Import a profile bundle",
+	Long: `Import the rules and profiles of a bundle written by "profiles export" in
+one transaction. Items that already exist with a different definition are
+handled by --strategy: skip keeps the stored one, overwrite replaces it and
+rename imports the bundle's as <name>-imported. --dry-run only prints the
+preview. A plain profile exported by earlier versions is still accepted.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if profileStore == nil {
 			return errors.New("profile store not initialized")
@@ -127,18 +237,38 @@ var profilesImportCmd = &cobra.Command{
 		if profileImportPath == "" {
 			return errors.New("--file is required")
 		}
+		strategy, err := profiles.ParseStrategy(profileStrategy)
+		if err != nil {
+			return err
+		}
 		data, err := os.ReadFile(profileImportPath)
 		if err != nil {
 			return err
 		}
-		var p profiles.Profile
-		if err := json.Unmarshal(data, &p); err != nil {
+		bundle, err := profiles.ParseBundle(data)
+		if err != nil {
 			return err
 		}
-		if err := profileStore.SaveProfile(p); err != nil {
+		uow := app.UnitOfWork{DB: db, Rules: ruleStore, Profiles: profileStore}
+		plan, err := uow.ImportBundle(cmd.Context(), bundle, strategy, profileDryRun)
+		if err != nil {
 			return err
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "profile %q imported\n", p.Name)
+		for _, item := range plan.Items {
+			if item.As != item.Name {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %s as %s\n", item.Kind, item.Name, item.Action, item.As)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %s\n", item.Kind, item.Name, item.Action)
+			}
+		}
+		switch {
+		case profileDryRun:
+			fmt.Fprintln(cmd.OutOrStdout(), "dry run: nothing imported")
+		case plan.Empty():
+			fmt.Fprintln(cmd.OutOrStdout(), "nothing to import")
+		default:
+			fmt.Fprintf(cmd.OutOrStdout(), "imported %d rule(s) and %d profile(s)\n", len(plan.Rules), len(plan.Profiles))
+		}
 		return nil
 	},
 }
@@ -147,20 +277,33 @@ func init() {
 	profilesCmd.AddCommand(profilesListCmd)
 	profilesCmd.AddCommand(profilesCreateCmd)
 	profilesCmd.AddCommand(profilesActivateCmd)
+	profilesCmd.AddCommand(profilesEffectiveCmd)
 	profilesCmd.AddCommand(profilesExportCmd)
 	profilesCmd.AddCommand(profilesImportCmd)
 
+	profilesListCmd.Flags().StringVar(&profileRule, "rule", "", "only list profiles containing this rule")
+
 	profilesCreateCmd.Flags().StringVar(&profileName, "name", "", "profile name (required)")
 	profilesCreateCmd.Flags().StringVar(&profileDescription, "description", "", "profile description")
+	profilesCreateCmd.Flags().StringVar(&profileRules, "rules", "", "comma-separated rule names")
+	profilesCreateCmd.Flags().StringVar(&profileExtends, "extends", "", "comma-separated parent profiles to inherit rules from")
+	profilesCreateCmd.Flags().StringVar(&profileExclude, "exclude", "", "comma-separated inherited rules to leave out")
+	profilesCreateCmd.Flags().StringVar(&profilePolicy, "default-policy", "", "policy for unmatched connections, e.g. \"inbound=deny,outbound=prompt\" (default inherited)")
+	profilesCreateCmd.Flags().StringVar(&profileSchedule, "schedule", "", "activate the profile automatically within this schedule, e.g. \"mon-fri 09:00-17:00\"")
 	_ = profilesCreateCmd.MarkFlagRequired("name")
 
 	profilesActivateCmd.Flags().StringVar(&profileName, "name", "", "profile name (required)")
 	_ = profilesActivateCmd.MarkFlagRequired("name")
 
-	profilesExportCmd.Flags().StringVar(&profileName, "name", "", "profile name (required)")
+	profilesEffectiveCmd.Flags().StringVar(&profileName, "name", "", "profile name (required)")
+	_ = profilesEffectiveCmd.MarkFlagRequired("name")
+
+	profilesExportCmd.Flags().StringVar(&profileName, "name", "", "comma-separated profile names (required)")
 	profilesExportCmd.Flags().StringVar(&profileExportPath, "file", "", "export file path (optional, prints to stdout if omitted)")
 	_ = profilesExportCmd.MarkFlagRequired("name")
 
 	profilesImportCmd.Flags().StringVar(&profileImportPath, "file", "", "import file path (required)")
+	profilesImportCmd.Flags().StringVar(&profileStrategy, "strategy", string(profiles.StrategySkip), "what to do with existing items that differ: skip, overwrite or rename")
+	profilesImportCmd.Flags().BoolVar(&profileDryRun, "dry-run", false, "preview the import without writing anything")
 	_ = profilesImportCmd.MarkFlagRequired("file")
 }
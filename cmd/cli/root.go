@@ -4,15 +4,20 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/vhPedroGitHub/firewall/internal/app"
 	"github.com/vhPedroGitHub/firewall/internal/config"
 	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/monitor"
+	"github.com/vhPedroGitHub/firewall/internal/platform"
 	"github.com/vhPedroGitHub/firewall/internal/profiles"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 var (
@@ -20,8 +25,8 @@ var (
 	verbose      bool
 	dbPath       string
 	db           *sql.DB
-	ruleStore    rules.Store
-	profileStore profiles.Store
+	ruleStore    *rules.SQLiteStore
+	profileStore *profiles.SQLiteStore
 )
 
 // rootCmd is the base command for the CLI.
@@ -78,7 +83,31 @@ func ensureStore(cmd *cobra.Command, args []string) error {
 		dbPath = cfg.DBPath
 	}
 
-	handle, err := sql.Open("sqlite3", dbPath)
+	if err := platform.Configure(platform.Options{
+		LinuxBackend:  cfg.Platform.LinuxBackend,
+		LinuxAppMatch: cfg.Platform.LinuxAppMatch,
+	}); err != nil {
+		return err
+	}
+	if err := monitor.Configure(monitor.Options{
+		Mode:           cfg.Monitor.Mode,
+		QueueNum:       cfg.Monitor.QueueNum,
+		Timeout:        time.Duration(cfg.Monitor.TimeoutSeconds) * time.Second,
+		TimeoutVerdict: cfg.Monitor.TimeoutVerdict,
+	}); err != nil {
+		return err
+	}
+	if err := app.Configure(app.Options{
+		DefaultPolicy: rules.DefaultPolicy{Inbound: cfg.DefaultPolicy.Inbound, Outbound: cfg.DefaultPolicy.Outbound},
+	}); err != nil {
+		return err
+	}
+
+	// Initialize logging first so schema migrations run by the stores are logged
+	if err := initLogging(cfg); err != nil {
+		return err
+	}
+	handle, err := storage.Open(dbPath)
 	if err != nil {
 		return err
 	}
@@ -87,26 +116,26 @@ func ensureStore(cmd *cobra.Command, args []string) error {
 		handle.Close()
 		return err
 	}
+	store.SetSource(rules.SourceCLI)
 	pStore, err := profiles.NewSQLiteStore(handle)
 	if err != nil {
 		handle.Close()
 		return err
 	}
-	// Initialize logging
-	logPath := cfg.LogPath
-	if logPath == "" {
-		logPath = "firewall.log"
-	}
-	if err := logging.Init(logPath); err != nil {
-		handle.Close()
-		return err
-	}
 	db = handle
 	ruleStore = store
 	profileStore = pStore
 	return nil
 }
 
+func initLogging(cfg config.Config) error {
+	logPath := cfg.LogPath
+	if logPath == "" {
+		logPath = "firewall.log"
+	}
+	return logging.Init(logPath)
+}
+
 func cleanupStore(cmd *cobra.Command, args []string) {
 	if db != nil {
 		_ = db.Close()
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/app"
+	"github.com/vhPedroGitHub/firewall/internal/policy"
+	"github.com/vhPedroGitHub/firewall/internal/ruleio"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+var (
+	ruleIOFile   string
+	ruleIOFormat string
+	ruleIODryRun bool
+)
+
+// ruleIOFormatFor resolves --format, falling back to the file extension and,
+// when writing to stdout, to JSON.
+func ruleIOFormatFor(path string) (ruleio.Format, error) {
+	if ruleIOFormat != "" {
+		return ruleio.ParseFormat(ruleIOFormat)
+	}
+	if path == "" || path == "-" {
+		return ruleio.JSON, nil
+	}
+	return ruleio.FormatFromPath(path)
+}
+
+var rulesExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export all rules as JSON, YAML or CSV",
+	Long: `Export every stored rule. JSON and YAML are written as a policy document,
+which "rules import" and "firewall apply" both read. Temporary rules (with an
+expiry or bound to the session) are left out.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		format, err := ruleIOFormatFor(ruleIOFile)
+		if err != nil {
+			return err
+		}
+		list, err := ruleStore.ListRules()
+		if err != nil {
+			return err
+		}
+		var persistent []rules.Rule
+		for _, r := range list {
+			if !r.Session && r.ExpiresAt.IsZero() {
+				persistent = append(persistent, r)
+			}
+		}
+		var buf bytes.Buffer
+		if err := ruleio.Export(&buf, format, persistent); err != nil {
+			return err
+		}
+		if skipped := len(list) - len(persistent); skipped > 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "skipped %d temporary rule(s)\n", skipped)
+		}
+		if ruleIOFile == "" || ruleIOFile == "-" {
+			_, err := cmd.OutOrStdout().Write(buf.Bytes())
+			return err
+		}
+		if err := os.WriteFile(ruleIOFile, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d rule(s) exported to %s\n", len(persistent), ruleIOFile)
+		return nil
+	},
+}
+
+var rulesImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import rules from JSON, YAML, CSV, iptables-save or netsh output",
+	Long: `Import rules in one batch, replacing stored rules of the same name.
+
+JSON, YAML and CSV files use the layout written by "rules export" and must be
+valid as a whole. With --format iptables-save or --format netsh the file is a
+dump of an existing firewall ("iptables-save", or "netsh advfirewall firewall
+show rule name=all verbose"); entries that have no rule equivalent are listed
+and skipped. Use "-" to read standard input and --dry-run to only preview.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		if ruleIOFile == "" {
+			return errors.New("--file is required")
+		}
+		format, err := ruleIOFormatFor(ruleIOFile)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if ruleIOFile == "-" {
+			data, err = io.ReadAll(cmd.InOrStdin())
+		} else {
+			data, err = os.ReadFile(ruleIOFile)
+		}
+		if err != nil {
+			return err
+		}
+		res, err := ruleio.Import(data, format)
+		if err != nil {
+			return err
+		}
+		for _, issue := range res.Issues {
+			if issue.Line > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "skipped line %d: %s\n    %s\n", issue.Line, issue.Reason, issue.Text)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "skipped %s: %s\n", issue.Text, issue.Reason)
+			}
+		}
+
+		svc := app.Service{Store: ruleStore}
+		changes, err := svc.ImportRules(cmd.Context(), res.Rules, ruleIODryRun)
+		if err != nil {
+			return err
+		}
+		counts := make(map[policy.Action]int)
+		for _, c := range changes {
+			counts[c.Action]++
+			switch c.Action {
+			case policy.Create:
+				fmt.Fprintf(cmd.OutOrStdout(), "+ %s\n", c.Name)
+			case policy.Update:
+				fmt.Fprintf(cmd.OutOrStdout(), "~ %s\n", c.Name)
+			}
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d to create, %d to update, %d unchanged, %d skipped\n",
+			counts[policy.Create], counts[policy.Update], counts[policy.Unchanged], len(res.Issues))
+		if ruleIODryRun {
+			fmt.Fprintln(cmd.OutOrStdout(), "dry run: nothing imported")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rulesCmd.AddCommand(rulesExportCmd)
+	rulesCmd.AddCommand(rulesImportCmd)
+
+	rulesExportCmd.Flags().StringVar(&ruleIOFile, "file", "", "export file path (optional, prints to stdout if omitted)")
+	rulesExportCmd.Flags().StringVar(&ruleIOFormat, "format", "", "json, yaml or csv (default from the file extension, else json)")
+
+	rulesImportCmd.Flags().StringVar(&ruleIOFile, "file", "", "import file path, or - for standard input (required)")
+	rulesImportCmd.Flags().StringVar(&ruleIOFormat, "format", "", "json, yaml, csv, iptables-save or netsh (default from the file extension)")
+	rulesImportCmd.Flags().BoolVar(&ruleIODryRun, "dry-run", false, "preview the import without writing anything")
+	_ = rulesImportCmd.MarkFlagRequired("file")
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/monitor"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
@@ -19,7 +21,28 @@ var (
 	addProtocol  string
 	addDirection string
 	addPorts     string
+	addUser      string
+	addGroup     string
+	addRemote    string
+	addLocal     string
+	addLocalPort string
+	addRemPort   string
+	addPriority  int
+	addSHA256    string
+	addPin       bool
+	addPackage   string
+	addFor       time.Duration
+	addSession   bool
+	addSchedule  string
 	removeName   string
+	pinName      string
+	listPort     int
+	renameName   string
+	renameTo     string
+
+	reorderName     string
+	reorderPriority int
+	reorderOrder    string
 )
 
 var rulesCmd = &cobra.Command{
@@ -34,16 +57,36 @@ var rulesListCmd = &cobra.Command{
 		if ruleStore == nil {
 			return errors.New("rule store not initialized")
 		}
-		list, err := ruleStore.ListRules()
+		var list []rules.Rule
+		var err error
+		if listPort > 0 {
+			list, err = ruleStore.FindRulesByPort(cmd.Context(), listPort)
+		} else {
+			list, err = ruleStore.ListRules()
+		}
 		if err != nil {
 			return err
 		}
 		if len(list) == 0 {
+			if listPort > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "no rules name port %d\n", listPort)
+				return nil
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), "no rules configured")
 			return nil
 		}
 		for _, r := range list {
-			fmt.Fprintf(cmd.OutOrStdout(), "- %s [%s %s %s] app=%s ports=%v\n", r.Name, r.Action, r.Protocol, r.Direction, r.Application, r.Ports)
+			lifetime := ""
+			switch {
+			case r.Session:
+				lifetime = " session"
+			case !r.ExpiresAt.IsZero():
+				lifetime = " expires=" + r.ExpiresAt.Local().Format(time.RFC3339)
+			}
+			if r.Schedule != nil {
+				lifetime += fmt.Sprintf(" schedule=%q", r.Schedule.String())
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "- %s [%s %s %s] app=%s ports=%v priority=%d%s\n", r.Name, r.Action, r.Protocol, r.Direction, r.Application, r.Ports, r.Priority, lifetime)
 		}
 		return nil
 	},
@@ -56,7 +99,7 @@ var rulesAddCmd = &cobra.Command{
 		if ruleStore == nil {
 			return errors.New("rule store not initialized")
 		}
-		ports, err := parsePortsFlag(addPorts)
+		ports, portList, err := parsePortsFlag(addPorts)
 		if err != nil {
 			return err
 		}
@@ -67,6 +110,44 @@ var rulesAddCmd = &cobra.Command{
 			Protocol:    addProtocol,
 			Direction:   addDirection,
 			Ports:       ports,
+			User:        addUser,
+			Group:       addGroup,
+			Priority:    addPriority,
+			SHA256:      addSHA256,
+			Package:     addPackage,
+			Session:     addSession,
+
+			RemoteAddresses: parseListFlag(addRemote),
+			LocalAddresses:  parseListFlag(addLocal),
+			LocalPorts:      parseListFlag(addLocalPort),
+			RemotePorts:     parseListFlag(addRemPort),
+		}
+		if addSchedule != "" {
+			if r.Schedule, err = rules.ParseSchedule(addSchedule); err != nil {
+				return err
+			}
+		}
+		if addFor > 0 {
+			r.ExpiresAt = time.Now().Add(addFor).UTC().Truncate(time.Second)
+		}
+		if addPin {
+			if addSHA256 != "" {
+				return errors.New("use either --sha256 or --pin")
+			}
+			sum, err := monitor.ExecutableHash(addApp)
+			if err != nil {
+				return fmt.Errorf("hash %s: %w", addApp, err)
+			}
+			r.SHA256 = sum
+		}
+		// Ranges and service names given to --ports apply to the same end as a
+		// plain port list would.
+		if len(portList) > 0 {
+			if r.Direction == "inbound" {
+				r.LocalPorts = append(r.LocalPorts, portList...)
+			} else {
+				r.RemotePorts = append(r.RemotePorts, portList...)
+			}
 		}
 		if err := ruleStore.SaveRule(r); err != nil {
 			return err
@@ -94,52 +175,245 @@ var rulesRemoveCmd = &cobra.Command{
 		if removeName == "" {
 			return errors.New("--name is required")
 		}
+		var members []string
+		if profileStore != nil {
+			found, err := profileStore.FindProfilesContainingRule(cmd.Context(), removeName)
+			if err != nil {
+				return err
+			}
+			for _, p := range found {
+				members = append(members, p.Name)
+			}
+		}
 		if err := ruleStore.DeleteRule(removeName); err != nil {
 			return err
 		}
 		logging.LogEvent("info", "rule-remove", fmt.Sprintf("Rule %q removed", removeName), map[string]interface{}{
-			"name": removeName,
+			"name":     removeName,
+			"profiles": members,
 		})
 		fmt.Fprintf(cmd.OutOrStdout(), "rule %q removed\n", removeName)
+		if len(members) > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "also removed from profiles: %s\n", strings.Join(members, ", "))
+		}
 		return nil
 	},
 }
 
-func parsePortsFlag(raw string) ([]int, error) {
-	if strings.TrimSpace(raw) == "" {
-		return nil, nil
-	}
-	parts := strings.Split(raw, ",")
-	out := make([]int, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
+var rulesRenameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "Rename a firewall rule",
+	Long:  `Rename a rule. Profiles listing it keep it under the new name.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		if err := ruleStore.RenameRule(cmd.Context(), renameName, renameTo); err != nil {
+			return err
+		}
+		logging.LogEvent("info", "rule-rename", fmt.Sprintf("Rule %q renamed to %q", renameName, renameTo), map[string]interface{}{
+			"name":     renameTo,
+			"previous": renameName,
+		})
+		fmt.Fprintf(cmd.OutOrStdout(), "rule %q renamed to %q\n", renameName, renameTo)
+		return nil
+	},
+}
+
+// parsePortsFlag parses --ports. A list of plain port numbers is returned as
+// ints; once it contains a range or a service name every entry is returned as
+// a port list entry instead.
+var rulesPinCmd = &cobra.Command{
+	Use:   "pin",
+	Short: "Pin a rule to the current SHA-256 of its executable",
+	Long: `Records the SHA-256 of the rule's application as it is now. Run it again
+after a legitimate update: connections from an executable that no longer
+matches its pin are treated as coming from an unknown application.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		list, err := ruleStore.ListRules()
+		if err != nil {
+			return err
+		}
+		for _, r := range list {
+			if r.Name != pinName {
+				continue
+			}
+			sum, err := monitor.ExecutableHash(r.Application)
+			if err != nil {
+				return fmt.Errorf("hash %s: %w", r.Application, err)
+			}
+			previous := r.SHA256
+			r.SHA256 = sum
+			if err := ruleStore.SaveRule(r); err != nil {
+				return err
+			}
+			logging.LogEvent("info", "rule-pin", fmt.Sprintf("Rule %q pinned to %s", r.Name, sum), map[string]interface{}{
+				"name":     r.Name,
+				"app":      r.Application,
+				"sha256":   sum,
+				"previous": previous,
+			})
+			fmt.Fprintf(cmd.OutOrStdout(), "rule %q pinned to sha256 %s\n", r.Name, sum)
+			return nil
+		}
+		return fmt.Errorf("rule %q not found", pinName)
+	},
+}
+
+var rulesReorderCmd = &cobra.Command{
+	Use:   "reorder",
+	Short: "Change the evaluation order of rules",
+	Long: `Rules are evaluated first-match in ascending priority; rules of equal
+priority are ordered most specific first, then by name.
+
+Set one rule's priority with --name and --priority, or renumber several rules
+with --order a,b,c, which gives them priorities 10, 20, 30 in that order.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+
+		priorities := make(map[string]int)
+		switch {
+		case reorderOrder != "" && reorderName != "":
+			return errors.New("use either --name or --order")
+		case reorderOrder != "":
+			for i, name := range parseListFlag(reorderOrder) {
+				priorities[name] = (i + 1) * 10
+			}
+		case reorderName != "":
+			if !cmd.Flags().Changed("priority") {
+				return errors.New("--priority is required with --name")
+			}
+			priorities[reorderName] = reorderPriority
+		default:
+			return errors.New("--name or --order is required")
+		}
+
+		list, err := ruleStore.ListRules()
+		if err != nil {
+			return err
+		}
+		byName := make(map[string]rules.Rule, len(list))
+		for _, r := range list {
+			byName[r.Name] = r
+		}
+		for name := range priorities {
+			if _, ok := byName[name]; !ok {
+				return fmt.Errorf("rule %q not found", name)
+			}
+		}
+
+		var moved []rules.Rule
+		for _, r := range list {
+			p, ok := priorities[r.Name]
+			if !ok || r.Priority == p {
+				continue
+			}
+			r.Priority = p
+			moved = append(moved, r)
+		}
+		// Renumber all at once so a failure leaves the old order intact.
+		if err := ruleStore.SaveRules(cmd.Context(), moved); err != nil {
+			return err
+		}
+		for _, r := range moved {
+			logging.LogEvent("info", "rule-reorder", fmt.Sprintf("Rule %q moved to priority %d", r.Name, r.Priority), map[string]interface{}{
+				"name":     r.Name,
+				"priority": r.Priority,
+			})
+		}
+
+		list, err = ruleStore.ListRules()
+		if err != nil {
+			return err
+		}
+		for i, r := range list {
+			fmt.Fprintf(cmd.OutOrStdout(), "%d. %s (priority %d)\n", i+1, r.Name, r.Priority)
+		}
+		return nil
+	},
+}
+
+func parsePortsFlag(raw string) ([]int, []string, error) {
+	entries := parseListFlag(raw)
+	out := make([]int, 0, len(entries))
+	for _, p := range entries {
+		if _, err := rules.ParsePort(p); err != nil {
+			return nil, nil, fmt.Errorf("invalid port %q", p)
 		}
 		v, err := strconv.Atoi(p)
 		if err != nil {
-			return nil, fmt.Errorf("invalid port %q", p)
+			return nil, entries, nil
 		}
 		out = append(out, v)
 	}
-	return out, nil
+	if len(out) == 0 {
+		return nil, nil, nil
+	}
+	return out, nil, nil
+}
+
+// parseListFlag splits a comma-separated flag value, dropping blank entries.
+func parseListFlag(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
 }
 
 func init() {
 	rulesCmd.AddCommand(rulesListCmd)
 	rulesCmd.AddCommand(rulesAddCmd)
 	rulesCmd.AddCommand(rulesRemoveCmd)
+	rulesCmd.AddCommand(rulesRenameCmd)
+	rulesCmd.AddCommand(rulesReorderCmd)
+	rulesCmd.AddCommand(rulesPinCmd)
 
 	rulesAddCmd.Flags().StringVar(&addName, "name", "", "rule name (required)")
-	rulesAddCmd.Flags().StringVar(&addApp, "app", "", "application path or identifier (required)")
+	rulesAddCmd.Flags().StringVar(&addApp, "app", "", "application path, \"any\", directory prefix (trailing /), glob or re:regex (required)")
 	rulesAddCmd.Flags().StringVar(&addAction, "action", "allow", "action: allow or deny")
 	rulesAddCmd.Flags().StringVar(&addProtocol, "protocol", "tcp", "protocol: tcp|udp|any")
 	rulesAddCmd.Flags().StringVar(&addDirection, "direction", "outbound", "direction: inbound|outbound")
-	rulesAddCmd.Flags().StringVar(&addPorts, "ports", "", "comma-separated port list (required for tcp/udp)")
+	rulesAddCmd.Flags().StringVar(&addPorts, "ports", "", "comma-separated ports, from-to ranges or service names (required for tcp/udp)")
+	rulesAddCmd.Flags().StringVar(&addUser, "user", "", "only match sockets owned by this user (Linux, outbound)")
+	rulesAddCmd.Flags().StringVar(&addGroup, "group", "", "only match sockets owned by this group (Linux, outbound)")
+	rulesAddCmd.Flags().StringVar(&addLocalPort, "local-ports", "", "comma-separated local ports, ranges or service names (default any)")
+	rulesAddCmd.Flags().StringVar(&addRemPort, "remote-ports", "", "comma-separated remote ports, ranges or service names (default any)")
+	rulesAddCmd.Flags().StringVar(&addRemote, "remote", "", "comma-separated remote IPs, CIDRs or from-to ranges (default any)")
+	rulesAddCmd.Flags().StringVar(&addLocal, "local", "", "comma-separated local IPs, CIDRs or from-to ranges (default any)")
+
+	rulesAddCmd.Flags().IntVar(&addPriority, "priority", 0, "evaluation priority, lowest first")
+	rulesAddCmd.Flags().StringVar(&addSHA256, "sha256", "", "only trust the executable with this SHA-256")
+	rulesAddCmd.Flags().BoolVar(&addPin, "pin", false, "pin the current SHA-256 of --app")
+	rulesAddCmd.Flags().DurationVar(&addFor, "for", 0, "remove the rule after this long, e.g. 1h (default permanent)")
+	rulesAddCmd.Flags().BoolVar(&addSession, "session", false, "remove the rule when the firewall session ends")
+	rulesAddCmd.Flags().StringVar(&addSchedule, "schedule", "", "only enforce the rule within this schedule, e.g. \"mon-fri 09:00-17:00 Europe/Madrid\"")
+	rulesAddCmd.Flags().StringVar(&addPackage, "package", "", "only trust the executable if this package owns it (Linux)")
 
 	_ = rulesAddCmd.MarkFlagRequired("name")
 	_ = rulesAddCmd.MarkFlagRequired("app")
 
 	rulesRemoveCmd.Flags().StringVar(&removeName, "name", "", "rule name to remove (required)")
 	_ = rulesRemoveCmd.MarkFlagRequired("name")
+
+	rulesListCmd.Flags().IntVar(&listPort, "port", 0, "only list rules naming this port on either end")
+
+	rulesRenameCmd.Flags().StringVar(&renameName, "name", "", "rule to rename (required)")
+	rulesRenameCmd.Flags().StringVar(&renameTo, "to", "", "new rule name (required)")
+	_ = rulesRenameCmd.MarkFlagRequired("name")
+	_ = rulesRenameCmd.MarkFlagRequired("to")
+
+	rulesPinCmd.Flags().StringVar(&pinName, "name", "", "rule to pin (required)")
+	_ = rulesPinCmd.MarkFlagRequired("name")
+
+	rulesReorderCmd.Flags().StringVar(&reorderName, "name", "", "rule to move")
+	rulesReorderCmd.Flags().IntVar(&reorderPriority, "priority", 0, "new priority for --name")
+	rulesReorderCmd.Flags().StringVar(&reorderOrder, "order", "", "comma-separated rule names to renumber in this order")
 }
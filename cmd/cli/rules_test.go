@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -49,6 +50,31 @@ func TestRulesCommands_AddListRemove(t *testing.T) {
 	}
 }
 
+func TestRulesReorder(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+
+	for _, name := range []string{"aaa-allow", "block-all"} {
+		if _, err := runCLI("rules", "add", "--name", name, "--app", "app", "--protocol", "any"); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+
+	out, err := runCLI("rules", "reorder", "--order", "block-all,aaa-allow")
+	if err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if !contains(out, "1. block-all (priority 10)") || !contains(out, "2. aaa-allow (priority 20)") {
+		t.Fatalf("unexpected reorder output: %s", out)
+	}
+
+	if _, err := runCLI("rules", "reorder", "--order", "missing"); err == nil {
+		t.Fatalf("expected error for unknown rule")
+	}
+}
+
 func runCLI(args ...string) (string, error) {
 	buf := &bytes.Buffer{}
 	rootCmd.SetOut(buf)
@@ -69,3 +95,391 @@ func runCLI(args ...string) (string, error) {
 func contains(s, sub string) bool {
 	return bytes.Contains([]byte(s), []byte(sub))
 }
+
+func TestParsePortsFlag(t *testing.T) {
+	ports, list, err := parsePortsFlag("80, 443")
+	if err != nil || len(ports) != 2 || list != nil {
+		t.Fatalf("plain ports: got %v %v %v", ports, list, err)
+	}
+
+	ports, list, err = parsePortsFlag("https,6000-7000")
+	if err != nil || ports != nil || len(list) != 2 {
+		t.Fatalf("ranges and services: got %v %v %v", ports, list, err)
+	}
+
+	if _, _, err := parsePortsFlag("80,nosuchservice"); err == nil {
+		t.Fatalf("expected error for unknown service")
+	}
+}
+
+func TestDBCommands(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+
+	out, err := runCLI("db", "status")
+	if err != nil {
+		t.Fatalf("db status: %v", err)
+	}
+	if !contains(out, "schema version 0") || !contains(out, "0001_initial pending") {
+		t.Fatalf("unexpected status output: %s", out)
+	}
+
+	out, err = runCLI("db", "migrate")
+	if err != nil {
+		t.Fatalf("db migrate: %v", err)
+	}
+	if !contains(out, "applied 0001_initial") {
+		t.Fatalf("unexpected migrate output: %s", out)
+	}
+
+	out, err = runCLI("db", "migrate")
+	if err != nil || !contains(out, "already up to date") {
+		t.Fatalf("second migrate: %v %s", err, out)
+	}
+}
+
+func TestRulesRenameAndFindByPort(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+
+	if _, err := runCLI("rules", "add", "--name", "ssh", "--app", "any", "--protocol", "tcp", "--direction", "inbound", "--ports", "22"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	out, err := runCLI("rules", "rename", "--name", "ssh", "--to", "remote-shell")
+	if err != nil || !contains(out, `rule "ssh" renamed to "remote-shell"`) {
+		t.Fatalf("rename: %v %s", err, out)
+	}
+
+	out, err = runCLI("rules", "list", "--port", "22")
+	listPort = 0
+	if err != nil || !contains(out, "remote-shell [allow tcp inbound]") {
+		t.Fatalf("list --port 22: %v %s", err, out)
+	}
+	out, err = runCLI("rules", "list", "--port", "80")
+	listPort = 0
+	if err != nil || !contains(out, "no rules name port 80") {
+		t.Fatalf("list --port 80: %v %s", err, out)
+	}
+}
+
+func TestRulesHistoryAndRevert(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+
+	if _, err := runCLI("rules", "add", "--name", "ssh", "--app", "any", "--protocol", "tcp", "--direction", "inbound", "--ports", "22"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := runCLI("rules", "add", "--name", "ssh", "--app", "any", "--action", "deny", "--protocol", "tcp", "--direction", "inbound", "--ports", "22"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	out, err := runCLI("rules", "history", "--name", "ssh")
+	historyName = ""
+	if err != nil || !contains(out, "#1 ") || !contains(out, "create ssh by ") || !contains(out, "(cli)") ||
+		!contains(out, `#2 `) || !contains(out, `update ssh`) || !contains(out, `action "allow" -> "deny"`) {
+		t.Fatalf("history: %v %s", err, out)
+	}
+
+	out, err = runCLI("rules", "revert", "--to", "1", "--no-sync")
+	revertNoSync = false
+	if err != nil || !contains(out, "undid #2") {
+		t.Fatalf("revert: %v %s", err, out)
+	}
+	out, err = runCLI("rules", "list")
+	if err != nil || !contains(out, "ssh [allow tcp inbound]") {
+		t.Fatalf("list after revert: %v %s", err, out)
+	}
+	out, err = runCLI("rules", "history", "--limit", "1")
+	historyLimit = 0
+	if err != nil || !contains(out, "#3 ") || !contains(out, `action "deny" -> "allow"`) {
+		t.Fatalf("history after revert: %v %s", err, out)
+	}
+}
+
+func TestProfilesInheritance(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() { profileRules, profileExtends, profileExclude = "", "", "" }()
+
+	for _, name := range []string{"dns", "ntp", "git"} {
+		if _, err := runCLI("rules", "add", "--name", name, "--app", "any", "--protocol", "any"); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if _, err := runCLI("profiles", "create", "--name", "base", "--description", "Base", "--rules", "dns,ntp"); err != nil {
+		t.Fatalf("create base: %v", err)
+	}
+	profileRules = ""
+	if _, err := runCLI("profiles", "create", "--name", "work", "--description", "Work", "--rules", "git", "--extends", "base", "--exclude", "ntp"); err != nil {
+		t.Fatalf("create work: %v", err)
+	}
+	profileRules, profileExtends, profileExclude = "", "", ""
+
+	out, err := runCLI("profiles", "list")
+	if err != nil || !contains(out, "- work: Work [1 rules] extends=base excludes=ntp") {
+		t.Fatalf("list: %v %s", err, out)
+	}
+	out, err = runCLI("profiles", "effective", "--name", "work")
+	if err != nil || !contains(out, "- dns (from base)\n- git\n") || contains(out, "ntp") {
+		t.Fatalf("effective: %v %s", err, out)
+	}
+
+	if _, err := runCLI("profiles", "create", "--name", "base", "--description", "Base", "--extends", "work"); err == nil {
+		t.Fatal("expected a cycle to be rejected")
+	}
+}
+
+func TestProfilesDefaultPolicy(t *testing.T) {
+	dbPath = filepath.Join(t.TempDir(), "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() { profileRules, profileExtends, profilePolicy = "", "", "" }()
+
+	if _, err := runCLI("rules", "add", "--name", "dns", "--app", "any", "--protocol", "any"); err != nil {
+		t.Fatalf("add dns: %v", err)
+	}
+	if _, err := runCLI("profiles", "create", "--name", "base", "--description", "Base", "--rules", "dns", "--default-policy", "deny"); err != nil {
+		t.Fatalf("create base: %v", err)
+	}
+	profileRules = ""
+	if _, err := runCLI("profiles", "create", "--name", "work", "--description", "Work", "--extends", "base", "--default-policy", "outbound=allow"); err != nil {
+		t.Fatalf("create work: %v", err)
+	}
+	profileExtends, profilePolicy = "", ""
+
+	out, err := runCLI("profiles", "list")
+	if err != nil || !contains(out, "- base: Base [1 rules] default-policy=inbound=deny,outbound=deny") {
+		t.Fatalf("list: %v %s", err, out)
+	}
+	out, err = runCLI("profiles", "effective", "--name", "work")
+	if err != nil || !contains(out, "- dns (from base)\n") || !contains(out, "default policy: inbound=deny,outbound=allow\n") {
+		t.Fatalf("effective: %v %s", err, out)
+	}
+
+	if _, err := runCLI("profiles", "create", "--name", "bad", "--description", "Bad", "--default-policy", "outbound=block"); err == nil {
+		t.Fatal("expected an invalid default policy to be rejected")
+	}
+}
+
+func TestProfilesBundleExportImport(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() {
+		profileRules, profileExtends = "", ""
+		profileExportPath, profileImportPath, profileStrategy, profileDryRun = "", "", "skip", false
+	}()
+
+	for _, name := range []string{"dns", "git"} {
+		if _, err := runCLI("rules", "add", "--name", name, "--app", "any", "--protocol", "any"); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if _, err := runCLI("profiles", "create", "--name", "base", "--description", "Base", "--rules", "dns"); err != nil {
+		t.Fatalf("create base: %v", err)
+	}
+	if _, err := runCLI("profiles", "create", "--name", "work", "--description", "Work", "--rules", "git", "--extends", "base"); err != nil {
+		t.Fatalf("create work: %v", err)
+	}
+	profileRules, profileExtends = "", ""
+	bundlePath := filepath.Join(dir, "work.json")
+	out, err := runCLI("profiles", "export", "--name", "work", "--file", bundlePath)
+	if err != nil || !contains(out, "2 profile(s) and 2 rule(s) exported") {
+		t.Fatalf("export: %v %s", err, out)
+	}
+
+	// A fresh database receives the profiles together with their rules.
+	dbPath = filepath.Join(t.TempDir(), "rules.db")
+	db = nil
+	ruleStore = nil
+	out, err = runCLI("profiles", "import", "--file", bundlePath, "--dry-run")
+	if err != nil || !contains(out, "rule dns: create") || !contains(out, "dry run: nothing imported") {
+		t.Fatalf("preview: %v %s", err, out)
+	}
+	profileDryRun = false
+	out, err = runCLI("profiles", "import", "--file", bundlePath)
+	if err != nil || !contains(out, "imported 2 rule(s) and 2 profile(s)") {
+		t.Fatalf("import: %v %s", err, out)
+	}
+	out, err = runCLI("profiles", "effective", "--name", "work")
+	if err != nil || !contains(out, "- dns (from base)\n- git\n") {
+		t.Fatalf("effective after import: %v %s", err, out)
+	}
+
+	if _, err := runCLI("rules", "add", "--name", "git", "--app", "/usr/bin/git", "--protocol", "any"); err != nil {
+		t.Fatalf("change git: %v", err)
+	}
+	out, err = runCLI("profiles", "import", "--file", bundlePath, "--strategy", "rename")
+	if err != nil || !contains(out, "rule git: rename as git-imported") || !contains(out, "profile work: rename as work-imported") || !contains(out, "profile base: unchanged") {
+		t.Fatalf("rename import: %v %s", err, out)
+	}
+	out, err = runCLI("profiles", "effective", "--name", "work-imported")
+	if err != nil || !contains(out, "- git-imported\n") {
+		t.Fatalf("effective of renamed profile: %v %s", err, out)
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() { applyPrune, applyDryRun = false, false }()
+
+	if _, err := runCLI("rules", "add", "--name", "old", "--app", "any", "--protocol", "any"); err != nil {
+		t.Fatalf("add old: %v", err)
+	}
+	policyPath := filepath.Join(dir, "policy.yaml")
+	doc := `version: 1
+rules:
+  - name: web
+    application: any
+    ports: [443]
+profiles:
+  - name: work
+    description: Work
+    rules: [web]
+`
+	if err := os.WriteFile(policyPath, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCLI("apply", "-f", policyPath, "--prune", "--dry-run")
+	if err != nil || !contains(out, "+ rule web\n- rule old\n+ profile work\n2 to create, 0 to update, 1 to delete, 0 unchanged") || !contains(out, "dry run") {
+		t.Fatalf("dry run: %v %s", err, out)
+	}
+	applyDryRun = false
+	out, err = runCLI("apply", "-f", policyPath, "--prune")
+	if err != nil || !contains(out, "policy applied") {
+		t.Fatalf("apply: %v %s", err, out)
+	}
+	out, err = runCLI("rules", "list")
+	if err != nil || !contains(out, "web") || contains(out, "old") {
+		t.Fatalf("rules after apply: %v %s", err, out)
+	}
+	out, err = runCLI("apply", "-f", policyPath)
+	if err != nil || !contains(out, "up to date (2 unchanged)") {
+		t.Fatalf("second apply: %v %s", err, out)
+	}
+
+	if err := os.WriteFile(policyPath, []byte(doc+"  - name: broken\n    description: Broken\n    rules: [missing]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCLI("apply", "-f", policyPath); err == nil {
+		t.Fatal("expected a reference to an undeclared rule to fail")
+	}
+}
+
+func TestRulesExportImport(t *testing.T) {
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() { ruleIOFile, ruleIOFormat, ruleIODryRun = "", "", false }()
+
+	if _, err := runCLI("rules", "add", "--name", "web", "--app", "any", "--ports", "80,443"); err != nil {
+		t.Fatalf("add web: %v", err)
+	}
+	if _, err := runCLI("rules", "add", "--name", "tmp", "--app", "any", "--protocol", "any", "--for", "1h"); err != nil {
+		t.Fatalf("add tmp: %v", err)
+	}
+	csvPath := filepath.Join(dir, "rules.csv")
+	out, err := runCLI("rules", "export", "--file", csvPath)
+	if err != nil || !contains(out, "1 rule(s) exported") {
+		t.Fatalf("export: %v %s", err, out)
+	}
+
+	dbPath = filepath.Join(t.TempDir(), "rules.db")
+	db = nil
+	ruleStore = nil
+	out, err = runCLI("rules", "import", "--file", csvPath)
+	if err != nil || !contains(out, "+ web\n1 to create, 0 to update, 0 unchanged, 0 skipped") {
+		t.Fatalf("import: %v %s", err, out)
+	}
+
+	dumpPath := filepath.Join(dir, "iptables.rules")
+	dump := "*filter\n-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT\n-A INPUT -i eth0 -j DROP\nCOMMIT\n"
+	if err := os.WriteFile(dumpPath, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runCLI("rules", "import", "--file", dumpPath, "--format", "iptables-save", "--dry-run")
+	if err != nil || !contains(out, "skipped line 3: option -i is not supported") || !contains(out, "+ input-1\n") || !contains(out, "dry run") {
+		t.Fatalf("iptables import: %v %s", err, out)
+	}
+	out, err = runCLI("rules", "list")
+	if err != nil || contains(out, "input-1") {
+		t.Fatalf("dry run wrote rules: %v %s", err, out)
+	}
+}
+
+func TestRulesLint(t *testing.T) {
+	dbPath = filepath.Join(t.TempDir(), "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() { lintProfile, profileRules = "", "" }()
+
+	out, err := runCLI("rules", "lint")
+	if err != nil || !contains(out, "no problems found") {
+		t.Fatalf("lint empty: %v %s", err, out)
+	}
+
+	if _, err := runCLI("rules", "add", "--name", "web", "--app", "any", "--action", "allow", "--ports", "80,443"); err != nil {
+		t.Fatalf("add web: %v", err)
+	}
+	if _, err := runCLI("rules", "add", "--name", "zblock", "--app", "any", "--action", "deny", "--ports", "443"); err != nil {
+		t.Fatalf("add zblock: %v", err)
+	}
+	out, err = runCLI("rules", "lint")
+	if err == nil || !contains(out, "error   shadowed      zblock:") || !contains(out, "1 error(s), 0 warning(s), 0 info") {
+		t.Fatalf("lint: %v %s", err, out)
+	}
+
+	if _, err := runCLI("profiles", "create", "--name", "web-only", "--description", "Web", "--rules", "web"); err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	out, err = runCLI("rules", "lint", "--profile", "web-only")
+	if err != nil || !contains(out, "no problems found") {
+		t.Fatalf("lint profile: %v %s", err, out)
+	}
+	if _, err := runCLI("rules", "lint", "--profile", "missing"); err == nil {
+		t.Fatal("expected an unknown profile to fail")
+	}
+}
+
+func TestRulesTest(t *testing.T) {
+	dbPath = filepath.Join(t.TempDir(), "rules.db")
+	db = nil
+	ruleStore = nil
+	defer func() { traceApp, traceProtocol, traceDirection, traceSrc, traceDst = "", "tcp", "outbound", "", "" }()
+
+	if _, err := runCLI("rules", "add", "--name", "web", "--app", "any", "--action", "allow", "--direction", "outbound", "--ports", "80"); err != nil {
+		t.Fatalf("add web: %v", err)
+	}
+	if _, err := runCLI("rules", "add", "--name", "block-curl", "--app", "/usr/bin/curl", "--action", "deny", "--direction", "outbound", "--ports", "443"); err != nil {
+		t.Fatalf("add block-curl: %v", err)
+	}
+
+	out, err := runCLI("rules", "test", "--app", "/usr/bin/curl", "--proto", "tcp", "--dir", "outbound", "--dst", "1.2.3.4:443")
+	if err != nil || !contains(out, "connection: /usr/bin/curl tcp outbound *:* -> 1.2.3.4:443") ||
+		!contains(out, "= block-curl: matches") || !contains(out, `decision: deny: rule "block-curl" denies it`) {
+		t.Fatalf("test: %v %s", err, out)
+	}
+
+	out, err = runCLI("rules", "test", "--app", "/usr/bin/wget", "--dst", "1.2.3.4:22")
+	if err != nil || !contains(out, "  - web: remote port 22 is not in 80") || !contains(out, "decision: prompt") {
+		t.Fatalf("test unmatched: %v %s", err, out)
+	}
+
+	if _, err := runCLI("rules", "test", "--app", "/usr/bin/curl", "--dst", "nowhere:80"); err == nil {
+		t.Fatal("expected an invalid address to fail")
+	}
+}
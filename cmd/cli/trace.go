@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vhPedroGitHub/firewall/internal/app"
+	"github.com/vhPedroGitHub/firewall/internal/monitor"
+)
+
+var (
+	traceApp       string
+	traceProtocol  string
+	traceDirection string
+	traceSrc       string
+	traceDst       string
+)
+
+// parseEndpointFlag parses "1.2.3.4:443", "[::1]:443" or a bare address; an
+// empty value leaves the address and port unset.
+func parseEndpointFlag(flag, value string) (string, int, error) {
+	if value == "" {
+		return "", 0, nil
+	}
+	host, portStr, err := net.SplitHostPort(value)
+	if err != nil {
+		host, portStr = strings.Trim(value, "[]"), ""
+	}
+	if _, err := netip.ParseAddr(host); err != nil {
+		return "", 0, fmt.Errorf("invalid --%s address %q", flag, host)
+	}
+	if portStr == "" {
+		return host, 0, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid --%s port %q", flag, portStr)
+	}
+	return host, port, nil
+}
+
+var rulesTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Show what the firewall would decide for a connection",
+	Long: `Run a simulated connection through the enforced rules with the same
+matching as the monitor and print the decision, the rule that decides it (and
+the profile it is enforced through) and why every earlier rule did not match.
+Nothing is prompted or saved.
+
+--src is the local end and --dst the remote end of the connection, in either
+direction, each written as address:port or a bare address.`,
+	Example: `  firewall rules test --app /usr/bin/curl --proto tcp --dir outbound --dst 1.2.3.4:443`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ruleStore == nil {
+			return errors.New("rule store not initialized")
+		}
+		event := monitor.ConnectionEvent{
+			AppPath:   traceApp,
+			Protocol:  strings.ToLower(traceProtocol),
+			Direction: strings.ToLower(traceDirection),
+		}
+		if event.Protocol != "tcp" && event.Protocol != "udp" {
+			return fmt.Errorf("invalid --proto %q: must be tcp or udp", traceProtocol)
+		}
+		if event.Direction != "inbound" && event.Direction != "outbound" {
+			return fmt.Errorf("invalid --dir %q: must be inbound or outbound", traceDirection)
+		}
+		var err error
+		if event.SrcAddr, event.SrcPort, err = parseEndpointFlag("src", traceSrc); err != nil {
+			return err
+		}
+		if event.DstAddr, event.DstPort, err = parseEndpointFlag("dst", traceDst); err != nil {
+			return err
+		}
+
+		svc := app.Service{Store: ruleStore, Profiles: profileStore}
+		t, err := svc.TraceConnection(event)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "connection: %s %s %s %s -> %s\n", event.AppPath, event.Protocol, event.Direction,
+			traceEndpoint(event.SrcAddr, event.SrcPort), traceEndpoint(event.DstAddr, event.DstPort))
+		if t.Profile != "" {
+			fmt.Fprintf(out, "profile: %s\n", t.Profile)
+		}
+		for _, step := range t.Skipped {
+			fmt.Fprintf(out, "  - %s: %s\n", step.Rule, step.Reason)
+		}
+		if t.Rule != nil {
+			via := ""
+			if t.From != "" && t.From != t.Profile {
+				via = fmt.Sprintf(" (inherited from %s)", t.From)
+			}
+			fmt.Fprintf(out, "  = %s: matches%s\n", t.Rule.Name, via)
+		}
+		if t.Prompt {
+			fmt.Fprintf(out, "decision: prompt, deny without prompts: %s\n", t.Reason)
+		} else {
+			fmt.Fprintf(out, "decision: %s: %s\n", t.Decision, t.Reason)
+		}
+		return nil
+	},
+}
+
+// traceEndpoint renders one end of a simulated connection, "*" when unset.
+func traceEndpoint(addr string, port int) string {
+	if addr == "" {
+		addr = "*"
+	}
+	p := "*"
+	if port != 0 {
+		p = strconv.Itoa(port)
+	}
+	return net.JoinHostPort(addr, p)
+}
+
+func init() {
+	rulesCmd.AddCommand(rulesTestCmd)
+
+	rulesTestCmd.Flags().StringVar(&traceApp, "app", "", "executable path making the connection (required)")
+	rulesTestCmd.Flags().StringVar(&traceProtocol, "proto", "tcp", "protocol: tcp|udp")
+	rulesTestCmd.Flags().StringVar(&traceDirection, "dir", "outbound", "direction: inbound|outbound")
+	rulesTestCmd.Flags().StringVar(&traceSrc, "src", "", "local address[:port] (default any)")
+	rulesTestCmd.Flags().StringVar(&traceDst, "dst", "", "remote address[:port] (default any)")
+	_ = rulesTestCmd.MarkFlagRequired("app")
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// ExportBundle packs the named profiles, the profiles they extend and every
+// rule any of them includes or excludes into a self-contained bundle.
+func (s *Service) ExportBundle(names []string) (*profiles.Bundle, error) {
+	if s.Profiles == nil {
+		return nil, errors.New("profile store not configured")
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no profiles to export")
+	}
+	list, err := profiles.Closure(names, func(name string) (*profiles.Profile, error) {
+		p, err := s.Profiles.GetProfile(name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("profile %q not found", name)
+		}
+		return p, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.Store.ListRules()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]rules.Rule, len(stored))
+	for _, r := range stored {
+		byName[r.Name] = r
+	}
+	var ruleList []rules.Rule
+	seen := make(map[string]bool)
+	for _, p := range list {
+		for _, name := range append(append([]string{}, p.Rules...), p.Exclude...) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			r, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("profile %q references unknown rule %q", p.Name, name)
+			}
+			ruleList = append(ruleList, r)
+		}
+	}
+	return profiles.NewBundle(list, ruleList, time.Now())
+}
+
+// ImportBundle merges a bundle into the stores in one transaction, resolving
+// name conflicts with strategy, and returns the plan it followed. With dryRun
+// nothing is written. Callers reconcile the platform afterwards.
+func (u UnitOfWork) ImportBundle(ctx context.Context, b *profiles.Bundle, strategy profiles.Strategy, dryRun bool) (*profiles.ImportPlan, error) {
+	var plan *profiles.ImportPlan
+	err := u.Do(ctx, func(ctx context.Context, s Stores) error {
+		storedRules, err := s.Rules.ListRulesContext(ctx)
+		if err != nil {
+			return err
+		}
+		storedProfiles, err := s.Profiles.ListProfilesContext(ctx)
+		if err != nil {
+			return err
+		}
+		if plan, err = profiles.PlanImport(b, strategy, storedRules, storedProfiles); err != nil {
+			return err
+		}
+		if dryRun || plan.Empty() {
+			return nil
+		}
+		if err := s.Rules.SaveRules(ctx, plan.Rules); err != nil {
+			return err
+		}
+		for _, p := range plan.Profiles {
+			if err := s.Profiles.SaveProfileContext(ctx, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.LogEvent("error", "profile-import-failed", fmt.Sprintf("Profile bundle import failed: %v", err), map[string]interface{}{
+			"strategy": string(strategy),
+		})
+		return nil, err
+	}
+	if !dryRun {
+		logging.LogEvent("info", "profile-import", fmt.Sprintf("Profile bundle imported (%d rule(s), %d profile(s) written)", len(plan.Rules), len(plan.Profiles)), map[string]interface{}{
+			"strategy": string(strategy),
+		})
+	}
+	return plan, nil
+}
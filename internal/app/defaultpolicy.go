@@ -0,0 +1,84 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Options tunes behaviour shared by every Service.
+type Options struct {
+	// DefaultPolicy applies where the active profile sets no default policy,
+	// or when no profile is active. Unset directions prompt.
+	DefaultPolicy rules.DefaultPolicy
+}
+
+var (
+	optionsMu sync.RWMutex
+	options   Options
+)
+
+// Configure sets the options used by every Service.
+func Configure(opts Options) error {
+	if err := opts.DefaultPolicy.Validate(); err != nil {
+		return fmt.Errorf("default policy: %w", err)
+	}
+	optionsMu.Lock()
+	options = opts
+	optionsMu.Unlock()
+	return nil
+}
+
+func configuredPolicy() rules.DefaultPolicy {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	return options.DefaultPolicy
+}
+
+// DefaultPolicy returns the default policy in force: the active profile's,
+// inherited directions included, falling back to the configured policy and
+// then to prompting. Both directions are always set.
+func (s *Service) DefaultPolicy() (rules.DefaultPolicy, error) {
+	var active *profiles.Profile
+	if s.Profiles != nil {
+		p, err := s.Profiles.GetActiveProfile()
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return rules.DefaultPolicy{}, fmt.Errorf("failed to load active profile: %w", err)
+		}
+		active = p
+	}
+	return s.resolvePolicy(active)
+}
+
+// ProfilePolicy returns the default policy a profile puts in force when it is
+// active, resolved like DefaultPolicy.
+func (s *Service) ProfilePolicy(name string) (rules.DefaultPolicy, error) {
+	if s.Profiles == nil {
+		return rules.DefaultPolicy{}, errors.New("profile store not configured")
+	}
+	p, err := s.Profiles.GetProfile(name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rules.DefaultPolicy{}, fmt.Errorf("profile %q not found", name)
+	}
+	if err != nil {
+		return rules.DefaultPolicy{}, err
+	}
+	return s.resolvePolicy(p)
+}
+
+// resolvePolicy is DefaultPolicy for a known active profile, nil for none.
+func (s *Service) resolvePolicy(active *profiles.Profile) (rules.DefaultPolicy, error) {
+	var policy rules.DefaultPolicy
+	if active != nil {
+		var err error
+		if policy, err = profiles.EffectivePolicy(*active, s.Profiles.GetProfile); err != nil {
+			return rules.DefaultPolicy{}, err
+		}
+	}
+	policy = policy.Or(configuredPolicy())
+	return rules.DefaultPolicy{Inbound: policy.For("inbound"), Outbound: policy.For("outbound")}, nil
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestDesiredRules_DefaultPolicy(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+	if err := Configure(Options{DefaultPolicy: rules.DefaultPolicy{Outbound: "deny"}}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	t.Cleanup(func() { Configure(Options{}) })
+
+	desired, err := svc.DesiredRules()
+	if err != nil {
+		t.Fatalf("desired: %v", err)
+	}
+	last := desired[len(desired)-1]
+	if len(desired) != 4 || last.Name != "default-policy-outbound" || last.Action != "deny" {
+		t.Fatalf("desired without profile = %+v", desired)
+	}
+
+	if err := svc.Profiles.SaveProfile(profiles.Profile{Name: "open", Description: "Open", Rules: []string{"web"}, DefaultPolicy: rules.DefaultPolicy{Inbound: "allow", Outbound: "prompt"}}); err != nil {
+		t.Fatalf("save open: %v", err)
+	}
+	if _, err := svc.ActivateProfile("open"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if got := svc.Platform.(*fakePlatform).installed; len(got) != 2 || got[0] != "default-policy-inbound" || got[1] != "web" {
+		t.Errorf("installed for open = %v", got)
+	}
+	if policy, _ := svc.DefaultPolicy(); policy != (rules.DefaultPolicy{Inbound: "allow", Outbound: "prompt"}) {
+		t.Errorf("DefaultPolicy() = %+v", policy)
+	}
+
+	if policy, err := svc.ProfilePolicy("work"); err != nil || policy != (rules.DefaultPolicy{Inbound: "prompt", Outbound: "deny"}) {
+		t.Errorf("ProfilePolicy(work) = %+v, %v", policy, err)
+	}
+	if _, err := svc.ProfilePolicy("missing"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+
+	if err := Configure(Options{DefaultPolicy: rules.DefaultPolicy{Inbound: "block"}}); err == nil {
+		t.Error("expected an invalid policy to be rejected")
+	}
+}
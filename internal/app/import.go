@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/policy"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// ImportRules saves imported rules in one batch, replacing stored rules of the
+// same name, and reports per rule whether it is created, updated or already
+// stored as is. With dryRun nothing is written. Callers reconcile the
+// platform afterwards.
+func (s *Service) ImportRules(ctx context.Context, list []rules.Rule, dryRun bool) ([]policy.Change, error) {
+	stored, err := s.Store.ListRules()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]rules.Rule, len(stored))
+	for _, r := range stored {
+		byName[r.Name] = r
+	}
+	var changes []policy.Change
+	var changed []rules.Rule
+	for _, r := range list {
+		c := policy.Change{Kind: "rule", Name: r.Name, Action: policy.Create}
+		if old, ok := byName[r.Name]; ok {
+			c.Action = policy.Update
+			if rules.Equal(old, r) {
+				c.Action = policy.Unchanged
+			}
+		}
+		changes = append(changes, c)
+		if c.Action != policy.Unchanged {
+			changed = append(changed, r)
+		}
+	}
+	if dryRun || len(changed) == 0 {
+		return changes, nil
+	}
+	if err := rules.SaveAll(ctx, s.Store, changed); err != nil {
+		logging.LogEvent("error", "rule-import-failed", fmt.Sprintf("Rule import failed: %v", err), nil)
+		return nil, err
+	}
+	logging.LogEvent("info", "rule-import", fmt.Sprintf("Imported %d rule(s)", len(changed)), map[string]interface{}{
+		"count": len(changed),
+	})
+	return changes, nil
+}
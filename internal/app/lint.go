@@ -0,0 +1,48 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// LintRules analyses the stored rules, or with a profile name the rules that
+// profile puts in effect including inherited ones, and reports shadowed,
+// redundant, contradictory and dead rules.
+func (s *Service) LintRules(profile string) ([]rules.Finding, error) {
+	all, err := s.Store.ListRules()
+	if err != nil {
+		return nil, err
+	}
+	if profile == "" {
+		return rules.Lint(all, rules.LintOptions{}), nil
+	}
+	if s.Profiles == nil {
+		return nil, errors.New("profile store not configured")
+	}
+	p, err := s.Profiles.GetProfile(profile)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("profile %q not found", profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	effective, err := profiles.Effective(*p, s.Profiles.GetProfile)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(effective))
+	for _, r := range effective {
+		members[r.Name] = true
+	}
+	var list []rules.Rule
+	for _, r := range all {
+		if members[r.Name] {
+			list = append(list, r)
+		}
+	}
+	return rules.Lint(list, rules.LintOptions{}), nil
+}
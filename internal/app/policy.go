@@ -0,0 +1,54 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/policy"
+)
+
+// ApplyPolicy converges the stores on a declarative document in one
+// transaction and returns the plan it followed; see policy.Compute. With
+// dryRun nothing is written. Callers reconcile the platform afterwards.
+func (u UnitOfWork) ApplyPolicy(ctx context.Context, doc *policy.Document, prune, dryRun bool) (*policy.Plan, error) {
+	var plan *policy.Plan
+	err := u.Do(ctx, func(ctx context.Context, s Stores) error {
+		storedRules, err := s.Rules.ListRulesContext(ctx)
+		if err != nil {
+			return err
+		}
+		storedProfiles, err := s.Profiles.ListProfilesContext(ctx)
+		if err != nil {
+			return err
+		}
+		if plan, err = policy.Compute(doc, storedRules, storedProfiles, prune); err != nil {
+			return err
+		}
+		if dryRun || plan.Empty() {
+			return nil
+		}
+		if err := s.Rules.SaveRules(ctx, plan.SaveRules); err != nil {
+			return err
+		}
+		for _, p := range plan.SaveProfiles {
+			if err := s.Profiles.SaveProfileContext(ctx, p); err != nil {
+				return err
+			}
+		}
+		return s.Rules.DeleteRules(ctx, plan.DeleteRules)
+	})
+	if err != nil {
+		logging.LogEvent("error", "policy-apply-failed", fmt.Sprintf("Policy apply failed: %v", err), map[string]interface{}{
+			"prune": prune,
+		})
+		return nil, err
+	}
+	if !dryRun && !plan.Empty() {
+		logging.LogEvent("info", "policy-apply", fmt.Sprintf("Policy applied (%d created, %d updated, %d deleted)",
+			plan.Count(policy.Create), plan.Count(policy.Update), plan.Count(policy.Delete)), map[string]interface{}{
+			"prune": prune,
+		})
+	}
+	return plan, nil
+}
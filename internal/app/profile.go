@@ -0,0 +1,140 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/platform"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+)
+
+// ActiveProfileName returns the name of the active profile, or "" when no
+// profile is active or the service has no profile store.
+func (s *Service) ActiveProfileName() (string, error) {
+	if s.Profiles == nil {
+		return "", nil
+	}
+	active, err := s.Profiles.GetActiveProfile()
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load active profile: %w", err)
+	}
+	return active.Name, nil
+}
+
+// EffectiveRules resolves the rules the named profile enforces, inherited ones
+// included; see profiles.Effective.
+func (s *Service) EffectiveRules(name string) ([]profiles.EffectiveRule, error) {
+	if s.Profiles == nil {
+		return nil, errors.New("profile store not configured")
+	}
+	p, err := s.Profiles.GetProfile(name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return profiles.Effective(*p, s.Profiles.GetProfile)
+}
+
+// ActivateProfile makes name the active profile and reconciles the platform to
+// exactly its rules; an empty name deactivates every profile, so all stored
+// rules are enforced. If the platform cannot be reconciled the previously
+// active profile is restored and re-applied, and the error is returned.
+func (s *Service) ActivateProfile(name string) (*platform.Plan, error) {
+	if s.Profiles == nil {
+		return nil, errors.New("profile store not configured")
+	}
+	if name != "" {
+		if _, err := s.Profiles.GetProfile(name); errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("profile %q not found", name)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	previous, err := s.ActiveProfileName()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Profiles.SetActiveProfile(name); err != nil {
+		return nil, err
+	}
+	plan, err := s.Sync()
+	if err != nil {
+		restoreErr := s.Profiles.SetActiveProfile(previous)
+		if restoreErr == nil {
+			_, restoreErr = s.Sync()
+		}
+		logging.LogEvent("error", "profile-activate-failed", fmt.Sprintf("Activating profile %q failed, restored %q: %v", name, previous, err), map[string]interface{}{
+			"profile":  name,
+			"restored": previous,
+			"rollback": errString(restoreErr),
+		})
+		if restoreErr != nil {
+			return plan, fmt.Errorf("activate profile %q: %w (restoring %q also failed: %v)", name, err, previous, restoreErr)
+		}
+		return plan, fmt.Errorf("activate profile %q: %w (profile %q restored)", name, err, previous)
+	}
+
+	msg := fmt.Sprintf("Profile %q activated", name)
+	if name == "" {
+		msg = "Profiles deactivated"
+	}
+	logging.LogEvent("info", "profile-activate", msg, map[string]interface{}{
+		"profile":  name,
+		"previous": previous,
+		"added":    len(plan.Add),
+		"updated":  len(plan.Update),
+		"removed":  len(plan.Remove),
+	})
+	return plan, nil
+}
+
+// AdoptRule adds a rule saved while a profile is active, such as one created
+// from a monitor prompt, to that profile so it is enforced alongside the rest
+// of the profile. It does nothing when no profile is active or the profile
+// already enforces the rule, possibly through inheritance.
+func (s *Service) AdoptRule(name string) error {
+	if s.Profiles == nil {
+		return nil
+	}
+	active, err := s.Profiles.GetActiveProfile()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load active profile: %w", err)
+	}
+	effective, err := profiles.Effective(*active, s.Profiles.GetProfile)
+	if err != nil {
+		return err
+	}
+	for _, r := range effective {
+		if r.Name == name {
+			return nil
+		}
+	}
+	// Listing the rule overrides an exclusion of it.
+	exclude := active.Exclude[:0:0]
+	for _, r := range active.Exclude {
+		if r != name {
+			exclude = append(exclude, r)
+		}
+	}
+	active.Exclude = exclude
+	active.Rules = append(active.Rules, name)
+	return s.Profiles.SaveProfile(*active)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// fakePlatform records the rule set it was asked to install and the rules it
+// last bound; fail makes the next ApplyPlan calls fail until it is cleared.
+type fakePlatform struct {
+	installed []string
+	bound     []string
+	fail      error
+}
+
+func (f *fakePlatform) PlanRuleset(desired []rules.Rule) (*platform.Plan, error) {
+	plan := &platform.Plan{Backend: "fake"}
+	have := make(map[string]bool)
+	for _, name := range f.installed {
+		have[name] = true
+	}
+	for _, r := range desired {
+		if have[r.Name] {
+			plan.Unchanged = append(plan.Unchanged, r.Name)
+			delete(have, r.Name)
+		} else {
+			plan.Add = append(plan.Add, r)
+		}
+	}
+	for name := range have {
+		plan.Remove = append(plan.Remove, name)
+	}
+	return plan, nil
+}
+
+func (f *fakePlatform) ApplyPlan(p *platform.Plan) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.installed = append([]string(nil), p.Unchanged...)
+	for _, r := range p.Add {
+		f.installed = append(f.installed, r.Name)
+	}
+	sort.Strings(f.installed)
+	return nil
+}
+
+func (f *fakePlatform) BindApplications(list []rules.Rule) (int, error) {
+	f.bound = nil
+	for _, r := range list {
+		f.bound = append(f.bound, r.Name)
+	}
+	return 0, nil
+}
+
+func seedProfiles(t *testing.T, svc *Service) {
+	t.Helper()
+	for _, name := range []string{"web", "ssh", "mail"} {
+		if err := svc.Store.SaveRule(rules.Rule{Name: name, Application: "any", Action: "allow", Protocol: "any", Direction: "outbound"}); err != nil {
+			t.Fatalf("save rule: %v", err)
+		}
+	}
+	for _, p := range []profiles.Profile{
+		{Name: "work", Description: "Work", Rules: []string{"web", "ssh"}},
+		{Name: "home", Description: "Home", Rules: []string{"mail"}},
+	} {
+		if err := svc.Profiles.SaveProfile(p); err != nil {
+			t.Fatalf("save profile: %v", err)
+		}
+	}
+}
+
+func TestActivateProfile_ReconcilesPlatform(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+	fake := svc.Platform.(*fakePlatform)
+
+	if _, err := svc.ActivateProfile("work"); err != nil {
+		t.Fatalf("activate work: %v", err)
+	}
+	if got := fake.installed; len(got) != 2 || got[0] != "ssh" || got[1] != "web" {
+		t.Fatalf("installed after work = %v", got)
+	}
+	plan, err := svc.ActivateProfile("home")
+	if err != nil {
+		t.Fatalf("activate home: %v", err)
+	}
+	if len(plan.Remove) != 2 || len(plan.Add) != 1 {
+		t.Errorf("unexpected plan: add %d, remove %d", len(plan.Add), len(plan.Remove))
+	}
+	if got := fake.installed; len(got) != 1 || got[0] != "mail" {
+		t.Fatalf("installed after home = %v", got)
+	}
+
+	if _, err := svc.ActivateProfile("missing"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestActivateProfile_RollsBackOnFailure(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+	fake := svc.Platform.(*fakePlatform)
+	if _, err := svc.ActivateProfile("work"); err != nil {
+		t.Fatalf("activate work: %v", err)
+	}
+
+	fake.fail = errors.New("backend unavailable")
+	if _, err := svc.ActivateProfile("home"); err == nil {
+		t.Fatal("expected activation to fail")
+	}
+	if name, _ := svc.ActiveProfileName(); name != "work" {
+		t.Errorf("active profile after failed switch = %q, want work", name)
+	}
+	if got := fake.installed; len(got) != 2 {
+		t.Errorf("installed rules changed by a failed switch: %v", got)
+	}
+}
+
+func TestAdoptRule_JoinsActiveProfile(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+
+	// Without an active profile every rule is enforced already.
+	if err := svc.AdoptRule("mail"); err != nil {
+		t.Fatalf("adopt without profile: %v", err)
+	}
+	if _, err := svc.ActivateProfile("work"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	desired, _ := svc.DesiredRules()
+	if len(desired) != 2 {
+		t.Fatalf("work should scope to 2 rules, got %d", len(desired))
+	}
+	for i := 0; i < 2; i++ {
+		if err := svc.AdoptRule("mail"); err != nil {
+			t.Fatalf("adopt: %v", err)
+		}
+	}
+	p, _ := svc.Profiles.GetProfile("work")
+	if len(p.Rules) != 3 || p.Rules[2] != "mail" {
+		t.Errorf("work rules after adopt = %v", p.Rules)
+	}
+}
+
+func TestDesiredRules_FollowsInheritance(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+	if err := svc.Profiles.SaveProfile(profiles.Profile{Name: "laptop", Description: "Laptop", Rules: []string{"mail"}, Extends: []string{"work"}, Exclude: []string{"ssh"}}); err != nil {
+		t.Fatalf("save laptop: %v", err)
+	}
+	if _, err := svc.ActivateProfile("laptop"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if got := svc.Platform.(*fakePlatform).installed; len(got) != 2 || got[0] != "mail" || got[1] != "web" {
+		t.Errorf("installed for laptop = %v, want [mail web]", got)
+	}
+}
+
+func TestBindApplications_BindsDesiredRules(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+	fake := svc.Platform.(*fakePlatform)
+	if _, err := svc.ActivateProfile("work"); err != nil {
+		t.Fatalf("activate work: %v", err)
+	}
+
+	// A monitor started in another process binds without syncing.
+	fake.bound = nil
+	if _, err := svc.BindApplications(); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if len(fake.bound) != 2 || fake.bound[0] != "ssh" || fake.bound[1] != "web" {
+		t.Errorf("bound = %v, want the active profile's rules [ssh web]", fake.bound)
+	}
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+)
+
+// Scheduler applies rule and profile schedules at their boundaries. Schedules
+// have minute resolution, so it re-evaluates them at the start of every minute
+// and only acts on changes.
+//
+// A scheduled rule is enforced while its schedule is in effect. When a
+// scheduled profile's schedule starts, the profile is activated; when it ends,
+// the profile that was active before is restored (none if the scheduler did not
+// see it, e.g. after a restart). Switching profiles by hand in between is left
+// alone until the next boundary.
+type Scheduler struct {
+	svc *Service
+
+	mu       sync.Mutex
+	rules    map[string]bool // last seen state of scheduled rules
+	profiles map[string]bool // last seen state of scheduled profiles
+	fallback string          // profile to restore when a scheduled one ends
+}
+
+// NewScheduler creates a scheduler driving svc.
+func NewScheduler(svc *Service) *Scheduler {
+	return &Scheduler{svc: svc}
+}
+
+// Tick evaluates every schedule at now, switches the active profile if one
+// starts or ends and reconciles the platform when anything changed.
+func (sc *Scheduler) Tick(now time.Time) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	changed, err := sc.tickRules(now)
+	if err != nil {
+		return err
+	}
+	if sc.svc.Profiles != nil {
+		// A profile switch reconciles the platform itself.
+		switched, err := sc.tickProfiles(now)
+		if err != nil || switched {
+			return err
+		}
+	}
+	if !changed {
+		return nil
+	}
+	_, err = sc.svc.Sync()
+	return err
+}
+
+func (sc *Scheduler) tickRules(now time.Time) (bool, error) {
+	list, err := sc.svc.Store.ListRules()
+	if err != nil {
+		return false, err
+	}
+	state := make(map[string]bool)
+	changed := false
+	for _, r := range list {
+		if r.Schedule == nil {
+			continue
+		}
+		on := r.Schedule.Contains(now)
+		state[r.Name] = on
+		if prev, known := sc.rules[r.Name]; known && prev == on {
+			continue
+		}
+		changed = true
+		msg := fmt.Sprintf("Rule %q left its schedule", r.Name)
+		if on {
+			msg = fmt.Sprintf("Rule %q entered its schedule", r.Name)
+		}
+		logging.LogEvent("info", "schedule-rule", msg, map[string]interface{}{
+			"name":     r.Name,
+			"active":   on,
+			"schedule": r.Schedule.String(),
+		})
+	}
+	sc.rules = state
+	return changed, nil
+}
+
+func (sc *Scheduler) tickProfiles(now time.Time) (bool, error) {
+	list, err := sc.svc.Profiles.ListProfiles()
+	if err != nil {
+		return false, err
+	}
+
+	var active *profiles.Profile
+	var entered string
+	left := make(map[string]bool)
+	state := make(map[string]bool)
+	for i := range list {
+		p := &list[i]
+		if p.Active {
+			active = p
+		}
+		if p.Schedule == nil {
+			continue
+		}
+		on := p.Schedule.Contains(now)
+		state[p.Name] = on
+		prev, known := sc.profiles[p.Name]
+		switch {
+		case on && !prev && entered == "":
+			entered = p.Name
+		case !on && (prev || !known):
+			left[p.Name] = true
+		}
+	}
+	sc.profiles = state
+
+	current := ""
+	if active != nil {
+		current = active.Name
+	}
+	var target, reason, fallback string
+	switch {
+	case entered != "" && entered != current:
+		fallback = current
+		target, reason = entered, fmt.Sprintf("Profile %q activated by its schedule", entered)
+	case current != "" && left[current]:
+		target, reason = sc.fallback, fmt.Sprintf("Profile %q deactivated by its schedule", current)
+	default:
+		return false, nil
+	}
+
+	// An empty target deactivates every profile. A failed switch leaves the
+	// current profile active.
+	if _, err := sc.svc.ActivateProfile(target); err != nil {
+		return false, fmt.Errorf("failed to switch profile: %w", err)
+	}
+	sc.fallback = fallback
+	logging.LogEvent("info", "schedule-profile", reason, map[string]interface{}{
+		"from": current,
+		"to":   target,
+	})
+	return true, nil
+}
+
+// Start evaluates schedules now and then at the start of every minute until
+// the returned stop function is called.
+func (sc *Scheduler) Start() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			now := time.Now()
+			if err := sc.Tick(now); err != nil {
+				logging.LogEvent("error", "schedule-failed", fmt.Sprintf("Failed to apply schedules: %v", err), nil)
+			}
+			timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(time.Now()))
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ruleStore, err := rules.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("rule store: %v", err)
+	}
+	profileStore, err := profiles.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("profile store: %v", err)
+	}
+	return &Service{Store: ruleStore, Profiles: profileStore, Platform: &fakePlatform{}}
+}
+
+func TestScheduler_Rules(t *testing.T) {
+	svc := newTestService(t)
+	work, _ := rules.ParseSchedule("09:00-17:00 UTC")
+	if err := svc.Store.SaveRule(rules.Rule{Name: "games", Application: "any", Action: "deny", Protocol: "any", Direction: "outbound", Schedule: work}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	sc := NewScheduler(svc)
+	at := func(hour int) time.Time { return time.Date(2024, 4, 1, hour, 0, 0, 0, time.UTC) }
+
+	for _, step := range []struct {
+		hour int
+		want bool
+	}{
+		{8, true},   // first evaluation
+		{8, false},  // nothing moved
+		{9, true},   // schedule starts
+		{12, false}, // still inside
+		{17, true},  // schedule ends
+	} {
+		changed, err := sc.tickRules(at(step.hour))
+		if err != nil {
+			t.Fatalf("tickRules: %v", err)
+		}
+		if changed != step.want {
+			t.Errorf("at %02d:00 changed = %v, want %v", step.hour, changed, step.want)
+		}
+	}
+}
+
+func TestScheduler_Profiles(t *testing.T) {
+	svc := newTestService(t)
+	work, _ := rules.ParseSchedule("mon-fri 09:00-17:00 UTC")
+	for _, p := range []profiles.Profile{
+		{Name: "home", Description: "Home", Rules: []string{}},
+		{Name: "work", Description: "Work", Rules: []string{}, Schedule: work},
+	} {
+		if err := svc.Profiles.SaveProfile(p); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := svc.Profiles.SetActiveProfile("home"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	sc := NewScheduler(svc)
+	active := func() string {
+		p, err := svc.Profiles.GetActiveProfile()
+		if err != nil {
+			return ""
+		}
+		return p.Name
+	}
+
+	// 2024-04-01 is a Monday.
+	if switched, _ := sc.tickProfiles(time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC)); switched || active() != "home" {
+		t.Fatalf("nothing should change before work hours, active %q", active())
+	}
+	if switched, _ := sc.tickProfiles(time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)); !switched || active() != "work" {
+		t.Fatalf("work should be activated at 09:00, active %q", active())
+	}
+	if switched, _ := sc.tickProfiles(time.Date(2024, 4, 1, 17, 0, 0, 0, time.UTC)); !switched || active() != "home" {
+		t.Fatalf("home should be restored at 17:00, active %q", active())
+	}
+
+	// A profile switched by hand is left alone until the next boundary.
+	if err := svc.Profiles.SetActiveProfile("work"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if switched, _ := sc.tickProfiles(time.Date(2024, 4, 1, 18, 0, 0, 0, time.UTC)); switched || active() != "work" {
+		t.Fatalf("manual activation should stick, active %q", active())
+	}
+}
@@ -1,16 +1,53 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/vhPedroGitHub/firewall/internal/logging"
 	"github.com/vhPedroGitHub/firewall/internal/platform"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
 // Service centralizes core operations shared by CLI and GUI.
 type Service struct {
-	Store rules.Store
+	Store    rules.Store
+	Profiles profiles.Store // optional; when set the active profile scopes enforcement
+	Platform Platform       // optional; defaults to the OS firewall adapter
+}
+
+// Platform is the firewall the service reconciles with the desired rules.
+type Platform interface {
+	PlanRuleset(desired []rules.Rule) (*platform.Plan, error)
+	ApplyPlan(p *platform.Plan) error
+	BindApplications(list []rules.Rule) (int, error)
+}
+
+// osPlatform is the OS firewall adapter of the platform package.
+type osPlatform struct{}
+
+func (osPlatform) PlanRuleset(desired []rules.Rule) (*platform.Plan, error) {
+	return platform.PlanRuleset(desired)
+}
+
+func (osPlatform) ApplyPlan(p *platform.Plan) error {
+	return platform.ApplyPlan(p)
+}
+
+func (osPlatform) BindApplications(list []rules.Rule) (int, error) {
+	return platform.BindApplications(list)
+}
+
+func (s *Service) adapter() Platform {
+	if s.Platform != nil {
+		return s.Platform
+	}
+	return osPlatform{}
 }
 
 // ListRules returns stored rules.
@@ -45,7 +82,225 @@ func (s *Service) DeleteRule(name string) error {
 	return nil
 }
 
-// ApplyRule dispatches to the platform-specific adapter.
+// ApplyRule persists a rule and reconciles the platform so the kernel matches
+// the store, rather than appending the rule on its own.
 func (s *Service) ApplyRule(r rules.Rule) error {
-	return platform.ApplyRule(r)
+	if err := s.SaveRule(r); err != nil {
+		return err
+	}
+	_, err := s.Sync()
+	return err
+}
+
+// DesiredRules returns the rule set that should be enforced: the unexpired
+// effective rules of the active profile, inherited ones included, when one is
+// active, otherwise every unexpired stored rule, followed by the catch-all
+// rules of the default policy.
+func (s *Service) DesiredRules() ([]rules.Rule, error) {
+	list, active, err := s.scopedRules()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.resolvePolicy(active)
+	if err != nil {
+		return nil, err
+	}
+	return append(list, policy.CatchAll()...), nil
+}
+
+// Changes returns a counter that moves whenever the stores' contents change,
+// so the monitor can keep the desired rules between changes. It fails when a
+// store keeps no such counter.
+func (s *Service) Changes() (int64, error) {
+	var total int64
+	for _, store := range []any{s.Store, s.Profiles} {
+		if store == nil {
+			continue
+		}
+		counter, ok := store.(interface{ Changes() (int64, error) })
+		if !ok {
+			return 0, fmt.Errorf("%T does not count changes", store)
+		}
+		n, err := counter.Changes()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// scopedRules returns the unexpired rules in scope and the active profile,
+// which is nil when none is active.
+func (s *Service) scopedRules() ([]rules.Rule, *profiles.Profile, error) {
+	all, err := s.Store.ListRules()
+	if err != nil {
+		return nil, nil, err
+	}
+	all = rules.Active(all, time.Now())
+	if s.Profiles == nil {
+		return all, nil, nil
+	}
+
+	active, err := s.Profiles.GetActiveProfile()
+	if errors.Is(err, sql.ErrNoRows) {
+		return all, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load active profile: %w", err)
+	}
+
+	effective, err := profiles.Effective(*active, s.Profiles.GetProfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	members := make(map[string]bool, len(effective))
+	for _, r := range effective {
+		members[r.Name] = true
+	}
+	var out []rules.Rule
+	for _, r := range all {
+		if members[r.Name] {
+			out = append(out, r)
+		}
+	}
+	return out, active, nil
+}
+
+// PlanSync computes the changes needed to converge the platform on the desired
+// rule set without applying them (dry run).
+func (s *Service) PlanSync() (*platform.Plan, error) {
+	desired, err := s.DesiredRules()
+	if err != nil {
+		return nil, err
+	}
+	return s.adapter().PlanRuleset(desired)
+}
+
+// Sync reconciles the platform with the desired rule set in a single atomic
+// batch and returns the plan that was applied. Running processes of the
+// affected applications are then bound so per-application rules match them.
+func (s *Service) Sync() (*platform.Plan, error) {
+	desired, err := s.DesiredRules()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.adapter().PlanRuleset(desired)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.adapter().ApplyPlan(plan); err != nil {
+		logging.LogEvent("error", "sync-failed", fmt.Sprintf("Platform sync failed: %v", err), map[string]interface{}{
+			"backend": plan.Backend,
+		})
+		return plan, err
+	}
+	logging.LogEvent("info", "sync", "Platform rules reconciled", map[string]interface{}{
+		"backend":   plan.Backend,
+		"added":     len(plan.Add),
+		"updated":   len(plan.Update),
+		"removed":   len(plan.Remove),
+		"unchanged": len(plan.Unchanged),
+	})
+
+	if _, err := s.adapter().BindApplications(desired); err != nil {
+		logging.LogEvent("warning", "bind-failed", fmt.Sprintf("Failed to bind application processes: %v", err), nil)
+	}
+	return plan, nil
+}
+
+// BindApplications places running processes of the applications bound by the
+// desired rules where the platform can match them. The monitor binds on
+// start, before it places processes as they exec, so it knows the rule set
+// even when no sync ran in its process.
+func (s *Service) BindApplications() (int, error) {
+	desired, err := s.DesiredRules()
+	if err != nil {
+		return 0, err
+	}
+	return s.adapter().BindApplications(desired)
+}
+
+// PurgeExpired deletes rules whose expiry has passed and, when any were
+// deleted, reconciles the platform so they leave the kernel as well.
+func (s *Service) PurgeExpired(now time.Time) ([]string, error) {
+	return s.purge("expired", func(r rules.Rule) bool { return r.Expired(now) })
+}
+
+// EndSession deletes session-scoped rules and reconciles the platform. It runs
+// when a session ends and when the next one starts, in case the previous one
+// did not end cleanly.
+func (s *Service) EndSession() ([]string, error) {
+	return s.purge("session", func(r rules.Rule) bool { return r.Session })
+}
+
+func (s *Service) purge(reason string, match func(rules.Rule) bool) ([]string, error) {
+	purged, err := rules.Purge(s.Store, match)
+	if len(purged) > 0 {
+		logging.LogEvent("info", "rule-purge", fmt.Sprintf("Removed %d %s rule(s)", len(purged), reason), map[string]interface{}{
+			"reason": reason,
+			"rules":  purged,
+		})
+	}
+	if err != nil || len(purged) == 0 {
+		return purged, err
+	}
+	_, err = s.Sync()
+	return purged, err
+}
+
+// RuleHistory lists recorded rule changes, newest first; see
+// rules.HistoryStore.
+func (s *Service) RuleHistory(ctx context.Context, name string, limit int) ([]rules.Change, error) {
+	hs, ok := s.Store.(rules.HistoryStore)
+	if !ok {
+		return nil, errors.New("rule store does not keep a history")
+	}
+	return hs.History(ctx, name, limit)
+}
+
+// RevertRules restores the stored rules to their state right after revision
+// and returns the changes it undid. Callers reconcile the platform afterwards.
+func (s *Service) RevertRules(ctx context.Context, revision int64) ([]rules.Change, error) {
+	hs, ok := s.Store.(rules.HistoryStore)
+	if !ok {
+		return nil, errors.New("rule store does not keep a history")
+	}
+	undone, err := hs.Revert(ctx, revision)
+	if err != nil {
+		logging.LogEvent("error", "rule-revert-failed", fmt.Sprintf("Revert to revision %d failed: %v", revision, err), map[string]interface{}{
+			"revision": revision,
+		})
+		return nil, err
+	}
+	logging.LogEvent("info", "rule-revert", fmt.Sprintf("Rules reverted to revision %d (%d change(s) undone)", revision, len(undone)), map[string]interface{}{
+		"revision": revision,
+		"undone":   len(undone),
+	})
+	return undone, nil
+}
+
+// JanitorInterval is how often StartJanitor's callers purge expired rules.
+const JanitorInterval = time.Minute
+
+// StartJanitor purges expired rules every interval until the returned stop
+// function is called.
+func (s *Service) StartJanitor(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if _, err := s.PurgeExpired(now); err != nil {
+					logging.LogEvent("error", "janitor-failed", fmt.Sprintf("Failed to purge expired rules: %v", err), nil)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
 }
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/monitor"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+)
+
+// ConnectionTrace is a monitor.Trace with the profile context of the rules.
+type ConnectionTrace struct {
+	monitor.Trace
+	// Profile is the active profile that scopes the rules, or "" when every
+	// stored rule is enforced.
+	Profile string
+	// From is the profile the deciding rule is enforced through, which differs
+	// from Profile when the rule is inherited.
+	From string
+}
+
+// TraceConnection simulates a connection against the enforced rules, as the
+// monitor's handler would decide it, without prompting or saving anything.
+func (s *Service) TraceConnection(event monitor.ConnectionEvent) (*ConnectionTrace, error) {
+	h := monitor.NewDefaultHandler(s.Store)
+	h.Scope = s
+	t, err := h.Trace(event)
+	if err != nil {
+		return nil, err
+	}
+	out := &ConnectionTrace{Trace: *t}
+	if s.Profiles == nil {
+		return out, nil
+	}
+	active, err := s.Profiles.GetActiveProfile()
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active profile: %w", err)
+	}
+	out.Profile = active.Name
+	if t.Rule == nil {
+		return out, nil
+	}
+	effective, err := profiles.Effective(*active, s.Profiles.GetProfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range effective {
+		if r.Name == t.Rule.Name {
+			out.From = r.From
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/monitor"
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+)
+
+func TestTraceConnection_ReportsProfile(t *testing.T) {
+	svc := newTestService(t)
+	seedProfiles(t, svc)
+	event := monitor.ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstAddr: "1.2.3.4", DstPort: 443}
+
+	tr, err := svc.TraceConnection(event)
+	if err != nil {
+		t.Fatalf("trace: %v", err)
+	}
+	if tr.Profile != "" || tr.Rule == nil || tr.Rule.Name != "mail" || tr.Decision != monitor.DecisionAllow {
+		t.Fatalf("trace without profile = %+v", tr)
+	}
+
+	if err := svc.Profiles.SaveProfile(profiles.Profile{Name: "office", Description: "Office", Extends: []string{"work"}}); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+	if _, err := svc.ActivateProfile("office"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	tr, err = svc.TraceConnection(event)
+	if err != nil {
+		t.Fatalf("trace: %v", err)
+	}
+	if tr.Profile != "office" || tr.From != "work" || tr.Rule == nil || tr.Rule.Name != "ssh" {
+		t.Fatalf("trace with profile = %+v", tr)
+	}
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+// Stores are the rule and profile stores bound to one transaction.
+type Stores struct {
+	Rules    *rules.SQLiteStore
+	Profiles *profiles.SQLiteStore
+}
+
+// UnitOfWork groups writes to the rule and profile stores so they commit
+// together or not at all. Both stores must share DB.
+type UnitOfWork struct {
+	DB       *sql.DB
+	Rules    *rules.SQLiteStore
+	Profiles *profiles.SQLiteStore
+}
+
+// Do runs fn with stores bound to a new transaction, committing it when fn
+// returns nil and rolling it back otherwise.
+func (u UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, s Stores) error) error {
+	return storage.InTx(ctx, u.DB, func(tx *sql.Tx) error {
+		return fn(ctx, Stores{
+			Rules:    u.Rules.WithTx(tx),
+			Profiles: u.Profiles.WithTx(tx),
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+func TestUnitOfWork_RollsBackBothStores(t *testing.T) {
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	ruleStore, err := rules.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("rule store: %v", err)
+	}
+	profileStore, err := profiles.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("profile store: %v", err)
+	}
+	uow := UnitOfWork{DB: db, Rules: ruleStore, Profiles: profileStore}
+	ctx := context.Background()
+
+	write := func(ctx context.Context, s Stores) error {
+		if err := s.Rules.SaveRule(rules.Rule{Name: "web", Application: "any", Action: "allow", Protocol: "any", Direction: "outbound"}); err != nil {
+			return err
+		}
+		return s.Profiles.SaveProfile(profiles.Profile{Name: "work", Description: "Work", Rules: []string{"web"}})
+	}
+
+	boom := errors.New("boom")
+	err = uow.Do(ctx, func(ctx context.Context, s Stores) error {
+		if err := write(ctx, s); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Do error = %v, want boom", err)
+	}
+	if list, _ := ruleStore.ListRules(); len(list) != 0 {
+		t.Errorf("rolled back rule is still stored: %+v", list)
+	}
+	if list, _ := profileStore.ListProfiles(); len(list) != 0 {
+		t.Errorf("rolled back profile is still stored: %+v", list)
+	}
+
+	if err := uow.Do(ctx, write); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	p, err := profileStore.GetProfile("work")
+	if err != nil || len(p.Rules) != 1 || p.Rules[0] != "web" {
+		t.Fatalf("committed profile = %+v, %v", p, err)
+	}
+}
@@ -18,6 +18,15 @@ type Config struct {
 
 	// GUI settings
 	GUI GUIConfig `json:"gui"`
+
+	// Platform adapter settings
+	Platform PlatformConfig `json:"platform"`
+
+	// Connection monitor settings
+	Monitor MonitorConfig `json:"monitor"`
+
+	// Default policy for connections no rule matches
+	DefaultPolicy PolicyConfig `json:"default_policy"`
 }
 
 // GUIConfig represents GUI-specific settings.
@@ -27,6 +36,38 @@ type GUIConfig struct {
 	Theme  string `json:"theme"`
 }
 
+// PlatformConfig represents OS adapter settings.
+type PlatformConfig struct {
+	// LinuxBackend selects the packet filter on Linux: auto, iptables or nftables.
+	LinuxBackend string `json:"linux_backend"`
+
+	// LinuxAppMatch controls per-application enforcement on Linux: cgroup or none.
+	LinuxAppMatch string `json:"linux_app_match"`
+}
+
+// MonitorConfig represents connection monitor settings.
+type MonitorConfig struct {
+	// Mode selects how connections are observed: poll, or nfqueue to hold new
+	// outbound connections until they are decided (Linux only).
+	Mode string `json:"mode"`
+
+	// QueueNum is the NFQUEUE number used in nfqueue mode.
+	QueueNum uint16 `json:"queue_num"`
+
+	// TimeoutSeconds is how long a held connection waits for a decision.
+	TimeoutSeconds int `json:"timeout_seconds"`
+
+	// TimeoutVerdict is applied when no decision arrives in time: allow or deny.
+	TimeoutVerdict string `json:"timeout_verdict"`
+}
+
+// PolicyConfig represents the default policy per direction: prompt, allow or
+// deny. Profiles may override it.
+type PolicyConfig struct {
+	Inbound  string `json:"inbound"`
+	Outbound string `json:"outbound"`
+}
+
 // Default returns a Config with sensible defaults.
 func Default() Config {
 	return Config{
@@ -38,6 +79,20 @@ func Default() Config {
 			Height: 768,
 			Theme:  "dark",
 		},
+		Platform: PlatformConfig{
+			LinuxBackend:  "auto",
+			LinuxAppMatch: "cgroup",
+		},
+		Monitor: MonitorConfig{
+			Mode:           "poll",
+			QueueNum:       100,
+			TimeoutSeconds: 15,
+			TimeoutVerdict: "allow",
+		},
+		DefaultPolicy: PolicyConfig{
+			Inbound:  "prompt",
+			Outbound: "prompt",
+		},
 	}
 }
 
@@ -70,6 +125,30 @@ func Load(path string) (Config, error) {
 	if cfg.GUI.Width == 0 {
 		cfg.GUI = def.GUI
 	}
+	if cfg.Platform.LinuxBackend == "" {
+		cfg.Platform.LinuxBackend = def.Platform.LinuxBackend
+	}
+	if cfg.Platform.LinuxAppMatch == "" {
+		cfg.Platform.LinuxAppMatch = def.Platform.LinuxAppMatch
+	}
+	if cfg.Monitor == (MonitorConfig{}) {
+		cfg.Monitor = def.Monitor
+	}
+	if cfg.Monitor.Mode == "" {
+		cfg.Monitor.Mode = def.Monitor.Mode
+	}
+	if cfg.Monitor.TimeoutSeconds == 0 {
+		cfg.Monitor.TimeoutSeconds = def.Monitor.TimeoutSeconds
+	}
+	if cfg.Monitor.TimeoutVerdict == "" {
+		cfg.Monitor.TimeoutVerdict = def.Monitor.TimeoutVerdict
+	}
+	if cfg.DefaultPolicy.Inbound == "" {
+		cfg.DefaultPolicy.Inbound = def.DefaultPolicy.Inbound
+	}
+	if cfg.DefaultPolicy.Outbound == "" {
+		cfg.DefaultPolicy.Outbound = def.DefaultPolicy.Outbound
+	}
 
 	return cfg, nil
 }
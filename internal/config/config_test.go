@@ -104,6 +104,15 @@ func TestConfig_LoadWithDefaults(t *testing.T) {
 	if loaded.GUI.Width != def.GUI.Width {
 		t.Errorf("expected default GUI Width, got %d", loaded.GUI.Width)
 	}
+	if loaded.Platform.LinuxBackend != "auto" {
+		t.Errorf("expected default LinuxBackend %q, got %q", "auto", loaded.Platform.LinuxBackend)
+	}
+	if loaded.Monitor != def.Monitor {
+		t.Errorf("expected default Monitor settings, got %+v", loaded.Monitor)
+	}
+	if loaded.DefaultPolicy != def.DefaultPolicy {
+		t.Errorf("expected default policy settings, got %+v", loaded.DefaultPolicy)
+	}
 }
 
 func TestConfig_InvalidJSON(t *testing.T) {
@@ -3,14 +3,93 @@ package monitor
 import (
 	"fmt"
 	"runtime"
+	"sync"
+	"time"
 )
 
+// Monitoring modes. Poll observes connections after the fact by reading the
+// OS connection tables; nfqueue (Linux only) holds each new outbound
+// connection in the kernel until the Handler has decided on it.
+const (
+	ModePoll    = "poll"
+	ModeNFQueue = "nfqueue"
+)
+
+// Options tunes how connections are observed.
+type Options struct {
+	Mode           string        // poll or nfqueue
+	QueueNum       uint16        // NFQUEUE number used in nfqueue mode
+	Timeout        time.Duration // how long a held connection waits for a decision
+	TimeoutVerdict string        // allow or deny, issued when the timeout expires
+}
+
+// DefaultOptions returns the options used until Configure is called.
+func DefaultOptions() Options {
+	return Options{
+		Mode:           ModePoll,
+		QueueNum:       100,
+		Timeout:        15 * time.Second,
+		TimeoutVerdict: "allow",
+	}
+}
+
+var (
+	optionsMu sync.RWMutex
+	options   = DefaultOptions()
+)
+
+// Configure sets the options used by New. Zero values fall back to defaults.
+func Configure(opts Options) error {
+	def := DefaultOptions()
+	if opts.Mode == "" {
+		opts.Mode = def.Mode
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = def.Timeout
+	}
+	if opts.TimeoutVerdict == "" {
+		opts.TimeoutVerdict = def.TimeoutVerdict
+	}
+	switch opts.Mode {
+	case ModePoll, ModeNFQueue:
+	default:
+		return fmt.Errorf("unknown monitor mode: %s", opts.Mode)
+	}
+	if _, err := parseVerdict(opts.TimeoutVerdict); err != nil {
+		return err
+	}
+
+	optionsMu.Lock()
+	options = opts
+	optionsMu.Unlock()
+	return nil
+}
+
+// parseVerdict maps a configured verdict name to a Decision.
+func parseVerdict(name string) (Decision, error) {
+	switch name {
+	case "allow":
+		return DecisionAllow, nil
+	case "deny":
+		return DecisionDeny, nil
+	default:
+		return DecisionDeny, fmt.Errorf("invalid timeout verdict: %s (expected allow or deny)", name)
+	}
+}
+
 // New creates a platform-specific monitor.
 func New() (Monitor, error) {
+	optionsMu.RLock()
+	opts := options
+	optionsMu.RUnlock()
+
 	switch runtime.GOOS {
 	case "windows":
 		return NewWindowsMonitor(), nil
 	case "linux":
+		if opts.Mode == ModeNFQueue {
+			return NewNFQueueMonitor(opts), nil
+		}
 		return NewLinuxMonitor(), nil
 	default:
 		return nil, fmt.Errorf("monitoring not supported on %s", runtime.GOOS)
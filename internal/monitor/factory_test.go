@@ -0,0 +1,25 @@
+package monitor
+
+import "testing"
+
+func TestConfigure(t *testing.T) {
+	defer Configure(DefaultOptions())
+
+	if err := Configure(Options{Mode: ModeNFQueue, QueueNum: 5}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	optionsMu.RLock()
+	got := options
+	optionsMu.RUnlock()
+	def := DefaultOptions()
+	if got.QueueNum != 5 || got.Timeout != def.Timeout || got.TimeoutVerdict != def.TimeoutVerdict {
+		t.Errorf("unexpected options after Configure: %+v", got)
+	}
+
+	if err := Configure(Options{Mode: "pcap"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if err := Configure(Options{TimeoutVerdict: "reject"}); err == nil {
+		t.Error("expected error for unknown timeout verdict")
+	}
+}
@@ -1,9 +1,13 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/vhPedroGitHub/firewall/internal/logging"
 	"github.com/vhPedroGitHub/firewall/internal/notify"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
@@ -11,6 +15,38 @@ import (
 // DefaultHandler implements Handler with rule checking and user prompts.
 type DefaultHandler struct {
 	Store rules.Store
+	Scope Scope // optional; when set only the rules it returns are enforced
+
+	// Prompt asks the user to pick one of options; nil uses notify.Choose.
+	Prompt func(title, message string, options []string) (string, error)
+
+	cacheMu sync.Mutex
+	cache   ruleCache
+}
+
+// ChangeCounter is implemented by rule sources that can tell cheaply whether
+// their rules may have changed: the counter moves on every change. The handler
+// keeps the sorted rules of such a source until it does.
+type ChangeCounter interface {
+	Changes() (int64, error)
+}
+
+// ruleCache is the sorted rule set as loaded at a change count. Schedules
+// switch on minute boundaries, so a load is also only good for its minute.
+type ruleCache struct {
+	ordered []rules.Rule
+	changes int64
+	minute  time.Time
+	valid   bool
+}
+
+// Scope narrows the rules the handler enforces, typically to those of the
+// active profile.
+type Scope interface {
+	// DesiredRules returns the rules to enforce.
+	DesiredRules() ([]rules.Rule, error)
+	// AdoptRule brings a rule saved from a prompt into the enforced set.
+	AdoptRule(name string) error
 }
 
 // NewDefaultHandler creates a new handler with the given rule store.
@@ -25,127 +61,296 @@ func (h *DefaultHandler) HandleConnection(event ConnectionEvent) (Decision, erro
 }
 
 // HandleConnectionWithPrompts checks if a rule exists for the connection event.
-// If no rule exists and prompts are enabled, it prompts the user.
-// If prompts are disabled, it denies the connection.
+// A default policy of allow or deny is part of the scope's rules as a final
+// catch-all, so only connections left to prompt get this far unmatched: if
+// prompts are enabled it prompts the user, otherwise it denies the connection.
 func (h *DefaultHandler) HandleConnectionWithPrompts(event ConnectionEvent, promptsEnabled bool) (Decision, error) {
-	// Check if we have a matching rule
-	existingRules, err := h.Store.ListRules()
+	// Check if we have a matching rule; the first match in evaluation order wins
+	existingRules, err := h.evaluationOrder()
 	if err != nil {
 		return DecisionDeny, fmt.Errorf("failed to list rules: %w", err)
 	}
 
 	for _, rule := range existingRules {
-		if h.matchesRule(event, rule) {
-			// Rule found - apply it
-			if rule.Action == "allow" {
-				return DecisionAllow, nil
-			}
-			return DecisionDeny, nil
+		if !h.matchesRule(event, rule) {
+			continue
 		}
+		// A rule whose pinned identity does not match the executable must not
+		// hand its permissions on, nor may a broader rule further down
+		if mismatch := identityMismatch(event, rule); mismatch != "" {
+			logging.LogEvent("warning", "identity_mismatch",
+				fmt.Sprintf("Executable %s does not match rule %q: %s", event.AppPath, rule.Name, mismatch),
+				map[string]interface{}{
+					"rule":     rule.Name,
+					"app":      event.AppPath,
+					"pid":      event.PID,
+					"mismatch": mismatch,
+				})
+			return h.unknownApplication(event, promptsEnabled,
+				fmt.Sprintf("WARNING: this executable does not match rule %q (%s).", rule.Name, mismatch))
+		}
+		// Rule found - apply it
+		if rule.Action == "allow" {
+			return DecisionAllow, nil
+		}
+		return DecisionDeny, nil
 	}
 
-	// No matching rule found
+	return h.unknownApplication(event, promptsEnabled, "")
+}
+
+// unknownApplication decides a connection no rule vouches for: it prompts the
+// user when prompts are enabled and denies otherwise. A non-empty warning is
+// shown at the top of the prompt.
+func (h *DefaultHandler) unknownApplication(event ConnectionEvent, promptsEnabled bool, warning string) (Decision, error) {
 	if !promptsEnabled {
 		// Prompts disabled - deny by default
 		return DecisionDeny, nil
 	}
 
 	// Prompts enabled - ask user
-	decision, err := h.promptUser(event)
+	decision, lifetime, err := h.promptUser(event, warning)
 	if err != nil {
 		return DecisionDeny, fmt.Errorf("failed to prompt user: %w", err)
 	}
 
+	// Remember the answer for as long as the user asked; a rule for an
+	// unresolved owner would decide every other unresolved connection
+	if decision != DecisionCancel && !lifetime.Once && event.OwnerResolved() {
+		if err := h.SaveDecisionWithLifetime(event, decision, lifetime); err != nil {
+			logging.LogEvent("error", "rule_save_error",
+				fmt.Sprintf("Failed to save rule for %s: %v", event.AppPath, err), nil)
+		}
+	}
+
 	return decision, nil
 }
 
+// identityMismatch checks a rule's executable pins against the connecting
+// executable and describes the first mismatch, or returns "" when the rule pins
+// nothing or everything matches.
+func identityMismatch(event ConnectionEvent, rule rules.Rule) string {
+	if rule.SHA256 != "" {
+		sum, err := ExecutableHash(event.AppPath)
+		if err != nil {
+			return fmt.Sprintf("cannot hash executable: %v", err)
+		}
+		if !strings.EqualFold(sum, rule.SHA256) {
+			return fmt.Sprintf("sha256 %s, pinned %s", sum, rule.SHA256)
+		}
+	}
+	if rule.Package != "" {
+		pkg, err := ExecutablePackage(event.AppPath)
+		if err != nil {
+			return fmt.Sprintf("cannot verify package %s: %v", rule.Package, err)
+		}
+		if pkg != rule.Package {
+			return fmt.Sprintf("owned by package %s, pinned %s", pkg, rule.Package)
+		}
+	}
+	return ""
+}
+
+// evaluationOrder lists the unexpired rules in scope in the order they are
+// evaluated, without relying on the store to return them sorted or on the
+// janitor having removed expired rules yet. The sorted set is reused until the
+// rule source reports a change.
+func (h *DefaultHandler) evaluationOrder() ([]rules.Rule, error) {
+	var source any = h.Store
+	if h.Scope != nil {
+		source = h.Scope
+	}
+	now := time.Now()
+	minute := now.Truncate(time.Minute)
+	changes, counted := int64(0), false
+	if counter, ok := source.(ChangeCounter); ok {
+		n, err := counter.Changes()
+		changes, counted = n, err == nil
+	}
+
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	c := h.cache
+	if !counted || !c.valid || c.changes != changes || !c.minute.Equal(minute) {
+		var list []rules.Rule
+		var err error
+		if h.Scope != nil {
+			list, err = h.Scope.DesiredRules()
+		} else {
+			list, err = h.Store.ListRules()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ordered := append([]rules.Rule(nil), list...)
+		rules.Sort(ordered)
+		c = ruleCache{ordered: ordered, changes: changes, minute: minute, valid: counted}
+		h.cache = c
+	}
+	return rules.Active(c.ordered, now), nil
+}
+
 // matchesRule checks if a connection event matches a rule.
 func (h *DefaultHandler) matchesRule(event ConnectionEvent, rule rules.Rule) bool {
+	return ruleMismatch(event, rule) == ""
+}
+
+// ruleMismatch describes the first criterion of rule the connection event
+// fails, or returns "" when the rule matches.
+func ruleMismatch(event ConnectionEvent, rule rules.Rule) string {
+	// Only rules for any application vouch for a connection whose owner is
+	// unknown, whatever their pattern happens to match
+	if !event.OwnerResolved() {
+		if app, err := rules.ParseApplication(rule.Application); err != nil || app.Kind != rules.AppAny {
+			return "application is unknown; only rules for any application apply"
+		}
+	}
+
 	// Check app path
-	if rule.Application != "" && !strings.EqualFold(rule.Application, event.AppPath) {
-		return false
+	if !rules.MatchApplication(rule.Application, event.AppPath) {
+		return fmt.Sprintf("application %s does not match %s", event.AppPath, rule.Application)
 	}
 
 	// Check protocol
-	if rule.Protocol != "" && !strings.EqualFold(rule.Protocol, event.Protocol) {
-		return false
+	if rule.Protocol != "" && rule.Protocol != "any" && !strings.EqualFold(rule.Protocol, event.Protocol) {
+		return fmt.Sprintf("protocol %s is not %s", event.Protocol, rule.Protocol)
 	}
 
 	// Check direction
 	if rule.Direction != "" && !strings.EqualFold(rule.Direction, event.Direction) {
-		return false
+		return fmt.Sprintf("direction %s is not %s", event.Direction, rule.Direction)
 	}
 
-	// Check ports if specified
-	if len(rule.Ports) > 0 {
-		portMatch := false
-		eventPort := event.DstPort
-		if event.Direction == "inbound" {
-			eventPort = event.SrcPort
-		}
+	// Check addresses; SrcAddr is always the local end and DstAddr the remote one
+	if !rules.MatchAddress(rule.RemoteAddresses, event.DstAddr) {
+		return fmt.Sprintf("remote address %s is not in %s", event.DstAddr, strings.Join(rule.RemoteAddresses, ","))
+	}
+	if !rules.MatchAddress(rule.LocalAddresses, event.SrcAddr) {
+		return fmt.Sprintf("local address %s is not in %s", event.SrcAddr, strings.Join(rule.LocalAddresses, ","))
+	}
 
-		for _, p := range rule.Ports {
-			if p == eventPort {
-				portMatch = true
-				break
-			}
-		}
-		if !portMatch {
-			return false
-		}
+	// Check ports; the legacy Ports list is folded into the side it applies to
+	if ranges := rule.LocalPortRanges(); !rules.MatchPort(ranges, event.SrcPort) {
+		return fmt.Sprintf("local port %d is not in %s", event.SrcPort, portList(ranges))
+	}
+	if ranges := rule.RemotePortRanges(); !rules.MatchPort(ranges, event.DstPort) {
+		return fmt.Sprintf("remote port %d is not in %s", event.DstPort, portList(ranges))
 	}
 
-	return true
+	return ""
+}
+
+// portList renders port ranges for a mismatch description.
+func portList(ranges []rules.PortRange) string {
+	parts := make([]string, len(ranges))
+	for i, p := range ranges {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, ",")
 }
 
-// promptUser displays a notification asking the user to allow or deny the connection.
-func (h *DefaultHandler) promptUser(event ConnectionEvent) (Decision, error) {
+// Lifetime says how long a decision taken at a prompt is kept.
+type Lifetime struct {
+	Once    bool          // decide this connection only; no rule is saved
+	Session bool          // keep until the firewall session ends
+	For     time.Duration // keep for this long; zero keeps the rule permanently
+}
+
+// PromptOption is one of the answers offered when a connection is unknown.
+type PromptOption struct {
+	Label    string
+	Decision Decision
+	Lifetime Lifetime
+}
+
+// PromptOptions are the answers offered by the connection prompt, in order.
+var PromptOptions = []PromptOption{
+	{"Allow once", DecisionAllow, Lifetime{Once: true}},
+	{"Allow for this session", DecisionAllow, Lifetime{Session: true}},
+	{"Allow for 1 hour", DecisionAllow, Lifetime{For: time.Hour}},
+	{"Allow always", DecisionAllow, Lifetime{}},
+	{"Deny once", DecisionDeny, Lifetime{Once: true}},
+	{"Deny for 1 hour", DecisionDeny, Lifetime{For: time.Hour}},
+	{"Deny always", DecisionDeny, Lifetime{}},
+}
+
+// promptUser asks the user what to do with a connection and for how long.
+func (h *DefaultHandler) promptUser(event ConnectionEvent, warning string) (Decision, Lifetime, error) {
 	// Build prompt message
 	msg := fmt.Sprintf(
-		"Application: %s\nProtocol: %s\nDirection: %s\nFrom: %s:%d\nTo: %s:%d\n\nAllow this connection?",
+		"Application: %s\nProtocol: %s\nDirection: %s\nFrom: %s\nTo: %s\n\nAllow this connection?",
 		event.AppPath,
 		event.Protocol,
 		event.Direction,
-		event.SrcAddr,
-		event.SrcPort,
-		event.DstAddr,
-		event.DstPort,
+		endpoint(event.SrcAddr, event.SrcPort),
+		endpoint(event.DstAddr, event.DstPort),
 	)
+	if !event.OwnerResolved() {
+		msg += "\n\nThe application could not be identified, so the answer only applies to this connection."
+	}
+	if warning != "" {
+		msg = warning + "\n\n" + msg
+	}
 
-	// Show notification with Yes/No options
-	result, err := notify.Show("Firewall Connection Request", msg)
+	labels := make([]string, len(PromptOptions))
+	for i, o := range PromptOptions {
+		labels[i] = o.Label
+	}
+	choose := h.Prompt
+	if choose == nil {
+		choose = notify.Choose
+	}
+	choice, err := choose("Firewall Connection Request", msg, labels)
 	if err != nil {
-		return DecisionDeny, err
+		return DecisionDeny, Lifetime{}, err
 	}
+	return parsePromptChoice(choice)
+}
 
-	// Parse result - notify.Show returns "yes" or "no" from user dialog
-	result = strings.ToLower(strings.TrimSpace(result))
-	switch result {
-	case "yes", "allow", "ok":
-		return DecisionAllow, nil
-	case "no", "deny", "cancel":
-		return DecisionDeny, nil
-	default:
-		return DecisionCancel, nil
+// parsePromptChoice maps the label picked in the prompt to a decision. A
+// dismissed prompt cancels.
+func parsePromptChoice(choice string) (Decision, Lifetime, error) {
+	choice = strings.TrimSpace(choice)
+	for _, o := range PromptOptions {
+		if strings.EqualFold(o.Label, choice) {
+			return o.Decision, o.Lifetime, nil
+		}
 	}
+	return DecisionCancel, Lifetime{}, nil
 }
 
 // SaveDecisionAsRule saves a user's decision as a permanent rule.
 func (h *DefaultHandler) SaveDecisionAsRule(event ConnectionEvent, decision Decision) error {
-	if decision == DecisionCancel {
+	return h.SaveDecisionWithLifetime(event, decision, Lifetime{})
+}
+
+// SaveDecisionWithLifetime saves a user's decision as a rule that lasts as long
+// as the lifetime says. Decisions for a single connection are not saved.
+func (h *DefaultHandler) SaveDecisionWithLifetime(event ConnectionEvent, decision Decision, lifetime Lifetime) error {
+	if decision == DecisionCancel || lifetime.Once {
 		return nil // Don't save cancelled decisions
 	}
+	if !event.OwnerResolved() {
+		return fmt.Errorf("cannot save a rule for an unidentified application (%q)", event.AppPath)
+	}
 
 	action := "deny"
 	if decision == DecisionAllow {
 		action = "allow"
 	}
 
+	// The service port is the local end of inbound connections and the
+	// remote end of outbound ones, like Rule.Ports
+	port := event.DstPort
+	if event.Direction == "inbound" {
+		port = event.SrcPort
+	}
+
 	// Generate a unique rule name
 	ruleName := fmt.Sprintf("auto_%s_%s_%d",
 		sanitizeForRuleName(event.AppPath),
 		event.Protocol,
-		event.DstPort,
+		port,
 	)
 
 	rule := rules.Rule{
@@ -154,14 +359,35 @@ func (h *DefaultHandler) SaveDecisionAsRule(event ConnectionEvent, decision Deci
 		Action:      action,
 		Protocol:    event.Protocol,
 		Direction:   event.Direction,
-		Ports:       []int{event.DstPort},
+		Ports:       []int{port},
+		Session:     lifetime.Session,
+	}
+	if lifetime.For > 0 {
+		rule.ExpiresAt = time.Now().Add(lifetime.For).UTC().Truncate(time.Second)
 	}
 
 	if err := rules.Validate(rule); err != nil {
 		return fmt.Errorf("generated invalid rule: %w", err)
 	}
 
-	return h.Store.SaveRule(rule)
+	ctx := rules.WithAudit(context.Background(), rules.Audit{Source: rules.SourceMonitor})
+	if err := rules.SaveAll(ctx, h.Store, []rules.Rule{rule}); err != nil {
+		return err
+	}
+	return h.adopt(rule.Name)
+}
+
+// adopt brings a newly saved rule into the handler's scope, if it has one.
+func (h *DefaultHandler) adopt(names ...string) error {
+	if h.Scope == nil {
+		return nil
+	}
+	for _, name := range names {
+		if err := h.Scope.AdoptRule(name); err != nil {
+			return fmt.Errorf("failed to add rule %q to the active profile: %w", name, err)
+		}
+	}
+	return nil
 }
 
 // sanitizeForRuleName converts a file path to a safe rule name component.
@@ -193,13 +419,16 @@ func sanitizeForRuleName(path string) string {
 
 // CheckRule implements RuleChecker interface.
 func (h *DefaultHandler) CheckRule(event ConnectionEvent) *rules.Rule {
-	existingRules, err := h.Store.ListRules()
+	existingRules, err := h.evaluationOrder()
 	if err != nil {
 		return nil
 	}
 
 	for _, rule := range existingRules {
 		if h.matchesRule(event, rule) {
+			if identityMismatch(event, rule) != "" {
+				return nil
+			}
 			return &rule
 		}
 	}
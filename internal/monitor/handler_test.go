@@ -1,7 +1,10 @@
 package monitor
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
@@ -79,6 +82,128 @@ func TestDefaultHandler_MatchesRule(t *testing.T) {
 			},
 			matches: true,
 		},
+		{
+			name: "glob app",
+			event: ConnectionEvent{
+				AppPath:   "/opt/app-1.2.3/bin/app",
+				Protocol:  "tcp",
+				Direction: "outbound",
+				DstPort:   443,
+			},
+			rule: rules.Rule{
+				Application: "/opt/app-*/bin/app",
+				Protocol:    "tcp",
+				Direction:   "outbound",
+				Ports:       []int{443},
+			},
+			matches: true,
+		},
+		{
+			name: "directory prefix app mismatch",
+			event: ConnectionEvent{
+				AppPath:   "/usr/bin/java",
+				Protocol:  "tcp",
+				Direction: "outbound",
+				DstPort:   443,
+			},
+			rule: rules.Rule{
+				Application: "/usr/lib/jvm/",
+				Protocol:    "any",
+				Direction:   "outbound",
+			},
+			matches: false,
+		},
+		{
+			name: "remote address in range",
+			event: ConnectionEvent{
+				AppPath:   "/usr/bin/curl",
+				Protocol:  "tcp",
+				Direction: "outbound",
+				DstAddr:   "10.0.0.15",
+				DstPort:   443,
+			},
+			rule: rules.Rule{
+				Application:     "/usr/bin/curl",
+				Protocol:        "tcp",
+				Direction:       "outbound",
+				Ports:           []int{443},
+				RemoteAddresses: []string{"10.0.0.0/24"},
+			},
+			matches: true,
+		},
+		{
+			name: "remote address outside list",
+			event: ConnectionEvent{
+				AppPath:   "/usr/bin/curl",
+				Protocol:  "tcp",
+				Direction: "outbound",
+				DstAddr:   "2001:db8::1",
+				DstPort:   443,
+			},
+			rule: rules.Rule{
+				Application:     "/usr/bin/curl",
+				Protocol:        "tcp",
+				Direction:       "outbound",
+				Ports:           []int{443},
+				RemoteAddresses: []string{"10.0.0.0/24", "2001:db9::/32"},
+			},
+			matches: false,
+		},
+		{
+			name: "local address mismatch",
+			event: ConnectionEvent{
+				AppPath:   "/usr/sbin/sshd",
+				Protocol:  "tcp",
+				Direction: "inbound",
+				SrcAddr:   "192.168.1.5",
+				DstAddr:   "192.168.1.100",
+				DstPort:   22,
+			},
+			rule: rules.Rule{
+				Application:    "/usr/sbin/sshd",
+				Protocol:       "tcp",
+				Direction:      "inbound",
+				Ports:          []int{22},
+				LocalAddresses: []string{"192.168.1.1"},
+			},
+			matches: false,
+		},
+		{
+			name: "remote port range and service",
+			event: ConnectionEvent{
+				AppPath:   "/usr/bin/app",
+				Protocol:  "tcp",
+				Direction: "outbound",
+				SrcPort:   40000,
+				DstPort:   6500,
+			},
+			rule: rules.Rule{
+				Application: "/usr/bin/app",
+				Protocol:    "tcp",
+				Direction:   "outbound",
+				RemotePorts: []string{"https", "6000-7000"},
+				LocalPorts:  []string{"1024-65535"},
+			},
+			matches: true,
+		},
+		{
+			name: "local port outside range",
+			event: ConnectionEvent{
+				AppPath:   "/usr/bin/app",
+				Protocol:  "tcp",
+				Direction: "outbound",
+				SrcPort:   80,
+				DstPort:   443,
+			},
+			rule: rules.Rule{
+				Application: "/usr/bin/app",
+				Protocol:    "tcp",
+				Direction:   "outbound",
+				RemotePorts: []string{"https"},
+				LocalPorts:  []string{"1024-65535"},
+			},
+			matches: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -119,3 +244,234 @@ func TestSanitizeForRuleName(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultHandler_EvaluationOrder(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "aaa-allow", Action: "allow", Protocol: "any", Direction: "outbound"},
+		{Name: "block-all", Action: "deny", Protocol: "any", Direction: "outbound", Priority: -1},
+	}}
+	handler := NewDefaultHandler(store)
+	event := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstPort: 443}
+
+	decision, err := handler.HandleConnectionWithPrompts(event, false)
+	if err != nil {
+		t.Fatalf("HandleConnectionWithPrompts: %v", err)
+	}
+	if decision != DecisionDeny {
+		t.Errorf("lower priority value should win over name order, got %v", decision)
+	}
+	if got := handler.CheckRule(event); got == nil || got.Name != "block-all" {
+		t.Errorf("CheckRule() = %+v, want block-all", got)
+	}
+}
+
+func TestDefaultHandler_IdentityMismatch(t *testing.T) {
+	app := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(app, []byte("trusted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "pinned", Application: app, Action: "allow", Protocol: "any", Direction: "outbound", SHA256: sha256Hex("trusted")},
+		{Name: "fallback", Application: "any", Action: "allow", Protocol: "any", Direction: "outbound"},
+	}}
+	handler := NewDefaultHandler(store)
+	event := ConnectionEvent{AppPath: app, Protocol: "tcp", Direction: "outbound", DstPort: 443}
+
+	if decision, _ := handler.HandleConnectionWithPrompts(event, false); decision != DecisionAllow {
+		t.Fatalf("pinned executable should be allowed, got %v", decision)
+	}
+
+	// A different binary at the same path must not inherit the rule, nor fall
+	// through to broader rules.
+	if err := os.WriteFile(app, []byte("tampered!"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if decision, _ := handler.HandleConnectionWithPrompts(event, false); decision != DecisionDeny {
+		t.Errorf("tampered executable should be treated as unknown, got %v", decision)
+	}
+	if got := handler.CheckRule(event); got != nil {
+		t.Errorf("CheckRule() = %+v, want nil on mismatch", got)
+	}
+}
+
+func TestDefaultHandler_IgnoresExpiredRules(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "expired-allow", Action: "allow", Protocol: "any", Direction: "outbound", Priority: -1, ExpiresAt: time.Now().Add(-time.Minute)},
+		{Name: "deny", Action: "deny", Protocol: "any", Direction: "outbound"},
+	}}
+	handler := NewDefaultHandler(store)
+	event := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstPort: 443}
+
+	if got := handler.CheckRule(event); got == nil || got.Name != "deny" {
+		t.Errorf("CheckRule() = %+v, want deny", got)
+	}
+}
+
+func TestParsePromptChoice(t *testing.T) {
+	decision, lifetime, _ := parsePromptChoice("Allow for 1 hour\n")
+	if decision != DecisionAllow || lifetime.For != time.Hour {
+		t.Errorf("got %v %+v", decision, lifetime)
+	}
+	if decision, _, _ := parsePromptChoice(""); decision != DecisionCancel {
+		t.Errorf("dismissed prompt should cancel, got %v", decision)
+	}
+}
+
+func TestSaveDecisionWithLifetime(t *testing.T) {
+	store := &mockStore{}
+	handler := NewDefaultHandler(store)
+	event := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstPort: 443}
+
+	if err := handler.SaveDecisionWithLifetime(event, DecisionAllow, Lifetime{Once: true}); err != nil || len(store.rules) != 0 {
+		t.Fatalf("a one-off decision should not be saved: %v %+v", err, store.rules)
+	}
+
+	if err := handler.SaveDecisionWithLifetime(event, DecisionAllow, Lifetime{For: time.Hour}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := handler.SaveDecisionWithLifetime(event, DecisionDeny, Lifetime{Session: true}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if len(store.rules) != 2 {
+		t.Fatalf("expected 2 saved rules, got %+v", store.rules)
+	}
+	if until := time.Until(store.rules[0].ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("unexpected expiry %v", store.rules[0].ExpiresAt)
+	}
+	if !store.rules[1].Session || !store.rules[1].ExpiresAt.IsZero() {
+		t.Errorf("expected a session rule without expiry, got %+v", store.rules[1])
+	}
+}
+
+func TestSaveDecisionWithLifetime_Inbound(t *testing.T) {
+	store := &mockStore{}
+	handler := NewDefaultHandler(store)
+	// An inbound connection to the local SSH server from a remote ephemeral port.
+	event := ConnectionEvent{AppPath: "/usr/sbin/sshd", Protocol: "tcp", Direction: "inbound",
+		SrcAddr: "192.168.1.10", SrcPort: 22, DstAddr: "203.0.113.5", DstPort: 51234}
+
+	if err := handler.SaveDecisionWithLifetime(event, DecisionAllow, Lifetime{}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	saved := store.rules[0]
+	if saved.Name != "auto_sshd_tcp_22" || len(saved.Ports) != 1 || saved.Ports[0] != 22 {
+		t.Fatalf("expected a rule for local port 22, got %+v", saved)
+	}
+	if rule := handler.CheckRule(event); rule == nil || rule.Name != saved.Name {
+		t.Errorf("the saved rule should match the connection it was made for, got %+v", rule)
+	}
+	event.SrcPort = 2222
+	if rule := handler.CheckRule(event); rule != nil {
+		t.Errorf("the saved rule should not match another local port, got %+v", rule)
+	}
+}
+
+func TestDefaultHandler_UnresolvedOwner(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "legacy", Application: UnknownApplication, Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "everything", Application: "re:.*", Action: "allow", Protocol: "any", Direction: "outbound"},
+	}}
+	handler := NewDefaultHandler(store)
+
+	for _, app := range []string{UnknownApplication, "inode:1234", "PID:42", ""} {
+		event := ConnectionEvent{AppPath: app, Protocol: "tcp", Direction: "outbound", DstPort: 443}
+		if event.OwnerResolved() {
+			t.Errorf("%q should not count as resolved", app)
+		}
+		if rule := handler.CheckRule(event); rule != nil {
+			t.Errorf("%q matched rule %q", app, rule.Name)
+		}
+		if decision, _ := handler.HandleConnectionWithPrompts(event, false); decision != DecisionDeny {
+			t.Errorf("%q decision = %v, want deny", app, decision)
+		}
+		if err := handler.SaveDecisionWithLifetime(event, DecisionAllow, Lifetime{}); err == nil {
+			t.Errorf("a rule for %q should not be saved", app)
+		}
+	}
+	if len(store.rules) != 2 {
+		t.Errorf("no rule should have been saved, got %+v", store.rules)
+	}
+
+	// Rules for any application still apply.
+	store.rules = append(store.rules, rules.Rule{Name: "any", Application: rules.AnyApplication, Action: "allow", Protocol: "any", Direction: "outbound"})
+	if rule := handler.CheckRule(ConnectionEvent{AppPath: UnknownApplication, Protocol: "tcp", Direction: "outbound", DstPort: 443}); rule == nil || rule.Name != "any" {
+		t.Errorf("expected the any rule to match, got %+v", rule)
+	}
+}
+
+// listScope scopes a handler to a fixed list of rules and records adoptions.
+type listScope struct {
+	rules   []rules.Rule
+	adopted []string
+}
+
+func (s *listScope) DesiredRules() ([]rules.Rule, error) { return s.rules, nil }
+
+func (s *listScope) AdoptRule(name string) error {
+	s.adopted = append(s.adopted, name)
+	return nil
+}
+
+func TestDefaultHandler_Scope(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "allow-all", Action: "allow", Protocol: "any", Direction: "outbound", Priority: -1},
+		{Name: "deny-all", Action: "deny", Protocol: "any", Direction: "outbound"},
+	}}
+	scope := &listScope{rules: store.rules[1:]}
+	handler := NewDefaultHandler(store)
+	handler.Scope = scope
+	event := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstPort: 443}
+
+	if got := handler.CheckRule(event); got == nil || got.Name != "deny-all" {
+		t.Errorf("rules outside the scope must be ignored, CheckRule() = %+v", got)
+	}
+
+	if err := handler.SaveDecisionWithLifetime(event, DecisionAllow, Lifetime{}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if len(scope.adopted) != 1 || scope.adopted[0] != store.rules[2].Name {
+		t.Errorf("saved decision should join the scope, adopted %v", scope.adopted)
+	}
+}
+
+// countingStore is a mockStore that counts its changes and its listings.
+type countingStore struct {
+	mockStore
+	changes int64
+	lists   int
+}
+
+func (s *countingStore) Changes() (int64, error) { return s.changes, nil }
+
+func (s *countingStore) ListRules() ([]rules.Rule, error) {
+	s.lists++
+	return s.mockStore.ListRules()
+}
+
+func TestDefaultHandler_CachesRulesBetweenChanges(t *testing.T) {
+	store := &countingStore{mockStore: mockStore{rules: []rules.Rule{
+		{Name: "deny-all", Action: "deny", Protocol: "any", Direction: "outbound"},
+	}}}
+	handler := NewDefaultHandler(store)
+	event := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstPort: 443}
+
+	for i := 0; i < 3; i++ {
+		if decision, _ := handler.HandleConnectionWithPrompts(event, false); decision != DecisionDeny {
+			t.Fatalf("decision = %v, want deny", decision)
+		}
+		handler.CheckRule(event)
+	}
+	if store.lists != 1 {
+		t.Errorf("rules listed %d times without a change, want 1", store.lists)
+	}
+
+	store.rules = append(store.rules, rules.Rule{Name: "allow-curl", Application: "/usr/bin/curl", Action: "allow", Protocol: "any", Direction: "outbound", Priority: -1})
+	store.changes++
+	if got := handler.CheckRule(event); got == nil || got.Name != "allow-curl" {
+		t.Errorf("CheckRule() = %+v after a change, want allow-curl", got)
+	}
+	if store.lists != 2 {
+		t.Errorf("rules listed %d times, want a reload after the change", store.lists)
+	}
+}
@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// identityEntry caches what is known about one executable. Entries are keyed by
+// path and invalidated when the file's size or modification time changes, so a
+// binary replaced in place is hashed again.
+type identityEntry struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+	pkg     string
+	pkgErr  error
+	pkgDone bool
+}
+
+var (
+	identityMu    sync.Mutex
+	identityCache = make(map[string]*identityEntry)
+)
+
+// ExecutableHash returns the hex SHA-256 of the executable at path.
+func ExecutableHash(path string) (string, error) {
+	entry, err := identityFor(path)
+	if err != nil {
+		return "", err
+	}
+	return entry.sha256, nil
+}
+
+// ExecutablePackage returns the name of the installed package that owns the
+// executable at path, asking dpkg or rpm. It fails where neither is available
+// or the file belongs to no package.
+func ExecutablePackage(path string) (string, error) {
+	entry, err := identityFor(path)
+	if err != nil {
+		return "", err
+	}
+
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	if !entry.pkgDone {
+		entry.pkg, entry.pkgErr = ownerPackage(path)
+		entry.pkgDone = true
+	}
+	return entry.pkg, entry.pkgErr
+}
+
+// identityFor returns the cache entry for path, hashing the file when it is new
+// or has changed.
+func identityFor(path string) (*identityEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	identityMu.Lock()
+	entry, ok := identityCache[path]
+	identityMu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry, nil
+	}
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry = &identityEntry{size: info.Size(), modTime: info.ModTime(), sha256: sum}
+
+	identityMu.Lock()
+	identityCache[path] = entry
+	identityMu.Unlock()
+	return entry, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ownerPackage queries the package manager for the package owning path.
+func ownerPackage(path string) (string, error) {
+	if _, err := exec.LookPath("dpkg-query"); err == nil {
+		output, err := exec.Command("dpkg-query", "-S", path).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s is not owned by any package", path)
+		}
+		// "curl: /usr/bin/curl", possibly "curl:amd64: /usr/bin/curl"
+		line := strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+		name, _, _ := strings.Cut(line, ":")
+		return strings.TrimSpace(name), nil
+	}
+	if _, err := exec.LookPath("rpm"); err == nil {
+		output, err := exec.Command("rpm", "-qf", "--queryformat", "%{NAME}\n", path).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s is not owned by any package", path)
+		}
+		return strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0], nil
+	}
+	return "", fmt.Errorf("no supported package manager found")
+}
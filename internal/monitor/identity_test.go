@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExecutableHash_RehashesChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(path, []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ExecutableHash(path)
+	if err != nil {
+		t.Fatalf("ExecutableHash: %v", err)
+	}
+	if want := sha256Hex("v1"); got != want {
+		t.Fatalf("hash = %s, want %s", got, want)
+	}
+
+	// Replace the binary in place; the cache must notice.
+	if err := os.WriteFile(path, []byte("v2-longer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ExecutableHash(path); got != sha256Hex("v2-longer") {
+		t.Fatalf("stale hash after replacement: %s", got)
+	}
+
+	if _, err := ExecutableHash(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected error for missing executable")
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
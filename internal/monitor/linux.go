@@ -7,6 +7,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -17,7 +18,8 @@ import (
 
 // LinuxMonitor monitors network connections on Linux.
 // This is a simplified implementation that reads /proc/net/tcp and /proc/net/udp.
-// A production implementation would use netfilter/nfqueue for real-time monitoring.
+// Connections are only seen after they are established; NFQueueMonitor holds
+// them until a decision is made instead.
 type LinuxMonitor struct {
 	mu       sync.Mutex
 	running  bool
@@ -85,6 +87,8 @@ func (m *LinuxMonitor) monitorLoop(ctx context.Context, events chan<- Connection
 		case <-ticker.C:
 			m.checkConnections(events, "tcp", "/proc/net/tcp")
 			m.checkConnections(events, "udp", "/proc/net/udp")
+			m.checkConnections(events, "tcp", "/proc/net/tcp6")
+			m.checkConnections(events, "udp", "/proc/net/udp6")
 		}
 	}
 }
@@ -104,13 +108,11 @@ func (m *LinuxMonitor) checkConnections(events chan<- ConnectionEvent, protocol,
 	for scanner.Scan() {
 		line := scanner.Text()
 		if event := m.parseProcNetLine(line, protocol); event != nil {
-			key := fmt.Sprintf("%s|%s|%s:%d|%s:%d",
+			key := fmt.Sprintf("%s|%s|%s|%s",
 				event.AppPath,
 				event.Protocol,
-				event.SrcAddr,
-				event.SrcPort,
-				event.DstAddr,
-				event.DstPort,
+				endpoint(event.SrcAddr, event.SrcPort),
+				endpoint(event.DstAddr, event.DstPort),
 			)
 
 			m.mu.Lock()
@@ -129,7 +131,7 @@ func (m *LinuxMonitor) checkConnections(events chan<- ConnectionEvent, protocol,
 	}
 }
 
-// parseProcNetLine parses a /proc/net/tcp or /proc/net/udp line.
+// parseProcNetLine parses a line of /proc/net/tcp, udp, tcp6 or udp6.
 func (m *LinuxMonitor) parseProcNetLine(line, protocol string) *ConnectionEvent {
 	// Example line from /proc/net/tcp:
 	//   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12345 1 ...
@@ -182,31 +184,35 @@ func (m *LinuxMonitor) parseProcNetLine(line, protocol string) *ConnectionEvent
 	}
 }
 
-// parseHexAddress converts hex address format to IP:port.
+// parseHexAddress converts the kernel's hex address format to IP and port.
+// IPv4 addresses are 8 hex chars and IPv6 addresses 32; both are stored as
+// 32-bit words in host (little-endian) byte order.
 func parseHexAddress(hexAddr string) (string, int) {
 	parts := strings.Split(hexAddr, ":")
 	if len(parts) != 2 {
 		return "", 0
 	}
 
-	// Convert hex IP to decimal
 	ipHex := parts[0]
-	if len(ipHex) != 8 {
+	if len(ipHex) != 8 && len(ipHex) != 32 {
 		return "", 0
 	}
 
-	// IP is in little-endian format
-	ip := fmt.Sprintf("%d.%d.%d.%d",
-		hexToInt(ipHex[6:8]),
-		hexToInt(ipHex[4:6]),
-		hexToInt(ipHex[2:4]),
-		hexToInt(ipHex[0:2]),
-	)
+	ip := make(net.IP, 0, len(ipHex)/2)
+	for word := 0; word < len(ipHex); word += 8 {
+		for i := 6; i >= 0; i -= 2 {
+			b, err := strconv.ParseUint(ipHex[word+i:word+i+2], 16, 8)
+			if err != nil {
+				return "", 0
+			}
+			ip = append(ip, byte(b))
+		}
+	}
 
 	// Convert hex port to decimal
 	port := hexToInt(parts[1])
 
-	return ip, port
+	return ip.String(), port
 }
 
 // hexToInt converts a hex string to int.
@@ -215,15 +221,6 @@ func hexToInt(hex string) int {
 	return int(val)
 }
 
-// isLocalAddress checks if an IP is a local/private address.
-func isLocalAddress(ip string) bool {
-	return strings.HasPrefix(ip, "192.168.") ||
-		strings.HasPrefix(ip, "10.") ||
-		strings.HasPrefix(ip, "172.16.") ||
-		strings.HasPrefix(ip, "127.") ||
-		ip == "0.0.0.0"
-}
-
 // getProcessByInode finds the process that owns a socket inode.
 func (m *LinuxMonitor) getProcessByInode(inode string) string {
 	appPath, _ := m.getProcessByInodeWithPID(inode)
@@ -232,6 +229,12 @@ func (m *LinuxMonitor) getProcessByInode(inode string) string {
 
 // getProcessByInodeWithPID finds the process and PID that owns a socket inode.
 func (m *LinuxMonitor) getProcessByInodeWithPID(inode string) (string, string) {
+	return lookupProcessByInode(inode)
+}
+
+// lookupProcessByInode searches /proc/*/fd/* for the process that owns a
+// socket inode and returns its executable path and PID.
+func lookupProcessByInode(inode string) (string, string) {
 	// Search /proc/*/fd/* for the inode
 	procDirs, err := filepath.Glob("/proc/[0-9]*/fd/*")
 	if err != nil {
@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import "testing"
+
+func TestParseHexAddress(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantAddr string
+		wantPort int
+	}{
+		{"0100007F:1F90", "127.0.0.1", 8080},
+		{"00000000000000000000000001000000:0016", "::1", 22},
+		{"0000000000000000FFFF00000100007F:0050", "127.0.0.1", 80}, // IPv4-mapped
+		{"B80D0120000000000000000001000000:01BB", "2001:db8::1", 443},
+		{"0100007F", "", 0},
+		{"0100:1F90", "", 0},
+	}
+	for _, tt := range tests {
+		addr, port := parseHexAddress(tt.in)
+		if addr != tt.wantAddr || port != tt.wantPort {
+			t.Errorf("parseHexAddress(%q) = %q, %d, want %q, %d", tt.in, addr, port, tt.wantAddr, tt.wantPort)
+		}
+	}
+}
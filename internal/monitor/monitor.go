@@ -1,6 +1,10 @@
 package monitor
 
 import (
+	"net"
+	"strconv"
+	"strings"
+
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
@@ -10,12 +14,39 @@ type ConnectionEvent struct {
 	PID       string // Process ID
 	Protocol  string // tcp, udp, icmp
 	Direction string // inbound, outbound
-	SrcAddr   string // Source IP address
+	SrcAddr   string // Source IP address (IPv4 dotted or IPv6 without brackets)
 	SrcPort   int    // Source port
-	DstAddr   string // Destination IP address
+	DstAddr   string // Destination IP address (IPv4 dotted or IPv6 without brackets)
 	DstPort   int    // Destination port
 	State     string // Connection state (ESTABLISHED, LISTENING, TIME_WAIT, etc.)
 	Timestamp string // Time when the connection was detected
+
+	// verdict is set by monitors that hold the connection until a decision is
+	// made; it is nil for connections that were only observed.
+	verdict chan<- Decision
+}
+
+// UnknownApplication is the AppPath of a connection whose owning process could
+// not be resolved.
+const UnknownApplication = "unknown"
+
+// OwnerResolved reports whether the event names the executable that made the
+// connection. Besides UnknownApplication, the Linux monitor reports owners it
+// could only partly resolve as "inode:N" or "PID:N".
+func (e ConnectionEvent) OwnerResolved() bool {
+	return e.AppPath != "" && e.AppPath != UnknownApplication &&
+		!strings.HasPrefix(e.AppPath, "inode:") && !strings.HasPrefix(e.AppPath, "PID:")
+}
+
+// resolve reports the decision for a held connection back to its monitor.
+func (e ConnectionEvent) resolve(d Decision) {
+	if e.verdict == nil {
+		return
+	}
+	select {
+	case e.verdict <- d:
+	default:
+	}
 }
 
 // Decision represents the user's choice for a connection.
@@ -27,6 +58,18 @@ const (
 	DecisionCancel
 )
 
+// String returns "allow", "deny" or "cancel".
+func (d Decision) String() string {
+	switch d {
+	case DecisionAllow:
+		return "allow"
+	case DecisionDeny:
+		return "deny"
+	default:
+		return "cancel"
+	}
+}
+
 // Monitor defines the interface for connection monitoring.
 type Monitor interface {
 	// Start begins monitoring network connections.
@@ -49,3 +92,37 @@ type RuleChecker interface {
 	// CheckRule returns the matching rule's action (allow/deny) or nil if no match.
 	CheckRule(event ConnectionEvent) *rules.Rule
 }
+
+// endpoint formats an address and port as host:port, bracketing IPv6 addresses.
+func endpoint(addr string, port int) string {
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// splitEndpoint parses "1.2.3.4:80" or "[::1]:80" into address and port.
+func splitEndpoint(s string) (string, int, bool) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, port, true
+}
+
+// isLocalAddress checks if an IP is a loopback, private, link-local or
+// unspecified IPv4 or IPv6 address.
+func isLocalAddress(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		// Strip an IPv6 zone such as fe80::1%eth0
+		if idx := strings.LastIndex(addr, "%"); idx > 0 {
+			ip = net.ParseIP(addr[:idx])
+		}
+	}
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
@@ -0,0 +1,33 @@
+package monitor
+
+import "testing"
+
+func TestEndpoint(t *testing.T) {
+	if got := endpoint("10.0.0.1", 22); got != "10.0.0.1:22" {
+		t.Errorf("endpoint(ipv4) = %q", got)
+	}
+	if got := endpoint("2001:db8::1", 443); got != "[2001:db8::1]:443" {
+		t.Errorf("endpoint(ipv6) = %q", got)
+	}
+
+	addr, port, ok := splitEndpoint("[fe80::1%12]:135")
+	if !ok || addr != "fe80::1%12" || port != 135 {
+		t.Errorf("splitEndpoint(ipv6) = %q, %d, %v", addr, port, ok)
+	}
+	if _, _, ok := splitEndpoint("*:*"); ok {
+		t.Error("splitEndpoint should reject wildcard ports")
+	}
+}
+
+func TestIsLocalAddress(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "192.168.1.1", "172.20.0.1", "0.0.0.0", "::1", "::", "fe80::1%eth0", "fd00::1"} {
+		if !isLocalAddress(addr) {
+			t.Errorf("isLocalAddress(%q) = false, want true", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::1", "not-an-ip"} {
+		if isLocalAddress(addr) {
+			t.Errorf("isLocalAddress(%q) = true, want false", addr)
+		}
+	}
+}
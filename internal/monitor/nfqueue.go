@@ -0,0 +1,558 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/platform"
+)
+
+// nfnetlink_queue protocol constants (linux/netfilter/nfnetlink_queue.h).
+const (
+	nfnlSubsysQueue = 3
+
+	nfqnlMsgPacket  = 0
+	nfqnlMsgVerdict = 1
+	nfqnlMsgConfig  = 2
+
+	nfqaPacketHdr  = 1
+	nfqaVerdictHdr = 1
+	nfqaPayload    = 10
+
+	nfqaCfgCmd    = 1
+	nfqaCfgParams = 2
+	nfqaCfgMask   = 4
+	nfqaCfgFlags  = 5
+
+	nfqnlCfgCmdBind  = 1
+	nfqnlCopyPacket  = 2
+	nfqaCfgFFailOpen = 1
+
+	nfDrop   = 0
+	nfAccept = 1
+
+	// nlaTypeMask strips the nested/byte-order flags from an attribute type.
+	nlaTypeMask = 0x3fff
+
+	// nfqCopyRange is how much of each packet the kernel copies to us; enough
+	// for an IPv6 header plus the transport ports.
+	nfqCopyRange = 128
+)
+
+// NFQueueMonitor intercepts new outbound TCP/UDP connections through an
+// NFQUEUE. Each connection is held in the kernel until the consumer of the
+// event channel reports a decision or the configured timeout expires, at which
+// point the timeout verdict is issued.
+type NFQueueMonitor struct {
+	mu       sync.Mutex
+	running  bool
+	cancel   context.CancelFunc
+	opts     Options
+	fallback Decision
+
+	fdMu    sync.Mutex
+	fd      int
+	pending sync.WaitGroup
+}
+
+// NewNFQueueMonitor creates a new NFQUEUE connection monitor.
+func NewNFQueueMonitor(opts Options) *NFQueueMonitor {
+	return &NFQueueMonitor{opts: opts, fd: -1}
+}
+
+// Start binds the queue, points new outbound connections at it and begins
+// delivering events.
+func (m *NFQueueMonitor) Start() (<-chan ConnectionEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return nil, fmt.Errorf("monitor already running")
+	}
+
+	fallback, err := parseVerdict(m.opts.TimeoutVerdict)
+	if err != nil {
+		return nil, err
+	}
+	m.fallback = fallback
+
+	fd, err := openQueue(m.opts.QueueNum)
+	if err != nil {
+		return nil, err
+	}
+	m.fdMu.Lock()
+	m.fd = fd
+	m.fdMu.Unlock()
+
+	if err := platform.EnableQueue(m.opts.QueueNum); err != nil {
+		m.closeQueue()
+		return nil, fmt.Errorf("failed to enable queue: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.running = true
+
+	events := make(chan ConnectionEvent, 64)
+	go m.readLoop(ctx, fd, events)
+
+	return events, nil
+}
+
+// Stop removes the queue rule and releases every held connection with the
+// timeout verdict.
+func (m *NFQueueMonitor) Stop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running {
+		return fmt.Errorf("monitor not running")
+	}
+
+	err := platform.DisableQueue()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.running = false
+
+	if err != nil {
+		return fmt.Errorf("failed to disable queue: %w", err)
+	}
+	return nil
+}
+
+// readLoop receives queued packets until the monitor is stopped.
+func (m *NFQueueMonitor) readLoop(ctx context.Context, fd int, events chan<- ConnectionEvent) {
+	defer close(events)
+	defer m.closeQueue()
+
+	buf := make([]byte, 1<<16)
+	for ctx.Err() == nil {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			// Timeouts let us notice cancellation; ENOBUFS means the kernel
+			// dropped messages, which fail-open already let through.
+			if err == syscall.EAGAIN || err == syscall.EINTR || err == syscall.ENOBUFS {
+				continue
+			}
+			logging.LogEvent("error", "nfqueue_error", fmt.Sprintf("NFQUEUE receive failed: %v", err), nil)
+			return
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, msg := range msgs {
+			id, payload, ok := parseNfqPacket(msg)
+			if !ok {
+				continue
+			}
+			m.hold(ctx, id, payload, events)
+		}
+	}
+}
+
+// hold turns a queued packet into a ConnectionEvent and issues its verdict
+// once a decision arrives.
+func (m *NFQueueMonitor) hold(ctx context.Context, id uint32, payload []byte, events chan<- ConnectionEvent) {
+	pkt, ok := decodePacket(payload)
+	if !ok {
+		m.sendVerdict(id, m.fallback)
+		return
+	}
+	if pkt.fragment {
+		// The verdict on the first fragment decides the connection
+		m.sendVerdict(id, DecisionAllow)
+		return
+	}
+
+	appPath, pid := packetOwner(pkt.protocol, pkt.srcPort)
+	reply := make(chan Decision, 1)
+	event := ConnectionEvent{
+		AppPath:   appPath,
+		PID:       pid,
+		Protocol:  pkt.protocol,
+		Direction: "outbound",
+		SrcAddr:   pkt.srcAddr,
+		SrcPort:   pkt.srcPort,
+		DstAddr:   pkt.dstAddr,
+		DstPort:   pkt.dstPort,
+		State:     "NEW",
+		Timestamp: time.Now().Format("2006-01-02 15:04:05"),
+		verdict:   reply,
+	}
+
+	select {
+	case events <- event:
+	default:
+		// The consumer is still busy with earlier connections; don't stall the queue.
+		m.sendVerdict(id, m.fallback)
+		return
+	}
+
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+		decision, timedOut := awaitDecision(ctx, reply, m.opts.Timeout, m.fallback)
+		if timedOut {
+			logging.LogEvent("warning", "connection_timeout",
+				fmt.Sprintf("No decision for %s (%s to %s) within %s, applying %s",
+					event.AppPath, event.Protocol, endpoint(event.DstAddr, event.DstPort), m.opts.Timeout, m.opts.TimeoutVerdict),
+				nil)
+		}
+		m.sendVerdict(id, decision)
+	}()
+}
+
+// awaitDecision waits for the decision on a held connection. Cancelled
+// decisions, timeouts and shutdown all resolve to the fallback verdict; the
+// second result reports whether the timeout expired.
+func awaitDecision(ctx context.Context, reply <-chan Decision, timeout time.Duration, fallback Decision) (Decision, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case d := <-reply:
+		if d == DecisionCancel {
+			return fallback, false
+		}
+		return d, false
+	case <-timer.C:
+		return fallback, true
+	case <-ctx.Done():
+		return fallback, false
+	}
+}
+
+// sendVerdict tells the kernel what to do with a held packet.
+func (m *NFQueueMonitor) sendVerdict(id uint32, d Decision) {
+	m.fdMu.Lock()
+	defer m.fdMu.Unlock()
+
+	if m.fd < 0 {
+		return
+	}
+	_ = syscall.Sendto(m.fd, nfqVerdictMessage(m.opts.QueueNum, id, d), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// closeQueue waits for outstanding verdicts and closes the netlink socket,
+// which also unbinds the queue.
+func (m *NFQueueMonitor) closeQueue() {
+	m.pending.Wait()
+
+	m.fdMu.Lock()
+	defer m.fdMu.Unlock()
+	if m.fd >= 0 {
+		syscall.Close(m.fd)
+		m.fd = -1
+	}
+}
+
+// openQueue opens a netfilter netlink socket and binds it to queue num in
+// copy-packet mode.
+func openQueue(num uint16) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+	// A receive timeout lets the read loop notice when it has been stopped.
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 1}); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("failed to set socket timeout: %w", err)
+	}
+
+	for seq, msg := range nfqConfigMessages(num) {
+		if err := nfqRequest(fd, uint32(seq+1), msg); err != nil {
+			syscall.Close(fd)
+			return -1, fmt.Errorf("failed to configure queue %d: %w", num, err)
+		}
+	}
+	return fd, nil
+}
+
+// nfqRequest sends a config message and waits for the kernel's acknowledgement.
+func nfqRequest(fd int, seq uint32, msg []byte) error {
+	binary.NativeEndian.PutUint32(msg[8:12], seq)
+	if err := syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, syscall.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Type != syscall.NLMSG_ERROR || m.Header.Seq != seq || len(m.Data) < 4 {
+				continue
+			}
+			if errno := int32(binary.NativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+}
+
+// nfqConfigMessages returns the messages that bind a queue, request packet
+// copies and make the kernel accept packets instead of dropping them when our
+// queue overflows.
+func nfqConfigMessages(num uint16) [][]byte {
+	flags := syscall.NLM_F_REQUEST | syscall.NLM_F_ACK
+
+	bind := nfqMessage(nfqnlMsgConfig, uint16(flags), num,
+		nlAttr(nfqaCfgCmd, []byte{nfqnlCfgCmdBind, 0, 0, 0}))
+
+	params := make([]byte, 5)
+	binary.BigEndian.PutUint32(params[0:4], nfqCopyRange)
+	params[4] = nfqnlCopyPacket
+	failOpen := make([]byte, 4)
+	binary.BigEndian.PutUint32(failOpen, nfqaCfgFFailOpen)
+	setup := nfqMessage(nfqnlMsgConfig, uint16(flags), num,
+		nlAttr(nfqaCfgParams, params),
+		nlAttr(nfqaCfgMask, failOpen),
+		nlAttr(nfqaCfgFlags, failOpen))
+
+	return [][]byte{bind, setup}
+}
+
+// nfqVerdictMessage builds the verdict for a held packet.
+func nfqVerdictMessage(num uint16, id uint32, d Decision) []byte {
+	verdict := uint32(nfDrop)
+	if d == DecisionAllow {
+		verdict = nfAccept
+	}
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr[0:4], verdict)
+	binary.BigEndian.PutUint32(hdr[4:8], id)
+	return nfqMessage(nfqnlMsgVerdict, syscall.NLM_F_REQUEST, num, nlAttr(nfqaVerdictHdr, hdr))
+}
+
+// nfqMessage frames attributes as an nfnetlink queue message for queue num.
+func nfqMessage(msgType, flags, num uint16, attrs ...[]byte) []byte {
+	body := []byte{syscall.AF_UNSPEC, 0, byte(num >> 8), byte(num)} // struct nfgenmsg
+	for _, a := range attrs {
+		body = append(body, a...)
+	}
+
+	b := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(body))
+	binary.NativeEndian.PutUint32(b[0:4], uint32(syscall.NLMSG_HDRLEN+len(body)))
+	binary.NativeEndian.PutUint16(b[4:6], nfnlSubsysQueue<<8|msgType)
+	binary.NativeEndian.PutUint16(b[6:8], flags)
+	return append(b, body...)
+}
+
+// nlAttr encodes a netlink attribute, padded to 4 bytes.
+func nlAttr(typ uint16, data []byte) []byte {
+	b := make([]byte, nlAlign(4+len(data)))
+	binary.NativeEndian.PutUint16(b[0:2], uint16(4+len(data)))
+	binary.NativeEndian.PutUint16(b[2:4], typ)
+	copy(b[4:], data)
+	return b
+}
+
+func nlAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+// parseNfqPacket extracts the packet id and payload from a queued packet message.
+func parseNfqPacket(msg syscall.NetlinkMessage) (uint32, []byte, bool) {
+	if msg.Header.Type != nfnlSubsysQueue<<8|nfqnlMsgPacket || len(msg.Data) < 4 {
+		return 0, nil, false
+	}
+
+	var (
+		id      uint32
+		hasID   bool
+		payload []byte
+	)
+	attrs := msg.Data[4:]
+	for len(attrs) >= 4 {
+		l := int(binary.NativeEndian.Uint16(attrs[0:2]))
+		if l < 4 || l > len(attrs) {
+			break
+		}
+		data := attrs[4:l]
+		switch binary.NativeEndian.Uint16(attrs[2:4]) & nlaTypeMask {
+		case nfqaPacketHdr:
+			if len(data) >= 4 {
+				id = binary.BigEndian.Uint32(data[0:4])
+				hasID = true
+			}
+		case nfqaPayload:
+			payload = data
+		}
+		if nlAlign(l) >= len(attrs) {
+			break
+		}
+		attrs = attrs[nlAlign(l):]
+	}
+	return id, payload, hasID
+}
+
+// queuedPacket is the part of a held packet the monitor cares about.
+type queuedPacket struct {
+	protocol string
+	srcAddr  string
+	srcPort  int
+	dstAddr  string
+	dstPort  int
+	fragment bool // a non-first fragment: no transport header, so no ports
+}
+
+// IPv6 extension headers decodePacket walks past (RFC 8200).
+const (
+	ipv6HopByHop    = 0
+	ipv6Routing     = 43
+	ipv6Fragment    = 44
+	ipv6AuthHeader  = 51
+	ipv6DestOptions = 60
+)
+
+// decodePacket reads addresses, protocol and ports from a raw IPv4 or IPv6
+// packet. Only TCP and UDP are recognised. IPv6 extension headers are skipped
+// to reach the transport header. Non-first fragments carry no ports; they are
+// returned with fragment set and only addresses filled in.
+func decodePacket(b []byte) (queuedPacket, bool) {
+	var (
+		proto     byte
+		src, dst  net.IP
+		transport []byte
+		fragment  bool
+	)
+
+	if len(b) == 0 {
+		return queuedPacket{}, false
+	}
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		if ihl < 20 || len(b) < ihl {
+			return queuedPacket{}, false
+		}
+		proto, src, dst, transport = b[9], net.IP(b[12:16]), net.IP(b[16:20]), b[ihl:]
+		fragment = binary.BigEndian.Uint16(b[6:8])&0x1fff != 0
+	case 6:
+		if len(b) < 40 {
+			return queuedPacket{}, false
+		}
+		proto, src, dst, transport = b[6], net.IP(b[8:24]), net.IP(b[24:40]), b[40:]
+		for !fragment {
+			var size int
+			switch proto {
+			case ipv6HopByHop, ipv6Routing, ipv6DestOptions:
+				if len(transport) < 2 {
+					return queuedPacket{}, false
+				}
+				size = (int(transport[1]) + 1) * 8
+			case ipv6AuthHeader:
+				if len(transport) < 2 {
+					return queuedPacket{}, false
+				}
+				size = (int(transport[1]) + 2) * 4
+			case ipv6Fragment:
+				if len(transport) < 8 {
+					return queuedPacket{}, false
+				}
+				size = 8
+				fragment = binary.BigEndian.Uint16(transport[2:4])>>3 != 0
+			default:
+				size = -1
+			}
+			if size < 0 {
+				break
+			}
+			if len(transport) < size {
+				return queuedPacket{}, false
+			}
+			proto, transport = transport[0], transport[size:]
+		}
+	default:
+		return queuedPacket{}, false
+	}
+
+	pkt := queuedPacket{
+		srcAddr:  src.String(),
+		dstAddr:  dst.String(),
+		fragment: fragment,
+	}
+	switch proto {
+	case syscall.IPPROTO_TCP:
+		pkt.protocol = "tcp"
+	case syscall.IPPROTO_UDP:
+		pkt.protocol = "udp"
+	default:
+		return queuedPacket{}, false
+	}
+	if fragment {
+		return pkt, true
+	}
+	if len(transport) < 4 {
+		return queuedPacket{}, false
+	}
+	pkt.srcPort = int(binary.BigEndian.Uint16(transport[0:2]))
+	pkt.dstPort = int(binary.BigEndian.Uint16(transport[2:4]))
+	return pkt, true
+}
+
+// packetOwner resolves the process owning the local end of a held connection
+// by its source port. Dual-stack sockets are listed in the *6 tables even for
+// IPv4 traffic, so both tables are searched.
+func packetOwner(protocol string, localPort int) (string, string) {
+	for _, procFile := range []string{"/proc/net/" + protocol, "/proc/net/" + protocol + "6"} {
+		if inode := findSocketInode(procFile, localPort); inode != "" {
+			return lookupProcessByInode(inode)
+		}
+	}
+	return UnknownApplication, ""
+}
+
+// findSocketInode returns the inode of the socket bound to localPort in a
+// /proc/net table, or "" if there is none.
+func findSocketInode(procFile string, localPort int) string {
+	file, err := os.Open(procFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Skip header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[9] == "0" {
+			continue
+		}
+		local := fields[1]
+		idx := strings.LastIndex(local, ":")
+		if idx < 0 || hexToInt(local[idx+1:]) != localPort {
+			continue
+		}
+		return fields[9]
+	}
+	return ""
+}
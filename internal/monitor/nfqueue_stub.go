@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package monitor
+
+import "fmt"
+
+// NFQueueMonitor stub for non-Linux platforms.
+type NFQueueMonitor struct{}
+
+func NewNFQueueMonitor(opts Options) *NFQueueMonitor {
+	_ = opts
+	return &NFQueueMonitor{}
+}
+
+func (m *NFQueueMonitor) Start() (<-chan ConnectionEvent, error) {
+	return nil, fmt.Errorf("nfqueue monitor not available on this platform")
+}
+
+func (m *NFQueueMonitor) Stop() error {
+	return fmt.Errorf("nfqueue monitor not available on this platform")
+}
@@ -0,0 +1,191 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"context"
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDecodePacket_IPv4TCP(t *testing.T) {
+	pkt := make([]byte, 24)
+	pkt[0] = 0x45 // IPv4, 20-byte header
+	pkt[9] = syscall.IPPROTO_TCP
+	copy(pkt[12:16], []byte{192, 168, 1, 10})
+	copy(pkt[16:20], []byte{93, 184, 216, 34})
+	binary.BigEndian.PutUint16(pkt[20:22], 50000)
+	binary.BigEndian.PutUint16(pkt[22:24], 443)
+
+	got, ok := decodePacket(pkt)
+	if !ok {
+		t.Fatal("expected packet to decode")
+	}
+	want := queuedPacket{protocol: "tcp", srcAddr: "192.168.1.10", srcPort: 50000, dstAddr: "93.184.216.34", dstPort: 443}
+	if got != want {
+		t.Errorf("decodePacket() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodePacket_IPv6UDP(t *testing.T) {
+	pkt := make([]byte, 44)
+	pkt[0] = 0x60
+	pkt[6] = syscall.IPPROTO_UDP
+	pkt[23] = 1 // ::1
+	pkt[39] = 1 // ::1
+	binary.BigEndian.PutUint16(pkt[40:42], 40000)
+	binary.BigEndian.PutUint16(pkt[42:44], 53)
+
+	got, ok := decodePacket(pkt)
+	if !ok {
+		t.Fatal("expected packet to decode")
+	}
+	if got.protocol != "udp" || got.srcAddr != "::1" || got.dstPort != 53 || got.srcPort != 40000 {
+		t.Errorf("unexpected packet: %+v", got)
+	}
+}
+
+func TestDecodePacket_IPv6ExtensionHeaders(t *testing.T) {
+	// Hop-by-hop options (8 bytes), then destination options (16 bytes), then TCP.
+	pkt := make([]byte, 40+8+16+4)
+	pkt[0] = 0x60
+	pkt[6] = ipv6HopByHop
+	pkt[40] = ipv6DestOptions
+	pkt[48] = syscall.IPPROTO_TCP
+	pkt[49] = 1 // (1+1)*8 bytes
+	binary.BigEndian.PutUint16(pkt[64:66], 41000)
+	binary.BigEndian.PutUint16(pkt[66:68], 443)
+
+	got, ok := decodePacket(pkt)
+	if !ok || got.protocol != "tcp" || got.srcPort != 41000 || got.dstPort != 443 || got.fragment {
+		t.Fatalf("decodePacket() = %+v, %v", got, ok)
+	}
+
+	// A truncated extension header does not decode.
+	if _, ok := decodePacket(pkt[:52]); ok {
+		t.Error("truncated extension header should not decode")
+	}
+}
+
+func TestDecodePacket_Fragments(t *testing.T) {
+	// First IPv6 fragment: the fragment header is followed by the UDP header.
+	first := make([]byte, 40+8+4)
+	first[0] = 0x60
+	first[6] = ipv6Fragment
+	first[40] = syscall.IPPROTO_UDP
+	binary.BigEndian.PutUint16(first[42:44], 0x0001) // offset 0, more fragments
+	binary.BigEndian.PutUint16(first[48:50], 5353)
+	binary.BigEndian.PutUint16(first[50:52], 53)
+	got, ok := decodePacket(first)
+	if !ok || got.fragment || got.srcPort != 5353 || got.dstPort != 53 {
+		t.Errorf("first IPv6 fragment = %+v, %v", got, ok)
+	}
+
+	later := append([]byte(nil), first...)
+	binary.BigEndian.PutUint16(later[42:44], 185<<3) // offset 1480
+	if got, ok := decodePacket(later); !ok || !got.fragment || got.srcPort != 0 {
+		t.Errorf("later IPv6 fragment = %+v, %v", got, ok)
+	}
+
+	v4 := make([]byte, 28)
+	v4[0] = 0x45
+	v4[9] = syscall.IPPROTO_UDP
+	binary.BigEndian.PutUint16(v4[6:8], 185) // offset 1480 bytes
+	if got, ok := decodePacket(v4); !ok || !got.fragment || got.protocol != "udp" || got.dstPort != 0 {
+		t.Errorf("later IPv4 fragment = %+v, %v", got, ok)
+	}
+}
+
+func TestDecodePacket_RejectsUnsupported(t *testing.T) {
+	icmp := make([]byte, 28)
+	icmp[0] = 0x45
+	icmp[9] = syscall.IPPROTO_ICMP
+	if _, ok := decodePacket(icmp); ok {
+		t.Error("ICMP should not decode")
+	}
+	if _, ok := decodePacket([]byte{0x45, 0}); ok {
+		t.Error("truncated packet should not decode")
+	}
+}
+
+func TestParseNfqPacket(t *testing.T) {
+	hdr := make([]byte, 7) // packet_id, hw_protocol, hook
+	binary.BigEndian.PutUint32(hdr[0:4], 42)
+	payload := []byte{0x45, 1, 2, 3, 4}
+
+	raw := nfqMessage(nfqnlMsgPacket, 0, 100, nlAttr(nfqaPacketHdr, hdr), nlAttr(nfqaPayload, payload))
+	msgs, err := syscall.ParseNetlinkMessage(raw)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ParseNetlinkMessage: %v (%d messages)", err, len(msgs))
+	}
+
+	id, got, ok := parseNfqPacket(msgs[0])
+	if !ok || id != 42 {
+		t.Fatalf("parseNfqPacket() id=%d ok=%v, want 42 true", id, ok)
+	}
+	if string(got) != string(payload) {
+		t.Errorf("payload = %v, want %v", got, payload)
+	}
+}
+
+func TestNfqVerdictMessage(t *testing.T) {
+	raw := nfqVerdictMessage(100, 7, DecisionAllow)
+
+	if got := binary.NativeEndian.Uint32(raw[0:4]); int(got) != len(raw) {
+		t.Errorf("length = %d, want %d", got, len(raw))
+	}
+	if got := binary.NativeEndian.Uint16(raw[4:6]); got != nfnlSubsysQueue<<8|nfqnlMsgVerdict {
+		t.Errorf("type = %#x", got)
+	}
+	if got := binary.BigEndian.Uint16(raw[18:20]); got != 100 {
+		t.Errorf("queue = %d, want 100", got)
+	}
+	attr := raw[syscall.NLMSG_HDRLEN+4:]
+	if verdict := binary.BigEndian.Uint32(attr[4:8]); verdict != nfAccept {
+		t.Errorf("verdict = %d, want accept", verdict)
+	}
+	if id := binary.BigEndian.Uint32(attr[8:12]); id != 7 {
+		t.Errorf("id = %d, want 7", id)
+	}
+
+	drop := nfqVerdictMessage(100, 7, DecisionDeny)
+	if verdict := binary.BigEndian.Uint32(drop[syscall.NLMSG_HDRLEN+8 : syscall.NLMSG_HDRLEN+12]); verdict != nfDrop {
+		t.Errorf("verdict = %d, want drop", verdict)
+	}
+}
+
+func TestAwaitDecision(t *testing.T) {
+	ctx := context.Background()
+
+	reply := make(chan Decision, 1)
+	reply <- DecisionDeny
+	if d, timedOut := awaitDecision(ctx, reply, time.Second, DecisionAllow); d != DecisionDeny || timedOut {
+		t.Errorf("answered: got %v timedOut=%v, want deny", d, timedOut)
+	}
+
+	reply <- DecisionCancel
+	if d, _ := awaitDecision(ctx, reply, time.Second, DecisionAllow); d != DecisionAllow {
+		t.Errorf("cancelled: got %v, want fallback allow", d)
+	}
+
+	if d, timedOut := awaitDecision(ctx, reply, 10*time.Millisecond, DecisionDeny); d != DecisionDeny || !timedOut {
+		t.Errorf("timeout: got %v timedOut=%v, want fallback deny", d, timedOut)
+	}
+}
+
+func TestConnectionEvent_Resolve(t *testing.T) {
+	reply := make(chan Decision, 1)
+	event := ConnectionEvent{verdict: reply}
+
+	event.resolve(DecisionAllow)
+	event.resolve(DecisionDeny) // second answer is dropped, not blocked on
+	if d := <-reply; d != DecisionAllow {
+		t.Errorf("got %v, want allow", d)
+	}
+
+	// Observed-only events have nobody waiting.
+	ConnectionEvent{}.resolve(DecisionAllow)
+}
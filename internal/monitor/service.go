@@ -1,12 +1,16 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/platform"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 	"github.com/vhPedroGitHub/firewall/internal/stats"
 )
@@ -35,6 +39,7 @@ type Service struct {
 	store           rules.Store
 	stats           *stats.Collector
 	running         bool
+	stopWatch       context.CancelFunc
 	promptsEnabled  bool
 	eventsMu        sync.RWMutex
 	recentEvts      []ConnectionEventLog
@@ -80,6 +85,15 @@ func (s *Service) Start() error {
 
 	s.running = true
 
+	// Bind processes of per-application rules as they start rather than when
+	// they first connect
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWatch = cancel
+	if err := platform.WatchExec(ctx); err != nil {
+		logging.LogEvent("warning", "exec_watch_unavailable",
+			fmt.Sprintf("New processes are bound to their application rules on first connection only: %v", err), nil)
+	}
+
 	// Process events in background
 	go s.processEvents(events)
 
@@ -97,99 +111,157 @@ func (s *Service) Stop() error {
 		return fmt.Errorf("failed to stop monitor: %w", err)
 	}
 
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
 	s.running = false
 	logging.LogEvent("info", "monitor_stopped", "Connection monitoring stopped", nil)
 	return nil
 }
 
-// processEvents handles incoming connection events.
+// Connections are decided by a fixed pool of workers, so a prompt only holds
+// up the connections queued behind it on its own worker.
+const (
+	decisionWorkers = 8
+	workerBacklog   = 16 // events a worker queues before held ones are released
+)
+
+// processEvents hands incoming connection events to the decision workers.
+// Events of the same flow always go to the same worker and are decided in
+// arrival order, so the answer to one prompt covers the connections of its
+// flow queued behind it instead of prompting for each of them.
 func (s *Service) processEvents(events <-chan ConnectionEvent) {
-	for event := range events {
-		// Track active process
-		s.processesMu.Lock()
-		s.activeProcesses[event.AppPath] = event
-		s.processesMu.Unlock()
-
-		// Track traffic with varying estimates based on connection type
-		// HTTP/HTTPS typically have more download than upload
-		bytesOut := estimateOutboundBytes(event)
-		bytesIn := estimateInboundBytes(event)
-		s.trackTrafficBidirectional(event, bytesOut, bytesIn)
-
-		// Record in stats module
-		if event.AppPath != "" {
-			action := "unknown"
-			rulesList, _ := s.store.ListRules()
-			for _, rule := range rulesList {
-				if rule.Application == event.AppPath {
-					action = rule.Action
-					break
-				}
+	queues := make([]chan ConnectionEvent, decisionWorkers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan ConnectionEvent, workerBacklog)
+		wg.Add(1)
+		go func(queue <-chan ConnectionEvent) {
+			defer wg.Done()
+			for event := range queue {
+				s.processEvent(event)
 			}
+		}(queues[i])
+	}
 
-			s.stats.Record(stats.ConnectionStat{
-				Timestamp:   time.Now(),
-				Application: event.AppPath,
-				Protocol:    event.Protocol,
-				Direction:   event.Direction,
-				BytesSent:   bytesOut,
-				BytesRecv:   bytesIn,
-				Action:      action,
-			})
+	for event := range events {
+		queue := queues[flowWorker(event, len(queues))]
+		select {
+		case queue <- event:
+			continue
+		default:
 		}
-
-		// Log the connection attempt
-		logging.LogEvent("info", "connection_detected",
-			fmt.Sprintf("Connection from %s (%s %s to %s:%d)",
-				event.AppPath, event.Protocol, event.Direction, event.DstAddr, event.DstPort),
-			nil)
-
-		// Handle the connection (check rules and prompt if needed)
-		decision, err := s.handler.HandleConnectionWithPrompts(event, s.promptsEnabled)
-		if err != nil {
-			log.Printf("Error handling connection: %v", err)
-			logging.LogEvent("error", "connection_error",
-				fmt.Sprintf("Failed to handle connection from %s: %v", event.AppPath, err),
+		if event.verdict != nil {
+			// The worker is stuck behind a prompt; let the monitor apply its
+			// timeout verdict now rather than stall every other flow.
+			logging.LogEvent("warning", "connection_backlog",
+				fmt.Sprintf("Too many pending decisions for %s, releasing %s %s to %s",
+					event.AppPath, event.Protocol, event.Direction, endpoint(event.DstAddr, event.DstPort)),
 				nil)
+			event.resolve(DecisionCancel)
 			continue
 		}
+		queue <- event
+	}
 
-		// Log the decision
-		action := "denied"
-		if decision == DecisionAllow {
-			action = "allowed"
-		} else if decision == DecisionCancel {
-			action = "cancelled"
-		}
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+}
 
-		logging.LogEvent("info", "connection_"+action,
-			fmt.Sprintf("Connection %s: %s (%s %s to %s:%d)",
-				action, event.AppPath, event.Protocol, event.Direction, event.DstAddr, event.DstPort),
-			nil)
+// flowWorker picks the worker for an event's flow: the application, protocol,
+// direction and service port, which is what a rule saved from a prompt covers.
+func flowWorker(event ConnectionEvent, workers int) int {
+	port := event.DstPort
+	if event.Direction == "inbound" {
+		port = event.SrcPort
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d", event.AppPath, event.Protocol, event.Direction, port)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// processEvent records a connection event and decides it.
+func (s *Service) processEvent(event ConnectionEvent) {
+	// Track active process
+	s.processesMu.Lock()
+	s.activeProcesses[event.AppPath] = event
+	s.processesMu.Unlock()
 
-		// Track the event
-		ruleName := ""
-		if decision != DecisionCancel {
-			ruleName = fmt.Sprintf("auto_%s_%s_%d",
-				sanitizeForRuleName(event.AppPath),
-				event.Protocol,
-				event.DstPort)
+	// Keep per-application kernel rules in step with newly seen processes
+	if pid, err := strconv.Atoi(event.PID); err == nil {
+		_ = platform.BindProcess(pid, event.AppPath)
+	}
+
+	// Track traffic with varying estimates based on connection type
+	// HTTP/HTTPS typically have more download than upload
+	bytesOut := estimateOutboundBytes(event)
+	bytesIn := estimateInboundBytes(event)
+	s.trackTrafficBidirectional(event, bytesOut, bytesIn)
+
+	// Record in stats module
+	if event.AppPath != "" {
+		// Credit the rule that decides the connection, as the handler finds it
+		action := "unknown"
+		if rule := s.handler.CheckRule(event); rule != nil {
+			action = rule.Action
 		}
-		s.addEventLog(ConnectionEventLog{
-			Event:     event,
-			Decision:  action,
-			Timestamp: time.Now(),
-			RuleName:  ruleName,
+
+		s.stats.Record(stats.ConnectionStat{
+			Timestamp:   time.Now(),
+			Application: event.AppPath,
+			Protocol:    event.Protocol,
+			Direction:   event.Direction,
+			BytesSent:   bytesOut,
+			BytesRecv:   bytesIn,
+			Action:      action,
 		})
+	}
 
-		// Save the decision as a rule for future connections
-		if err := s.handler.SaveDecisionAsRule(event, decision); err != nil {
-			log.Printf("Error saving rule: %v", err)
-			logging.LogEvent("error", "rule_save_error",
-				fmt.Sprintf("Failed to save rule for %s: %v", event.AppPath, err),
-				nil)
-		}
+	// Log the connection attempt
+	logging.LogEvent("info", "connection_detected",
+		fmt.Sprintf("Connection from %s (%s %s to %s)",
+			event.AppPath, event.Protocol, event.Direction, endpoint(event.DstAddr, event.DstPort)),
+		nil)
+
+	// Handle the connection (check rules and prompt if needed)
+	decision, err := s.handler.HandleConnectionWithPrompts(event, s.promptsEnabled)
+	if err != nil {
+		log.Printf("Error handling connection: %v", err)
+		logging.LogEvent("error", "connection_error",
+			fmt.Sprintf("Failed to handle connection from %s: %v", event.AppPath, err),
+			nil)
+		event.resolve(DecisionCancel)
+		return
+	}
+	event.resolve(decision)
+
+	// Log the decision
+	action := "denied"
+	if decision == DecisionAllow {
+		action = "allowed"
+	} else if decision == DecisionCancel {
+		action = "cancelled"
+	}
+
+	logging.LogEvent("info", "connection_"+action,
+		fmt.Sprintf("Connection %s: %s (%s %s to %s)",
+			action, event.AppPath, event.Protocol, event.Direction, endpoint(event.DstAddr, event.DstPort)),
+		nil)
+
+	// Track the event with the rule that decided it, which includes a rule
+	// just saved from the prompt
+	ruleName := ""
+	if rule := s.handler.CheckRule(event); rule != nil {
+		ruleName = rule.Name
 	}
+	s.addEventLog(ConnectionEventLog{
+		Event:     event,
+		Decision:  action,
+		Timestamp: time.Now(),
+		RuleName:  ruleName,
+	})
 }
 
 // addEventLog adds an event to the recent events list.
@@ -228,6 +300,12 @@ func (s *Service) IsRunning() bool {
 	return s.running
 }
 
+// SetScope limits the rules the service enforces to those scope returns and
+// adds rules created from prompts to it. Call it before Start.
+func (s *Service) SetScope(scope Scope) {
+	s.handler.Scope = scope
+}
+
 // EnablePrompts enables automatic user prompts for unknown connections.
 func (s *Service) EnablePrompts() {
 	s.promptsEnabled = true
@@ -370,72 +448,38 @@ func estimateInboundBytes(event ConnectionEvent) int64 {
 
 // UpdateRuleTrafficPermissions creates or updates a rule to allow/deny upload/download for an app.
 func (s *Service) UpdateRuleTrafficPermissions(appPath string, allowUpload, allowDownload bool) error {
-	// Get existing rules for this app
-	rulesList, err := s.store.ListRules()
-	if err != nil {
-		return fmt.Errorf("failed to list rules: %w", err)
-	}
-
-	// Remove old auto-generated rules for this app
-	for _, rule := range rulesList {
-		if rule.Application == appPath && (rule.Name == fmt.Sprintf("auto_%s_outbound", sanitizeForRuleName(appPath)) ||
-			rule.Name == fmt.Sprintf("auto_%s_inbound", sanitizeForRuleName(appPath))) {
-			s.store.DeleteRule(rule.Name)
+	verdict := func(allow bool) string {
+		if allow {
+			return "allow"
 		}
+		return "deny"
 	}
-
-	// Create outbound rule (upload)
-	if allowUpload {
-		outboundRule := rules.Rule{
-			Name:        fmt.Sprintf("auto_%s_outbound", sanitizeForRuleName(appPath)),
+	name := sanitizeForRuleName(appPath)
+	// Saving upserts the auto-generated rules by name, so both directions
+	// are replaced together or, on failure, left as they were.
+	updated := []rules.Rule{
+		{
+			Name:        fmt.Sprintf("auto_%s_outbound", name),
 			Application: appPath,
-			Action:      "allow",
+			Action:      verdict(allowUpload),
 			Protocol:    "any",
 			Direction:   "outbound",
 			Ports:       []int{},
-		}
-		if err := s.store.SaveRule(outboundRule); err != nil {
-			return fmt.Errorf("failed to save outbound rule: %w", err)
-		}
-	} else {
-		outboundRule := rules.Rule{
-			Name:        fmt.Sprintf("auto_%s_outbound", sanitizeForRuleName(appPath)),
+		},
+		{
+			Name:        fmt.Sprintf("auto_%s_inbound", name),
 			Application: appPath,
-			Action:      "deny",
-			Protocol:    "any",
-			Direction:   "outbound",
-			Ports:       []int{},
-		}
-		if err := s.store.SaveRule(outboundRule); err != nil {
-			return fmt.Errorf("failed to save outbound rule: %w", err)
-		}
-	}
-
-	// Create inbound rule (download)
-	if allowDownload {
-		inboundRule := rules.Rule{
-			Name:        fmt.Sprintf("auto_%s_inbound", sanitizeForRuleName(appPath)),
-			Application: appPath,
-			Action:      "allow",
-			Protocol:    "any",
-			Direction:   "inbound",
-			Ports:       []int{},
-		}
-		if err := s.store.SaveRule(inboundRule); err != nil {
-			return fmt.Errorf("failed to save inbound rule: %w", err)
-		}
-	} else {
-		inboundRule := rules.Rule{
-			Name:        fmt.Sprintf("auto_%s_inbound", sanitizeForRuleName(appPath)),
-			Application: appPath,
-			Action:      "deny",
+			Action:      verdict(allowDownload),
 			Protocol:    "any",
 			Direction:   "inbound",
 			Ports:       []int{},
-		}
-		if err := s.store.SaveRule(inboundRule); err != nil {
-			return fmt.Errorf("failed to save inbound rule: %w", err)
-		}
+		},
+	}
+	if err := rules.SaveAll(context.Background(), s.store, updated); err != nil {
+		return fmt.Errorf("failed to save traffic rules: %w", err)
+	}
+	if err := s.handler.adopt(updated[0].Name, updated[1].Name); err != nil {
+		return err
 	}
 
 	logging.LogEvent("info", "traffic_permissions_updated",
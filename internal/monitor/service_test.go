@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/stats"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 // mockStore is a mock implementation of rules.Store for testing
@@ -89,6 +91,98 @@ func TestService_EventTracking(t *testing.T) {
 	}
 }
 
+func TestService_StatsCreditDecidingRule(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "exact", Application: "/usr/bin/test", Action: "allow", Protocol: "any", Direction: "outbound", Priority: 10},
+		{Name: "bin", Application: "/usr/bin/", Action: "deny", Protocol: "any", Direction: "outbound"},
+	}}
+	svc, err := NewService(store)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc.DisablePrompts()
+
+	events := make(chan ConnectionEvent, 2)
+	events <- ConnectionEvent{AppPath: "/usr/bin/test", Protocol: "tcp", Direction: "outbound", DstAddr: "93.184.216.34", DstPort: 443}
+	events <- ConnectionEvent{AppPath: "/opt/other", Protocol: "tcp", Direction: "outbound", DstAddr: "93.184.216.34", DstPort: 443}
+	close(events)
+	svc.processEvents(events)
+
+	got := svc.stats.Query(stats.Filter{})
+	if len(got) != 2 {
+		t.Fatalf("expected 2 stats, got %+v", got)
+	}
+	// The prefix rule comes first in evaluation order and decides.
+	for _, stat := range got {
+		want := "deny"
+		if stat.Application == "/opt/other" {
+			want = "unknown"
+		}
+		if stat.Action != want {
+			t.Errorf("%s credited with %q, want %q", stat.Application, stat.Action, want)
+		}
+	}
+	recent := svc.GetRecentEvents()
+	if len(recent) != 2 {
+		t.Fatalf("unexpected events %+v", recent)
+	}
+	for _, evt := range recent {
+		if evt.Event.AppPath == "/usr/bin/test" && evt.RuleName != "bin" {
+			t.Errorf("event credited to %q, want bin", evt.RuleName)
+		}
+	}
+}
+
+func TestService_PromptDoesNotBlockOtherFlows(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "curl", Application: "/usr/bin/curl", Action: "allow", Protocol: "any", Direction: "outbound"},
+	}}
+	svc, err := NewService(store)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	prompted := make(chan struct{})
+	release := make(chan struct{})
+	svc.handler.Prompt = func(title, message string, options []string) (string, error) {
+		close(prompted)
+		<-release
+		return "Deny once", nil
+	}
+
+	unknown := make(chan Decision, 1)
+	known := make(chan Decision, 1)
+	first := ConnectionEvent{AppPath: "/usr/bin/unknown", Protocol: "tcp", Direction: "outbound", DstAddr: "93.184.216.34", DstPort: 443, verdict: unknown}
+	second := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstAddr: "93.184.216.34", DstPort: 443, verdict: known}
+	if flowWorker(first, decisionWorkers) == flowWorker(second, decisionWorkers) {
+		t.Fatal("test flows share a worker")
+	}
+	events := make(chan ConnectionEvent, 2)
+	events <- first
+	events <- second
+	close(events)
+	done := make(chan struct{})
+	go func() {
+		svc.processEvents(events)
+		close(done)
+	}()
+
+	<-prompted
+	select {
+	case d := <-known:
+		if d != DecisionAllow {
+			t.Errorf("curl decided %v, want allow", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a pending prompt held up another flow")
+	}
+
+	close(release)
+	<-done
+	if d := <-unknown; d != DecisionDeny {
+		t.Errorf("prompted connection decided %v, want deny", d)
+	}
+}
+
 func TestService_PromptsControl(t *testing.T) {
 	store := &mockStore{}
 	svc, err := NewService(store)
@@ -228,3 +322,37 @@ func TestService_EventLogLimit(t *testing.T) {
 		t.Errorf("Expected last event port to be 149, got %d", events[len(events)-1].Event.DstPort)
 	}
 }
+
+func TestService_UpdateRuleTrafficPermissions(t *testing.T) {
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	store, err := rules.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	svc, err := NewService(store)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+
+	if err := svc.UpdateRuleTrafficPermissions("/usr/bin/app", true, false); err != nil {
+		t.Fatalf("UpdateRuleTrafficPermissions: %v", err)
+	}
+	if err := svc.UpdateRuleTrafficPermissions("/usr/bin/app", false, true); err != nil {
+		t.Fatalf("UpdateRuleTrafficPermissions: %v", err)
+	}
+	list, _ := store.ListRules()
+	if len(list) != 2 {
+		t.Fatalf("expected the two auto rules to be replaced, got %+v", list)
+	}
+	up, down, err := svc.GetRulePermissions("/usr/bin/app")
+	if err != nil {
+		t.Fatalf("GetRulePermissions: %v", err)
+	}
+	if up || !down {
+		t.Errorf("permissions = upload %v, download %v; want false, true", up, down)
+	}
+}
@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Trace explains how the handler decides a connection.
+type Trace struct {
+	Event    ConnectionEvent
+	Decision Decision
+	// Rule is the first rule in evaluation order that matches, or nil.
+	Rule *rules.Rule
+	// Mismatch is set when Rule pins an identity the executable fails; the
+	// rule then decides nothing and the connection is treated as unknown.
+	Mismatch string
+	// Prompt is set when no rule decides: the user is asked when prompts are
+	// enabled, and the connection is denied otherwise.
+	Prompt bool
+	// Skipped lists the rules evaluated before Rule and why each failed.
+	Skipped []TraceStep
+	// Reason sums up the decision.
+	Reason string
+}
+
+// TraceStep is a rule that did not match a traced connection.
+type TraceStep struct {
+	Rule   string
+	Reason string
+}
+
+// Trace runs a connection through the same rules and matching as
+// HandleConnectionWithPrompts without prompting, saving or resolving
+// anything, and reports which rule decides it and why the others did not.
+func (h *DefaultHandler) Trace(event ConnectionEvent) (*Trace, error) {
+	existingRules, err := h.evaluationOrder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %w", err)
+	}
+
+	t := &Trace{Event: event, Decision: DecisionDeny}
+	for _, rule := range existingRules {
+		if reason := ruleMismatch(event, rule); reason != "" {
+			t.Skipped = append(t.Skipped, TraceStep{Rule: rule.Name, Reason: reason})
+			continue
+		}
+		rule := rule
+		t.Rule = &rule
+		if mismatch := identityMismatch(event, rule); mismatch != "" {
+			t.Mismatch = mismatch
+			t.Prompt = true
+			t.Reason = fmt.Sprintf("executable does not match rule %q (%s); the user is asked, or it is denied when prompts are off", rule.Name, mismatch)
+			return t, nil
+		}
+		verb := "denies"
+		if rule.Action == "allow" {
+			t.Decision = DecisionAllow
+			verb = "allows"
+		}
+		t.Reason = fmt.Sprintf("rule %q %s it", rule.Name, verb)
+		if rules.IsCatchAll(rule) {
+			t.Reason = fmt.Sprintf("no rule matches and the default %s policy %s it", rule.Direction, verb)
+		}
+		return t, nil
+	}
+
+	t.Prompt = true
+	if len(existingRules) == 0 {
+		t.Reason = "no rules are enforced; the user is asked, or it is denied when prompts are off"
+	} else {
+		t.Reason = fmt.Sprintf("none of %d rule(s) matches; the user is asked, or it is denied when prompts are off", len(existingRules))
+	}
+	return t, nil
+}
@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestDefaultHandler_Trace(t *testing.T) {
+	store := &mockStore{rules: []rules.Rule{
+		{Name: "dns", Application: "any", Action: "allow", Protocol: "udp", Direction: "outbound", Ports: []int{53}},
+		{Name: "web", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{80}, Priority: -1},
+		{Name: "block-curl", Application: "/usr/bin/curl", Action: "deny", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+	}}
+	handler := NewDefaultHandler(store)
+
+	event := ConnectionEvent{AppPath: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", DstAddr: "1.2.3.4", DstPort: 443}
+	tr, err := handler.Trace(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Decision != DecisionDeny || tr.Prompt || tr.Rule == nil || tr.Rule.Name != "block-curl" {
+		t.Fatalf("trace = %+v", tr)
+	}
+	if len(tr.Skipped) != 1 || tr.Skipped[0].Rule != "web" || tr.Skipped[0].Reason != "remote port 443 is not in 80" {
+		t.Fatalf("skipped = %+v", tr.Skipped)
+	}
+	if decision, _ := handler.HandleConnectionWithPrompts(event, false); decision != tr.Decision {
+		t.Fatalf("handler decided %v, trace %v", decision, tr.Decision)
+	}
+
+	event.AppPath = "/usr/bin/wget"
+	tr, err = handler.Trace(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Prompt || tr.Rule != nil || !strings.Contains(tr.Reason, "none of 3 rule(s) matches") {
+		t.Fatalf("trace = %+v", tr)
+	}
+	if len(tr.Skipped) != 3 || tr.Skipped[0].Reason != "application /usr/bin/wget does not match /usr/bin/curl" ||
+		tr.Skipped[2].Rule != "dns" || tr.Skipped[2].Reason != "protocol tcp is not udp" {
+		t.Fatalf("skipped = %+v", tr.Skipped)
+	}
+}
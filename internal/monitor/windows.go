@@ -8,7 +8,6 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
-	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -106,13 +105,11 @@ func (m *WindowsMonitor) checkConnections(events chan<- ConnectionEvent) {
 		line := scanner.Text()
 		if event := m.parseNetstatLine(line); event != nil {
 			// Create a unique key for this connection
-			key := fmt.Sprintf("%s|%s|%s:%d|%s:%d",
+			key := fmt.Sprintf("%s|%s|%s|%s",
 				event.AppPath,
 				event.Protocol,
-				event.SrcAddr,
-				event.SrcPort,
-				event.DstAddr,
-				event.DstPort,
+				endpoint(event.SrcAddr, event.SrcPort),
+				endpoint(event.DstAddr, event.DstPort),
 			)
 
 			m.mu.Lock()
@@ -147,25 +144,13 @@ func (m *WindowsMonitor) parseNetstatLine(line string) *ConnectionEvent {
 		return nil
 	}
 
-	// Parse local address
-	localParts := strings.Split(fields[1], ":")
-	if len(localParts) != 2 {
+	// Parse local and foreign addresses; IPv6 endpoints look like [::1]:443
+	srcAddr, srcPort, ok := splitEndpoint(fields[1])
+	if !ok {
 		return nil
 	}
-	srcAddr := localParts[0]
-	srcPort, err := strconv.Atoi(localParts[1])
-	if err != nil {
-		return nil
-	}
-
-	// Parse foreign address
-	foreignParts := strings.Split(fields[2], ":")
-	if len(foreignParts) != 2 {
-		return nil
-	}
-	dstAddr := foreignParts[0]
-	dstPort, err := strconv.Atoi(foreignParts[1])
-	if err != nil {
+	dstAddr, dstPort, ok := splitEndpoint(fields[2])
+	if !ok {
 		return nil
 	}
 
@@ -179,9 +164,9 @@ func (m *WindowsMonitor) parseNetstatLine(line string) *ConnectionEvent {
 
 	// Determine direction (simplified - outbound if destination is not local)
 	direction := "outbound"
-	if !strings.HasPrefix(dstAddr, "192.168.") && !strings.HasPrefix(dstAddr, "10.") && !strings.HasPrefix(dstAddr, "172.") {
+	if !isLocalAddress(dstAddr) {
 		direction = "outbound"
-	} else if !strings.HasPrefix(srcAddr, "192.168.") && !strings.HasPrefix(srcAddr, "10.") && !strings.HasPrefix(srcAddr, "172.") {
+	} else if !isLocalAddress(srcAddr) {
 		direction = "inbound"
 	}
 
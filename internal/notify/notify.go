@@ -35,3 +35,16 @@ func Show(title, message string) (string, error) {
 		return "no", fmt.Errorf("notifications not supported on %s", runtime.GOOS)
 	}
 }
+
+// Choose displays a message with a list of options and returns the option the
+// user picked, or "" when the dialog was dismissed without a choice.
+func Choose(title, message string, options []string) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		return chooseWindows(title, message, options)
+	case "linux":
+		return chooseLinux(title, message, options)
+	default:
+		return "", fmt.Errorf("notifications not supported on %s", runtime.GOOS)
+	}
+}
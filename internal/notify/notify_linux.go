@@ -6,6 +6,7 @@ package notify
 import (
 	"fmt"
 	"os/exec"
+	"strings"
 )
 
 // promptLinux uses zenity for interactive dialog on Linux.
@@ -41,6 +42,23 @@ func showLinux(title, message string) (string, error) {
 	return "no", fmt.Errorf("notification failed: %w", err)
 }
 
+// chooseLinux uses a zenity list dialog on Linux.
+func chooseLinux(title, message string, options []string) (string, error) {
+	args := []string{"--list", fmt.Sprintf("--title=%s", title), fmt.Sprintf("--text=%s", message), "--column=Action", "--hide-header"}
+	cmd := exec.Command("zenity", append(args, options...)...)
+	output, err := cmd.Output()
+	if err == nil {
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	// Exit code 1 means the dialog was cancelled
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return "", nil
+	}
+
+	return "", fmt.Errorf("notification failed: %w", err)
+}
+
 // Windows stubs for Linux builds
 func promptWindows(app string) (bool, error) {
 	return false, fmt.Errorf("Windows prompts not supported on Linux")
@@ -49,3 +67,7 @@ func promptWindows(app string) (bool, error) {
 func showWindows(title, message string) (string, error) {
 	return "no", fmt.Errorf("Windows prompts not supported on Linux")
 }
+
+func chooseWindows(title, message string, options []string) (string, error) {
+	return "", fmt.Errorf("Windows prompts not supported on Linux")
+}
@@ -20,3 +20,11 @@ func promptLinux(app string) (bool, error) {
 func showLinux(title, message string) (string, error) {
 	return "no", fmt.Errorf("not supported on this platform")
 }
+
+func chooseWindows(title, message string, options []string) (string, error) {
+	return "", fmt.Errorf("not supported on this platform")
+}
+
+func chooseLinux(title, message string, options []string) (string, error) {
+	return "", fmt.Errorf("not supported on this platform")
+}
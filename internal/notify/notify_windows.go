@@ -6,6 +6,7 @@ package notify
 import (
 	"fmt"
 	"os/exec"
+	"strings"
 	"syscall"
 )
 
@@ -51,6 +52,26 @@ func showWindows(title, message string) (string, error) {
 	return "no", nil
 }
 
+// chooseWindows shows the options in a single-selection grid view on Windows.
+func chooseWindows(title, message string, options []string) (string, error) {
+	quoted := make([]string, len(options))
+	for i, o := range options {
+		quoted[i] = "'" + strings.ReplaceAll(o, "'", "''") + "'"
+	}
+	heading := strings.ReplaceAll(title+": "+strings.ReplaceAll(message, "\n", " "), "'", "''")
+	script := fmt.Sprintf(`@(%s) | Out-GridView -Title '%s' -OutputMode Single`, strings.Join(quoted, ","), heading)
+	cmd := exec.Command("powershell", "-WindowStyle", "Hidden", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: 0x08000000, // CREATE_NO_WINDOW
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("notification failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // Linux stubs for Windows builds
 func promptLinux(app string) (bool, error) {
 	return false, fmt.Errorf("Linux prompts not supported on Windows")
@@ -59,3 +80,7 @@ func promptLinux(app string) (bool, error) {
 func showLinux(title, message string) (string, error) {
 	return "no", fmt.Errorf("Linux prompts not supported on Windows")
 }
+
+func chooseLinux(title, message string, options []string) (string, error) {
+	return "", fmt.Errorf("Linux prompts not supported on Windows")
+}
@@ -0,0 +1,276 @@
+//go:build linux
+
+package linux
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Application matching modes. With cgroup matching, processes of each bound
+// application are moved into their own cgroup v2 group and rules match on that
+// group, so an "allow firefox" rule only opens the port for firefox. With none,
+// Rule.Application is informational and rules apply to every process.
+const (
+	AppMatchCgroup = "cgroup"
+	AppMatchNone   = "none"
+)
+
+const (
+	cgroupRoot   = "/sys/fs/cgroup"
+	cgroupParent = "firewall"
+)
+
+var appMatch = AppMatchCgroup
+
+// boundPatterns are the application patterns bound by the last BindApplications
+// call, in evaluation order, so BindProcess can place new processes.
+var boundPatterns []rules.AppPattern
+
+// SetAppMatch selects how Rule.Application is enforced ("cgroup" or "none").
+// An empty mode is treated as "cgroup".
+func SetAppMatch(mode string) error {
+	if mode == "" {
+		mode = AppMatchCgroup
+	}
+	switch mode {
+	case AppMatchCgroup, AppMatchNone:
+	default:
+		return fmt.Errorf("unknown linux app match mode: %s", mode)
+	}
+	backendMu.Lock()
+	appMatch = mode
+	backendMu.Unlock()
+
+	// Rules render differently without application matching
+	variant := ""
+	if mode != AppMatchCgroup {
+		variant = "app-match=" + mode
+	}
+	ruleset.SetVariant(variant)
+	return nil
+}
+
+func appMatchEnabled() bool {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return appMatch == AppMatchCgroup
+}
+
+// CgroupPath returns the cgroup v2 path, relative to the cgroup root, that
+// processes of app are placed in. app is an exact path or an application
+// pattern; patterns get a group of their own.
+func CgroupPath(app string) string {
+	sum := sha256.Sum256([]byte(app))
+	return cgroupParent + "/app-" + hex.EncodeToString(sum[:6])
+}
+
+// bindsApplication reports whether a rule is enforced per application in the
+// kernel: exact absolute paths and path patterns are, "any" and bare program
+// names are not.
+func bindsApplication(r rules.Rule) bool {
+	if !appMatchEnabled() || !kernelEnforced(r) {
+		return false
+	}
+	p, err := rules.ParseApplication(r.Application)
+	if err != nil {
+		return false
+	}
+	switch p.Kind {
+	case rules.AppAny:
+		return false
+	case rules.AppExact:
+		return filepath.IsAbs(r.Application)
+	default:
+		return true
+	}
+}
+
+// boundExact returns the exact application paths the rules bind to a cgroup
+// of their own, in list order.
+func boundExact(list []rules.Rule) []string {
+	var exact []string
+	seen := make(map[string]bool)
+	for _, r := range list {
+		if seen[r.Application] || !bindsApplication(r) {
+			continue
+		}
+		seen[r.Application] = true
+		if p, _ := rules.ParseApplication(r.Application); p.Kind == rules.AppExact {
+			exact = append(exact, r.Application)
+		}
+	}
+	return exact
+}
+
+// ruleGroups returns the cgroups a rule must match to reach every process of
+// its application, given the exact paths bound by the rules it is installed
+// with (see boundExact). A process lives in a single group, its exact-path
+// group when a rule binds its path, so a pattern rule also matches the groups
+// of the bound paths it covers: "deny /usr/bin/" still applies to curl after
+// "allow /usr/bin/curl tcp 443" gave curl a group of its own. It returns nil
+// for rules that do not bind their application.
+func ruleGroups(r rules.Rule, exact []string) []string {
+	if !bindsApplication(r) {
+		return nil
+	}
+	groups := []string{CgroupPath(r.Application)}
+	p, _ := rules.ParseApplication(r.Application)
+	if p.Kind == rules.AppExact {
+		return groups
+	}
+	for _, app := range exact {
+		if p.Match(app) {
+			groups = append(groups, CgroupPath(app))
+		}
+	}
+	return groups
+}
+
+// BindApplications creates the cgroup of every application bound by the given
+// rules and moves its running processes into it. A process lives in a single
+// cgroup, so one matching an exact-path rule goes to that rule's group, which
+// the pattern rules covering it match as well (see ruleGroups), and otherwise
+// to the group of the first pattern (in list order) it matches; rules of the
+// other patterns it matches do not apply to it in the kernel. It returns how
+// many processes were moved.
+// Processes started later are moved by WatchExec while the monitor runs, and
+// otherwise only by the next BindApplications or BindProcess; until then they
+// stay in their parent's cgroup and rules bound to their application do not
+// match them. Groups no rule binds any more are removed once they are empty.
+func BindApplications(list []rules.Rule) (int, error) {
+	exact := make(map[string]bool)
+	var patterns []rules.AppPattern
+	seen := make(map[string]bool)
+	for _, r := range list {
+		if !bindsApplication(r) || seen[r.Application] {
+			continue
+		}
+		seen[r.Application] = true
+		p, _ := rules.ParseApplication(r.Application)
+		if p.Kind == rules.AppExact {
+			exact[r.Application] = true
+		} else {
+			patterns = append(patterns, p)
+		}
+	}
+
+	backendMu.Lock()
+	boundPatterns = patterns
+	backendMu.Unlock()
+
+	keep := make(map[string]bool, len(seen))
+	for app := range seen {
+		keep[CgroupPath(app)] = true
+	}
+	removeCgroups(cgroupRoot, keep)
+	if len(seen) == 0 {
+		return 0, nil
+	}
+	for app := range seen {
+		if err := os.MkdirAll(filepath.Join(cgroupRoot, CgroupPath(app)), 0755); err != nil {
+			return 0, fmt.Errorf("create cgroup for %s: %w", app, err)
+		}
+	}
+
+	moved := 0
+	for pid, exe := range runningExecutables() {
+		group := cgroupFor(exe, exact, patterns)
+		if group == "" {
+			continue
+		}
+		if err := writeCgroupProc(group, pid); err != nil {
+			continue // process exited or is not movable
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// cgroupFor picks the group for an executable: its exact-path group first,
+// then the first matching pattern. It returns "" for unbound executables.
+func cgroupFor(exe string, exact map[string]bool, patterns []rules.AppPattern) string {
+	if exact[exe] {
+		return CgroupPath(exe)
+	}
+	for _, p := range patterns {
+		if p.Match(exe) {
+			return CgroupPath(p.Value)
+		}
+	}
+	return ""
+}
+
+// BindProcess moves a single process into its application's cgroup when a rule
+// binds that application, either by exact path or through a pattern bound by
+// the last BindApplications call. Processes of unbound applications are left
+// alone.
+func BindProcess(pid int, app string) error {
+	if !appMatchEnabled() || !filepath.IsAbs(app) {
+		return nil
+	}
+
+	// An existing exact-path group means a rule binds this executable
+	exact := map[string]bool{}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, CgroupPath(app))); err == nil {
+		exact[app] = true
+	}
+	backendMu.RLock()
+	patterns := boundPatterns
+	backendMu.RUnlock()
+
+	group := cgroupFor(app, exact, patterns)
+	if group == "" {
+		return nil
+	}
+	return writeCgroupProc(group, pid)
+}
+
+// removeCgroups deletes the application groups under root that are not in
+// keep, and the parent group when keep is empty. The kernel refuses to remove
+// a group that still holds processes, so those are left for a later call.
+func removeCgroups(root string, keep map[string]bool) {
+	dirs, _ := filepath.Glob(filepath.Join(root, cgroupParent, "app-*"))
+	for _, dir := range dirs {
+		if !keep[cgroupParent+"/"+filepath.Base(dir)] {
+			os.Remove(dir)
+		}
+	}
+	if len(keep) == 0 {
+		os.Remove(filepath.Join(root, cgroupParent))
+	}
+}
+
+func writeCgroupProc(path string, pid int) error {
+	procs := filepath.Join(cgroupRoot, path, "cgroup.procs")
+	return os.WriteFile(procs, []byte(strconv.Itoa(pid)), 0644)
+}
+
+// runningExecutables maps every visible PID to its executable path.
+func runningExecutables() map[int]string {
+	out := make(map[int]string)
+	entries, err := filepath.Glob("/proc/[0-9]*/exe")
+	if err != nil {
+		return out
+	}
+	for _, exePath := range entries {
+		target, err := os.Readlink(exePath)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.Split(exePath, "/")[2])
+		if err != nil {
+			continue
+		}
+		out[pid] = strings.TrimSuffix(target, " (deleted)")
+	}
+	return out
+}
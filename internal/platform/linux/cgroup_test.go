@@ -0,0 +1,184 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestCgroupPath(t *testing.T) {
+	a := CgroupPath("/usr/bin/firefox")
+	if a != CgroupPath("/usr/bin/firefox") {
+		t.Error("CgroupPath should be deterministic")
+	}
+	if a == CgroupPath("/usr/bin/curl") {
+		t.Error("different applications should get different cgroups")
+	}
+	if !strings.HasPrefix(a, "firewall/app-") || len(a) != len("firewall/app-")+12 {
+		t.Errorf("unexpected cgroup path %q", a)
+	}
+}
+
+func TestSetAppMatch(t *testing.T) {
+	defer SetAppMatch(AppMatchCgroup)
+
+	if err := SetAppMatch(AppMatchNone); err != nil {
+		t.Fatalf("SetAppMatch(none): %v", err)
+	}
+	if bindsApplication(rules.Rule{Application: "/usr/bin/firefox"}) {
+		t.Error("no rule should bind an application with matching disabled")
+	}
+	if err := SetAppMatch("selinux"); err == nil {
+		t.Error("expected error for unknown app match mode")
+	}
+
+	// Switching modes must reinstall rules, so it changes their fingerprints.
+	r := rules.Rule{Name: "web", Application: "/usr/bin/firefox", Action: "allow", Protocol: "any", Direction: "outbound"}
+	none := ruleset.Fingerprint(r)
+	SetAppMatch(AppMatchCgroup)
+	if ruleset.Fingerprint(r) == none {
+		t.Error("fingerprint should depend on the app match mode")
+	}
+}
+
+func TestRenderAppAndOwnerMatch(t *testing.T) {
+	defer SetAppMatch(AppMatchCgroup)
+	SetAppMatch(AppMatchCgroup)
+
+	browser := rules.Rule{Name: "web", Application: "/usr/bin/firefox", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}
+	service := rules.Rule{Name: "svc", Application: "postgres", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{5432}, User: "postgres", Group: "999"}
+	path := CgroupPath(browser.Application)
+
+	ipt := strings.Join(iptablesSpecs(browser, nil, false)[0], " ")
+	if !strings.Contains(ipt, "-m cgroup --path "+path) {
+		t.Errorf("iptables spec missing cgroup match: %s", ipt)
+	}
+	if nft := nftRuleExprs(browser, nil)[0]; !strings.Contains(nft, `socket cgroupv2 level 2 "`+path+`"`) {
+		t.Errorf("nft rule missing cgroup match: %s", nft)
+	}
+
+	ipt = strings.Join(iptablesSpecs(service, nil, false)[0], " ")
+	if strings.Contains(ipt, "-m cgroup") {
+		t.Errorf("non-path application should not be bound: %s", ipt)
+	}
+	if !strings.Contains(ipt, "-m owner --uid-owner postgres --gid-owner 999") {
+		t.Errorf("iptables spec missing owner match: %s", ipt)
+	}
+	if nft := nftRuleExprs(service, nil)[0]; !strings.Contains(nft, "meta skuid postgres meta skgid 999") {
+		t.Errorf("nft rule missing owner match: %s", nft)
+	}
+
+	// The cgroup/owner matches only work where the socket owner is known.
+	inbound := browser
+	inbound.Direction = "inbound"
+	if ipt := strings.Join(iptablesSpecs(inbound, nil, false)[0], " "); strings.Contains(ipt, "-m cgroup") {
+		t.Errorf("inbound iptables rule should not match on cgroup: %s", ipt)
+	}
+}
+
+func TestCgroupFor(t *testing.T) {
+	defer SetAppMatch(AppMatchCgroup)
+	SetAppMatch(AppMatchCgroup)
+
+	jvm, _ := rules.ParseApplication("/usr/lib/jvm/")
+	glob, _ := rules.ParseApplication("/usr/lib/*/bin/java")
+	exact := map[string]bool{"/usr/lib/jvm/java-17/bin/java": true}
+	patterns := []rules.AppPattern{jvm, glob}
+
+	if got := cgroupFor("/usr/lib/jvm/java-17/bin/java", exact, patterns); got != CgroupPath("/usr/lib/jvm/java-17/bin/java") {
+		t.Errorf("exact-path rule should claim the process, got %s", got)
+	}
+	if got := cgroupFor("/usr/lib/jvm/java-21/bin/java", exact, patterns); got != CgroupPath("/usr/lib/jvm/") {
+		t.Errorf("first matching pattern should claim the process, got %s", got)
+	}
+	if got := cgroupFor("/usr/bin/curl", exact, patterns); got != "" {
+		t.Errorf("unbound executable should be left alone, got %s", got)
+	}
+
+	for app, want := range map[string]bool{"/usr/lib/jvm/": true, "re:java$": true, "any": false, "postgres": false} {
+		r := rules.Rule{Application: app}
+		if got := bindsApplication(r); got != want {
+			t.Errorf("bindsApplication(%q) = %v, want %v", app, got, want)
+		}
+	}
+}
+
+func TestRuleGroups_ExactInsidePattern(t *testing.T) {
+	defer SetAppMatch(AppMatchCgroup)
+	SetAppMatch(AppMatchCgroup)
+
+	// curl gets a group of its own, so the directory rule evaluated after its
+	// allow rule must match that group too or curl escapes the deny.
+	list := []rules.Rule{
+		{Name: "curl-https", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "usr-bin", Application: "/usr/bin/", Action: "deny", Protocol: "any", Direction: "outbound"},
+		{Name: "opt", Application: "/opt/", Action: "deny", Protocol: "any", Direction: "outbound"},
+	}
+	curl, usrBin, opt := CgroupPath("/usr/bin/curl"), CgroupPath("/usr/bin/"), CgroupPath("/opt/")
+
+	exact := boundExact(list)
+	if got := ruleGroups(list[1], exact); len(got) != 2 || got[0] != usrBin || got[1] != curl {
+		t.Errorf("ruleGroups(usr-bin) = %v, want [%s %s]", got, usrBin, curl)
+	}
+	if got := ruleGroups(list[2], exact); len(got) != 1 || got[0] != opt {
+		t.Errorf("ruleGroups(opt) = %v, want [%s]", got, opt)
+	}
+
+	script := renderIptablesRuleset("*filter\nCOMMIT\n", list, false)
+	want := []string{
+		"-A FIREWALL-OUT -p tcp --dport 443 -m cgroup --path " + curl + " ",
+		"-A FIREWALL-OUT -m cgroup --path " + usrBin + " ",
+		"-A FIREWALL-OUT -m cgroup --path " + curl + " -m comment --comment \"" + ruleset.Tag(list[1]) + "\" -j DROP",
+	}
+	last := -1
+	for _, w := range want {
+		idx := strings.Index(script, w)
+		if idx < 0 || idx < last {
+			t.Fatalf("iptables script missing %q after the previous line:\n%s", w, script)
+		}
+		last = idx
+	}
+
+	nft := RenderNftRuleset(list)
+	allow := strings.Index(nft, `socket cgroupv2 level 2 "`+curl+`" accept`)
+	deny := strings.Index(nft, `socket cgroupv2 level 2 "`+curl+`" drop`)
+	if allow < 0 || deny < allow || !strings.Contains(nft, `socket cgroupv2 level 2 "`+usrBin+`" drop`) {
+		t.Errorf("nft script should deny curl's group after allowing its https traffic:\n%s", nft)
+	}
+}
+
+func TestRemoveCgroups(t *testing.T) {
+	root := t.TempDir()
+	kept, stale, busy := CgroupPath("/usr/bin/curl"), CgroupPath("/usr/bin/wget"), CgroupPath("/usr/bin/ssh")
+	for _, group := range []string{kept, stale, busy} {
+		if err := os.MkdirAll(filepath.Join(root, group), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A group with processes cannot be removed; a file stands in for them.
+	if err := os.WriteFile(filepath.Join(root, busy, "cgroup.procs"), []byte("42"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removeCgroups(root, map[string]bool{kept: true})
+	exists := func(group string) bool {
+		_, err := os.Stat(filepath.Join(root, group))
+		return err == nil
+	}
+	if !exists(kept) || exists(stale) || !exists(busy) {
+		t.Errorf("after bind: kept=%v stale=%v busy=%v, want true false true", exists(kept), exists(stale), exists(busy))
+	}
+
+	os.Remove(filepath.Join(root, busy, "cgroup.procs"))
+	removeCgroups(root, nil)
+	if exists(cgroupParent) {
+		t.Error("teardown should remove every empty group and the parent")
+	}
+}
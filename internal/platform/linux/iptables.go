@@ -0,0 +1,597 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// iptablesHooks maps each built-in chain to the managed chain it jumps into.
+var iptablesHooks = []struct{ builtin, managed string }{
+	{"INPUT", ChainIn},
+	{"OUTPUT", ChainOut},
+}
+
+// iptablesChain returns the managed chain a rule belongs to based on its direction.
+func iptablesChain(r rules.Rule) string {
+	return managedChain(r)
+}
+
+// iptablesRuleSpec builds the match/target part of an iptables rule (everything
+// after -A <chain>) around one of the rule's port matches and cgroups ("" for
+// none).
+func iptablesRuleSpec(r rules.Rule, group string, ports []string) []string {
+	var args []string
+
+	// Protocol
+	if r.Protocol != "any" {
+		args = append(args, "-p", r.Protocol)
+	}
+	args = append(args, ports...)
+
+	// Per-application and per-owner matching. Both rely on the socket owner,
+	// which iptables only knows for locally generated (outbound) packets.
+	if r.Direction == "outbound" {
+		if group != "" {
+			args = append(args, "-m", "cgroup", "--path", group)
+		}
+		if r.User != "" || r.Group != "" {
+			args = append(args, "-m", "owner")
+			if r.User != "" {
+				args = append(args, "--uid-owner", r.User)
+			}
+			if r.Group != "" {
+				args = append(args, "--gid-owner", r.Group)
+			}
+		}
+	}
+
+	// Tag the rule so it can be found again by name and definition
+	args = append(args, "-m", "comment", "--comment", ruleset.Tag(r))
+
+	target := "ACCEPT"
+	if r.Action == "deny" {
+		target = "DROP"
+	}
+	args = append(args, "-j", target)
+
+	return args
+}
+
+// iptablesFamily is one of the address families iptables keeps in separate
+// tables, each managed with its own set of tools.
+type iptablesFamily struct {
+	cmd, save, restore string
+	ipv6               bool
+}
+
+var (
+	iptablesV4 = iptablesFamily{cmd: "iptables", save: "iptables-save", restore: "iptables-restore"}
+	iptablesV6 = iptablesFamily{cmd: "ip6tables", save: "ip6tables-save", restore: "ip6tables-restore", ipv6: true}
+)
+
+// iptablesFamilies returns the families to manage. IPv6 is skipped on hosts
+// where it is disabled or ip6tables is not installed.
+func iptablesFamilies() []iptablesFamily {
+	if _, err := os.Stat("/proc/net/if_inet6"); err != nil {
+		return []iptablesFamily{iptablesV4}
+	}
+	if _, err := exec.LookPath(iptablesV6.save); err != nil {
+		return []iptablesFamily{iptablesV4}
+	}
+	return []iptablesFamily{iptablesV4, iptablesV6}
+}
+
+// iptablesMultiportMax is how many ports a multiport match takes; a range
+// counts as two.
+const iptablesMultiportMax = 15
+
+// iptablesPortMatches renders a rule's port restrictions as alternative match
+// arguments. Lists too long for one multiport match are split into chunks and
+// every combination of source and destination chunk becomes its own rule.
+func iptablesPortMatches(r rules.Rule) [][]string {
+	matches := [][]string{nil}
+	if r.Protocol == "any" {
+		return matches
+	}
+
+	sport, dport := portSides(r)
+	for _, side := range []struct {
+		single, multi string
+		ports         []rules.PortRange
+	}{{"--dport", "--dports", dport}, {"--sport", "--sports", sport}} {
+		chunks := iptablesPortChunks(side.ports)
+		if len(chunks) == 0 {
+			continue
+		}
+		var next [][]string
+		for _, m := range matches {
+			for _, chunk := range chunks {
+				args := append([]string{}, m...)
+				if len(chunk) == 1 {
+					args = append(args, side.single, chunk[0])
+				} else {
+					args = append(args, "-m", "multiport", side.multi, strings.Join(chunk, ","))
+				}
+				next = append(next, args)
+			}
+		}
+		matches = next
+	}
+	return matches
+}
+
+// iptablesPortChunks formats ports in iptables syntax ("443", "1024:65535")
+// grouped so each group fits in a multiport match.
+func iptablesPortChunks(ports []rules.PortRange) [][]string {
+	var (
+		chunks [][]string
+		chunk  []string
+		used   int
+	)
+	for _, p := range ports {
+		entry, cost := strconv.Itoa(p.From), 1
+		if p.To != p.From {
+			entry, cost = fmt.Sprintf("%d:%d", p.From, p.To), 2
+		}
+		if used+cost > iptablesMultiportMax {
+			chunks = append(chunks, chunk)
+			chunk, used = nil, 0
+		}
+		chunk = append(chunk, entry)
+		used += cost
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// iptablesSpecs expands a rule into the specs installed in one address family,
+// one per combination of its local and remote address entries in that family,
+// its port matches and its cgroups; exact holds the paths bound by the rule
+// set (see ruleGroups).
+// It returns nil when the rule's addresses all belong to the other family or
+// the rule is not enforced in the kernel.
+func iptablesSpecs(r rules.Rule, exact []string, ipv6 bool) [][]string {
+	if !kernelEnforced(r) {
+		return nil
+	}
+	local, ok := familyEntries(r.LocalAddresses, ipv6)
+	if !ok {
+		return nil
+	}
+	remote, ok := familyEntries(r.RemoteAddresses, ipv6)
+	if !ok {
+		return nil
+	}
+	if len(local) == 0 {
+		local = []string{""}
+	}
+	if len(remote) == 0 {
+		remote = []string{""}
+	}
+
+	// The cgroup match relies on the socket owner, known for outbound only
+	groups := []string{""}
+	if g := ruleGroups(r, exact); len(g) > 0 && r.Direction == "outbound" {
+		groups = g
+	}
+
+	ports := iptablesPortMatches(r)
+	var specs [][]string
+	if rules.IsCatchAll(r) && r.Action == "deny" {
+		specs = iptablesCatchAllExemptions(r, ipv6)
+	}
+	for _, l := range local {
+		for _, rem := range remote {
+			for _, g := range groups {
+				for _, p := range ports {
+					spec := iptablesAddressArgs(r, l, rem)
+					specs = append(specs, append(spec, iptablesRuleSpec(r, g, p)...))
+				}
+			}
+		}
+	}
+	return specs
+}
+
+// iptablesCatchAllExemptions returns the specs a default-deny catch-all
+// installs ahead of its drop in one address family: replies to connections
+// already let through, loopback traffic, the ICMP errors and IPv6 neighbor
+// discovery the network stack depends on, and DHCP client traffic. They carry
+// the catch-all's tag so they are replaced and removed together with it.
+func iptablesCatchAllExemptions(r rules.Rule, ipv6 bool) [][]string {
+	iface := "-o"
+	if r.Direction == "inbound" {
+		iface = "-i"
+	}
+	tag := []string{"-m", "comment", "--comment", ruleset.Tag(r), "-j", "ACCEPT"}
+	specs := [][]string{
+		{"-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED"},
+		{iface, "lo"},
+	}
+
+	icmp, icmpType, types := "icmp", "--icmp-type", []string{"destination-unreachable", "time-exceeded", "parameter-problem"}
+	client, server := "68", "67"
+	if ipv6 {
+		icmp, icmpType = "ipv6-icmp", "--icmpv6-type"
+		types = []string{"destination-unreachable", "packet-too-big", "time-exceeded", "parameter-problem",
+			"router-solicitation", "router-advertisement", "neighbour-solicitation", "neighbour-advertisement"}
+		client, server = "546", "547"
+	}
+	for _, t := range types {
+		specs = append(specs, []string{"-p", icmp, icmpType, t})
+	}
+	// DHCP replies reach the client port inbound; requests leave from it.
+	sport, dport := client, server
+	if r.Direction == "inbound" {
+		sport, dport = server, client
+	}
+	specs = append(specs, []string{"-p", "udp", "--sport", sport, "--dport", dport})
+
+	for i := range specs {
+		specs[i] = append(specs[i], tag...)
+	}
+	return specs
+}
+
+// iptablesAddressArgs matches the local and remote address entries ("" for
+// any), which map to source or destination depending on the rule direction.
+func iptablesAddressArgs(r rules.Rule, local, remote string) []string {
+	src, dst := local, remote
+	if r.Direction == "inbound" {
+		src, dst = remote, local
+	}
+
+	var args []string
+	for _, m := range []struct{ flag, side, entry string }{{"-s", "src", src}, {"-d", "dst", dst}} {
+		switch {
+		case m.entry == "":
+		case rules.IsRange(m.entry):
+			args = append(args, "-m", "iprange", "--"+m.side+"-range", m.entry)
+		default:
+			args = append(args, m.flag, m.entry)
+		}
+	}
+	return args
+}
+
+// applyIptablesRule appends a firewall rule to its managed chain in every family.
+func applyIptablesRule(r rules.Rule) error {
+	if err := initIptables(); err != nil {
+		return err
+	}
+
+	for _, f := range iptablesFamilies() {
+		for _, spec := range iptablesSpecs(r, nil, f.ipv6) {
+			args := append([]string{"-A", iptablesChain(r)}, spec...)
+			cmd := exec.Command(f.cmd, args...)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("%s failed: %w (output: %s)", f.cmd, err, string(output))
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeIptablesRule deletes every installed entry tagged with the rule name.
+func removeIptablesRule(name string) error {
+	for _, f := range iptablesFamilies() {
+		dump, err := f.dump()
+		if err != nil {
+			return err
+		}
+
+		var b strings.Builder
+		for _, in := range parseIptablesSave(dump) {
+			if in.Name == ruleset.TagName(name) {
+				b.WriteString(iptablesDeleteLine(in.Ref) + "\n")
+			}
+		}
+		if b.Len() == 0 {
+			continue
+		}
+		if err := f.load("*filter\n" + b.String() + "COMMIT\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initIptables creates the managed chains and jump hooks when they are missing.
+func initIptables() error {
+	var tables []iptablesTables
+	for _, f := range iptablesFamilies() {
+		tables = append(tables, f)
+	}
+	return initIptablesTables(tables...)
+}
+
+// initIptablesTables adds the missing managed chains and jump hooks to each
+// filter table.
+func initIptablesTables(tables ...iptablesTables) error {
+	for _, t := range tables {
+		dump, err := t.dump()
+		if err != nil {
+			return err
+		}
+		script := renderIptablesInit(dump)
+		if script == "" {
+			continue
+		}
+		if err := t.load(script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teardownIptables removes the jump hooks, the managed chains and any tagged
+// rule left in the built-in chains by older versions.
+func teardownIptables() error {
+	for _, f := range iptablesFamilies() {
+		dump, err := f.dump()
+		if err != nil {
+			return err
+		}
+		script := renderIptablesTeardown(dump)
+		if script == "" {
+			continue
+		}
+		if err := f.load(script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dump returns the family's current filter table as printed by iptables-save.
+func (f iptablesFamily) dump() (string, error) {
+	output, err := exec.Command(f.save, "-t", "filter").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", f.save, err)
+	}
+	return string(output), nil
+}
+
+// load feeds a script to `iptables-restore --noflush` for the family.
+func (f iptablesFamily) load(script string) error {
+	cmd := exec.Command(f.restore, "--noflush")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w (output: %s)", f.restore, err, string(output))
+	}
+	return nil
+}
+
+// replace replaces the family's filter table with a dump taken by dump.
+func (f iptablesFamily) replace(snapshot string) error {
+	cmd := exec.Command(f.restore, "-T", "filter")
+	cmd.Stdin = strings.NewReader(snapshot)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w (output: %s)", f.restore, err, string(output))
+	}
+	return nil
+}
+
+// parseIptablesSave extracts managed rules from iptables-save output. The
+// reference kept for each entry is the full rule line, which iptables-restore
+// can delete verbatim.
+func parseIptablesSave(dump string) []ruleset.Installed {
+	var out []ruleset.Installed
+	scanner := bufio.NewScanner(strings.NewReader(dump))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		name, fp, ok := ruleset.ParseTag(iptablesComment(line))
+		if !ok {
+			continue
+		}
+		out = append(out, ruleset.Installed{Name: name, Fingerprint: fp, Ref: line})
+	}
+	return out
+}
+
+// iptablesComment returns the comment of an iptables-save rule line, or "".
+func iptablesComment(line string) string {
+	args := iptablesArgs(line)
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--comment" {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// iptablesArgs splits an iptables-save rule line into arguments the way
+// iptables-restore does: double quotes group words and, inside them, a
+// backslash escapes the next character.
+func iptablesArgs(line string) []string {
+	var (
+		args   []string
+		cur    strings.Builder
+		inArg  bool
+		quoted bool
+	)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// iptablesQuote quotes an argument for iptables-restore, as iptables-save
+// prints it.
+func iptablesQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// iptablesSaveState summarises which of our objects exist in an iptables-save dump.
+type iptablesSaveState struct {
+	chains map[string]bool   // managed chains that are declared
+	hooks  map[string]string // built-in chain -> exact jump line
+}
+
+func parseIptablesState(dump string) iptablesSaveState {
+	state := iptablesSaveState{chains: map[string]bool{}, hooks: map[string]string{}}
+	scanner := bufio.NewScanner(strings.NewReader(dump))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for _, h := range iptablesHooks {
+			if strings.HasPrefix(line, ":"+h.managed+" ") {
+				state.chains[h.managed] = true
+			}
+			if strings.HasPrefix(line, "-A "+h.builtin+" ") && strings.HasSuffix(line, "-j "+h.managed) {
+				state.hooks[h.builtin] = line
+			}
+		}
+	}
+	return state
+}
+
+// renderIptablesInit returns the restore script that adds whatever managed
+// chains and jumps are missing, or "" when everything is in place. Existing
+// chains are not redeclared because iptables-restore would flush them.
+func renderIptablesInit(dump string) string {
+	state := parseIptablesState(dump)
+
+	var b strings.Builder
+	for _, h := range iptablesHooks {
+		if !state.chains[h.managed] {
+			fmt.Fprintf(&b, ":%s - [0:0]\n", h.managed)
+		}
+	}
+	for _, h := range iptablesHooks {
+		if _, ok := state.hooks[h.builtin]; !ok {
+			fmt.Fprintf(&b, "-I %s 1 -j %s\n", h.builtin, h.managed)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "*filter\n" + b.String() + "COMMIT\n"
+}
+
+// renderIptablesTeardown returns the restore script that removes every trace of
+// the tool from the filter table, or "" when nothing is installed.
+func renderIptablesTeardown(dump string) string {
+	state := parseIptablesState(dump)
+
+	var b strings.Builder
+	for _, h := range iptablesHooks {
+		if line, ok := state.hooks[h.builtin]; ok {
+			b.WriteString(iptablesDeleteLine(line) + "\n")
+		}
+	}
+	for _, in := range parseIptablesSave(dump) {
+		if !isManagedChainLine(in.Ref) {
+			b.WriteString(iptablesDeleteLine(in.Ref) + "\n")
+		}
+	}
+	for _, h := range iptablesHooks {
+		if state.chains[h.managed] {
+			fmt.Fprintf(&b, "-F %s\n-X %s\n", h.managed, h.managed)
+		}
+	}
+	b.WriteString(iptablesQueueCleanup(dump))
+	if b.Len() == 0 {
+		return ""
+	}
+	return "*filter\n" + b.String() + "COMMIT\n"
+}
+
+// renderIptablesRuleset renders an iptables-restore --noflush script that
+// replaces the contents of the managed chains with the desired rules, in order,
+// installs missing jumps and drops tagged rules left in the built-in chains.
+// Declaring the managed chains flushes them, and everything happens inside a
+// single COMMIT so the kernel swaps the table atomically.
+func renderIptablesRuleset(dump string, desired []rules.Rule, ipv6 bool) string {
+	state := parseIptablesState(dump)
+
+	var b strings.Builder
+	b.WriteString("*filter\n")
+	for _, h := range iptablesHooks {
+		fmt.Fprintf(&b, ":%s - [0:0]\n", h.managed)
+	}
+	exact := boundExact(desired)
+	for _, r := range desired {
+		for _, line := range iptablesRestoreLines(r, exact, ipv6) {
+			b.WriteString(line + "\n")
+		}
+	}
+	for _, h := range iptablesHooks {
+		if _, ok := state.hooks[h.builtin]; !ok {
+			fmt.Fprintf(&b, "-I %s 1 -j %s\n", h.builtin, h.managed)
+		}
+	}
+	for _, in := range parseIptablesSave(dump) {
+		if !isManagedChainLine(in.Ref) {
+			b.WriteString(iptablesDeleteLine(in.Ref) + "\n")
+		}
+	}
+	b.WriteString("COMMIT\n")
+	return b.String()
+}
+
+// isManagedChainLine reports whether an iptables-save rule line belongs to a managed chain.
+func isManagedChainLine(line string) bool {
+	for _, h := range iptablesHooks {
+		if strings.HasPrefix(line, "-A "+h.managed+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// iptablesDeleteLine turns an iptables-save append line into the matching delete.
+func iptablesDeleteLine(line string) string {
+	return "-D " + strings.TrimPrefix(line, "-A ")
+}
+
+// iptablesRestoreLines formats a rule as iptables-restore append lines for one family.
+func iptablesRestoreLines(r rules.Rule, exact []string, ipv6 bool) []string {
+	var lines []string
+	for _, spec := range iptablesSpecs(r, exact, ipv6) {
+		for i, arg := range spec {
+			if i > 0 && spec[i-1] == "--comment" {
+				spec[i] = iptablesQuote(arg)
+			}
+		}
+		lines = append(lines, "-A "+iptablesChain(r)+" "+strings.Join(spec, " "))
+	}
+	return lines
+}
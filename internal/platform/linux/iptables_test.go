@@ -0,0 +1,325 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestIptablesRuleSpec(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	r := rules.Rule{
+		Name:        "web",
+		Application: "/usr/bin/curl",
+		Action:      "allow",
+		Protocol:    "tcp",
+		Direction:   "outbound",
+		Ports:       []int{80, 443},
+	}
+
+	got := strings.Join(iptablesRuleSpec(r, "", iptablesPortMatches(r)[0]), " ")
+	want := "-p tcp -m multiport --dports 80,443 -m comment --comment " + ruleset.Tag(r) + " -j ACCEPT"
+	if got != want {
+		t.Errorf("iptablesRuleSpec() = %q, want %q", got, want)
+	}
+}
+
+func TestIptablesSpecs_Addresses(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	r := rules.Rule{
+		Name:            "lan",
+		Application:     "/usr/bin/curl",
+		Action:          "allow",
+		Protocol:        "any",
+		Direction:       "inbound",
+		RemoteAddresses: []string{"10.0.0.0/8", "192.168.1.10-192.168.1.20", "2001:db8::/32"},
+		LocalAddresses:  []string{"192.168.1.1"},
+	}
+
+	v4 := iptablesSpecs(r, nil, false)
+	if len(v4) != 2 {
+		t.Fatalf("expected one IPv4 spec per remote entry, got %v", v4)
+	}
+	if got := strings.Join(v4[0], " "); !strings.HasPrefix(got, "-s 10.0.0.0/8 -d 192.168.1.1 ") {
+		t.Errorf("inbound rule should match remote as source: %q", got)
+	}
+	if got := strings.Join(v4[1], " "); !strings.HasPrefix(got, "-m iprange --src-range 192.168.1.10-192.168.1.20 -d 192.168.1.1 ") {
+		t.Errorf("ranges should use iprange: %q", got)
+	}
+
+	// The only local address is IPv4, so nothing is installed for IPv6.
+	if v6 := iptablesSpecs(r, nil, true); v6 != nil {
+		t.Errorf("expected no IPv6 specs, got %v", v6)
+	}
+
+	r.LocalAddresses = nil
+	v6 := iptablesSpecs(r, nil, true)
+	if len(v6) != 1 || !strings.HasPrefix(strings.Join(v6[0], " "), "-s 2001:db8::/32 -m comment") {
+		t.Errorf("unexpected IPv6 specs: %v", v6)
+	}
+}
+
+func TestIptablesSpecs_CatchAll(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	catchAll := rules.DefaultPolicy{Inbound: "deny", Outbound: "allow"}.CatchAll()
+	tag := "-m comment --comment " + ruleset.Tag(catchAll[0])
+	join := func(specs [][]string) []string {
+		out := make([]string, len(specs))
+		for i, s := range specs {
+			out[i] = strings.Join(s, " ")
+		}
+		return out
+	}
+
+	v4 := join(iptablesSpecs(catchAll[0], nil, false))
+	if want := tag + " -j DROP"; v4[len(v4)-1] != want {
+		t.Errorf("last IPv4 spec = %q, want %q", v4[len(v4)-1], want)
+	}
+	for _, want := range []string{
+		"-m conntrack --ctstate ESTABLISHED,RELATED " + tag + " -j ACCEPT",
+		"-i lo " + tag + " -j ACCEPT",
+		"-p icmp --icmp-type destination-unreachable " + tag + " -j ACCEPT",
+		"-p icmp --icmp-type time-exceeded " + tag + " -j ACCEPT",
+		"-p udp --sport 67 --dport 68 " + tag + " -j ACCEPT",
+	} {
+		if !containsString(v4[:len(v4)-1], want) {
+			t.Errorf("IPv4 exemptions missing %q: %v", want, v4)
+		}
+	}
+
+	v6 := join(iptablesSpecs(catchAll[0], nil, true))
+	for _, want := range []string{
+		"-p ipv6-icmp --icmpv6-type packet-too-big " + tag + " -j ACCEPT",
+		"-p ipv6-icmp --icmpv6-type router-advertisement " + tag + " -j ACCEPT",
+		"-p ipv6-icmp --icmpv6-type neighbour-solicitation " + tag + " -j ACCEPT",
+		"-p ipv6-icmp --icmpv6-type neighbour-advertisement " + tag + " -j ACCEPT",
+		"-p udp --sport 547 --dport 546 " + tag + " -j ACCEPT",
+	} {
+		if !containsString(v6[:len(v6)-1], want) {
+			t.Errorf("IPv6 exemptions missing %q: %v", want, v6)
+		}
+	}
+
+	out := rules.DefaultPolicy{Outbound: "deny"}.CatchAll()[0]
+	if specs := join(iptablesSpecs(out, nil, false)); !containsString(specs, "-p udp --sport 68 --dport 67 -m comment --comment "+ruleset.Tag(out)+" -j ACCEPT") {
+		t.Errorf("outbound deny should let DHCP requests out: %v", specs)
+	}
+
+	if allow := iptablesSpecs(catchAll[1], nil, false); len(allow) != 1 {
+		t.Errorf("an allow catch-all needs no exemptions, got %v", allow)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIptablesPortMatches(t *testing.T) {
+	r := rules.Rule{Name: "x", Application: "app", Action: "allow", Protocol: "udp", Direction: "inbound",
+		LocalPorts: []string{"dns", "6000-7000"}, RemotePorts: []string{"1024-65535"}}
+
+	got := iptablesPortMatches(r)
+	if len(got) != 1 {
+		t.Fatalf("expected a single match, got %v", got)
+	}
+	if want := "-m multiport --dports 53,6000:7000 --sport 1024:65535"; strings.Join(got[0], " ") != want {
+		t.Errorf("iptablesPortMatches() = %q, want %q", strings.Join(got[0], " "), want)
+	}
+
+	// 20 single ports overflow one multiport match.
+	r.LocalPorts = nil
+	for p := 1; p <= 20; p++ {
+		r.Ports = append(r.Ports, p)
+	}
+	if got := iptablesPortMatches(r); len(got) != 2 {
+		t.Errorf("expected ports split over two rules, got %v", got)
+	}
+}
+
+func TestPlanIptables_SkipsOtherFamily(t *testing.T) {
+	v6only := rules.Rule{Name: "v6", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound", RemoteAddresses: []string{"::1"}}
+
+	plan := planIptables("*filter\nCOMMIT\n", []rules.Rule{v6only}, false)
+	if len(plan.Add) != 0 || strings.Contains(plan.Script, "firewall-rule:v6") {
+		t.Errorf("IPv6-only rule should not be planned for IPv4: %+v", plan)
+	}
+}
+
+func TestPlanIptables_SkipsPinnedAllow(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	pinned := rules.Rule{Name: "curl", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}, SHA256: sum}
+	pinnedDeny := rules.Rule{Name: "no-wget", Application: "/usr/bin/wget", Action: "deny", Protocol: "any", Direction: "outbound", Package: "wget"}
+
+	if specs := iptablesSpecs(pinned, nil, false); specs != nil {
+		t.Errorf("a pinned allow rule should not be rendered, got %v", specs)
+	}
+	plan := planIptables("*filter\nCOMMIT\n", []rules.Rule{pinned, pinnedDeny}, false)
+	if len(plan.Add) != 1 || plan.Add[0].Name != "no-wget" {
+		t.Errorf("only the pinned deny rule should be planned: %+v", plan.Add)
+	}
+	if strings.Contains(plan.Script, "firewall-rule:curl") || !strings.Contains(plan.Script, "firewall-rule:no-wget") {
+		t.Errorf("unexpected script:\n%s", plan.Script)
+	}
+}
+
+func TestParseIptablesSave(t *testing.T) {
+	dump := `# Generated by iptables-save
+*filter
+:INPUT ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:ssh:aaaa" -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 25 -j DROP
+-A OUTPUT -p tcp -m tcp --dport 443 -m comment --comment firewall-rule:web:bbbb -j ACCEPT
+COMMIT
+`
+
+	got := parseIptablesSave(dump)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 managed rules, got %+v", got)
+	}
+	if got[0].Name != "ssh" || got[0].Fingerprint != "aaaa" {
+		t.Errorf("unexpected first entry: %+v", got[0])
+	}
+	if got[1].Name != "web" || got[1].Fingerprint != "bbbb" {
+		t.Errorf("unexpected second entry: %+v", got[1])
+	}
+	if !strings.HasPrefix(got[0].Ref, "-A INPUT ") {
+		t.Errorf("expected raw rule line as reference, got %q", got[0].Ref)
+	}
+}
+
+func TestParseIptablesSave_QuotedComments(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	// iptables-save prints comments the way iptables-restore reads them, so
+	// the lines rendered for a rule parse back to its name and fingerprint.
+	for _, name := range []string{"web", "my web rule", `say "hi"`, `back\slash`} {
+		r := rules.Rule{Name: name, Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}
+		lines := iptablesRestoreLines(r, nil, false)
+		got := parseIptablesSave(strings.Join(lines, "\n"))
+		if len(got) != 1 || got[0].Name != ruleset.TagName(name) || got[0].Fingerprint != ruleset.Fingerprint(r) {
+			t.Errorf("round trip of %q: rendered %q, parsed %+v", name, lines, got)
+		}
+	}
+
+	line := `-A FIREWALL-OUT -m comment --comment "firewall-rule:a \"b\" \\c:abcd" -j ACCEPT`
+	if got := parseIptablesSave(line); len(got) != 1 || got[0].Name != `a "b" \c` {
+		t.Errorf("escaped comment parsed as %+v", got)
+	}
+}
+
+func TestRenderIptablesRuleset(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	dump := `*filter
+:INPUT ACCEPT [0:0]
+:OUTPUT ACCEPT [0:0]
+:FIREWALL-IN - [0:0]
+:FIREWALL-OUT - [0:0]
+-A INPUT -j FIREWALL-IN
+-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:legacy:aaaa" -j ACCEPT
+-A FIREWALL-IN -p tcp -m tcp --dport 25 -m comment --comment "firewall-rule:smtp:bbbb" -j ACCEPT
+COMMIT
+`
+	web := rules.Rule{Name: "web", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}
+
+	script := renderIptablesRuleset(dump, []rules.Rule{web}, false)
+
+	for _, want := range []string{
+		":FIREWALL-IN - [0:0]\n",
+		":FIREWALL-OUT - [0:0]\n",
+		`-A FIREWALL-OUT -p tcp --dport 443 -m comment --comment "` + ruleset.Tag(web) + `" -j ACCEPT`,
+		"-I OUTPUT 1 -j FIREWALL-OUT",
+		`-D INPUT -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:legacy:aaaa" -j ACCEPT`,
+		"COMMIT\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q\nscript:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "-I INPUT") {
+		t.Errorf("existing INPUT hook should not be duplicated:\n%s", script)
+	}
+	if strings.Contains(script, "-D FIREWALL-IN") {
+		t.Errorf("managed chains are flushed, not edited rule by rule:\n%s", script)
+	}
+}
+
+func TestPlanIptables_MigratesLegacyRules(t *testing.T) {
+	dump := `*filter
+-A INPUT -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:legacy:aaaa" -j ACCEPT
+COMMIT
+`
+	plan := planIptables(dump, nil, false)
+	if len(plan.Remove) != 1 || plan.Remove[0] != "legacy" {
+		t.Errorf("Remove = %v, want [legacy]", plan.Remove)
+	}
+	if plan.Empty() {
+		t.Error("expected legacy rule to make the plan non-empty")
+	}
+}
+
+func TestRenderIptablesInit(t *testing.T) {
+	if got := renderIptablesInit("*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n"); !strings.Contains(got, ":FIREWALL-IN - [0:0]") ||
+		!strings.Contains(got, "-I INPUT 1 -j FIREWALL-IN") || !strings.Contains(got, "-I OUTPUT 1 -j FIREWALL-OUT") {
+		t.Errorf("expected chains and hooks to be created, got:\n%s", got)
+	}
+
+	ready := `*filter
+:FIREWALL-IN - [0:0]
+:FIREWALL-OUT - [0:0]
+-A INPUT -j FIREWALL-IN
+-A OUTPUT -j FIREWALL-OUT
+COMMIT
+`
+	if got := renderIptablesInit(ready); got != "" {
+		t.Errorf("expected no-op when already initialized, got:\n%s", got)
+	}
+}
+
+func TestRenderIptablesTeardown(t *testing.T) {
+	dump := `*filter
+:FIREWALL-IN - [0:0]
+:FIREWALL-OUT - [0:0]
+-A INPUT -j FIREWALL-IN
+-A OUTPUT -j FIREWALL-OUT
+-A OUTPUT -p tcp -m comment --comment "firewall-rule:legacy:aaaa" -j ACCEPT
+-A FIREWALL-IN -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:ssh:bbbb" -j ACCEPT
+COMMIT
+`
+	script := renderIptablesTeardown(dump)
+
+	for _, want := range []string{
+		"-D INPUT -j FIREWALL-IN",
+		"-D OUTPUT -j FIREWALL-OUT",
+		`-D OUTPUT -p tcp -m comment --comment "firewall-rule:legacy:aaaa" -j ACCEPT`,
+		"-F FIREWALL-IN\n-X FIREWALL-IN",
+		"-F FIREWALL-OUT\n-X FIREWALL-OUT",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q\nscript:\n%s", want, script)
+		}
+	}
+
+	if got := renderIptablesTeardown("*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n"); got != "" {
+		t.Errorf("expected no-op on a clean host, got:\n%s", got)
+	}
+}
@@ -0,0 +1,352 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// nftables objects owned by this tool. Everything lives in a dedicated table so
+// our rules never mix with the distribution's own ruleset: the input/output base
+// chains hold nothing but a jump into ChainIn/ChainOut, where the rules live.
+const (
+	nftFamily      = "inet"
+	nftTable       = "firewall"
+	nftInputChain  = "input"
+	nftOutputChain = "output"
+)
+
+// nftChain returns the managed chain a rule belongs to based on its direction.
+func nftChain(r rules.Rule) string {
+	return managedChain(r)
+}
+
+// RenderNftTable returns the nft statements that create our table, the base
+// chains with their single jump, and the managed chains. The statements are
+// idempotent so they can prefix every script we load.
+func RenderNftTable() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "add table %s %s\n", nftFamily, nftTable)
+	fmt.Fprintf(&b, "add chain %s %s %s { type filter hook input priority 0 ; policy accept ; }\n", nftFamily, nftTable, nftInputChain)
+	fmt.Fprintf(&b, "add chain %s %s %s { type filter hook output priority 0 ; policy accept ; }\n", nftFamily, nftTable, nftOutputChain)
+	fmt.Fprintf(&b, "add chain %s %s %s\n", nftFamily, nftTable, ChainIn)
+	fmt.Fprintf(&b, "add chain %s %s %s\n", nftFamily, nftTable, ChainOut)
+	fmt.Fprintf(&b, "add chain %s %s %s\n", nftFamily, nftTable, ChainQueue)
+	fmt.Fprintf(&b, "flush chain %s %s %s\n", nftFamily, nftTable, nftInputChain)
+	fmt.Fprintf(&b, "flush chain %s %s %s\n", nftFamily, nftTable, nftOutputChain)
+	fmt.Fprintf(&b, "add rule %s %s %s jump %s\n", nftFamily, nftTable, nftInputChain, ChainIn)
+	fmt.Fprintf(&b, "add rule %s %s %s jump %s\n", nftFamily, nftTable, nftOutputChain, ChainOut)
+	fmt.Fprintf(&b, "add rule %s %s %s jump %s\n", nftFamily, nftTable, nftOutputChain, ChainQueue)
+	return b.String()
+}
+
+// RenderNftRule renders the match/verdict expression for a rule and one of its
+// cgroups ("" for none), e.g.
+// `meta l4proto tcp tcp dport { 80, 443 } accept comment "firewall-rule:web:3f2a9c0e5b7d1e44"`.
+func RenderNftRule(r rules.Rule, group string) string {
+	var parts []string
+
+	if r.Protocol != "any" {
+		parts = append(parts, "meta l4proto "+r.Protocol)
+		sport, dport := portSides(r)
+		if len(dport) > 0 {
+			parts = append(parts, fmt.Sprintf("%s dport %s", r.Protocol, nftPortSet(dport)))
+		}
+		if len(sport) > 0 {
+			parts = append(parts, fmt.Sprintf("%s sport %s", r.Protocol, nftPortSet(sport)))
+		}
+	}
+
+	// Per-application matching via the owning socket's cgroup, which nft can
+	// look up in both directions.
+	if group != "" {
+		parts = append(parts, fmt.Sprintf(`socket cgroupv2 level 2 "%s"`, group))
+	}
+	if r.User != "" {
+		parts = append(parts, "meta skuid "+r.User)
+	}
+	if r.Group != "" {
+		parts = append(parts, "meta skgid "+r.Group)
+	}
+
+	verdict := "accept"
+	if r.Action == "deny" {
+		verdict = "drop"
+	}
+	parts = append(parts, verdict)
+	parts = append(parts, `comment "`+ruleset.Tag(r)+`"`)
+
+	return strings.Join(parts, " ")
+}
+
+// RenderNftRuleset renders a complete nft script that replaces the contents of
+// the managed chains with the given rules, in order. nft -f applies the script
+// atomically.
+func RenderNftRuleset(list []rules.Rule) string {
+	var b strings.Builder
+	b.WriteString(RenderNftTable())
+	fmt.Fprintf(&b, "flush chain %s %s %s\n", nftFamily, nftTable, ChainIn)
+	fmt.Fprintf(&b, "flush chain %s %s %s\n", nftFamily, nftTable, ChainOut)
+	exact := boundExact(list)
+	for _, r := range list {
+		for _, expr := range nftRuleExprs(r, exact) {
+			fmt.Fprintf(&b, "add rule %s %s %s %s\n", nftFamily, nftTable, nftChain(r), expr)
+		}
+	}
+	return b.String()
+}
+
+// nftRuleExprs expands a rule into one expression per cgroup (see ruleGroups,
+// with the paths exact bound by the rule set) and address family it covers.
+// The inet table sees both families, so a rule without addresses needs a
+// single expression while address matches must name ip or ip6. Rules not
+// enforced in the kernel yield none.
+func nftRuleExprs(r rules.Rule, exact []string) []string {
+	if !kernelEnforced(r) {
+		return nil
+	}
+	if rules.IsCatchAll(r) && r.Action == "deny" {
+		return append(nftCatchAllExemptions(r), RenderNftRule(r, ""))
+	}
+	groups := ruleGroups(r, exact)
+	if len(groups) == 0 {
+		groups = []string{""}
+	}
+	var exprs []string
+	for _, g := range groups {
+		exprs = append(exprs, nftAddressExprs(r, RenderNftRule(r, g))...)
+	}
+	return exprs
+}
+
+// nftAddressExprs prefixes a rendered rule with the address matches of each
+// family the rule covers.
+func nftAddressExprs(r rules.Rule, base string) []string {
+	if len(r.LocalAddresses) == 0 && len(r.RemoteAddresses) == 0 {
+		return []string{base}
+	}
+
+	// Outbound rules see the local end as the source; inbound rules the remote end.
+	saddr, daddr := r.LocalAddresses, r.RemoteAddresses
+	if r.Direction == "inbound" {
+		saddr, daddr = r.RemoteAddresses, r.LocalAddresses
+	}
+
+	var exprs []string
+	for _, fam := range []struct {
+		name string
+		ipv6 bool
+	}{{"ip", false}, {"ip6", true}} {
+		src, ok := familyEntries(saddr, fam.ipv6)
+		if !ok {
+			continue
+		}
+		dst, ok := familyEntries(daddr, fam.ipv6)
+		if !ok {
+			continue
+		}
+		var parts []string
+		if len(src) > 0 {
+			parts = append(parts, fmt.Sprintf("%s saddr %s", fam.name, nftAddrSet(src)))
+		}
+		if len(dst) > 0 {
+			parts = append(parts, fmt.Sprintf("%s daddr %s", fam.name, nftAddrSet(dst)))
+		}
+		exprs = append(exprs, strings.Join(append(parts, base), " "))
+	}
+	return exprs
+}
+
+// nftCatchAllExemptions returns the expressions a default-deny catch-all
+// installs ahead of its drop: replies to connections already let through,
+// loopback traffic, the ICMP errors and IPv6 neighbor discovery the network
+// stack depends on, and DHCP client traffic are accepted, tagged like the
+// catch-all itself.
+func nftCatchAllExemptions(r rules.Rule) []string {
+	iface := "oifname"
+	if r.Direction == "inbound" {
+		iface = "iifname"
+	}
+	// DHCP replies reach the client port inbound; requests leave from it.
+	dhcp4, dhcp6 := "udp sport 68 udp dport 67", "udp sport 546 udp dport 547"
+	if r.Direction == "inbound" {
+		dhcp4, dhcp6 = "udp sport 67 udp dport 68", "udp sport 547 udp dport 546"
+	}
+	comment := `comment "` + ruleset.Tag(r) + `"`
+	return []string{
+		"ct state established,related accept " + comment,
+		iface + ` "lo" accept ` + comment,
+		"icmp type { destination-unreachable, time-exceeded, parameter-problem } accept " + comment,
+		"icmpv6 type { destination-unreachable, packet-too-big, time-exceeded, parameter-problem, " +
+			"nd-router-solicit, nd-router-advert, nd-neighbor-solicit, nd-neighbor-advert } accept " + comment,
+		"meta nfproto ipv4 " + dhcp4 + " accept " + comment,
+		"meta nfproto ipv6 " + dhcp6 + " accept " + comment,
+	}
+}
+
+// nftAddrSet formats address entries as a single value or an anonymous set.
+// CIDRs are masked since nft rejects prefixes with host bits set.
+func nftAddrSet(entries []string) string {
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		if prefix, err := netip.ParsePrefix(e); err == nil {
+			e = prefix.Masked().String()
+		}
+		parts[i] = e
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// nftPortSet formats ports and ranges as a single value or an anonymous set.
+func nftPortSet(ports []rules.PortRange) string {
+	if len(ports) == 1 {
+		return ports[0].String()
+	}
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		parts[i] = p.String()
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// applyNftRule appends a single rule to our table, creating the table if needed.
+func applyNftRule(r rules.Rule) error {
+	script := RenderNftTable()
+	for _, expr := range nftRuleExprs(r, nil) {
+		script += fmt.Sprintf("add rule %s %s %s %s\n", nftFamily, nftTable, nftChain(r), expr)
+	}
+	return runNftScript(script)
+}
+
+// removeNftRule deletes every rule in our chains tagged with the rule name.
+func removeNftRule(name string) error {
+	installed, err := nftInstalled()
+	if err != nil {
+		return err
+	}
+
+	var stale []ruleset.Installed
+	for _, in := range installed {
+		if in.Name == ruleset.TagName(name) {
+			stale = append(stale, in)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	for _, in := range stale {
+		parts := strings.Fields(in.Ref)
+		if len(parts) != 2 {
+			continue
+		}
+		fmt.Fprintf(&b, "delete rule %s %s %s handle %s\n", nftFamily, nftTable, parts[0], parts[1])
+	}
+	return runNftScript(b.String())
+}
+
+// nftInstalled lists managed rules from our table; a missing table means nothing is installed.
+func nftInstalled() ([]ruleset.Installed, error) {
+	cmd := exec.Command("nft", "-a", "list", "table", nftFamily, nftTable)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "No such file or directory") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("nft list failed: %w (output: %s)", err, string(output))
+	}
+	return parseNftInstalled(string(output)), nil
+}
+
+// parseNftInstalled extracts managed rules from `nft -a list table` output.
+// Each reference is "<chain> <handle>".
+func parseNftInstalled(listing string) []ruleset.Installed {
+	marker := `comment "` + ruleset.TagPrefix
+
+	var out []ruleset.Installed
+	chain := ""
+	scanner := bufio.NewScanner(strings.NewReader(listing))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "chain ") {
+			chain = strings.Fields(line)[1]
+			continue
+		}
+		idx := strings.Index(line, marker)
+		if idx < 0 || chain == "" {
+			continue
+		}
+		tag := line[idx+len(`comment "`):]
+		end := strings.Index(tag, `"`)
+		if end < 0 {
+			continue
+		}
+		name, fp, ok := ruleset.ParseTag(tag[:end])
+		if !ok {
+			continue
+		}
+		hidx := strings.LastIndex(line, "# handle ")
+		if hidx < 0 {
+			continue
+		}
+		handle, err := strconv.Atoi(strings.TrimSpace(line[hidx+len("# handle "):]))
+		if err != nil {
+			continue
+		}
+		out = append(out, ruleset.Installed{
+			Name:        name,
+			Fingerprint: fp,
+			Ref:         fmt.Sprintf("%s %d", chain, handle),
+		})
+	}
+	return out
+}
+
+// initNft creates our table and chains and hooks them into input/output.
+func initNft() error {
+	return runNftScript(RenderNftTable())
+}
+
+// teardownNft deletes our table, which removes every chain and rule in it.
+func teardownNft() error {
+	exists, err := nftTableExists()
+	if err != nil || !exists {
+		return err
+	}
+	return runNftScript(fmt.Sprintf("delete table %s %s\n", nftFamily, nftTable))
+}
+
+// nftTableExists reports whether our table is loaded.
+func nftTableExists() (bool, error) {
+	cmd := exec.Command("nft", "list", "table", nftFamily, nftTable)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(output), "No such file or directory") {
+			return false, nil
+		}
+		return false, fmt.Errorf("nft list failed: %w (output: %s)", err, string(output))
+	}
+	return true, nil
+}
+
+// runNftScript feeds a script to `nft -f -`.
+func runNftScript(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nft failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
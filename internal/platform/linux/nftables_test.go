@@ -0,0 +1,278 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestRenderNftRule(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	tests := []struct {
+		name string
+		rule rules.Rule
+		want string
+	}{
+		{
+			name: "multiple ports use anonymous set",
+			rule: rules.Rule{
+				Name:        "web-browser",
+				Application: "/usr/bin/firefox",
+				Action:      "allow",
+				Protocol:    "tcp",
+				Direction:   "outbound",
+				Ports:       []int{80, 443},
+			},
+			want: `meta l4proto tcp tcp dport { 80, 443 } accept`,
+		},
+		{
+			name: "single port deny",
+			rule: rules.Rule{
+				Name:        "block-dns",
+				Application: "/usr/bin/app",
+				Action:      "deny",
+				Protocol:    "udp",
+				Direction:   "inbound",
+				Ports:       []int{53},
+			},
+			want: `meta l4proto udp udp dport 53 drop`,
+		},
+		{
+			name: "any protocol",
+			rule: rules.Rule{
+				Name:        "allow-all",
+				Application: "/usr/bin/app",
+				Action:      "allow",
+				Protocol:    "any",
+				Direction:   "outbound",
+			},
+			want: `accept`,
+		},
+		{
+			name: "ranges, services and source ports",
+			rule: rules.Rule{
+				Name:        "game",
+				Application: "/usr/bin/app",
+				Action:      "allow",
+				Protocol:    "udp",
+				Direction:   "outbound",
+				LocalPorts:  []string{"1024-65535"},
+				RemotePorts: []string{"dns", "6000-7000"},
+			},
+			want: `meta l4proto udp udp dport { 53, 6000-7000 } udp sport 1024-65535 accept`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want + ` comment "` + ruleset.Tag(tt.rule) + `"`
+			if got := RenderNftRule(tt.rule, ""); got != want {
+				t.Errorf("RenderNftRule() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderNftRule_LongName(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	r := rules.Rule{
+		Name:        `"quoted"-` + strings.Repeat("a", 200),
+		Application: "/usr/bin/app",
+		Action:      "allow",
+		Protocol:    "any",
+		Direction:   "outbound",
+	}
+
+	expr := RenderNftRule(r, "")
+	comment := ruleset.Tag(r)
+	if !strings.HasSuffix(expr, `comment "`+comment+`"`) || strings.Contains(comment, `"`) || len(comment) > 128 {
+		t.Fatalf("comment should be quotable and fit in 128 bytes: %s", expr)
+	}
+
+	// The listed rule is recognised as the installed copy of r.
+	listing := "table inet firewall {\n\tchain FIREWALL-OUT {\n\t\t" + expr + " # handle 7\n\t}\n}\n"
+	plan := ruleset.Diff(parseNftInstalled(listing), []rules.Rule{r})
+	if len(plan.Unchanged) != 1 || !plan.Empty() {
+		t.Errorf("installed rule not matched to its definition: %+v", plan)
+	}
+}
+
+func TestRenderNftRuleset(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	list := []rules.Rule{
+		{Name: "ssh", Application: "/usr/sbin/sshd", Action: "allow", Protocol: "tcp", Direction: "inbound", Ports: []int{22}},
+		{Name: "web", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+	}
+
+	script := RenderNftRuleset(list)
+
+	for _, want := range []string{
+		"add table inet firewall",
+		"add chain inet firewall input { type filter hook input priority 0 ; policy accept ; }",
+		"add chain inet firewall output { type filter hook output priority 0 ; policy accept ; }",
+		"add chain inet firewall FIREWALL-IN",
+		"add chain inet firewall FIREWALL-OUT",
+		"add rule inet firewall input jump FIREWALL-IN",
+		"add rule inet firewall output jump FIREWALL-OUT",
+		"flush chain inet firewall FIREWALL-IN",
+		"flush chain inet firewall FIREWALL-OUT",
+		"add rule inet firewall FIREWALL-IN meta l4proto tcp tcp dport 22 accept comment",
+		"add rule inet firewall FIREWALL-OUT meta l4proto tcp tcp dport 443 accept comment",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q\nscript:\n%s", want, script)
+		}
+	}
+}
+
+func TestRenderNftRuleset_SkipsPinnedAllow(t *testing.T) {
+	list := []rules.Rule{
+		{Name: "curl", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}, Package: "curl"},
+		{Name: "no-wget", Application: "/usr/bin/wget", Action: "deny", Protocol: "any", Direction: "outbound", Package: "wget"},
+	}
+
+	if exprs := nftRuleExprs(list[0], nil); exprs != nil {
+		t.Errorf("a pinned allow rule should not be rendered, got %v", exprs)
+	}
+	script := RenderNftRuleset(list)
+	if strings.Contains(script, "firewall-rule:curl") {
+		t.Errorf("pinned allow rule installed:\n%s", script)
+	}
+	want := `socket cgroupv2 level 2 "` + CgroupPath("/usr/bin/wget") + `" drop`
+	if !strings.Contains(script, want) {
+		t.Errorf("pinned deny rule should still be installed, script missing %q:\n%s", want, script)
+	}
+}
+
+func TestNftRuleExprs_Addresses(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	r := rules.Rule{
+		Name:            "lan",
+		Application:     "/usr/bin/curl",
+		Action:          "deny",
+		Protocol:        "any",
+		Direction:       "outbound",
+		RemoteAddresses: []string{"10.1.2.3/8", "192.168.1.10-192.168.1.20", "2001:db8::/32"},
+	}
+
+	got := nftRuleExprs(r, nil)
+	if len(got) != 2 {
+		t.Fatalf("expected one expression per family, got %v", got)
+	}
+	if !strings.HasPrefix(got[0], "ip daddr { 10.0.0.0/8, 192.168.1.10-192.168.1.20 } drop") {
+		t.Errorf("unexpected IPv4 expression: %q", got[0])
+	}
+	if !strings.HasPrefix(got[1], "ip6 daddr 2001:db8::/32 drop") {
+		t.Errorf("unexpected IPv6 expression: %q", got[1])
+	}
+
+	r.Direction = "inbound"
+	r.RemoteAddresses = []string{"10.0.0.1"}
+	r.LocalAddresses = []string{"::1"}
+	if got := nftRuleExprs(r, nil); len(got) != 0 {
+		t.Errorf("rule with no family in common should render nothing, got %v", got)
+	}
+}
+
+func TestNftRuleExprs_CatchAll(t *testing.T) {
+	SetAppMatch(AppMatchNone)
+	defer SetAppMatch(AppMatchCgroup)
+
+	r := rules.DefaultPolicy{Inbound: "deny"}.CatchAll()[0]
+	got := nftRuleExprs(r, nil)
+	if last := got[len(got)-1]; !strings.HasPrefix(last, "drop comment") {
+		t.Errorf("last expression = %q, want the drop", last)
+	}
+	for _, prefix := range []string{
+		"ct state established,related accept comment",
+		`iifname "lo" accept comment`,
+		"icmp type { destination-unreachable, time-exceeded, parameter-problem } accept comment",
+		"icmpv6 type { destination-unreachable, packet-too-big, time-exceeded, parameter-problem, nd-router-solicit, nd-router-advert, nd-neighbor-solicit, nd-neighbor-advert } accept comment",
+		"meta nfproto ipv4 udp sport 67 udp dport 68 accept comment",
+		"meta nfproto ipv6 udp sport 547 udp dport 546 accept comment",
+	} {
+		found := false
+		for _, expr := range got[:len(got)-1] {
+			found = found || strings.HasPrefix(expr, prefix)
+		}
+		if !found {
+			t.Errorf("exemptions missing %q: %v", prefix, got)
+		}
+	}
+
+	r = rules.DefaultPolicy{Outbound: "deny"}.CatchAll()[0]
+	got = nftRuleExprs(r, nil)
+	if !strings.HasPrefix(got[1], `oifname "lo" accept`) || !strings.HasPrefix(got[4], "meta nfproto ipv4 udp sport 68 udp dport 67 accept") {
+		t.Errorf("unexpected outbound exemptions: %v", got)
+	}
+}
+
+func TestParseNftInstalled(t *testing.T) {
+	listing := `table inet firewall { # handle 9
+	chain input { # handle 1
+		type filter hook input priority filter; policy accept;
+		jump FIREWALL-IN # handle 10
+	}
+	chain FIREWALL-IN { # handle 5
+		meta l4proto tcp tcp dport 22 accept comment "firewall-rule:ssh:aaaa" # handle 3
+	}
+	chain FIREWALL-OUT { # handle 6
+		meta l4proto tcp tcp dport 443 accept comment "firewall-rule:web:bbbb" # handle 4
+		meta l4proto tcp tcp dport 80 accept comment "unrelated" # handle 5
+	}
+}`
+
+	got := parseNftInstalled(listing)
+	want := []ruleset.Installed{
+		{Name: "ssh", Fingerprint: "aaaa", Ref: "FIREWALL-IN 3"},
+		{Name: "web", Fingerprint: "bbbb", Ref: "FIREWALL-OUT 4"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseNftInstalled() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDetectBackend(t *testing.T) {
+	found := func(string) (string, error) { return "/usr/sbin/nft", nil }
+	missing := func(string) (string, error) { return "", errors.New("not found") }
+
+	if got := detectBackend(found); got != BackendNftables {
+		t.Errorf("detectBackend(nft present) = %q, want %q", got, BackendNftables)
+	}
+	if got := detectBackend(missing); got != BackendIptables {
+		t.Errorf("detectBackend(nft missing) = %q, want %q", got, BackendIptables)
+	}
+}
+
+func TestSetBackend(t *testing.T) {
+	defer SetBackend(BackendAuto)
+
+	if err := SetBackend(BackendIptables); err != nil {
+		t.Fatalf("SetBackend(iptables): %v", err)
+	}
+	if got := Backend(); got != BackendIptables {
+		t.Errorf("Backend() = %q, want %q", got, BackendIptables)
+	}
+	if err := SetBackend("pf"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
@@ -5,80 +5,151 @@ package linux
 import (
 	"fmt"
 	"os/exec"
-	"strings"
+	"sync"
 
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
-// ApplyRule applies a firewall rule using iptables on Linux.
-func ApplyRule(r rules.Rule) error {
-	// Map our rule to iptables parameters
-	chain := "INPUT"
-	if r.Direction == "outbound" {
-		chain = "OUTPUT"
+// Supported packet filter backends.
+const (
+	BackendAuto     = "auto"
+	BackendIptables = "iptables"
+	BackendNftables = "nftables"
+)
+
+// Managed chains. All of our rules live here; the built-in INPUT/OUTPUT chains
+// only receive a single jump into them. ChainQueue comes after ChainOut and
+// hands undecided new connections to the monitor when NFQUEUE interception is on.
+const (
+	ChainIn    = "FIREWALL-IN"
+	ChainOut   = "FIREWALL-OUT"
+	ChainQueue = "FIREWALL-QUEUE"
+)
+
+var (
+	backendMu sync.RWMutex
+	backend   = BackendAuto
+)
+
+// SetBackend selects the packet filter backend used by ApplyRule and RemoveRule.
+// An empty name is treated as "auto".
+func SetBackend(name string) error {
+	if name == "" {
+		name = BackendAuto
+	}
+	switch name {
+	case BackendAuto, BackendIptables, BackendNftables:
+	default:
+		return fmt.Errorf("unknown linux backend: %s", name)
 	}
+	backendMu.Lock()
+	backend = name
+	backendMu.Unlock()
+	return nil
+}
 
-	target := "ACCEPT"
-	if r.Action == "deny" {
-		target = "DROP"
+// Backend returns the backend in use, resolving "auto" by probing for the nft binary.
+func Backend() string {
+	backendMu.RLock()
+	name := backend
+	backendMu.RUnlock()
+	if name != BackendAuto {
+		return name
 	}
+	return detectBackend(exec.LookPath)
+}
 
-	// Build iptables command: iptables -A <chain> -p <protocol> --dport <ports> -j <target>
-	args := []string{"-A", chain}
+// detectBackend prefers nftables when the nft binary is installed and falls back to iptables.
+func detectBackend(lookPath func(string) (string, error)) string {
+	if _, err := lookPath("nft"); err == nil {
+		return BackendNftables
+	}
+	return BackendIptables
+}
 
-	// Protocol
-	if r.Protocol != "any" {
-		args = append(args, "-p", r.Protocol)
+// managedChain returns the managed chain a rule belongs to based on its direction.
+func managedChain(r rules.Rule) string {
+	if r.Direction == "outbound" {
+		return ChainOut
 	}
+	return ChainIn
+}
 
-	// Ports (for tcp/udp)
-	if len(r.Ports) > 0 && r.Protocol != "any" {
-		portList := make([]string, len(r.Ports))
-		for i, p := range r.Ports {
-			portList[i] = fmt.Sprintf("%d", p)
-		}
-		portSpec := strings.Join(portList, ",")
+// portSides maps a rule's local and remote ports onto the packet's source and
+// destination ports, which swap between outbound and inbound traffic.
+func portSides(r rules.Rule) (sport, dport []rules.PortRange) {
+	local, remote := r.LocalPortRanges(), r.RemotePortRanges()
+	if r.Direction == "inbound" {
+		return remote, local
+	}
+	return local, remote
+}
+
+// kernelEnforced reports whether a rule is installed in the kernel. Allow
+// rules pinned to an executable's hash or package are not: the kernel cannot
+// check the pin, so their connections are left to the monitor, which does.
+func kernelEnforced(r rules.Rule) bool {
+	return r.Action != "allow" || !r.Pinned()
+}
 
-		if r.Direction == "inbound" {
-			args = append(args, "--dport", portSpec)
-		} else {
-			args = append(args, "--dport", portSpec)
+// familyEntries returns the entries of an address list that belong to one
+// family. An empty list means "any address" and yields nil with ok set; ok is
+// false when the list only names the other family, so a rule restricted to it
+// must not be installed for this family at all.
+func familyEntries(list []string, ipv6 bool) (entries []string, ok bool) {
+	if len(list) == 0 {
+		return nil, true
+	}
+	for _, entry := range list {
+		if rules.IsIPv6Entry(entry) == ipv6 {
+			entries = append(entries, entry)
 		}
 	}
+	return entries, len(entries) > 0
+}
 
-	// Add comment with application name
-	args = append(args, "-m", "comment", "--comment", fmt.Sprintf("firewall-rule:%s:%s", r.Name, r.Application))
-
-	// Target
-	args = append(args, "-j", target)
+// Init creates the managed chains and installs the jumps from the built-in
+// input/output hooks. It is idempotent.
+func Init() error {
+	if Backend() == BackendNftables {
+		return initNft()
+	}
+	return initIptables()
+}
 
-	cmd := exec.Command("iptables", args...)
-	output, err := cmd.CombinedOutput()
+// Teardown removes the managed chains, their jumps and every rule we installed,
+// leaving the host firewall as it was before the tool was used, and then the
+// application cgroups that are empty.
+func Teardown() error {
+	var err error
+	if Backend() == BackendNftables {
+		err = teardownNft()
+	} else {
+		err = teardownIptables()
+	}
 	if err != nil {
-		return fmt.Errorf("iptables failed: %w (output: %s)", err, string(output))
+		return err
 	}
 
+	backendMu.Lock()
+	boundPatterns = nil
+	backendMu.Unlock()
+	removeCgroups(cgroupRoot, nil)
 	return nil
 }
 
-// RemoveRule removes a firewall rule by name using iptables comment matching on Linux.
-func RemoveRule(name string) error {
-	// Search and delete rules with our comment pattern
-	for _, chain := range []string{"INPUT", "OUTPUT"} {
-		comment := fmt.Sprintf("firewall-rule:%s:", name)
-
-		// List rules with line numbers, find matching comment, delete
-		cmd := exec.Command("iptables", "-L", chain, "--line-numbers", "-n")
-		_, err := cmd.CombinedOutput()
-		if err != nil {
-			continue
-		}
-
-		// Simple approach: try to delete by comment match
-		// In production, parse output and delete by line number
-		delCmd := exec.Command("iptables", "-D", chain, "-m", "comment", "--comment", comment)
-		_ = delCmd.Run() // Ignore error if rule doesn't exist
+// ApplyRule applies a firewall rule using the selected backend on Linux.
+func ApplyRule(r rules.Rule) error {
+	if Backend() == BackendNftables {
+		return applyNftRule(r)
 	}
+	return applyIptablesRule(r)
+}
 
-	return nil
+// RemoveRule removes a firewall rule by name using the selected backend on Linux.
+func RemoveRule(name string) error {
+	if Backend() == BackendNftables {
+		return removeNftRule(name)
+	}
+	return removeIptablesRule(name)
 }
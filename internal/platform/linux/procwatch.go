@@ -0,0 +1,114 @@
+//go:build linux
+
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+)
+
+// Process events connector (linux/connector.h, linux/cn_proc.h).
+const (
+	cnIdxProc         = 1
+	cnValProc         = 1
+	procCnMcastListen = 1
+	procEventExec     = 2
+
+	cnMsgLen = 20 // struct cn_msg without data
+)
+
+// WatchExec moves processes into their application's cgroup as soon as the
+// kernel reports that they executed a bound program, instead of waiting for
+// the next BindApplications or for the monitor to see them connect. It
+// listens on the process events connector, which requires root, until ctx is
+// done. A process still runs in its parent's cgroup for the moment between
+// its exec and the move, so a connection opened right away can escape a rule
+// bound to its application.
+func WatchExec(ctx context.Context) error {
+	if !appMatchEnabled() {
+		return nil
+	}
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		return fmt.Errorf("open process events connector: %w", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc, Pid: uint32(os.Getpid())}); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("bind process events connector: %w", err)
+	}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 1}); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	if err := syscall.Sendto(fd, procListenMessage(), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("subscribe to process events: %w", err)
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+		buf := make([]byte, syscall.Getpagesize())
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				// ENOBUFS means events were dropped; the next sync binds them.
+				if err == syscall.EAGAIN || err == syscall.EINTR || err == syscall.ENOBUFS {
+					continue
+				}
+				logging.LogEvent("error", "exec_watch_error", fmt.Sprintf("Process events receive failed: %v", err), nil)
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, msg := range msgs {
+				pid, ok := parseProcExec(msg.Data)
+				if !ok {
+					continue
+				}
+				exe, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+				if err != nil {
+					continue // already gone
+				}
+				_ = BindProcess(pid, strings.TrimSuffix(exe, " (deleted)"))
+			}
+		}
+	}()
+	return nil
+}
+
+// procListenMessage builds the netlink message subscribing to process events.
+func procListenMessage() []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+cnMsgLen+4)
+	binary.NativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.NativeEndian.PutUint16(b[4:6], syscall.NLMSG_DONE)
+	binary.NativeEndian.PutUint32(b[12:16], uint32(os.Getpid()))
+	cn := b[syscall.NLMSG_HDRLEN:]
+	binary.NativeEndian.PutUint32(cn[0:4], cnIdxProc)
+	binary.NativeEndian.PutUint32(cn[4:8], cnValProc)
+	binary.NativeEndian.PutUint16(cn[16:18], 4)
+	binary.NativeEndian.PutUint32(cn[cnMsgLen:], procCnMcastListen)
+	return b
+}
+
+// parseProcExec returns the process (thread group) ID of an exec event in a
+// connector message; other events are ignored.
+func parseProcExec(data []byte) (int, bool) {
+	// struct proc_event: what, cpu, timestamp_ns, then for exec the pid and tgid.
+	const what, tgid = cnMsgLen, cnMsgLen + 20
+	if len(data) < tgid+4 || binary.NativeEndian.Uint32(data[0:4]) != cnIdxProc {
+		return 0, false
+	}
+	if binary.NativeEndian.Uint32(data[what:what+4]) != procEventExec {
+		return 0, false
+	}
+	return int(binary.NativeEndian.Uint32(data[tgid : tgid+4])), true
+}
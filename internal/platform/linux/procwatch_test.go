@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+func TestParseProcExec(t *testing.T) {
+	event := func(what uint32) []byte {
+		data := make([]byte, cnMsgLen+24)
+		binary.NativeEndian.PutUint32(data[0:4], cnIdxProc)
+		binary.NativeEndian.PutUint32(data[4:8], cnValProc)
+		binary.NativeEndian.PutUint32(data[cnMsgLen:], what)
+		binary.NativeEndian.PutUint32(data[cnMsgLen+16:], 4321) // pid (thread)
+		binary.NativeEndian.PutUint32(data[cnMsgLen+20:], 4300) // tgid
+		return data
+	}
+
+	if pid, ok := parseProcExec(event(procEventExec)); !ok || pid != 4300 {
+		t.Errorf("exec event = %d, %v; want 4300", pid, ok)
+	}
+	if _, ok := parseProcExec(event(1)); ok {
+		t.Error("fork events should be ignored")
+	}
+	if _, ok := parseProcExec(event(procEventExec)[:cnMsgLen+8]); ok {
+		t.Error("truncated events should be ignored")
+	}
+
+	msg := procListenMessage()
+	if int(binary.NativeEndian.Uint32(msg[0:4])) != len(msg) || binary.NativeEndian.Uint32(msg[syscall.NLMSG_HDRLEN+cnMsgLen:]) != procCnMcastListen {
+		t.Errorf("unexpected listen message %v", msg)
+	}
+}
@@ -0,0 +1,111 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// EnableQueue sends new outbound TCP/UDP connections that no managed rule
+// decided to the given NFQUEUE, where the monitor holds them until it issues a
+// verdict. The queue rules use bypass, so traffic flows normally whenever no
+// process is listening on the queue.
+func EnableQueue(num uint16) error {
+	if Backend() == BackendNftables {
+		return runNftScript(RenderNftQueue(num))
+	}
+	for _, f := range iptablesFamilies() {
+		dump, err := f.dump()
+		if err != nil {
+			return err
+		}
+		if err := f.load(renderIptablesQueue(dump, num)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisableQueue stops handing connections to the monitor's queue.
+func DisableQueue() error {
+	if Backend() == BackendNftables {
+		exists, err := nftTableExists()
+		if err != nil || !exists {
+			return err
+		}
+		return runNftScript(fmt.Sprintf("flush chain %s %s %s\n", nftFamily, nftTable, ChainQueue))
+	}
+	for _, f := range iptablesFamilies() {
+		dump, err := f.dump()
+		if err != nil {
+			return err
+		}
+		cleanup := iptablesQueueCleanup(dump)
+		if cleanup == "" {
+			continue
+		}
+		if err := f.load("*filter\n" + cleanup + "COMMIT\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderNftQueue renders the nft script that points ChainQueue at queue num.
+func RenderNftQueue(num uint16) string {
+	var b strings.Builder
+	b.WriteString(RenderNftTable())
+	fmt.Fprintf(&b, "flush chain %s %s %s\n", nftFamily, nftTable, ChainQueue)
+	fmt.Fprintf(&b, "add rule %s %s %s ct state new meta l4proto { tcp, udp } queue num %d bypass\n", nftFamily, nftTable, ChainQueue, num)
+	return b.String()
+}
+
+// renderIptablesQueue returns the restore script that (re)creates ChainQueue
+// with NFQUEUE targets for queue num and appends its jump to OUTPUT, after the
+// jump into ChainOut, so only connections our rules did not accept reach it.
+func renderIptablesQueue(dump string, num uint16) string {
+	var b strings.Builder
+	b.WriteString("*filter\n")
+	fmt.Fprintf(&b, ":%s - [0:0]\n", ChainQueue)
+	for _, proto := range []string{"tcp", "udp"} {
+		fmt.Fprintf(&b, "-A %s -p %s -m conntrack --ctstate NEW -j NFQUEUE --queue-num %d --queue-bypass\n", ChainQueue, proto, num)
+	}
+	if _, hooks := iptablesQueueState(dump); len(hooks) == 0 {
+		fmt.Fprintf(&b, "-A OUTPUT -j %s\n", ChainQueue)
+	}
+	b.WriteString("COMMIT\n")
+	return b.String()
+}
+
+// iptablesQueueCleanup returns the restore lines that remove ChainQueue and its
+// jump, or "" when neither exists.
+func iptablesQueueCleanup(dump string) string {
+	declared, hooks := iptablesQueueState(dump)
+
+	var b strings.Builder
+	for _, line := range hooks {
+		b.WriteString(iptablesDeleteLine(line) + "\n")
+	}
+	if declared {
+		fmt.Fprintf(&b, "-F %s\n-X %s\n", ChainQueue, ChainQueue)
+	}
+	return b.String()
+}
+
+// iptablesQueueState reports whether ChainQueue is declared in an
+// iptables-save dump and returns the OUTPUT lines that jump into it.
+func iptablesQueueState(dump string) (declared bool, hooks []string) {
+	scanner := bufio.NewScanner(strings.NewReader(dump))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, ":"+ChainQueue+" ") {
+			declared = true
+		}
+		if strings.HasPrefix(line, "-A OUTPUT ") && strings.HasSuffix(line, "-j "+ChainQueue) {
+			hooks = append(hooks, line)
+		}
+	}
+	return declared, hooks
+}
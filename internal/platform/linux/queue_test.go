@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderNftQueue(t *testing.T) {
+	script := RenderNftQueue(100)
+
+	for _, want := range []string{
+		"add chain inet firewall FIREWALL-QUEUE",
+		"add rule inet firewall output jump FIREWALL-QUEUE",
+		"flush chain inet firewall FIREWALL-QUEUE",
+		"add rule inet firewall FIREWALL-QUEUE ct state new meta l4proto { tcp, udp } queue num 100 bypass",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q\nscript:\n%s", want, script)
+		}
+	}
+	// The queue jump must come after the rules so only undecided traffic is queued.
+	if strings.Index(script, "jump FIREWALL-QUEUE") < strings.Index(script, "jump FIREWALL-OUT") {
+		t.Errorf("queue jump should follow the FIREWALL-OUT jump:\n%s", script)
+	}
+}
+
+func TestRenderIptablesQueue(t *testing.T) {
+	dump := `*filter
+:OUTPUT ACCEPT [0:0]
+:FIREWALL-OUT - [0:0]
+-A OUTPUT -j FIREWALL-OUT
+COMMIT
+`
+	script := renderIptablesQueue(dump, 100)
+	for _, want := range []string{
+		":FIREWALL-QUEUE - [0:0]\n",
+		"-A FIREWALL-QUEUE -p tcp -m conntrack --ctstate NEW -j NFQUEUE --queue-num 100 --queue-bypass\n",
+		"-A FIREWALL-QUEUE -p udp -m conntrack --ctstate NEW -j NFQUEUE --queue-num 100 --queue-bypass\n",
+		"-A OUTPUT -j FIREWALL-QUEUE\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q\nscript:\n%s", want, script)
+		}
+	}
+
+	hooked := dump + "-A OUTPUT -j FIREWALL-QUEUE\n"
+	if script := renderIptablesQueue(hooked, 100); strings.Contains(script, "-A OUTPUT") {
+		t.Errorf("existing queue hook should not be duplicated:\n%s", script)
+	}
+}
+
+func TestIptablesQueueCleanup(t *testing.T) {
+	dump := `*filter
+:OUTPUT ACCEPT [0:0]
+:FIREWALL-QUEUE - [0:0]
+-A OUTPUT -j FIREWALL-QUEUE
+-A FIREWALL-QUEUE -p tcp -m conntrack --ctstate NEW -j NFQUEUE --queue-num 100 --queue-bypass
+COMMIT
+`
+	got := iptablesQueueCleanup(dump)
+	want := "-D OUTPUT -j FIREWALL-QUEUE\n-F FIREWALL-QUEUE\n-X FIREWALL-QUEUE\n"
+	if got != want {
+		t.Errorf("iptablesQueueCleanup() = %q, want %q", got, want)
+	}
+	if got := iptablesQueueCleanup("*filter\nCOMMIT\n"); got != "" {
+		t.Errorf("expected no cleanup without a queue chain, got %q", got)
+	}
+}
@@ -0,0 +1,157 @@
+//go:build linux
+
+package linux
+
+import (
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// PlanRuleset diffs the desired rules against the managed rules installed by
+// the selected backend and renders the batch that would converge them. The
+// batch rewrites the managed chains as a whole so rule order always matches
+// the desired order. Rules the kernel cannot enforce are left out.
+func PlanRuleset(desired []rules.Rule) (*ruleset.Plan, error) {
+	var enforced []rules.Rule
+	for _, r := range desired {
+		if kernelEnforced(r) {
+			enforced = append(enforced, r)
+			continue
+		}
+		logging.LogEvent("warning", "rule-skipped", fmt.Sprintf("Rule %q not installed: the kernel cannot verify its executable pin, so only the connection monitor allows its connections", r.Name), map[string]interface{}{
+			"name": r.Name,
+			"app":  r.Application,
+		})
+	}
+	desired = enforced
+
+	if Backend() == BackendNftables {
+		installed, err := nftInstalled()
+		if err != nil {
+			return nil, err
+		}
+		plan := ruleset.Diff(installed, desired)
+		plan.Backend = BackendNftables
+		plan.Script = RenderNftRuleset(desired)
+		return &plan, nil
+	}
+
+	// iptables keeps IPv4 and IPv6 in separate tables, so each family is
+	// planned on its own and the results are summarised together.
+	dump, err := iptablesV4.dump()
+	if err != nil {
+		return nil, err
+	}
+	plan := planIptables(dump, desired, false)
+	if len(iptablesFamilies()) == 1 {
+		return &plan, nil
+	}
+
+	dump6, err := iptablesV6.dump()
+	if err != nil {
+		return nil, err
+	}
+	plan6 := planIptables(dump6, desired, true)
+	merged := ruleset.Merge(desired, plan, plan6)
+	merged.Script = plan.Script
+	merged.Script6 = plan6.Script
+	return &merged, nil
+}
+
+// planIptables diffs one family's iptables-save dump against the desired rules
+// that apply to it. Tagged rules outside the managed chains (left by older
+// versions) always count as stale so the plan migrates them.
+func planIptables(dump string, desired []rules.Rule, ipv6 bool) ruleset.Plan {
+	var applicable []rules.Rule
+	for _, r := range desired {
+		if len(iptablesSpecs(r, nil, ipv6)) > 0 {
+			applicable = append(applicable, r)
+		}
+	}
+	desired = applicable
+
+	var managed, legacy []ruleset.Installed
+	for _, in := range parseIptablesSave(dump) {
+		if isManagedChainLine(in.Ref) {
+			managed = append(managed, in)
+		} else {
+			legacy = append(legacy, in)
+		}
+	}
+
+	plan := ruleset.Diff(managed, desired)
+	wanted := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		wanted[ruleset.TagName(r.Name)] = true
+	}
+	removed := make(map[string]bool, len(plan.Remove))
+	for _, name := range plan.Remove {
+		removed[name] = true
+	}
+	for _, in := range legacy {
+		plan.Stale = append(plan.Stale, in)
+		if !wanted[in.Name] && !removed[in.Name] {
+			removed[in.Name] = true
+			plan.Remove = append(plan.Remove, in.Name)
+		}
+	}
+
+	plan.Backend = BackendIptables
+	plan.Script = renderIptablesRuleset(dump, desired, ipv6)
+	return plan
+}
+
+// ApplyPlan loads a plan's script in a single atomic batch. With iptables the
+// IPv6 batch is loaded separately, after the IPv4 one; see applyIptables. A
+// plan without rule changes still restores the managed chains and the hooks
+// into them, which the diff does not look at, when they have gone missing.
+func ApplyPlan(p *ruleset.Plan) error {
+	if p.Backend == BackendNftables {
+		if p.Empty() {
+			return initNft()
+		}
+		return runNftScript(p.Script)
+	}
+	return applyIptables(p, iptablesV4, iptablesV6)
+}
+
+// iptablesTables loads batches into one family's filter table.
+type iptablesTables interface {
+	dump() (string, error)
+	load(script string) error
+	replace(snapshot string) error
+}
+
+// applyIptables loads the IPv4 batch and then the IPv6 one. The IPv4 filter
+// table is snapshotted first and restored when the IPv6 batch fails, so both
+// families keep enforcing the same rule set. An empty plan only adds missing
+// chains and hooks.
+func applyIptables(p *ruleset.Plan, v4, v6 iptablesTables) error {
+	if p.Empty() {
+		tables := []iptablesTables{v4}
+		if p.Script6 != "" {
+			tables = append(tables, v6)
+		}
+		return initIptablesTables(tables...)
+	}
+	if p.Script6 == "" {
+		return v4.load(p.Script)
+	}
+	snapshot, err := v4.dump()
+	if err != nil {
+		return err
+	}
+	if err := v4.load(p.Script); err != nil {
+		return err
+	}
+	if err := v6.load(p.Script6); err != nil {
+		if rerr := v4.replace(snapshot); rerr != nil {
+			return fmt.Errorf("%w; restoring the IPv4 rules also failed: %v", err, rerr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build linux
+// +build linux
+
+package linux
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// fakeTables is a filter table whose loads append to its content; fail makes
+// load fail without changing anything.
+type fakeTables struct {
+	content string
+	fail    error
+}
+
+func (f *fakeTables) dump() (string, error) { return f.content, nil }
+
+func (f *fakeTables) load(script string) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.content += script
+	return nil
+}
+
+func (f *fakeTables) replace(snapshot string) error {
+	f.content = snapshot
+	return nil
+}
+
+func TestApplyIptables_RestoresIPv4WhenIPv6Fails(t *testing.T) {
+	v4 := &fakeTables{content: "old-v4\n"}
+	v6 := &fakeTables{content: "old-v6\n", fail: errors.New("ip6tables-restore failed")}
+	plan := &ruleset.Plan{Backend: BackendIptables, Add: []rules.Rule{{Name: "web"}}, Script: "new-v4\n", Script6: "new-v6\n"}
+
+	err := applyIptables(plan, v4, v6)
+	if err == nil || !strings.Contains(err.Error(), "ip6tables-restore failed") {
+		t.Fatalf("expected the IPv6 failure, got %v", err)
+	}
+	if v4.content != "old-v4\n" || v6.content != "old-v6\n" {
+		t.Errorf("families should keep the previous rules, got v4 %q, v6 %q", v4.content, v6.content)
+	}
+
+	v6.fail = nil
+	if err := applyIptables(plan, v4, v6); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if v4.content != "old-v4\nnew-v4\n" || v6.content != "old-v6\nnew-v6\n" {
+		t.Errorf("both families should be loaded, got v4 %q, v6 %q", v4.content, v6.content)
+	}
+}
+
+func TestApplyIptables_EmptyPlanRepairsHooks(t *testing.T) {
+	// The rules are in place but something deleted the INPUT hook.
+	dump := "*filter\n:FIREWALL-IN - [0:0]\n:FIREWALL-OUT - [0:0]\n-A OUTPUT -j FIREWALL-OUT\n" +
+		"-A FIREWALL-IN -p tcp -m tcp --dport 22 -m comment --comment \"firewall-rule:ssh:aaaa\" -j ACCEPT\nCOMMIT\n"
+	v4, v6 := &fakeTables{content: dump}, &fakeTables{content: dump}
+	plan := &ruleset.Plan{Backend: BackendIptables, Unchanged: []string{"ssh"}, Script: "full-v4\n", Script6: "full-v6\n"}
+
+	if err := applyIptables(plan, v4, v6); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	for _, f := range []*fakeTables{v4, v6} {
+		added := strings.TrimPrefix(f.content, dump)
+		if added != "*filter\n-I INPUT 1 -j FIREWALL-IN\nCOMMIT\n" {
+			t.Errorf("expected only the missing hook to be added, got %q", added)
+		}
+	}
+}
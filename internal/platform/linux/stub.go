@@ -3,8 +3,10 @@
 package linux
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
@@ -12,3 +14,60 @@ func ApplyRule(r rules.Rule) error {
 	_ = r
 	return fmt.Errorf("linux adapter not available on this platform")
 }
+
+func RemoveRule(name string) error {
+	_ = name
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func SetBackend(name string) error {
+	_ = name
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func PlanRuleset(desired []rules.Rule) (*ruleset.Plan, error) {
+	_ = desired
+	return nil, fmt.Errorf("linux adapter not available on this platform")
+}
+
+func ApplyPlan(p *ruleset.Plan) error {
+	_ = p
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func Init() error {
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func Teardown() error {
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func SetAppMatch(mode string) error {
+	_ = mode
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func BindApplications(list []rules.Rule) (int, error) {
+	_ = list
+	return 0, fmt.Errorf("linux adapter not available on this platform")
+}
+
+func BindProcess(pid int, app string) error {
+	_, _ = pid, app
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func WatchExec(ctx context.Context) error {
+	_ = ctx
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func EnableQueue(num uint16) error {
+	_ = num
+	return fmt.Errorf("linux adapter not available on this platform")
+}
+
+func DisableQueue() error {
+	return fmt.Errorf("linux adapter not available on this platform")
+}
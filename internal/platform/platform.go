@@ -1,14 +1,108 @@
 package platform
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 
 	lin "github.com/vhPedroGitHub/firewall/internal/platform/linux"
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
 	win "github.com/vhPedroGitHub/firewall/internal/platform/windows"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
+// Plan is a dry-run description of how installed rules would change.
+type Plan = ruleset.Plan
+
+// Options tunes the OS-specific adapters.
+type Options struct {
+	LinuxBackend  string // auto, iptables or nftables
+	LinuxAppMatch string // cgroup or none
+}
+
+// Configure applies adapter options for the current OS; options for other
+// platforms are ignored.
+func Configure(opts Options) error {
+	switch runtime.GOOS {
+	case "linux":
+		if err := lin.SetBackend(opts.LinuxBackend); err != nil {
+			return err
+		}
+		return lin.SetAppMatch(opts.LinuxAppMatch)
+	default:
+		return nil
+	}
+}
+
+// BindApplications places running processes of the applications referenced by
+// list where the OS adapter can match them. Windows matches program paths
+// natively, so only Linux has work to do.
+func BindApplications(list []rules.Rule) (int, error) {
+	if runtime.GOOS != "linux" {
+		return 0, nil
+	}
+	return lin.BindApplications(list)
+}
+
+// BindProcess places a single process seen by the monitor where the OS adapter
+// can match it.
+func BindProcess(pid int, app string) error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return lin.BindProcess(pid, app)
+}
+
+// WatchExec places new processes where the OS adapter can match them as they
+// start, until ctx is done. Only Linux has work to do.
+func WatchExec(ctx context.Context) error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return lin.WatchExec(ctx)
+}
+
+// EnableQueue hands new outbound connections that no installed rule decided
+// to the NFQUEUE the monitor listens on. Only Linux supports interception.
+func EnableQueue(num uint16) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("connection interception not supported on %s", runtime.GOOS)
+	}
+	return lin.EnableQueue(num)
+}
+
+// DisableQueue stops handing connections to the monitor.
+func DisableQueue() error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return lin.DisableQueue()
+}
+
+// Init creates the adapter's managed chains and hooks.
+func Init() error {
+	switch runtime.GOOS {
+	case "windows":
+		return win.Init()
+	case "linux":
+		return lin.Init()
+	default:
+		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
+// Teardown removes every rule, chain and hook installed by the adapter.
+func Teardown() error {
+	switch runtime.GOOS {
+	case "windows":
+		return win.Teardown()
+	case "linux":
+		return lin.Teardown()
+	default:
+		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
 // ApplyRule dispatches to the OS-specific adapter.
 func ApplyRule(r rules.Rule) error {
 	switch runtime.GOOS {
@@ -20,3 +114,32 @@ func ApplyRule(r rules.Rule) error {
 		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
 }
+
+// PlanRuleset diffs the desired rule set against what the OS adapter has
+// installed without touching the kernel.
+func PlanRuleset(desired []rules.Rule) (*Plan, error) {
+	// Backends install rules in the order given, which must be evaluation order
+	desired = append([]rules.Rule(nil), desired...)
+	rules.Sort(desired)
+
+	switch runtime.GOOS {
+	case "windows":
+		return win.PlanRuleset(desired)
+	case "linux":
+		return lin.PlanRuleset(desired)
+	default:
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
+
+// ApplyPlan applies a plan produced by PlanRuleset as a single batch.
+func ApplyPlan(p *Plan) error {
+	switch runtime.GOOS {
+	case "windows":
+		return win.ApplyPlan(p)
+	case "linux":
+		return lin.ApplyPlan(p)
+	default:
+		return fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+	}
+}
@@ -0,0 +1,236 @@
+// Package ruleset holds the OS-neutral pieces of whole-ruleset reconciliation:
+// rule fingerprints, the tags that mark kernel rules as ours, and the diff
+// between what is installed and what the store says should be.
+package ruleset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// TagPrefix marks every kernel rule managed by this tool.
+const TagPrefix = "firewall-rule:"
+
+// Tags carry the rule name verbatim when it fits in the smallest comment a
+// backend keeps (128 bytes in nftables) next to the prefix and fingerprint and
+// every backend can quote it; other names are replaced by a hash.
+const (
+	tagMax        = 128
+	tagNameMax    = tagMax - len(TagPrefix) - len(":") - 16
+	tagHashPrefix = "#"
+)
+
+// Installed is a managed rule found in the kernel.
+type Installed struct {
+	Name        string
+	Fingerprint string
+	Ref         string // backend-specific handle used to delete the entry
+}
+
+// Plan describes the changes needed to converge installed state on a desired rule set.
+type Plan struct {
+	Backend   string
+	Add       []rules.Rule // desired rules with nothing installed
+	Update    []rules.Rule // desired rules whose installed definition differs
+	Remove    []string     // installed rules that are no longer desired, named as by TagName
+	Unchanged []string
+	Stale     []Installed // installed entries deleted by Update and Remove
+	Script    string      // exact batch fed to the backend
+	Script6   string      // IPv6 batch for backends that keep address families apart
+}
+
+// Empty reports whether applying the plan would change anything.
+func (p *Plan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Update) == 0 && len(p.Remove) == 0
+}
+
+var (
+	variantMu sync.RWMutex
+	variant   string
+)
+
+// SetVariant records adapter settings that change how every rule is rendered,
+// such as the Linux application match mode. The variant is part of every
+// fingerprint, so changing it makes the next sync reinstall the rules. The
+// empty variant leaves fingerprints as they were before variants existed.
+func SetVariant(v string) {
+	variantMu.Lock()
+	variant = v
+	variantMu.Unlock()
+}
+
+// Fingerprint returns a short stable hash of a rule definition and the current
+// variant so changed rules can be told apart from installed ones without
+// parsing backend syntax.
+func Fingerprint(r rules.Rule) string {
+	data, _ := json.Marshal(r)
+	variantMu.RLock()
+	if variant != "" {
+		data = append(append(data, 0), variant...)
+	}
+	variantMu.RUnlock()
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Tag returns the comment/description attached to the kernel rule for r.
+func Tag(r rules.Rule) string {
+	return TagPrefix + TagName(r.Name) + ":" + Fingerprint(r)
+}
+
+// TagName returns a rule name as tags carry it: the name itself, or "#" and a
+// hash of it for names too long for a tag or holding quotes or control
+// characters. Installed entries are matched to rules through it.
+func TagName(name string) string {
+	verbatim := len(name) <= tagNameMax && utf8.ValidString(name) && !strings.HasPrefix(name, tagHashPrefix) &&
+		!strings.ContainsFunc(name, func(c rune) bool { return c == '"' || unicode.IsControl(c) })
+	if verbatim {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return tagHashPrefix + hex.EncodeToString(sum[:8])
+}
+
+// ParseTag splits a tag produced by Tag into rule name, as TagName returns
+// it, and fingerprint.
+func ParseTag(tag string) (name, fingerprint string, ok bool) {
+	if !strings.HasPrefix(tag, TagPrefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(tag, TagPrefix)
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return rest[:idx], rest[idx+1:], true
+}
+
+// Diff compares installed entries with the desired rules. Desired order is
+// preserved in Add and Update so backends install rules in evaluation order.
+func Diff(installed []Installed, desired []rules.Rule) Plan {
+	byName := make(map[string][]Installed)
+	var order []string
+	for _, in := range installed {
+		if _, seen := byName[in.Name]; !seen {
+			order = append(order, in.Name)
+		}
+		byName[in.Name] = append(byName[in.Name], in)
+	}
+
+	var plan Plan
+	wanted := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		wanted[TagName(r.Name)] = true
+		entries := byName[TagName(r.Name)]
+		if len(entries) == 0 {
+			plan.Add = append(plan.Add, r)
+			continue
+		}
+
+		fp := Fingerprint(r)
+		current := true
+		for _, in := range entries {
+			if in.Fingerprint != fp {
+				current = false
+				break
+			}
+		}
+		if current {
+			plan.Unchanged = append(plan.Unchanged, r.Name)
+			continue
+		}
+		plan.Update = append(plan.Update, r)
+		plan.Stale = append(plan.Stale, entries...)
+	}
+
+	for _, name := range order {
+		if wanted[name] {
+			continue
+		}
+		plan.Remove = append(plan.Remove, name)
+		plan.Stale = append(plan.Stale, byName[name]...)
+	}
+
+	return plan
+}
+
+// Merge summarises the per-family plans of a backend that keeps IPv4 and IPv6
+// in separate tables. A rule counts as added only when every family that
+// carries it lacks it and as unchanged only when no family needs work; anything
+// in between is an update. Families whose plan does not mention a rule (its
+// addresses belong to another family) are ignored for it. Scripts are left for
+// the caller to fill in.
+func Merge(desired []rules.Rule, plans ...Plan) Plan {
+	var merged Plan
+	if len(plans) == 0 {
+		return merged
+	}
+	merged.Backend = plans[0].Backend
+
+	added := make([]map[string]bool, len(plans))
+	updated := make([]map[string]bool, len(plans))
+	unchanged := make([]map[string]bool, len(plans))
+	for i, p := range plans {
+		added[i] = make(map[string]bool, len(p.Add))
+		for _, r := range p.Add {
+			added[i][r.Name] = true
+		}
+		updated[i] = make(map[string]bool, len(p.Update))
+		for _, r := range p.Update {
+			updated[i][r.Name] = true
+		}
+		unchanged[i] = make(map[string]bool, len(p.Unchanged))
+		for _, name := range p.Unchanged {
+			unchanged[i][name] = true
+		}
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		wanted[TagName(r.Name)] = true
+		missingEverywhere, changed := true, false
+		for i := range plans {
+			switch {
+			case added[i][r.Name]:
+				changed = true
+			case updated[i][r.Name]:
+				changed = true
+				missingEverywhere = false
+			case unchanged[i][r.Name]:
+				missingEverywhere = false
+			}
+		}
+		switch {
+		case changed && missingEverywhere:
+			merged.Add = append(merged.Add, r)
+		case changed:
+			merged.Update = append(merged.Update, r)
+		default:
+			merged.Unchanged = append(merged.Unchanged, r.Name)
+		}
+	}
+
+	// A desired rule removed from one family has moved to the other; it is
+	// reported through that family's plan rather than as a removal.
+	removed := make(map[string]bool)
+	for _, p := range plans {
+		for _, name := range p.Remove {
+			if wanted[name] {
+				continue
+			}
+			if !removed[name] {
+				removed[name] = true
+				merged.Remove = append(merged.Remove, name)
+			}
+		}
+		merged.Stale = append(merged.Stale, p.Stale...)
+	}
+	return merged
+}
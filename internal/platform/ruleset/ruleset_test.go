@@ -0,0 +1,171 @@
+package ruleset
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func testRule(name string, ports ...int) rules.Rule {
+	return rules.Rule{
+		Name:        name,
+		Application: "/usr/bin/app",
+		Action:      "allow",
+		Protocol:    "tcp",
+		Direction:   "outbound",
+		Ports:       ports,
+	}
+}
+
+func TestTagRoundTrip(t *testing.T) {
+	r := testRule("web:alt", 443)
+
+	name, fp, ok := ParseTag(Tag(r))
+	if !ok {
+		t.Fatalf("ParseTag(%q) failed", Tag(r))
+	}
+	if name != r.Name {
+		t.Errorf("name = %q, want %q", name, r.Name)
+	}
+	if fp != Fingerprint(r) {
+		t.Errorf("fingerprint = %q, want %q", fp, Fingerprint(r))
+	}
+
+	if _, _, ok := ParseTag("something-else"); ok {
+		t.Error("expected foreign tag to be rejected")
+	}
+}
+
+func TestTagName(t *testing.T) {
+	long := strings.Repeat("a", 200)
+	for name, verbatim := range map[string]bool{
+		"web":                   true,
+		"my web rule":           true,
+		"web:alt":               true,
+		strings.Repeat("a", 97): true,
+		long:                    false,
+		`say "hi"`:              false,
+		"two\nlines":            false,
+		"#1234":                 false,
+	} {
+		got := TagName(name)
+		if (got == name) != verbatim {
+			t.Errorf("TagName(%q) = %q, verbatim %v", name, got, verbatim)
+		}
+		if len(Tag(testRule(name))) > tagMax {
+			t.Errorf("tag for %q exceeds %d bytes", name, tagMax)
+		}
+	}
+	if TagName(long) == TagName(long+"b") {
+		t.Error("distinct long names should get distinct tags")
+	}
+
+	// Rules are matched to installed entries through their tag name.
+	r := testRule(long, 443)
+	tagged, fp, _ := ParseTag(Tag(r))
+	plan := Diff([]Installed{{Name: tagged, Fingerprint: fp}, {Name: TagName(long + "b"), Fingerprint: fp}}, []rules.Rule{r})
+	if len(plan.Unchanged) != 1 || len(plan.Remove) != 1 || plan.Remove[0] != TagName(long+"b") {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+}
+
+func TestFingerprint_ChangesWithDefinition(t *testing.T) {
+	if Fingerprint(testRule("web", 443)) == Fingerprint(testRule("web", 8443)) {
+		t.Error("expected fingerprint to change when ports change")
+	}
+	if Fingerprint(testRule("web", 443)) != Fingerprint(testRule("web", 443)) {
+		t.Error("expected fingerprint to be stable")
+	}
+}
+
+func TestFingerprint_ChangesWithVariant(t *testing.T) {
+	defer SetVariant("")
+	plain := Fingerprint(testRule("web", 443))
+
+	SetVariant("app-match=none")
+	if Fingerprint(testRule("web", 443)) == plain {
+		t.Error("fingerprint should change with the variant")
+	}
+	SetVariant("")
+	if Fingerprint(testRule("web", 443)) != plain {
+		t.Error("the empty variant should keep the original fingerprint")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	keep := testRule("keep", 22)
+	changed := testRule("changed", 443)
+	added := testRule("added", 80)
+
+	installed := []Installed{
+		{Name: "keep", Fingerprint: Fingerprint(keep), Ref: "1"},
+		{Name: "changed", Fingerprint: "outdated", Ref: "2"},
+		{Name: "gone", Fingerprint: "whatever", Ref: "3"},
+	}
+
+	plan := Diff(installed, []rules.Rule{keep, changed, added})
+
+	if len(plan.Add) != 1 || plan.Add[0].Name != "added" {
+		t.Errorf("Add = %+v, want [added]", plan.Add)
+	}
+	if len(plan.Update) != 1 || plan.Update[0].Name != "changed" {
+		t.Errorf("Update = %+v, want [changed]", plan.Update)
+	}
+	if len(plan.Remove) != 1 || plan.Remove[0] != "gone" {
+		t.Errorf("Remove = %v, want [gone]", plan.Remove)
+	}
+	if len(plan.Unchanged) != 1 || plan.Unchanged[0] != "keep" {
+		t.Errorf("Unchanged = %v, want [keep]", plan.Unchanged)
+	}
+	if len(plan.Stale) != 2 || plan.Stale[0].Ref != "2" || plan.Stale[1].Ref != "3" {
+		t.Errorf("Stale = %+v, want refs [2 3]", plan.Stale)
+	}
+	if plan.Empty() {
+		t.Error("expected non-empty plan")
+	}
+}
+
+func TestDiff_InSync(t *testing.T) {
+	r := testRule("web", 443)
+	plan := Diff([]Installed{{Name: "web", Fingerprint: Fingerprint(r)}}, []rules.Rule{r})
+	if !plan.Empty() {
+		t.Errorf("expected empty plan, got %+v", plan)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	web, ssh, dns := testRule("web", 443), testRule("ssh", 22), testRule("dns", 53)
+	desired := []rules.Rule{web, ssh, dns}
+
+	// IPv4 has everything installed; IPv6 has only dns and an old rule.
+	v4 := Diff([]Installed{
+		{Name: "web", Fingerprint: Fingerprint(web)},
+		{Name: "ssh", Fingerprint: Fingerprint(ssh)},
+		{Name: "dns", Fingerprint: Fingerprint(dns)},
+	}, desired)
+	v6 := Diff([]Installed{
+		{Name: "dns", Fingerprint: Fingerprint(dns)},
+		{Name: "old", Fingerprint: "x"},
+	}, desired)
+
+	got := Merge(desired, v4, v6)
+
+	if len(got.Add) != 0 {
+		t.Errorf("rules installed in one family should not count as added: %+v", got.Add)
+	}
+	if len(got.Update) != 2 || got.Update[0].Name != "web" || got.Update[1].Name != "ssh" {
+		t.Errorf("Update = %+v, want web, ssh", got.Update)
+	}
+	if len(got.Unchanged) != 1 || got.Unchanged[0] != "dns" {
+		t.Errorf("Unchanged = %v, want [dns]", got.Unchanged)
+	}
+	if len(got.Remove) != 1 || got.Remove[0] != "old" {
+		t.Errorf("Remove = %v, want [old]", got.Remove)
+	}
+
+	none := Merge(desired, Diff(nil, desired), Diff(nil, desired))
+	if len(none.Add) != 3 {
+		t.Errorf("rules missing everywhere should be added, got %+v", none.Add)
+	}
+}
@@ -7,11 +7,12 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
-// ApplyRule applies a firewall rule using netsh advfirewall on Windows.
-func ApplyRule(r rules.Rule) error {
+// netshAddArgs maps a rule to `netsh advfirewall firewall add rule` arguments.
+func netshAddArgs(r rules.Rule) []string {
 	// Map our rule to netsh parameters
 	dir := "in"
 	if r.Direction == "outbound" {
@@ -34,25 +35,78 @@ func ApplyRule(r rules.Rule) error {
 		fmt.Sprintf("name=%s", r.Name),
 		fmt.Sprintf("dir=%s", dir),
 		fmt.Sprintf("action=%s", action),
-		fmt.Sprintf("program=%s", r.Application),
 		fmt.Sprintf("protocol=%s", protocol),
+		fmt.Sprintf("description=%s", ruleset.Tag(r)),
+	}
+
+	// Block rules win over allow rules in Windows Firewall, so a deny
+	// catch-all is only recorded here; see netshFirewallPolicy
+	if rules.IsCatchAll(r) && r.Action == "deny" {
+		args = append(args, "enable=no")
+	}
+
+	// "any" application rules cover every program, which netsh expresses by
+	// leaving the program out
+	if app, err := rules.ParseApplication(r.Application); err != nil || app.Kind != rules.AppAny {
+		args = append(args, fmt.Sprintf("program=%s", r.Application))
 	}
 
-	// Add port specification if needed
-	if len(r.Ports) > 0 && protocol != "any" {
-		portList := make([]string, len(r.Ports))
-		for i, p := range r.Ports {
-			portList[i] = fmt.Sprintf("%d", p)
+	// Add port specification if needed; netsh takes ranges as from-to
+	if protocol != "any" {
+		if local := r.LocalPortRanges(); len(local) > 0 {
+			args = append(args, fmt.Sprintf("localport=%s", netshPortList(local)))
 		}
-		portSpec := strings.Join(portList, ",")
-		if dir == "in" {
-			args = append(args, fmt.Sprintf("localport=%s", portSpec))
-		} else {
-			args = append(args, fmt.Sprintf("remoteport=%s", portSpec))
+		if remote := r.RemotePortRanges(); len(remote) > 0 {
+			args = append(args, fmt.Sprintf("remoteport=%s", netshPortList(remote)))
 		}
 	}
 
-	cmd := exec.Command("netsh", args...)
+	// netsh accepts IPs, CIDRs and from-to ranges of either family as-is
+	if len(r.RemoteAddresses) > 0 {
+		args = append(args, fmt.Sprintf("remoteip=%s", strings.Join(r.RemoteAddresses, ",")))
+	}
+	if len(r.LocalAddresses) > 0 {
+		args = append(args, fmt.Sprintf("localip=%s", strings.Join(r.LocalAddresses, ",")))
+	}
+
+	return args
+}
+
+// netshPortList formats port ranges as a netsh port list.
+func netshPortList(ports []rules.PortRange) string {
+	parts := make([]string, len(ports))
+	for i, p := range ports {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// netshUnsupported returns why Windows Firewall cannot enforce a rule, or ""
+// when it can. It matches programs by exact path only, so rules naming a
+// directory prefix, glob or regex are left to the connection monitor, and so
+// are allow rules pinned to an executable's hash or package, which it cannot
+// check. Socket owners are matched on Linux only; installing such a rule
+// without its owner would widen it to every account.
+func netshUnsupported(r rules.Rule) string {
+	app, err := rules.ParseApplication(r.Application)
+	if err != nil || (app.Kind != rules.AppExact && app.Kind != rules.AppAny) {
+		return fmt.Sprintf("cannot match application pattern %q", r.Application)
+	}
+	if r.User != "" || r.Group != "" {
+		return "cannot match the socket owner user or group"
+	}
+	if r.Action == "allow" && r.Pinned() {
+		return "cannot verify the executable pin"
+	}
+	return ""
+}
+
+// ApplyRule applies a firewall rule using netsh advfirewall on Windows.
+func ApplyRule(r rules.Rule) error {
+	if reason := netshUnsupported(r); reason != "" {
+		return fmt.Errorf("windows firewall %s", reason)
+	}
+	cmd := exec.Command("netsh", netshAddArgs(r)...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("netsh failed: %w (output: %s)", err, string(output))
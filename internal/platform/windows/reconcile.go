@@ -0,0 +1,328 @@
+//go:build windows
+
+package windows
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// PlanRuleset diffs the desired rules against managed Windows Firewall rules
+// and renders the netsh batch that would converge them. Rules netsh cannot
+// express are skipped.
+func PlanRuleset(desired []rules.Rule) (*ruleset.Plan, error) {
+	var expressible []rules.Rule
+	for _, r := range desired {
+		reason := netshUnsupported(r)
+		if reason == "" {
+			expressible = append(expressible, r)
+			continue
+		}
+		logging.LogEvent("warning", "rule-skipped", fmt.Sprintf("Rule %q not installed: windows firewall %s", r.Name, reason), map[string]interface{}{
+			"name": r.Name,
+			"app":  r.Application,
+		})
+	}
+	desired = expressible
+	for _, o := range blockOverrides(desired) {
+		logging.LogEvent("warning", "rule-order-ignored", fmt.Sprintf("Rule %q is evaluated before %q but windows firewall lets the block win where they overlap", o.allow, o.deny), map[string]interface{}{
+			"allow": o.allow,
+			"deny":  o.deny,
+		})
+	}
+
+	cmd := exec.Command("netsh", "advfirewall", "firewall", "show", "rule", "name=all", "verbose")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("netsh show failed: %w (output: %s)", err, string(output))
+	}
+
+	policyOutput, err := exec.Command("netsh", "advfirewall", "show", "allprofiles", "firewallpolicy").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("netsh show firewallpolicy failed: %w (output: %s)", err, string(policyOutput))
+	}
+	saved, _ := parseSavedPolicies(string(output))
+
+	plan := ruleset.Diff(parseNetshRules(string(output)), desired)
+	plan.Backend = "netsh"
+	plan.Script = renderNetshBatch(&plan) + netshFirewallPolicy(desired, parseFirewallPolicies(string(policyOutput)), saved)
+	return &plan, nil
+}
+
+// override is an allow rule evaluated before a deny rule it overlaps.
+type override struct {
+	allow, deny string
+}
+
+// blockOverrides lists where Windows Firewall departs from evaluation order:
+// it ignores rule order and a matching block rule always wins, so an allow
+// rule evaluated first loses the connections it shares with a later deny rule.
+// Default policy catch-alls are left out; a deny catch-all is not enforced as
+// a rule.
+func blockOverrides(list []rules.Rule) []override {
+	ordered := append([]rules.Rule(nil), list...)
+	rules.Sort(ordered)
+	var out []override
+	for i, allow := range ordered {
+		if allow.Action != "allow" || rules.IsCatchAll(allow) {
+			continue
+		}
+		for _, deny := range ordered[i+1:] {
+			if deny.Action == "deny" && !rules.IsCatchAll(deny) && rules.Overlaps(allow, deny) {
+				out = append(out, override{allow: allow.Name, deny: deny.Name})
+			}
+		}
+	}
+	return out
+}
+
+// Firewall profiles and the rule that records their policies from before a
+// default policy first changed them. The rule is disabled and its name is
+// reserved for default policies, so it never matches traffic or a user rule.
+const (
+	savedPolicyRule   = rules.CatchAllPrefix + "saved"
+	savedPolicyPrefix = "firewall-policy:"
+)
+
+var firewallProfiles = []string{"domain", "private", "public"}
+
+// profilePolicy is a firewall profile's default actions as netsh spells them,
+// e.g. {"blockinbound", "allowoutbound"}.
+type profilePolicy struct {
+	Inbound, Outbound string
+}
+
+// netshFirewallPolicy returns the script lines that make the firewall
+// profiles' default actions follow the default policy catch-alls in desired.
+// Windows Firewall lets block rules override allow rules, so a deny catch-all
+// is enforced by the profiles instead of by its (disabled) rule. A direction
+// without a catch-all keeps the administrator's setting. current is the
+// profiles' policy now and saved the one recorded before the first change, nil
+// when none is recorded: it is recorded when a catch-all is first installed
+// and restored, and its record deleted, when the last one goes away.
+func netshFirewallPolicy(desired []rules.Rule, current, saved map[string]profilePolicy) string {
+	var managed profilePolicy
+	for _, r := range desired {
+		if !rules.IsCatchAll(r) {
+			continue
+		}
+		action := "allow"
+		if r.Action == "deny" {
+			action = "block"
+		}
+		if r.Direction == "inbound" {
+			managed.Inbound = action + "inbound"
+		} else {
+			managed.Outbound = action + "outbound"
+		}
+	}
+	active := managed != profilePolicy{}
+
+	var b strings.Builder
+	original := saved
+	if original == nil {
+		original = current
+		if active {
+			b.WriteString(netshLine([]string{"advfirewall", "firewall", "add", "rule", "name=" + savedPolicyRule,
+				"dir=in", "action=block", "enable=no", "description=" + savedPolicyPrefix + formatPolicies(current)}) + "\n")
+		}
+	}
+	for _, profile := range firewallProfiles {
+		want, ok := original[profile]
+		if !ok {
+			continue
+		}
+		if managed.Inbound != "" {
+			want.Inbound = managed.Inbound
+		}
+		if managed.Outbound != "" {
+			want.Outbound = managed.Outbound
+		}
+		if want != current[profile] {
+			b.WriteString(netshLine([]string{"advfirewall", "set", profile + "profile", "firewallpolicy", want.Inbound + "," + want.Outbound}) + "\n")
+		}
+	}
+	if saved != nil && !active {
+		b.WriteString(netshLine([]string{"advfirewall", "firewall", "delete", "rule", "name=" + savedPolicyRule}) + "\n")
+	}
+	return b.String()
+}
+
+// parseFirewallPolicies reads the output of `netsh advfirewall show
+// allprofiles firewallpolicy`.
+func parseFirewallPolicies(output string) map[string]profilePolicy {
+	out := make(map[string]profilePolicy)
+	profile := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(line, "Profile Settings:") {
+			profile = strings.ToLower(strings.Fields(line)[0])
+			continue
+		}
+		if profile == "" || !strings.HasPrefix(line, "Firewall Policy") {
+			continue
+		}
+		fields := strings.Fields(line)
+		in, outb, ok := strings.Cut(strings.ToLower(fields[len(fields)-1]), ",")
+		if ok {
+			out[profile] = profilePolicy{Inbound: in, Outbound: outb}
+		}
+	}
+	return out
+}
+
+// parseSavedPolicies finds the policies recorded in the savedPolicyRule in
+// `netsh advfirewall firewall show rule name=all verbose` output.
+func parseSavedPolicies(output string) (map[string]profilePolicy, bool) {
+	current := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Rule Name":
+			current = value
+		case "Description":
+			if current == savedPolicyRule && strings.HasPrefix(value, savedPolicyPrefix) {
+				return parsePolicies(strings.TrimPrefix(value, savedPolicyPrefix)), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// formatPolicies renders policies as "domain=blockinbound,allowoutbound;...".
+func formatPolicies(policies map[string]profilePolicy) string {
+	var parts []string
+	for _, profile := range firewallProfiles {
+		if p, ok := policies[profile]; ok {
+			parts = append(parts, profile+"="+p.Inbound+","+p.Outbound)
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// parsePolicies reads the form written by formatPolicies.
+func parsePolicies(s string) map[string]profilePolicy {
+	out := make(map[string]profilePolicy)
+	for _, part := range strings.Split(s, ";") {
+		profile, value, _ := strings.Cut(part, "=")
+		if in, outb, ok := strings.Cut(value, ","); ok {
+			out[profile] = profilePolicy{Inbound: in, Outbound: outb}
+		}
+	}
+	return out
+}
+
+// ApplyPlan runs a plan's script through a single `netsh -f` invocation.
+func ApplyPlan(p *ruleset.Plan) error {
+	// A plan without rule changes may still restore the profiles' policies.
+	if p.Script == "" {
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "firewall-*.netsh")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(p.Script); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	output, err := exec.Command("netsh", "-f", f.Name()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("netsh batch failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+// parseNetshRules extracts managed rules from `netsh advfirewall firewall show
+// rule name=all verbose`. Rules are ours when their description carries our tag;
+// the reference is the Windows rule name.
+func parseNetshRules(output string) []ruleset.Installed {
+	var out []ruleset.Installed
+	current := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Rule Name":
+			current = value
+		case "Description":
+			name, fp, ok := ruleset.ParseTag(value)
+			if !ok || current == "" {
+				continue
+			}
+			out = append(out, ruleset.Installed{Name: name, Fingerprint: fp, Ref: current})
+		}
+	}
+	return out
+}
+
+// renderNetshBatch renders a plan as a netsh script: stale rules are deleted
+// by name before new definitions are added.
+func renderNetshBatch(p *ruleset.Plan) string {
+	var b strings.Builder
+	deleted := make(map[string]bool)
+	for _, in := range p.Stale {
+		if deleted[in.Ref] {
+			continue
+		}
+		deleted[in.Ref] = true
+		b.WriteString(netshLine([]string{"advfirewall", "firewall", "delete", "rule", "name=" + in.Ref}) + "\n")
+	}
+	for _, r := range append(append([]rules.Rule{}, p.Add...), p.Update...) {
+		b.WriteString(netshLine(netshAddArgs(r)) + "\n")
+	}
+	return b.String()
+}
+
+// netshLine joins arguments for a netsh script, quoting values that contain spaces.
+func netshLine(args []string) string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if found && strings.ContainsAny(value, " \t") {
+			arg = key + `="` + value + `"`
+		}
+		out[i] = arg
+	}
+	return strings.Join(out, " ")
+}
+
+// Init prepares the adapter. Windows Firewall keeps our rules apart by their
+// tagged description, so there is nothing to create.
+func Init() error {
+	return nil
+}
+
+// Teardown deletes every rule whose description carries our tag and restores
+// the firewall profiles' policies a default policy changed.
+func Teardown() error {
+	plan, err := PlanRuleset(nil)
+	if err != nil {
+		return err
+	}
+	return ApplyPlan(plan)
+}
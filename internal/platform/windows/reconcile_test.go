@@ -0,0 +1,181 @@
+//go:build windows
+// +build windows
+
+package windows
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestParseNetshRules(t *testing.T) {
+	output := `
+Rule Name:                            web
+----------------------------------------------------------------------
+Description:                          firewall-rule:web:aaaa
+Enabled:                              Yes
+Direction:                            Out
+
+Rule Name:                            Core Networking - DNS (UDP-Out)
+----------------------------------------------------------------------
+Description:                          Outbound rule to allow DNS requests.
+Enabled:                              Yes
+`
+
+	got := parseNetshRules(output)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 managed rule, got %+v", got)
+	}
+	if got[0].Name != "web" || got[0].Fingerprint != "aaaa" || got[0].Ref != "web" {
+		t.Errorf("unexpected entry: %+v", got[0])
+	}
+}
+
+func TestRenderNetshBatch(t *testing.T) {
+	plan := &ruleset.Plan{
+		Add: []rules.Rule{{
+			Name:        "browser",
+			Application: "C:\\Program Files\\Firefox\\firefox.exe",
+			Action:      "allow",
+			Protocol:    "tcp",
+			Direction:   "outbound",
+			Ports:       []int{443},
+		}},
+		Stale: []ruleset.Installed{
+			{Name: "old", Fingerprint: "x", Ref: "old"},
+			{Name: "old", Fingerprint: "x", Ref: "old"},
+		},
+	}
+
+	script := renderNetshBatch(plan)
+
+	if strings.Count(script, "delete rule name=old") != 1 {
+		t.Errorf("expected a single delete for duplicate stale entries:\n%s", script)
+	}
+	if !strings.Contains(script, `program="C:\Program Files\Firefox\firefox.exe"`) {
+		t.Errorf("expected quoted program path:\n%s", script)
+	}
+	if !strings.Contains(script, "description=firewall-rule:browser:") {
+		t.Errorf("expected tagged description:\n%s", script)
+	}
+}
+
+func TestNetshFirewallPolicy(t *testing.T) {
+	current := map[string]profilePolicy{
+		"domain":  {"blockinbound", "allowoutbound"},
+		"private": {"blockinbound", "allowoutbound"},
+		"public":  {"blockinboundalways", "allowoutbound"},
+	}
+	desired := rules.DefaultPolicy{Outbound: "deny"}.CatchAll()
+
+	// The first catch-all records the original policies and only touches the
+	// direction it covers.
+	script := netshFirewallPolicy(desired, current, nil)
+	for _, want := range []string{
+		"add rule name=default-policy-saved dir=in action=block enable=no description=firewall-policy:domain=blockinbound,allowoutbound;private=blockinbound,allowoutbound;public=blockinboundalways,allowoutbound\n",
+		"set domainprofile firewallpolicy blockinbound,blockoutbound\n",
+		"set publicprofile firewallpolicy blockinboundalways,blockoutbound\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+
+	// Once applied nothing changes, and the inbound catch-all maps like the
+	// outbound one.
+	applied := map[string]profilePolicy{}
+	for name, p := range current {
+		applied[name] = profilePolicy{p.Inbound, "blockoutbound"}
+	}
+	if got := netshFirewallPolicy(desired, applied, current); got != "" {
+		t.Errorf("converged policy should need no lines, got %q", got)
+	}
+	desired = rules.DefaultPolicy{Inbound: "allow", Outbound: "deny"}.CatchAll()
+	if got := netshFirewallPolicy(desired, applied, current); strings.Count(got, "firewallpolicy allowinbound,blockoutbound") != 3 {
+		t.Errorf("inbound allow should apply to every profile, got %q", got)
+	}
+
+	// Without catch-alls the recorded policies come back and the record goes.
+	script = netshFirewallPolicy(nil, applied, current)
+	if !strings.Contains(script, "set publicprofile firewallpolicy blockinboundalways,allowoutbound\n") ||
+		!strings.HasSuffix(script, "delete rule name=default-policy-saved\n") {
+		t.Errorf("unexpected restore script:\n%s", script)
+	}
+	if got := netshFirewallPolicy(nil, current, nil); got != "" {
+		t.Errorf("prompting everywhere should leave the profiles alone, got %q", got)
+	}
+
+	if args := strings.Join(netshAddArgs(desired[1]), " "); !strings.Contains(args, "enable=no") {
+		t.Errorf("deny catch-all should be added disabled: %s", args)
+	}
+}
+
+func TestParseFirewallPolicies(t *testing.T) {
+	output := `
+Domain Profile Settings:
+----------------------------------------------------------------------
+Firewall Policy                       BlockInbound,AllowOutbound
+
+Private Profile Settings:
+----------------------------------------------------------------------
+Firewall Policy                       AllowInbound,BlockOutbound
+Ok.
+`
+	got := parseFirewallPolicies(output)
+	if len(got) != 2 || got["domain"] != (profilePolicy{"blockinbound", "allowoutbound"}) || got["private"] != (profilePolicy{"allowinbound", "blockoutbound"}) {
+		t.Errorf("parseFirewallPolicies = %+v", got)
+	}
+
+	rulesOutput := `
+Rule Name:                            default-policy-saved
+----------------------------------------------------------------------
+Description:                          firewall-policy:` + formatPolicies(got) + `
+Enabled:                              No
+`
+	saved, ok := parseSavedPolicies(rulesOutput)
+	if !ok || len(saved) != 2 || saved["private"] != got["private"] {
+		t.Errorf("parseSavedPolicies = %+v, %v", saved, ok)
+	}
+	if len(parseNetshRules(rulesOutput)) != 0 {
+		t.Error("the saved policy record should not be treated as a managed rule")
+	}
+}
+
+func TestNetshUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		rule rules.Rule
+		want string
+	}{
+		{"exact path", rules.Rule{Application: `C:\app.exe`, Action: "allow"}, ""},
+		{"pattern", rules.Rule{Application: `C:\Program Files\`, Action: "allow"}, "application pattern"},
+		{"pinned allow", rules.Rule{Application: `C:\app.exe`, Action: "allow", SHA256: strings.Repeat("ab", 32)}, "pin"},
+		{"pinned deny", rules.Rule{Application: `C:\app.exe`, Action: "deny", SHA256: strings.Repeat("ab", 32)}, ""},
+		{"owner user", rules.Rule{Application: "any", Action: "deny", User: "svc"}, "user or group"},
+		{"owner group", rules.Rule{Application: "any", Action: "allow", Group: "staff"}, "user or group"},
+	}
+	for _, tt := range tests {
+		got := netshUnsupported(tt.rule)
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: netshUnsupported = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBlockOverrides(t *testing.T) {
+	list := []rules.Rule{
+		{Name: "block-all", Application: "any", Action: "deny", Protocol: "any", Direction: "outbound", Priority: 10},
+		{Name: "browser", Application: `C:\Firefox\firefox.exe`, Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "mail", Application: `C:\Mail\mail.exe`, Action: "allow", Protocol: "tcp", Direction: "inbound", Ports: []int{25}},
+		{Name: "block-dns", Application: "any", Action: "deny", Protocol: "udp", Direction: "outbound", Ports: []int{53}, Priority: 5},
+	}
+	list = append(list, rules.DefaultPolicy{Outbound: "deny"}.CatchAll()...)
+
+	got := blockOverrides(list)
+	if len(got) != 1 || got[0] != (override{allow: "browser", deny: "block-all"}) {
+		t.Errorf("blockOverrides = %+v", got)
+	}
+}
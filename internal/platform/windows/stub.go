@@ -5,6 +5,7 @@ package windows
 import (
 	"fmt"
 
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 )
 
@@ -12,3 +13,21 @@ func ApplyRule(r rules.Rule) error {
 	_ = r
 	return fmt.Errorf("windows adapter not available on this platform")
 }
+
+func PlanRuleset(desired []rules.Rule) (*ruleset.Plan, error) {
+	_ = desired
+	return nil, fmt.Errorf("windows adapter not available on this platform")
+}
+
+func ApplyPlan(p *ruleset.Plan) error {
+	_ = p
+	return fmt.Errorf("windows adapter not available on this platform")
+}
+
+func Init() error {
+	return fmt.Errorf("windows adapter not available on this platform")
+}
+
+func Teardown() error {
+	return fmt.Errorf("windows adapter not available on this platform")
+}
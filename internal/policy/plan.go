@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Action is what applying a document does to one rule or profile.
+type Action string
+
+const (
+	Create    Action = "create"
+	Update    Action = "update"
+	Delete    Action = "delete"
+	Unchanged Action = "unchanged"
+)
+
+// Change is the planned action for one rule or profile.
+type Change struct {
+	Kind   string // "rule" or "profile"
+	Name   string
+	Action Action
+}
+
+// Plan lists the changes that converge the stores on a document and the
+// writes that carry them out.
+type Plan struct {
+	Changes      []Change
+	SaveRules    []rules.Rule
+	SaveProfiles []profiles.Profile // parents before the profiles extending them
+	DeleteRules  []string
+}
+
+// Empty reports whether the stores already match the document.
+func (p *Plan) Empty() bool {
+	return len(p.SaveRules) == 0 && len(p.SaveProfiles) == 0 && len(p.DeleteRules) == 0
+}
+
+// Count returns how many changes have the given action.
+func (p *Plan) Count(a Action) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == a {
+			n++
+		}
+	}
+	return n
+}
+
+// Compute plans how to converge the stored rules and profiles on doc. Rules
+// and profiles the document declares are created or updated; with prune,
+// stored rules it does not declare are deleted, which also drops them from
+// stored profiles. Profiles missing from the document are left alone and
+// declared profiles keep whether they are active.
+func Compute(doc *Document, storedRules []rules.Rule, storedProfiles []profiles.Profile, prune bool) (*Plan, error) {
+	ruleList, profileList, err := doc.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+
+	ruleByName := make(map[string]rules.Rule, len(storedRules))
+	for _, r := range storedRules {
+		ruleByName[r.Name] = r
+	}
+	available := make(map[string]bool)
+	for _, r := range ruleList {
+		available[r.Name] = true
+		stored, ok := ruleByName[r.Name]
+		switch {
+		case !ok:
+			plan.add("rule", r.Name, Create)
+			plan.SaveRules = append(plan.SaveRules, r)
+		case rules.Equal(stored, r):
+			plan.add("rule", r.Name, Unchanged)
+		default:
+			plan.add("rule", r.Name, Update)
+			plan.SaveRules = append(plan.SaveRules, r)
+		}
+	}
+	for _, r := range storedRules {
+		if available[r.Name] {
+			continue
+		}
+		if prune {
+			plan.add("rule", r.Name, Delete)
+			plan.DeleteRules = append(plan.DeleteRules, r.Name)
+		} else {
+			available[r.Name] = true
+		}
+	}
+
+	profileByName := make(map[string]profiles.Profile, len(storedProfiles)+len(profileList))
+	for _, p := range storedProfiles {
+		profileByName[p.Name] = p
+	}
+	declared := make(map[string]profiles.Profile, len(profileList))
+	for _, p := range profileList {
+		for _, list := range [][]string{p.Rules, p.Exclude} {
+			for _, name := range list {
+				if !available[name] {
+					return nil, fmt.Errorf("profile %q references rule %q, which is not declared", p.Name, name)
+				}
+			}
+		}
+		declared[p.Name] = p
+	}
+	lookup := func(name string) (*profiles.Profile, error) {
+		if p, ok := declared[name]; ok {
+			return &p, nil
+		}
+		if p, ok := profileByName[name]; ok {
+			return &p, nil
+		}
+		return nil, sql.ErrNoRows
+	}
+	names := make([]string, 0, len(profileList))
+	for _, p := range profileList {
+		if err := profiles.ValidateInheritance(p, lookup); err != nil {
+			return nil, err
+		}
+		names = append(names, p.Name)
+	}
+	ordered, err := profiles.Closure(names, lookup)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ordered {
+		if _, ok := declared[p.Name]; !ok {
+			continue
+		}
+		stored, ok := profileByName[p.Name]
+		switch {
+		case !ok:
+			plan.add("profile", p.Name, Create)
+			plan.SaveProfiles = append(plan.SaveProfiles, p)
+		case profiles.Equal(stored, p):
+			plan.add("profile", p.Name, Unchanged)
+		default:
+			p.Active = stored.Active
+			plan.add("profile", p.Name, Update)
+			plan.SaveProfiles = append(plan.SaveProfiles, p)
+		}
+	}
+	return plan, nil
+}
+
+func (p *Plan) add(kind, name string, a Action) {
+	p.Changes = append(p.Changes, Change{Kind: kind, Name: name, Action: a})
+}
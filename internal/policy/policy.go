@@ -0,0 +1,229 @@
+// Package policy implements the declarative desired-state document applied by
+// "firewall apply": one YAML or JSON file listing every rule and profile a
+// machine should have.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Version is the newest document version this package understands.
+const Version = 1
+
+// Document describes the desired rules and profiles. Keys are snake_case in
+// both YAML and JSON.
+type Document struct {
+	Version  int           `yaml:"version" json:"version"`
+	Rules    []RuleSpec    `yaml:"rules" json:"rules"`
+	Profiles []ProfileSpec `yaml:"profiles,omitempty" json:"profiles,omitempty"`
+}
+
+// RuleSpec is a rule as written in a document. Action, protocol and direction
+// default to allow, tcp and outbound like "rules add"; temporary rules cannot
+// be declared.
+type RuleSpec struct {
+	Name            string   `yaml:"name" json:"name"`
+	Application     string   `yaml:"application" json:"application"`
+	Action          string   `yaml:"action,omitempty" json:"action,omitempty"`
+	Protocol        string   `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+	Direction       string   `yaml:"direction,omitempty" json:"direction,omitempty"`
+	Ports           []int    `yaml:"ports,omitempty" json:"ports,omitempty"`
+	LocalPorts      []string `yaml:"local_ports,omitempty" json:"local_ports,omitempty"`
+	RemotePorts     []string `yaml:"remote_ports,omitempty" json:"remote_ports,omitempty"`
+	RemoteAddresses []string `yaml:"remote_addresses,omitempty" json:"remote_addresses,omitempty"`
+	LocalAddresses  []string `yaml:"local_addresses,omitempty" json:"local_addresses,omitempty"`
+	User            string   `yaml:"user,omitempty" json:"user,omitempty"`
+	Group           string   `yaml:"group,omitempty" json:"group,omitempty"`
+	Priority        int      `yaml:"priority,omitempty" json:"priority,omitempty"`
+	SHA256          string   `yaml:"sha256,omitempty" json:"sha256,omitempty"`
+	Package         string   `yaml:"package,omitempty" json:"package,omitempty"`
+	Schedule        string   `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+}
+
+// ProfileSpec is a profile as written in a document.
+type ProfileSpec struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Rules       []string `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Extends     []string `yaml:"extends,omitempty" json:"extends,omitempty"`
+	Exclude     []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	Schedule    string   `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+
+	// DefaultPolicy is written as "inbound=deny,outbound=prompt"; see
+	// rules.ParseDefaultPolicy.
+	DefaultPolicy string `yaml:"default_policy,omitempty" json:"default_policy,omitempty"`
+}
+
+// Parse decodes a YAML or JSON document; JSON is read as the YAML subset it
+// is. Unknown keys are rejected so that typos do not silently drop settings.
+func Parse(data []byte) (*Document, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty policy document")
+		}
+		return nil, fmt.Errorf("invalid policy document: %w", err)
+	}
+	if doc.Version == 0 {
+		doc.Version = Version
+	}
+	if doc.Version > Version {
+		return nil, fmt.Errorf("unsupported policy version %d", doc.Version)
+	}
+	return &doc, nil
+}
+
+// Rule converts the spec into a validated rule.
+func (s RuleSpec) Rule() (rules.Rule, error) {
+	r := rules.Rule{
+		Name:            s.Name,
+		Application:     s.Application,
+		Action:          s.Action,
+		Protocol:        s.Protocol,
+		Direction:       s.Direction,
+		Ports:           s.Ports,
+		User:            s.User,
+		Group:           s.Group,
+		Priority:        s.Priority,
+		SHA256:          s.SHA256,
+		Package:         s.Package,
+		RemoteAddresses: s.RemoteAddresses,
+		LocalAddresses:  s.LocalAddresses,
+		LocalPorts:      s.LocalPorts,
+		RemotePorts:     s.RemotePorts,
+	}
+	if r.Action == "" {
+		r.Action = "allow"
+	}
+	if r.Protocol == "" {
+		r.Protocol = "tcp"
+	}
+	if r.Direction == "" {
+		r.Direction = "outbound"
+	}
+	if s.Schedule != "" {
+		sched, err := rules.ParseSchedule(s.Schedule)
+		if err != nil {
+			return rules.Rule{}, err
+		}
+		r.Schedule = sched
+	}
+	if err := rules.Validate(r); err != nil {
+		return rules.Rule{}, err
+	}
+	return r, nil
+}
+
+// FromRule converts a stored rule into its document form. Expiry and session
+// settings have no document form and are dropped.
+func FromRule(r rules.Rule) RuleSpec {
+	s := RuleSpec{
+		Name:            r.Name,
+		Application:     r.Application,
+		Action:          r.Action,
+		Protocol:        r.Protocol,
+		Direction:       r.Direction,
+		Ports:           r.Ports,
+		User:            r.User,
+		Group:           r.Group,
+		Priority:        r.Priority,
+		SHA256:          r.SHA256,
+		Package:         r.Package,
+		RemoteAddresses: r.RemoteAddresses,
+		LocalAddresses:  r.LocalAddresses,
+		LocalPorts:      r.LocalPorts,
+		RemotePorts:     r.RemotePorts,
+	}
+	if r.Schedule != nil {
+		s.Schedule = r.Schedule.String()
+	}
+	return s
+}
+
+// Profile converts the spec into a validated profile.
+func (s ProfileSpec) Profile() (profiles.Profile, error) {
+	p := profiles.Profile{
+		Name:        s.Name,
+		Description: s.Description,
+		Rules:       s.Rules,
+		Extends:     s.Extends,
+		Exclude:     s.Exclude,
+	}
+	if p.Rules == nil {
+		p.Rules = []string{}
+	}
+	if s.Schedule != "" {
+		sched, err := rules.ParseSchedule(s.Schedule)
+		if err != nil {
+			return profiles.Profile{}, err
+		}
+		p.Schedule = sched
+	}
+	policy, err := rules.ParseDefaultPolicy(s.DefaultPolicy)
+	if err != nil {
+		return profiles.Profile{}, err
+	}
+	p.DefaultPolicy = policy
+	if err := profiles.Validate(p); err != nil {
+		return profiles.Profile{}, err
+	}
+	return p, nil
+}
+
+// FromProfile converts a stored profile into its document form.
+func FromProfile(p profiles.Profile) ProfileSpec {
+	s := ProfileSpec{
+		Name:        p.Name,
+		Description: p.Description,
+		Rules:       p.Rules,
+		Extends:     p.Extends,
+		Exclude:     p.Exclude,
+	}
+	if p.Schedule != nil {
+		s.Schedule = p.Schedule.String()
+	}
+	s.DefaultPolicy = p.DefaultPolicy.String()
+	return s
+}
+
+// Resolve converts and validates every rule and profile of the document. Names
+// must be unique within their kind.
+func (d *Document) Resolve() ([]rules.Rule, []profiles.Profile, error) {
+	ruleList := make([]rules.Rule, 0, len(d.Rules))
+	seen := make(map[string]bool, len(d.Rules))
+	for i, spec := range d.Rules {
+		r, err := spec.Rule()
+		if err != nil {
+			return nil, nil, fmt.Errorf("rules[%d] %q: %w", i, spec.Name, err)
+		}
+		if seen[r.Name] {
+			return nil, nil, fmt.Errorf("rule %q is declared twice", r.Name)
+		}
+		seen[r.Name] = true
+		ruleList = append(ruleList, r)
+	}
+	profileList := make([]profiles.Profile, 0, len(d.Profiles))
+	seen = make(map[string]bool, len(d.Profiles))
+	for i, spec := range d.Profiles {
+		p, err := spec.Profile()
+		if err != nil {
+			return nil, nil, fmt.Errorf("profiles[%d] %q: %w", i, spec.Name, err)
+		}
+		if seen[p.Name] {
+			return nil, nil, fmt.Errorf("profile %q is declared twice", p.Name)
+		}
+		seen[p.Name] = true
+		profileList = append(profileList, p)
+	}
+	return ruleList, profileList, nil
+}
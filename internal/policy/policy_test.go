@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+const testDocument = `
+version: 1
+rules:
+  - name: web
+    application: any
+    ports: [80, 443]
+  - name: dns
+    application: any
+    protocol: udp
+    ports: [53]
+profiles:
+  - name: work
+    description: Work
+    extends: [base]
+    rules: [web]
+  - name: base
+    description: Base
+    rules: [dns]
+`
+
+func TestParse(t *testing.T) {
+	doc, err := Parse([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	ruleList, profileList, err := doc.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	web := ruleList[0]
+	if web.Action != "allow" || web.Protocol != "tcp" || web.Direction != "outbound" || len(web.Ports) != 2 {
+		t.Errorf("web = %+v, want defaults allow/tcp/outbound", web)
+	}
+	if len(profileList) != 2 || profileList[0].Extends[0] != "base" {
+		t.Errorf("profiles = %+v", profileList)
+	}
+
+	if _, err := Parse([]byte(`{"version": 1, "rules": [{"name": "web", "application": "any", "protocol": "any"}]}`)); err != nil {
+		t.Errorf("JSON document: %v", err)
+	}
+	if _, err := Parse([]byte("rules:\n  - name: web\n    aplication: any\n")); err == nil {
+		t.Errorf("expected an unknown key to be rejected")
+	}
+	if _, err := Parse([]byte("version: 2\n")); err == nil {
+		t.Errorf("expected a newer version to be rejected")
+	}
+	doc, _ = Parse([]byte("rules:\n  - name: web\n    application: any\n    action: maybe\n"))
+	if _, _, err := doc.Resolve(); err == nil || !strings.Contains(err.Error(), `rules[0] "web"`) {
+		t.Errorf("invalid rule error = %v", err)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	doc, err := Parse([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	storedRules := []rules.Rule{
+		{Name: "web", Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{80, 443}},
+		{Name: "dns", Application: "any", Action: "allow", Protocol: "udp", Direction: "outbound", Ports: []int{5353}},
+		{Name: "old", Application: "any", Action: "deny", Protocol: "any", Direction: "inbound"},
+	}
+	storedProfiles := []profiles.Profile{{Name: "work", Description: "Work", Active: true, Rules: []string{"web", "old"}}}
+
+	summary := func(plan *Plan) string {
+		var parts []string
+		for _, c := range plan.Changes {
+			parts = append(parts, c.Kind+" "+c.Name+"="+string(c.Action))
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	plan, err := Compute(doc, storedRules, storedProfiles, false)
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+	if got, want := summary(plan), "rule web=unchanged, rule dns=update, profile base=create, profile work=update"; got != want {
+		t.Errorf("plan = %s\nwant %s", got, want)
+	}
+	if len(plan.SaveProfiles) != 2 || plan.SaveProfiles[0].Name != "base" || !plan.SaveProfiles[1].Active {
+		t.Errorf("profiles to save = %+v, want base first and work still active", plan.SaveProfiles)
+	}
+
+	plan, err = Compute(doc, storedRules, storedProfiles, true)
+	if err != nil {
+		t.Fatalf("Compute with prune: %v", err)
+	}
+	if len(plan.DeleteRules) != 1 || plan.DeleteRules[0] != "old" || plan.Count(Delete) != 1 {
+		t.Errorf("pruned rules = %v", plan.DeleteRules)
+	}
+
+	// With prune, a profile may only use rules the document declares.
+	doc.Profiles[1].Rules = []string{"dns", "old"}
+	if _, err := Compute(doc, storedRules, storedProfiles, true); err == nil {
+		t.Errorf("expected a reference to a pruned rule to be rejected")
+	}
+	if _, err := Compute(doc, storedRules, storedProfiles, false); err != nil {
+		t.Errorf("stored rule without prune: %v", err)
+	}
+
+	doc.Profiles[1].Extends = []string{"work"}
+	if _, err := Compute(doc, storedRules, storedProfiles, false); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("cycle error = %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package profiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Bundle format identifiers. A bundle with a newer version than BundleVersion
+// is rejected instead of being imported partially.
+const (
+	BundleFormat  = "firewall-profile-bundle"
+	BundleVersion = 1
+)
+
+// Bundle is a self-contained export of one or more profiles: it carries every
+// profile they extend and the full definition of every rule they reference,
+// so it can be imported into an empty database.
+type Bundle struct {
+	Format    string       `json:"format"`
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Host      string       `json:"host,omitempty"`
+	Profiles  []Profile    `json:"profiles"` // parents before the profiles extending them
+	Rules     []rules.Rule `json:"rules"`
+
+	// Checksum is the hex SHA-256 of the bundle encoded with an empty
+	// checksum; it detects truncated or hand-edited files.
+	Checksum string `json:"checksum"`
+}
+
+// NewBundle packs profiles and the rules they reference into a bundle and
+// seals it with its checksum. Profiles are exported inactive.
+func NewBundle(list []Profile, ruleList []rules.Rule, now time.Time) (*Bundle, error) {
+	b := &Bundle{
+		Format:    BundleFormat,
+		Version:   BundleVersion,
+		CreatedAt: now.UTC(),
+		Profiles:  make([]Profile, 0, len(list)),
+		Rules:     ruleList,
+	}
+	if b.Rules == nil {
+		b.Rules = []rules.Rule{}
+	}
+	if host, err := os.Hostname(); err == nil {
+		b.Host = host
+	}
+	for _, p := range list {
+		p.Active = false
+		b.Profiles = append(b.Profiles, p)
+	}
+	sum, err := b.sum()
+	if err != nil {
+		return nil, err
+	}
+	b.Checksum = sum
+	return b, nil
+}
+
+// sum computes the checksum of b.
+func (b Bundle) sum() (string, error) {
+	b.Checksum = ""
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// ParseBundle decodes and verifies a bundle. A plain profile as written by
+// earlier versions of "profiles export" is accepted as a bundle holding only
+// that profile; the rules it names must then already exist.
+func ParseBundle(data []byte) (*Bundle, error) {
+	// Field names match case-insensitively, so a profile's "Rules" would
+	// decode into the bundle's rules; look at the format first.
+	var header struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Format == "" {
+		var p Profile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, err
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("not a profile bundle")
+		}
+		return &Bundle{Profiles: []Profile{p}}, nil
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	if b.Format != BundleFormat {
+		return nil, fmt.Errorf("unknown bundle format %q", b.Format)
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	sum, err := b.sum()
+	if err != nil {
+		return nil, err
+	}
+	if b.Checksum != sum {
+		return nil, fmt.Errorf("bundle checksum mismatch: the file is damaged or was modified")
+	}
+	return &b, nil
+}
+
+// Closure returns the named profiles together with every profile they extend,
+// directly or indirectly, parents first and each profile once.
+func Closure(names []string, lookup Lookup) ([]Profile, error) {
+	var out []Profile
+	done := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		for _, n := range path {
+			if n == name {
+				return fmt.Errorf("profile inheritance cycle at %q", name)
+			}
+		}
+		p, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		for _, parent := range p.Extends {
+			if err := visit(parent, append(path, name)); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		out = append(out, *p)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Strategy decides what importing does with a bundle item whose name is
+// already taken by a different rule or profile. Items identical to the stored
+// ones are never conflicts.
+type Strategy string
+
+const (
+	StrategySkip      Strategy = "skip"      // keep the stored item
+	StrategyOverwrite Strategy = "overwrite" // replace it with the bundle's
+	StrategyRename    Strategy = "rename"    // import the bundle's under a new name
+)
+
+// ParseStrategy validates a conflict strategy name.
+func ParseStrategy(s string) (Strategy, error) {
+	switch st := Strategy(s); st {
+	case StrategySkip, StrategyOverwrite, StrategyRename:
+		return st, nil
+	}
+	return "", fmt.Errorf("invalid conflict strategy %q (want skip, overwrite or rename)", s)
+}
+
+// ImportAction is what importing does with one bundle item.
+type ImportAction string
+
+const (
+	ImportCreate    ImportAction = "create"
+	ImportUnchanged ImportAction = "unchanged"
+	ImportSkip      ImportAction = "skip"
+	ImportOverwrite ImportAction = "overwrite"
+	ImportRename    ImportAction = "rename"
+)
+
+// ImportItem describes the outcome for one rule or profile of a bundle.
+type ImportItem struct {
+	Kind   string // "rule" or "profile"
+	Name   string // name in the bundle
+	Action ImportAction
+	As     string // name it is stored under; differs from Name when renamed
+}
+
+// ImportPlan is the preview of an import: the outcome per item and the rules
+// and profiles to write, with references to renamed items already rewritten.
+type ImportPlan struct {
+	Items    []ImportItem
+	Rules    []rules.Rule
+	Profiles []Profile // parents before the profiles extending them
+}
+
+// Empty reports whether applying the plan would change nothing.
+func (p *ImportPlan) Empty() bool {
+	return len(p.Rules) == 0 && len(p.Profiles) == 0
+}
+
+// PlanImport decides how b merges into the stored rules and profiles under
+// strategy. A profile that is skipped keeps its stored definition, and bundle
+// profiles referencing a skipped rule use the stored rule of that name.
+// Imported profiles are inactive unless they overwrite the active profile.
+func PlanImport(b *Bundle, strategy Strategy, storedRules []rules.Rule, storedProfiles []Profile) (*ImportPlan, error) {
+	if _, err := ParseStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+	plan := &ImportPlan{}
+
+	ruleByName := make(map[string]rules.Rule, len(storedRules))
+	ruleTaken := make(map[string]bool)
+	for _, r := range storedRules {
+		ruleByName[r.Name] = r
+		ruleTaken[r.Name] = true
+	}
+	for _, r := range b.Rules {
+		ruleTaken[r.Name] = true
+	}
+	ruleAs := make(map[string]string, len(b.Rules))
+	for _, r := range b.Rules {
+		if _, dup := ruleAs[r.Name]; dup {
+			return nil, fmt.Errorf("bundle lists rule %q twice", r.Name)
+		}
+		item := ImportItem{Kind: "rule", Name: r.Name, As: r.Name}
+		stored, exists := ruleByName[r.Name]
+		switch {
+		case !exists:
+			item.Action = ImportCreate
+		case rules.Equal(stored, r):
+			item.Action = ImportUnchanged
+		case strategy == StrategySkip:
+			item.Action = ImportSkip
+		case strategy == StrategyOverwrite:
+			item.Action = ImportOverwrite
+		default:
+			item.Action = ImportRename
+			item.As = freeName(r.Name, ruleTaken)
+			r.Name = item.As
+		}
+		ruleAs[item.Name] = item.As
+		plan.Items = append(plan.Items, item)
+		if item.Action == ImportCreate || item.Action == ImportOverwrite || item.Action == ImportRename {
+			plan.Rules = append(plan.Rules, r)
+		}
+	}
+
+	profileByName := make(map[string]Profile, len(storedProfiles))
+	profileTaken := make(map[string]bool)
+	for _, p := range storedProfiles {
+		profileByName[p.Name] = p
+		profileTaken[p.Name] = true
+	}
+	for _, p := range b.Profiles {
+		profileTaken[p.Name] = true
+	}
+	ordered, err := parentsFirst(b.Profiles)
+	if err != nil {
+		return nil, err
+	}
+	profileAs := make(map[string]string, len(ordered))
+	for _, p := range ordered {
+		p.Rules = renamed(p.Rules, ruleAs)
+		p.Exclude = renamed(p.Exclude, ruleAs)
+		p.Extends = renamed(p.Extends, profileAs)
+		p.Active = false
+		if p.Rules == nil {
+			p.Rules = []string{}
+		}
+
+		item := ImportItem{Kind: "profile", Name: p.Name, As: p.Name}
+		stored, exists := profileByName[p.Name]
+		switch {
+		case !exists:
+			item.Action = ImportCreate
+		case Equal(stored, p):
+			item.Action = ImportUnchanged
+		case strategy == StrategySkip:
+			item.Action = ImportSkip
+		case strategy == StrategyOverwrite:
+			item.Action = ImportOverwrite
+			p.Active = stored.Active
+		default:
+			item.Action = ImportRename
+			item.As = freeName(p.Name, profileTaken)
+			p.Name = item.As
+		}
+		profileAs[item.Name] = item.As
+		plan.Items = append(plan.Items, item)
+		if item.Action == ImportCreate || item.Action == ImportOverwrite || item.Action == ImportRename {
+			plan.Profiles = append(plan.Profiles, p)
+		}
+	}
+	return plan, nil
+}
+
+// parentsFirst orders profiles so that each comes after the bundle profiles
+// it extends.
+func parentsFirst(list []Profile) ([]Profile, error) {
+	byName := make(map[string]Profile, len(list))
+	for _, p := range list {
+		if _, dup := byName[p.Name]; dup {
+			return nil, fmt.Errorf("bundle lists profile %q twice", p.Name)
+		}
+		byName[p.Name] = p
+	}
+	lookup := func(name string) (*Profile, error) {
+		p, ok := byName[name]
+		if !ok {
+			// Parents outside the bundle must already be stored; the
+			// store checks that when the profile is saved.
+			return &Profile{Name: name}, nil
+		}
+		return &p, nil
+	}
+	names := make([]string, 0, len(list))
+	for _, p := range list {
+		names = append(names, p.Name)
+	}
+	closure, err := Closure(names, lookup)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Profile, 0, len(list))
+	for _, p := range closure {
+		if _, ok := byName[p.Name]; ok {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// renamed maps names through as, keeping those it does not list.
+func renamed(list []string, as map[string]string) []string {
+	if list == nil {
+		return nil
+	}
+	out := make([]string, len(list))
+	for i, name := range list {
+		if n, ok := as[name]; ok {
+			name = n
+		}
+		out[i] = name
+	}
+	return out
+}
+
+// freeName returns the first of name-imported, name-imported-2, ... not in
+// taken and marks it taken.
+func freeName(name string, taken map[string]bool) string {
+	candidate := name + "-imported"
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-imported-%d", name, i)
+	}
+	taken[candidate] = true
+	return candidate
+}
@@ -0,0 +1,125 @@
+package profiles
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func bundleRule(name, action string) rules.Rule {
+	return rules.Rule{Name: name, Application: "any", Action: action, Protocol: "any", Direction: "outbound"}
+}
+
+func TestBundle_Checksum(t *testing.T) {
+	b, err := NewBundle([]Profile{{Name: "work", Description: "Work", Active: true, Rules: []string{"web"}}},
+		[]rules.Rule{bundleRule("web", "allow")}, time.Now())
+	if err != nil {
+		t.Fatalf("NewBundle: %v", err)
+	}
+	if b.Profiles[0].Active {
+		t.Errorf("exported profile is still active")
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	got, err := ParseBundle(data)
+	if err != nil {
+		t.Fatalf("ParseBundle: %v", err)
+	}
+	if len(got.Profiles) != 1 || len(got.Rules) != 1 || got.Rules[0].Name != "web" {
+		t.Errorf("parsed bundle = %+v", got)
+	}
+
+	tampered := strings.Replace(string(data), `"Action":"allow"`, `"Action":"deny"`, 1)
+	if _, err := ParseBundle([]byte(tampered)); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("tampered bundle error = %v, want checksum mismatch", err)
+	}
+
+	legacy, err := ParseBundle([]byte(`{"Name":"old","Description":"Old","Rules":["web"]}`))
+	if err != nil || len(legacy.Profiles) != 1 || legacy.Profiles[0].Name != "old" {
+		t.Errorf("legacy profile = %+v, %v", legacy, err)
+	}
+	if _, err := ParseBundle([]byte(`{"format":"firewall-profile-bundle","version":99}`)); err == nil {
+		t.Errorf("expected error for a newer bundle version")
+	}
+}
+
+func TestClosure_ParentsFirst(t *testing.T) {
+	lookup := mapLookup(
+		Profile{Name: "base", Rules: []string{"dns"}},
+		Profile{Name: "dev", Extends: []string{"base"}, Rules: []string{"git"}},
+		Profile{Name: "work", Extends: []string{"dev", "base"}},
+	)
+	list, err := Closure([]string{"work"}, lookup)
+	if err != nil {
+		t.Fatalf("Closure: %v", err)
+	}
+	var got []string
+	for _, p := range list {
+		got = append(got, p.Name)
+	}
+	if strings.Join(got, ",") != "base,dev,work" {
+		t.Errorf("closure = %v, want base,dev,work", got)
+	}
+}
+
+func TestPlanImport_Strategies(t *testing.T) {
+	b := &Bundle{
+		Rules: []rules.Rule{bundleRule("web", "allow"), bundleRule("ssh", "allow"), bundleRule("dns", "allow")},
+		Profiles: []Profile{
+			{Name: "work", Description: "Work", Extends: []string{"base"}, Rules: []string{"web", "ssh"}},
+			{Name: "base", Description: "Base", Rules: []string{"dns"}},
+		},
+	}
+	storedRules := []rules.Rule{bundleRule("web", "allow"), bundleRule("ssh", "deny")}
+	storedProfiles := []Profile{{Name: "work", Description: "Local work", Active: true, Rules: []string{"web"}}}
+
+	summary := func(plan *ImportPlan) string {
+		var parts []string
+		for _, item := range plan.Items {
+			s := item.Kind + " " + item.Name + "=" + string(item.Action)
+			if item.As != item.Name {
+				s += ">" + item.As
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	tests := []struct {
+		strategy Strategy
+		want     string
+	}{
+		{StrategySkip, "rule web=unchanged, rule ssh=skip, rule dns=create, profile base=create, profile work=skip"},
+		{StrategyOverwrite, "rule web=unchanged, rule ssh=overwrite, rule dns=create, profile base=create, profile work=overwrite"},
+		{StrategyRename, "rule web=unchanged, rule ssh=rename>ssh-imported, rule dns=create, profile base=create, profile work=rename>work-imported"},
+	}
+	for _, tt := range tests {
+		plan, err := PlanImport(b, tt.strategy, storedRules, storedProfiles)
+		if err != nil {
+			t.Fatalf("%s: PlanImport: %v", tt.strategy, err)
+		}
+		if got := summary(plan); got != tt.want {
+			t.Errorf("%s: plan = %s\nwant %s", tt.strategy, got, tt.want)
+		}
+		switch tt.strategy {
+		case StrategyOverwrite:
+			if !plan.Profiles[1].Active {
+				t.Errorf("overwriting the active profile deactivated it")
+			}
+		case StrategyRename:
+			work := plan.Profiles[1]
+			if work.Name != "work-imported" || strings.Join(work.Rules, ",") != "web,ssh-imported" || work.Active {
+				t.Errorf("renamed profile = %+v", work)
+			}
+		}
+	}
+
+	if _, err := PlanImport(b, "merge", nil, nil); err == nil {
+		t.Errorf("expected error for an unknown strategy")
+	}
+}
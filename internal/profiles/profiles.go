@@ -1,6 +1,11 @@
 package profiles
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
 
 // Profile represents a firewall configuration profile.
 type Profile struct {
@@ -8,9 +13,24 @@ type Profile struct {
 	Description string
 	Active      bool
 	Rules       []string // Rule names belonging to this profile
+
+	// Extends names parent profiles whose effective rules this profile
+	// inherits, in order. Exclude drops inherited rules; a rule listed in
+	// Rules is always part of the profile.
+	Extends []string
+	Exclude []string
+
+	// Schedule makes the scheduler activate the profile while it is in effect;
+	// profiles without one are only activated by hand.
+	Schedule *rules.Schedule
+
+	// DefaultPolicy decides connections none of the profile's rules match.
+	// Unset directions are inherited; see EffectivePolicy.
+	DefaultPolicy rules.DefaultPolicy
 }
 
-// Validate performs basic profile validation.
+// Validate performs basic profile validation. Inheritance across profiles is
+// checked by ValidateInheritance.
 func Validate(p Profile) error {
 	if p.Name == "" {
 		return fmt.Errorf("profile name is required")
@@ -18,5 +38,172 @@ func Validate(p Profile) error {
 	if p.Description == "" {
 		return fmt.Errorf("profile description is required")
 	}
+	if err := p.DefaultPolicy.Validate(); err != nil {
+		return fmt.Errorf("profile %q default policy: %w", p.Name, err)
+	}
+	seen := make(map[string]bool, len(p.Extends))
+	for _, parent := range p.Extends {
+		if parent == p.Name {
+			return fmt.Errorf("profile %q cannot extend itself", p.Name)
+		}
+		if seen[parent] {
+			return fmt.Errorf("profile %q extends %q twice", p.Name, parent)
+		}
+		seen[parent] = true
+	}
+	own := make(map[string]bool, len(p.Rules))
+	for _, r := range p.Rules {
+		own[r] = true
+	}
+	for _, r := range p.Exclude {
+		if own[r] {
+			return fmt.Errorf("profile %q both includes and excludes rule %q", p.Name, r)
+		}
+	}
 	return nil
 }
+
+// Equal reports whether two profiles have the same definition; whether they
+// are active does not matter and empty and missing lists are alike.
+func Equal(a, b Profile) bool {
+	return a.Name == b.Name && a.Description == b.Description &&
+		sameNames(a.Rules, b.Rules) && sameNames(a.Extends, b.Extends) && sameNames(a.Exclude, b.Exclude) &&
+		scheduleString(a.Schedule) == scheduleString(b.Schedule) && a.DefaultPolicy == b.DefaultPolicy
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func scheduleString(s *rules.Schedule) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
+
+// Lookup returns the stored profile with the given name.
+type Lookup func(name string) (*Profile, error)
+
+// ValidateInheritance checks that every profile p extends, directly or
+// through its parents, exists and that following Extends never leads back to
+// a profile already on the path. Profiles are read through lookup, except p
+// itself, which may not be stored yet.
+func ValidateInheritance(p Profile, lookup Lookup) error {
+	_, err := Effective(p, lookup)
+	return err
+}
+
+// EffectiveRule is a rule in a profile's effective set together with the
+// profile that contributes it.
+type EffectiveRule struct {
+	Name string
+	From string
+}
+
+// Effective resolves the rules a profile enforces: the effective rules of its
+// parents in Extends order, without those it excludes, followed by its own
+// rules. Each rule appears once, where it is first contributed; a rule the
+// profile lists itself is attributed to it even when a parent has it too.
+func Effective(p Profile, lookup Lookup) ([]EffectiveRule, error) {
+	return resolve(p, lookup, nil)
+}
+
+func resolve(p Profile, lookup Lookup, path []string) ([]EffectiveRule, error) {
+	for _, name := range path {
+		if name == p.Name {
+			return nil, fmt.Errorf("profile inheritance cycle: %s -> %s", strings.Join(path, " -> "), p.Name)
+		}
+	}
+	path = append(path, p.Name)
+
+	excluded := make(map[string]bool, len(p.Exclude))
+	for _, r := range p.Exclude {
+		excluded[r] = true
+	}
+	own := make(map[string]bool, len(p.Rules))
+	for _, r := range p.Rules {
+		own[r] = true
+	}
+
+	var out []EffectiveRule
+	seen := make(map[string]bool)
+	for _, name := range p.Extends {
+		parent, err := lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q extends unknown profile %q: %w", p.Name, name, err)
+		}
+		inherited, err := resolve(*parent, lookup, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range inherited {
+			if excluded[r.Name] || seen[r.Name] {
+				continue
+			}
+			seen[r.Name] = true
+			if own[r.Name] {
+				r.From = p.Name
+			}
+			out = append(out, r)
+		}
+	}
+	for _, r := range p.Rules {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, EffectiveRule{Name: r, From: p.Name})
+		}
+	}
+	return out, nil
+}
+
+// EffectivePolicy resolves a profile's default policy: each direction it
+// leaves unset is taken from its parents in Extends order, the first parent
+// that sets it, directly or through its own parents, winning. Directions no
+// profile sets stay unset.
+func EffectivePolicy(p Profile, lookup Lookup) (rules.DefaultPolicy, error) {
+	return resolvePolicy(p, lookup, nil)
+}
+
+func resolvePolicy(p Profile, lookup Lookup, path []string) (rules.DefaultPolicy, error) {
+	for _, name := range path {
+		if name == p.Name {
+			return rules.DefaultPolicy{}, fmt.Errorf("profile inheritance cycle: %s -> %s", strings.Join(path, " -> "), p.Name)
+		}
+	}
+	path = append(path, p.Name)
+
+	policy := p.DefaultPolicy
+	for _, name := range p.Extends {
+		if policy.Inbound != "" && policy.Outbound != "" {
+			break
+		}
+		parent, err := lookup(name)
+		if err != nil {
+			return rules.DefaultPolicy{}, fmt.Errorf("profile %q extends unknown profile %q: %w", p.Name, name, err)
+		}
+		inherited, err := resolvePolicy(*parent, lookup, path)
+		if err != nil {
+			return rules.DefaultPolicy{}, err
+		}
+		policy = policy.Or(inherited)
+	}
+	return policy, nil
+}
+
+// RuleNames returns the names of an effective rule set.
+func RuleNames(list []EffectiveRule) []string {
+	out := make([]string, 0, len(list))
+	for _, r := range list {
+		out = append(out, r.Name)
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package profiles
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func mapLookup(list ...Profile) Lookup {
+	byName := make(map[string]*Profile, len(list))
+	for i := range list {
+		byName[list[i].Name] = &list[i]
+	}
+	return func(name string) (*Profile, error) {
+		if p, ok := byName[name]; ok {
+			return p, nil
+		}
+		return nil, sql.ErrNoRows
+	}
+}
+
+func TestEffective(t *testing.T) {
+	base := Profile{Name: "base", Description: "Base", Rules: []string{"dns", "ntp", "vpn"}}
+	office := Profile{Name: "office", Description: "Office", Rules: []string{"printer"}}
+	work := Profile{Name: "work", Description: "Work", Extends: []string{"base", "office"}, Exclude: []string{"ntp"}, Rules: []string{"vpn", "git"}}
+
+	got, err := Effective(work, mapLookup(base, office))
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	want := []EffectiveRule{{"dns", "base"}, {"vpn", "work"}, {"printer", "office"}, {"git", "work"}}
+	if len(got) != len(want) {
+		t.Fatalf("Effective = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if names := RuleNames(got); strings.Join(names, ",") != "dns,vpn,printer,git" {
+		t.Errorf("RuleNames = %v", names)
+	}
+
+	if _, err := Effective(Profile{Name: "x", Extends: []string{"missing"}}, mapLookup()); err == nil {
+		t.Error("expected an error for an unknown parent")
+	}
+}
+
+func TestValidateInheritance_Cycles(t *testing.T) {
+	a := Profile{Name: "a", Description: "A", Extends: []string{"b"}}
+	b := Profile{Name: "b", Description: "B", Extends: []string{"c"}}
+	c := Profile{Name: "c", Description: "C", Extends: []string{"a"}}
+
+	err := ValidateInheritance(a, mapLookup(a, b, c))
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Fatalf("expected the cycle to be reported, got %v", err)
+	}
+
+	// A diamond is not a cycle.
+	top := Profile{Name: "top", Description: "Top", Rules: []string{"dns"}}
+	left := Profile{Name: "left", Description: "Left", Extends: []string{"top"}}
+	right := Profile{Name: "right", Description: "Right", Extends: []string{"top"}}
+	bottom := Profile{Name: "bottom", Description: "Bottom", Extends: []string{"left", "right"}}
+	if err := ValidateInheritance(bottom, mapLookup(top, left, right)); err != nil {
+		t.Errorf("diamond inheritance rejected: %v", err)
+	}
+
+	for _, p := range []Profile{
+		{Name: "self", Description: "Self", Extends: []string{"self"}},
+		{Name: "twice", Description: "Twice", Extends: []string{"a", "a"}},
+		{Name: "both", Description: "Both", Rules: []string{"dns"}, Exclude: []string{"dns"}},
+	} {
+		if err := Validate(p); err == nil {
+			t.Errorf("Validate(%s) should fail", p.Name)
+		}
+	}
+}
+
+func TestEffectivePolicy(t *testing.T) {
+	base := Profile{Name: "base", Description: "Base", DefaultPolicy: rules.DefaultPolicy{Inbound: "deny", Outbound: "allow"}}
+	office := Profile{Name: "office", Description: "Office", DefaultPolicy: rules.DefaultPolicy{Outbound: "prompt"}}
+	work := Profile{Name: "work", Description: "Work", Extends: []string{"office", "base"}}
+
+	got, err := EffectivePolicy(work, mapLookup(base, office))
+	if err != nil {
+		t.Fatalf("EffectivePolicy: %v", err)
+	}
+	if want := (rules.DefaultPolicy{Inbound: "deny", Outbound: "prompt"}); got != want {
+		t.Errorf("EffectivePolicy = %+v, want %+v", got, want)
+	}
+
+	work.DefaultPolicy.Inbound = "allow"
+	if got, _ := EffectivePolicy(work, mapLookup(base, office)); got.Inbound != "allow" {
+		t.Errorf("own policy should win, got %+v", got)
+	}
+
+	if err := Validate(Profile{Name: "x", Description: "X", DefaultPolicy: rules.DefaultPolicy{Inbound: "block"}}); err == nil {
+		t.Error("expected an invalid default policy to be rejected")
+	}
+}
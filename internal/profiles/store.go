@@ -1,9 +1,13 @@
 package profiles
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 // Store defines persistence operations for profiles.
@@ -16,35 +20,76 @@ type Store interface {
 	GetActiveProfile() (*Profile, error)
 }
 
-// SQLiteStore is a sqlite-backed implementation of Store.
+// ContextStore adds context-aware variants of the Store operations.
+type ContextStore interface {
+	Store
+	ListProfilesContext(ctx context.Context) ([]Profile, error)
+	SaveProfileContext(ctx context.Context, profile Profile) error
+	DeleteProfileContext(ctx context.Context, name string) error
+	GetProfileContext(ctx context.Context, name string) (*Profile, error)
+	SetActiveProfileContext(ctx context.Context, name string) error
+	GetActiveProfileContext(ctx context.Context) (*Profile, error)
+}
+
+// SQLiteStore is a sqlite-backed implementation of ContextStore. Rule
+// membership lives in the profile_rules table, parents in profile_parents and
+// exclusions in profile_exclusions; their references are foreign keys, so a
+// renamed rule or profile stays referenced and a deleted rule leaves them.
 type SQLiteStore struct {
-	db *sql.DB
+	conn storage.Conn
 }
 
-// NewSQLiteStore creates a sqlite-backed profile store.
+// NewSQLiteStore creates a sqlite-backed profile store; the database must be
+// opened with storage.Open.
 func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
 	if err := initSchema(db); err != nil {
 		return nil, err
 	}
-	return &SQLiteStore{db: db}, nil
+	return &SQLiteStore{conn: storage.Conn{DB: db}}, nil
 }
 
+// initSchema brings the shared database schema up to date.
 func initSchema(db *sql.DB) error {
-	schema := `
-CREATE TABLE IF NOT EXISTS profiles (
-	name TEXT PRIMARY KEY,
-	description TEXT NOT NULL,
-	active INTEGER NOT NULL DEFAULT 0,
-	rules TEXT NOT NULL
-);
-`
-	_, err := db.Exec(schema)
+	_, err := storage.Migrate(db)
 	return err
 }
 
-// ListProfiles lists all profiles.
-func (s *SQLiteStore) ListProfiles() ([]Profile, error) {
-	rows, err := s.db.Query(`SELECT name, description, active, rules FROM profiles ORDER BY name`)
+// WithTx returns a view of the store whose reads and writes run in tx, which
+// the caller commits or rolls back.
+func (s *SQLiteStore) WithTx(tx *sql.Tx) *SQLiteStore {
+	return &SQLiteStore{conn: storage.Conn{DB: s.conn.DB, Tx: tx}}
+}
+
+// Changes returns a counter that moves whenever the database's rules or
+// profiles change; see storage.Changes.
+func (s *SQLiteStore) Changes() (int64, error) {
+	return storage.Changes(context.Background(), s.conn.Q())
+}
+
+const profileColumns = `name, description, active, schedule, inbound_policy, outbound_policy`
+
+// scanProfile decodes the columns shared by every profile query.
+func scanProfile(row interface{ Scan(...any) error }) (*Profile, error) {
+	var p Profile
+	var active int
+	var schedule string
+	if err := row.Scan(&p.Name, &p.Description, &active, &schedule, &p.DefaultPolicy.Inbound, &p.DefaultPolicy.Outbound); err != nil {
+		return nil, err
+	}
+	p.Active = active == 1
+	p.Rules = []string{}
+	sched, err := rules.ScheduleFromString(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored schedule for %s: %w", p.Name, err)
+	}
+	p.Schedule = sched
+	return &p, nil
+}
+
+// queryProfiles runs a query selecting profileColumns and loads the rules,
+// parents and exclusions of every profile it returns.
+func queryProfiles(ctx context.Context, q storage.DBTX, query string, args ...any) ([]Profile, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -52,94 +97,235 @@ func (s *SQLiteStore) ListProfiles() ([]Profile, error) {
 
 	var out []Profile
 	for rows.Next() {
-		var p Profile
-		var active int
-		var rulesJSON string
-		if err := rows.Scan(&p.Name, &p.Description, &active, &rulesJSON); err != nil {
+		p, err := scanProfile(rows)
+		if err != nil {
 			return nil, err
 		}
-		p.Active = active == 1
-		if err := json.Unmarshal([]byte(rulesJSON), &p.Rules); err != nil {
-			return nil, fmt.Errorf("unmarshal rules for %s: %w", p.Name, err)
+		out = append(out, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range out {
+		if err := loadRelations(ctx, q, &out[i]); err != nil {
+			return nil, err
 		}
-		out = append(out, p)
 	}
-	return out, rows.Err()
+	return out, nil
 }
 
-// SaveProfile validates and persists a profile.
-func (s *SQLiteStore) SaveProfile(profile Profile) error {
-	if err := Validate(profile); err != nil {
+// queryProfile is queryProfiles for a single row; it returns sql.ErrNoRows
+// when nothing matches.
+func queryProfile(ctx context.Context, q storage.DBTX, query string, args ...any) (*Profile, error) {
+	p, err := scanProfile(q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadRelations(ctx, q, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// loadRelations fills in a profile's rules, parents and exclusions.
+func loadRelations(ctx context.Context, q storage.DBTX, p *Profile) error {
+	var err error
+	if p.Rules, err = names(ctx, q, `SELECT rule_name FROM profile_rules WHERE profile_name = ? ORDER BY position`, p.Name); err != nil {
+		return err
+	}
+	if p.Extends, err = names(ctx, q, `SELECT parent_name FROM profile_parents WHERE profile_name = ? ORDER BY position`, p.Name); err != nil {
 		return err
 	}
-	rulesJSON, err := json.Marshal(profile.Rules)
+	if p.Exclude, err = names(ctx, q, `SELECT rule_name FROM profile_exclusions WHERE profile_name = ? ORDER BY position`, p.Name); err != nil {
+		return err
+	}
+	// Only Rules is always a list, as it was before inheritance existed.
+	if len(p.Extends) == 0 {
+		p.Extends = nil
+	}
+	if len(p.Exclude) == 0 {
+		p.Exclude = nil
+	}
+	return nil
+}
+
+// names runs a query returning one name per row, in order.
+func names(ctx context.Context, q storage.DBTX, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// lookup reads profiles through q for resolving inheritance.
+func lookup(ctx context.Context, q storage.DBTX) Lookup {
+	return func(name string) (*Profile, error) {
+		return queryProfile(ctx, q, `SELECT `+profileColumns+` FROM profiles WHERE name = ?`, name)
+	}
+}
+
+// ListProfiles lists all profiles.
+func (s *SQLiteStore) ListProfiles() ([]Profile, error) {
+	return s.ListProfilesContext(context.Background())
+}
+
+// ListProfilesContext is ListProfiles with a context.
+func (s *SQLiteStore) ListProfilesContext(ctx context.Context) ([]Profile, error) {
+	return queryProfiles(ctx, s.conn.Q(), `SELECT `+profileColumns+` FROM profiles ORDER BY name`)
+}
+
+// FindProfilesContainingRule lists the profiles that include the named rule.
+func (s *SQLiteStore) FindProfilesContainingRule(ctx context.Context, rule string) ([]Profile, error) {
+	return queryProfiles(ctx, s.conn.Q(), `SELECT `+profileColumns+` FROM profiles
+WHERE name IN (SELECT profile_name FROM profile_rules WHERE rule_name = ?)
+ORDER BY name`, rule)
+}
+
+// SaveProfile validates and persists a profile. Every rule and parent it lists
+// must exist and extending it must not form a cycle; listing a name twice keeps
+// the first position.
+func (s *SQLiteStore) SaveProfile(profile Profile) error {
+	return s.SaveProfileContext(context.Background(), profile)
+}
+
+// SaveProfileContext is SaveProfile with a context.
+func (s *SQLiteStore) SaveProfileContext(ctx context.Context, profile Profile) error {
+	if err := Validate(profile); err != nil {
 		return err
 	}
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		return saveProfile(ctx, q, profile)
+	})
+}
+
+func saveProfile(ctx context.Context, q storage.DBTX, profile Profile) error {
 	active := 0
 	if profile.Active {
 		active = 1
 	}
-	_, err = s.db.Exec(`INSERT OR REPLACE INTO profiles (name, description, active, rules) VALUES (?,?,?,?)`,
-		profile.Name, profile.Description, active, string(rulesJSON))
-	return err
+	schedule := ""
+	if profile.Schedule != nil {
+		schedule = profile.Schedule.String()
+	}
+
+	// Update in place: replacing the row would cascade away its memberships.
+	if _, err := q.ExecContext(ctx, `INSERT INTO profiles (`+profileColumns+`) VALUES (?,?,?,?,?,?)
+ON CONFLICT(name) DO UPDATE SET description = excluded.description, active = excluded.active, schedule = excluded.schedule,
+	inbound_policy = excluded.inbound_policy, outbound_policy = excluded.outbound_policy`,
+		profile.Name, profile.Description, active, schedule, profile.DefaultPolicy.Inbound, profile.DefaultPolicy.Outbound); err != nil {
+		return err
+	}
+	for _, rel := range []struct {
+		table, column, target, missing string
+		list                           []string
+	}{
+		{"profile_rules", "rule_name", "rules", "references unknown rule", profile.Rules},
+		{"profile_parents", "parent_name", "profiles", "extends unknown profile", profile.Extends},
+		{"profile_exclusions", "rule_name", "rules", "excludes unknown rule", profile.Exclude},
+	} {
+		if _, err := q.ExecContext(ctx, `DELETE FROM `+rel.table+` WHERE profile_name = ?`, profile.Name); err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(rel.list))
+		for i, name := range rel.list {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			var n int
+			if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+rel.target+` WHERE name = ?`, name).Scan(&n); err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("profile %q %s %q", profile.Name, rel.missing, name)
+			}
+			if _, err := q.ExecContext(ctx, `INSERT INTO `+rel.table+` (profile_name, `+rel.column+`, position) VALUES (?,?,?)`,
+				profile.Name, name, i); err != nil {
+				return err
+			}
+		}
+	}
+	// The profile is stored by now, so a cycle through it shows up here.
+	return ValidateInheritance(profile, lookup(ctx, q))
 }
 
-// DeleteProfile removes a profile by name.
+// DeleteProfile removes a profile by name. A profile other profiles extend
+// cannot be deleted.
 func (s *SQLiteStore) DeleteProfile(name string) error {
-	_, err := s.db.Exec(`DELETE FROM profiles WHERE name = ?`, name)
-	return err
+	return s.DeleteProfileContext(context.Background(), name)
 }
 
-// GetProfile retrieves a profile by name.
-func (s *SQLiteStore) GetProfile(name string) (*Profile, error) {
-	var p Profile
-	var active int
-	var rulesJSON string
-	err := s.db.QueryRow(`SELECT name, description, active, rules FROM profiles WHERE name = ?`, name).
-		Scan(&p.Name, &p.Description, &active, &rulesJSON)
+// DeleteProfileContext is DeleteProfile with a context.
+func (s *SQLiteStore) DeleteProfileContext(ctx context.Context, name string) error {
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		children, err := names(ctx, q, `SELECT profile_name FROM profile_parents WHERE parent_name = ? ORDER BY profile_name`, name)
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			return fmt.Errorf("profile %q is extended by %s", name, strings.Join(children, ", "))
+		}
+		_, err = q.ExecContext(ctx, `DELETE FROM profiles WHERE name = ?`, name)
+		return err
+	})
+}
+
+// EffectiveRules resolves the rules the named profile enforces, including
+// those inherited from the profiles it extends; see Effective.
+func (s *SQLiteStore) EffectiveRules(ctx context.Context, name string) ([]EffectiveRule, error) {
+	p, err := s.GetProfileContext(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	p.Active = active == 1
-	if err := json.Unmarshal([]byte(rulesJSON), &p.Rules); err != nil {
-		return nil, err
-	}
-	return &p, nil
+	return Effective(*p, lookup(ctx, s.conn.Q()))
+}
+
+// GetProfile retrieves a profile by name.
+func (s *SQLiteStore) GetProfile(name string) (*Profile, error) {
+	return s.GetProfileContext(context.Background(), name)
+}
+
+// GetProfileContext is GetProfile with a context.
+func (s *SQLiteStore) GetProfileContext(ctx context.Context, name string) (*Profile, error) {
+	return queryProfile(ctx, s.conn.Q(), `SELECT `+profileColumns+` FROM profiles WHERE name = ?`, name)
 }
 
 // SetActiveProfile sets a profile as active (deactivates others).
 func (s *SQLiteStore) SetActiveProfile(name string) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return s.SetActiveProfileContext(context.Background(), name)
+}
 
-	// Deactivate all
-	if _, err := tx.Exec(`UPDATE profiles SET active = 0`); err != nil {
-		return err
-	}
-	// Activate target
-	if _, err := tx.Exec(`UPDATE profiles SET active = 1 WHERE name = ?`, name); err != nil {
+// SetActiveProfileContext is SetActiveProfile with a context.
+func (s *SQLiteStore) SetActiveProfileContext(ctx context.Context, name string) error {
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		// Deactivate all
+		if _, err := q.ExecContext(ctx, `UPDATE profiles SET active = 0`); err != nil {
+			return err
+		}
+		// Activate target
+		_, err := q.ExecContext(ctx, `UPDATE profiles SET active = 1 WHERE name = ?`, name)
 		return err
-	}
-	return tx.Commit()
+	})
 }
 
 // GetActiveProfile retrieves the currently active profile.
 func (s *SQLiteStore) GetActiveProfile() (*Profile, error) {
-	var p Profile
-	var active int
-	var rulesJSON string
-	err := s.db.QueryRow(`SELECT name, description, active, rules FROM profiles WHERE active = 1 LIMIT 1`).
-		Scan(&p.Name, &p.Description, &active, &rulesJSON)
-	if err != nil {
-		return nil, err
-	}
-	p.Active = true
-	if err := json.Unmarshal([]byte(rulesJSON), &p.Rules); err != nil {
-		return nil, err
-	}
-	return &p, nil
+	return s.GetActiveProfileContext(context.Background())
+}
+
+// GetActiveProfileContext is GetActiveProfile with a context.
+func (s *SQLiteStore) GetActiveProfileContext(ctx context.Context) (*Profile, error) {
+	return queryProfile(ctx, s.conn.Q(), `SELECT `+profileColumns+` FROM profiles WHERE active = 1 LIMIT 1`)
 }
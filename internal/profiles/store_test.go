@@ -1,14 +1,15 @@
 package profiles
 
 import (
-	"database/sql"
+	"context"
 	"testing"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 func setupTestStore(t *testing.T) *SQLiteStore {
-	db, err := sql.Open("sqlite3", ":memory:")
+	db, err := storage.Open(":memory:")
 	if err != nil {
 		t.Fatalf("failed to open db: %v", err)
 	}
@@ -16,6 +17,17 @@ func setupTestStore(t *testing.T) *SQLiteStore {
 	if err != nil {
 		t.Fatalf("failed to create store: %v", err)
 	}
+
+	// Profiles may only list stored rules.
+	ruleStore, err := rules.NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("failed to create rule store: %v", err)
+	}
+	for _, name := range []string{"web", "ssh"} {
+		if err := ruleStore.SaveRule(rules.Rule{Name: name, Application: "any", Action: "allow", Protocol: "any", Direction: "outbound"}); err != nil {
+			t.Fatalf("failed to save rule %s: %v", name, err)
+		}
+	}
 	return store
 }
 
@@ -228,3 +240,138 @@ func TestProfileStore_Update(t *testing.T) {
 		t.Errorf("expected rule name %q, got %q", "ssh", got.Rules[0])
 	}
 }
+
+func TestProfileStore_Schedule(t *testing.T) {
+	store := setupTestStore(t)
+
+	sched, err := rules.ParseSchedule("mon-fri 09:00-17:00 UTC")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	if err := store.SaveProfile(Profile{Name: "work", Description: "Work", Rules: []string{}, Schedule: sched}); err != nil {
+		t.Fatalf("SaveProfile failed: %v", err)
+	}
+	if err := store.SetActiveProfile("work"); err != nil {
+		t.Fatalf("SetActiveProfile failed: %v", err)
+	}
+
+	got, err := store.GetActiveProfile()
+	if err != nil {
+		t.Fatalf("GetActiveProfile failed: %v", err)
+	}
+	if got.Schedule == nil || got.Schedule.String() != sched.String() {
+		t.Errorf("expected schedule %q, got %v", sched, got.Schedule)
+	}
+}
+
+func TestProfileStore_DefaultPolicy(t *testing.T) {
+	store := setupTestStore(t)
+
+	policy := rules.DefaultPolicy{Inbound: "deny", Outbound: "prompt"}
+	if err := store.SaveProfile(Profile{Name: "strict", Description: "Strict", Rules: []string{}, DefaultPolicy: policy}); err != nil {
+		t.Fatalf("SaveProfile failed: %v", err)
+	}
+	got, err := store.GetProfile("strict")
+	if err != nil {
+		t.Fatalf("GetProfile failed: %v", err)
+	}
+	if got.DefaultPolicy != policy {
+		t.Errorf("expected default policy %+v, got %+v", policy, got.DefaultPolicy)
+	}
+
+	got.DefaultPolicy = rules.DefaultPolicy{}
+	if err := store.SaveProfile(*got); err != nil {
+		t.Fatalf("SaveProfile failed: %v", err)
+	}
+	if got, _ := store.GetProfile("strict"); !got.DefaultPolicy.IsZero() {
+		t.Errorf("expected the default policy to be cleared, got %+v", got.DefaultPolicy)
+	}
+}
+
+func TestProfileStore_MembershipFollowsRules(t *testing.T) {
+	store := setupTestStore(t)
+	ruleStore, err := rules.NewSQLiteStore(store.conn.DB)
+	if err != nil {
+		t.Fatalf("failed to create rule store: %v", err)
+	}
+
+	for _, p := range []Profile{
+		{Name: "work", Description: "Work", Rules: []string{"ssh", "web"}},
+		{Name: "home", Description: "Home", Rules: []string{"web"}},
+	} {
+		if err := store.SaveProfile(p); err != nil {
+			t.Fatalf("SaveProfile failed: %v", err)
+		}
+	}
+	if err := store.SaveProfile(Profile{Name: "bad", Description: "Bad", Rules: []string{"missing"}}); err == nil {
+		t.Error("expected an error for a profile listing an unknown rule")
+	}
+
+	found, err := store.FindProfilesContainingRule(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("FindProfilesContainingRule failed: %v", err)
+	}
+	if len(found) != 2 || found[0].Name != "home" || found[1].Name != "work" {
+		t.Fatalf("unexpected profiles for web: %+v", found)
+	}
+
+	// Saving a rule again must not drop it from its profiles.
+	if err := ruleStore.SaveRule(rules.Rule{Name: "web", Application: "any", Action: "deny", Protocol: "any", Direction: "outbound"}); err != nil {
+		t.Fatalf("SaveRule failed: %v", err)
+	}
+	if err := ruleStore.RenameRule(context.Background(), "web", "http"); err != nil {
+		t.Fatalf("RenameRule failed: %v", err)
+	}
+	got, _ := store.GetProfile("work")
+	if len(got.Rules) != 2 || got.Rules[0] != "ssh" || got.Rules[1] != "http" {
+		t.Errorf("rename should carry over to profiles, got %v", got.Rules)
+	}
+
+	if err := ruleStore.DeleteRule("http"); err != nil {
+		t.Fatalf("DeleteRule failed: %v", err)
+	}
+	got, _ = store.GetProfile("home")
+	if len(got.Rules) != 0 {
+		t.Errorf("deleted rule should leave its profiles, got %v", got.Rules)
+	}
+}
+
+func TestProfileStore_Inheritance(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+
+	if err := store.SaveProfile(Profile{Name: "base", Description: "Base", Rules: []string{"web", "ssh"}}); err != nil {
+		t.Fatalf("save base: %v", err)
+	}
+	if err := store.SaveProfile(Profile{Name: "work", Description: "Work", Rules: []string{}, Extends: []string{"base"}, Exclude: []string{"ssh"}}); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+	got, err := store.GetProfile("work")
+	if err != nil || len(got.Extends) != 1 || got.Extends[0] != "base" || len(got.Exclude) != 1 || got.Exclude[0] != "ssh" {
+		t.Fatalf("GetProfile(work) = %+v, %v", got, err)
+	}
+	effective, err := store.EffectiveRules(ctx, "work")
+	if err != nil || len(effective) != 1 || effective[0] != (EffectiveRule{Name: "web", From: "base"}) {
+		t.Fatalf("EffectiveRules(work) = %+v, %v", effective, err)
+	}
+
+	// Closing the loop must fail and leave base as it was.
+	if err := store.SaveProfile(Profile{Name: "base", Description: "Base", Rules: []string{"web"}, Extends: []string{"work"}}); err == nil {
+		t.Fatal("expected a cycle error")
+	}
+	if base, _ := store.GetProfile("base"); len(base.Extends) != 0 || len(base.Rules) != 2 {
+		t.Errorf("failed save changed base: %+v", base)
+	}
+	if err := store.SaveProfile(Profile{Name: "orphan", Description: "Orphan", Rules: []string{}, Extends: []string{"missing"}}); err == nil {
+		t.Error("expected an error for an unknown parent")
+	}
+	if err := store.DeleteProfile("base"); err == nil {
+		t.Error("a profile that is extended must not be deleted")
+	}
+	if err := store.DeleteProfile("work"); err != nil {
+		t.Fatalf("delete work: %v", err)
+	}
+	if err := store.DeleteProfile("base"); err != nil {
+		t.Errorf("base should be deletable once nothing extends it: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package ruleio
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/policy"
+)
+
+// csvColumn maps a CSV column to a rule field. List fields hold
+// comma-separated entries, as the matching "rules add" flags do.
+type csvColumn struct {
+	name string
+	get  func(s policy.RuleSpec) string
+	set  func(s *policy.RuleSpec, v string) error
+}
+
+func textColumn(name string, field func(s *policy.RuleSpec) *string) csvColumn {
+	return csvColumn{
+		name: name,
+		get:  func(s policy.RuleSpec) string { return *field(&s) },
+		set:  func(s *policy.RuleSpec, v string) error { *field(s) = v; return nil },
+	}
+}
+
+func listColumn(name string, field func(s *policy.RuleSpec) *[]string) csvColumn {
+	return csvColumn{
+		name: name,
+		get:  func(s policy.RuleSpec) string { return strings.Join(*field(&s), ",") },
+		set: func(s *policy.RuleSpec, v string) error {
+			*field(s) = splitList(v)
+			return nil
+		},
+	}
+}
+
+var csvColumns = []csvColumn{
+	textColumn("name", func(s *policy.RuleSpec) *string { return &s.Name }),
+	textColumn("application", func(s *policy.RuleSpec) *string { return &s.Application }),
+	textColumn("action", func(s *policy.RuleSpec) *string { return &s.Action }),
+	textColumn("protocol", func(s *policy.RuleSpec) *string { return &s.Protocol }),
+	textColumn("direction", func(s *policy.RuleSpec) *string { return &s.Direction }),
+	{
+		name: "ports",
+		get: func(s policy.RuleSpec) string {
+			out := make([]string, len(s.Ports))
+			for i, p := range s.Ports {
+				out[i] = strconv.Itoa(p)
+			}
+			return strings.Join(out, ",")
+		},
+		set: func(s *policy.RuleSpec, v string) error {
+			s.Ports = nil
+			for _, entry := range splitList(v) {
+				p, err := strconv.Atoi(entry)
+				if err != nil {
+					return fmt.Errorf("invalid port %q", entry)
+				}
+				s.Ports = append(s.Ports, p)
+			}
+			return nil
+		},
+	},
+	listColumn("local_ports", func(s *policy.RuleSpec) *[]string { return &s.LocalPorts }),
+	listColumn("remote_ports", func(s *policy.RuleSpec) *[]string { return &s.RemotePorts }),
+	listColumn("remote_addresses", func(s *policy.RuleSpec) *[]string { return &s.RemoteAddresses }),
+	listColumn("local_addresses", func(s *policy.RuleSpec) *[]string { return &s.LocalAddresses }),
+	textColumn("user", func(s *policy.RuleSpec) *string { return &s.User }),
+	textColumn("group", func(s *policy.RuleSpec) *string { return &s.Group }),
+	{
+		name: "priority",
+		get: func(s policy.RuleSpec) string {
+			if s.Priority == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.Priority)
+		},
+		set: func(s *policy.RuleSpec, v string) error {
+			if v == "" {
+				s.Priority = 0
+				return nil
+			}
+			p, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid priority %q", v)
+			}
+			s.Priority = p
+			return nil
+		},
+	},
+	textColumn("sha256", func(s *policy.RuleSpec) *string { return &s.SHA256 }),
+	textColumn("package", func(s *policy.RuleSpec) *string { return &s.Package }),
+	textColumn("schedule", func(s *policy.RuleSpec) *string { return &s.Schedule }),
+}
+
+// writeCSV writes one row per rule under a header naming every column.
+func writeCSV(w io.Writer, specs []policy.RuleSpec) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(csvColumns))
+	for i, c := range csvColumns {
+		header[i] = c.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, s := range specs {
+		row := make([]string, len(csvColumns))
+		for i, c := range csvColumns {
+			row[i] = c.get(s)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readCSV reads rules from CSV with a header row. Columns may come in any
+// order and be left out, except name and application.
+func readCSV(data []byte) ([]policy.RuleSpec, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty CSV file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]csvColumn, len(csvColumns))
+	for _, c := range csvColumns {
+		byName[c.name] = c
+	}
+	columns := make([]csvColumn, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		c, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("CSV column %q appears twice", name)
+		}
+		seen[name] = true
+		columns[i] = c
+	}
+	for _, required := range []string{"name", "application"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("CSV column %q is required", required)
+		}
+	}
+
+	var specs []policy.RuleSpec
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		var s policy.RuleSpec
+		for i, v := range row {
+			if err := columns[i].set(&s, strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
+
+// splitList splits a comma-separated field, dropping blank entries.
+func splitList(v string) []string {
+	var out []string
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package ruleio
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// iptablesDirections maps the chains whose rules can be imported to a rule
+// direction: the built-in filter chains and the managed chains hooked into
+// them.
+var iptablesDirections = map[string]string{
+	"INPUT":        "inbound",
+	"OUTPUT":       "outbound",
+	"FIREWALL-IN":  "inbound",
+	"FIREWALL-OUT": "outbound",
+}
+
+// iptablesModules are the match extensions whose options are translated;
+// tcp and udp only enable the port options.
+var iptablesModules = map[string]bool{
+	"tcp": true, "udp": true, "multiport": true, "comment": true, "owner": true, "iprange": true,
+}
+
+// parseIptablesSave translates the filter table of an iptables-save or
+// ip6tables-save dump. Each appended rule becomes an application-agnostic
+// rule named after its comment, or after its chain and position; rules made
+// by this tool keep their original name. Default chain policies and rules
+// matching on anything the rule model lacks (interfaces, connection state,
+// negation, other tables and chains, ...) are reported instead.
+func parseIptablesSave(dump string) *Result {
+	res := &Result{}
+	taken := names{}
+	managed := make(map[string]bool)
+	table := ""
+	position := make(map[string]int)
+
+	scanner := bufio.NewScanner(strings.NewReader(dump))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		issue := func(reason string, args ...any) {
+			res.Issues = append(res.Issues, Issue{Line: line, Text: text, Reason: fmt.Sprintf(reason, args...)})
+		}
+		switch {
+		case text == "" || strings.HasPrefix(text, "#") || text == "COMMIT":
+			continue
+		case strings.HasPrefix(text, "*"):
+			table = strings.TrimPrefix(text, "*")
+			continue
+		case strings.HasPrefix(text, ":"):
+			fields := strings.Fields(strings.TrimPrefix(text, ":"))
+			if table == "filter" && len(fields) >= 2 && fields[1] != "-" && fields[1] != "ACCEPT" {
+				if _, ok := iptablesDirections[fields[0]]; ok {
+					issue("default policy %s of chain %s is not imported", fields[1], fields[0])
+				}
+			}
+			continue
+		case !strings.HasPrefix(text, "-A "):
+			issue("unrecognized line")
+			continue
+		}
+
+		args, err := splitArgs(text)
+		if err != nil {
+			issue("%v", err)
+			continue
+		}
+		chain := args[1]
+		position[chain]++
+		if table != "filter" {
+			issue("rules of the %s table are not imported", table)
+			continue
+		}
+		direction, ok := iptablesDirections[chain]
+		if !ok {
+			issue("rules of chain %s are not imported", chain)
+			continue
+		}
+		m, reason := parseIptablesMatch(args[2:])
+		if reason != "" {
+			if m.target == "FIREWALL-IN" || m.target == "FIREWALL-OUT" {
+				continue // the hook into the managed chains
+			}
+			issue("%s", reason)
+			continue
+		}
+
+		r := rules.Rule{
+			Application: "any",
+			Action:      m.action,
+			Protocol:    m.protocol,
+			Direction:   direction,
+			User:        m.user,
+			Group:       m.group,
+		}
+		local, remote := m.dst, m.src
+		localPorts, remotePorts := m.dports, m.sports
+		if direction == "outbound" {
+			local, remote = m.src, m.dst
+			localPorts, remotePorts = m.sports, m.dports
+		}
+		r.LocalAddresses, r.RemoteAddresses = local, remote
+		setPorts(&r, localPorts, remotePorts)
+
+		name, _, tagged := ruleset.ParseTag(m.comment)
+		switch {
+		case tagged && managed[name]:
+			issue("further entry of managed rule %q skipped", name)
+			continue
+		case tagged:
+			managed[name] = true
+		case m.comment != "":
+			name = m.comment
+		default:
+			name = fmt.Sprintf("%s-%d", strings.ToLower(chain), position[chain])
+		}
+		r.Name = taken.unique(name)
+		if err := rules.Validate(r); err != nil {
+			issue("%v", err)
+			continue
+		}
+		res.Rules = append(res.Rules, r)
+	}
+	return res
+}
+
+// iptablesMatch is what an appended rule matches and does.
+type iptablesMatch struct {
+	protocol       string
+	src, dst       []string
+	sports, dports []string
+	user, group    string
+	comment        string
+	action         string
+	target         string
+}
+
+// parseIptablesMatch reads the options after "-A <chain>". A non-empty reason
+// explains why the rule cannot be translated.
+func parseIptablesMatch(args []string) (m iptablesMatch, reason string) {
+	m.protocol = "any"
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+		if opt == "!" {
+			return m, "negated matches are not supported"
+		}
+		if i+1 >= len(args) {
+			return m, fmt.Sprintf("option %s lacks a value", opt)
+		}
+		i++
+		value := args[i]
+		switch opt {
+		case "-p", "--protocol":
+			switch value {
+			case "tcp", "udp":
+				m.protocol = value
+			case "all":
+			default:
+				return m, fmt.Sprintf("protocol %s is not supported", value)
+			}
+		case "-s", "--source":
+			m.src = append(m.src, strings.Split(value, ",")...)
+		case "-d", "--destination":
+			m.dst = append(m.dst, strings.Split(value, ",")...)
+		case "--src-range":
+			m.src = append(m.src, value)
+		case "--dst-range":
+			m.dst = append(m.dst, value)
+		case "-m", "--match":
+			if !iptablesModules[value] {
+				return m, fmt.Sprintf("match %s is not supported", value)
+			}
+		case "--sport", "--source-port", "--sports", "--source-ports":
+			m.sports = append(m.sports, iptablesPorts(value)...)
+		case "--dport", "--destination-port", "--dports", "--destination-ports":
+			m.dports = append(m.dports, iptablesPorts(value)...)
+		case "--comment":
+			m.comment = value
+		case "--uid-owner":
+			m.user = value
+		case "--gid-owner":
+			m.group = value
+		case "-j", "--jump":
+			m.target = value
+			switch value {
+			case "ACCEPT":
+				m.action = "allow"
+			case "DROP", "REJECT":
+				m.action = "deny"
+			default:
+				return m, fmt.Sprintf("target %s is not supported", value)
+			}
+		case "--reject-with":
+			// Rejecting and dropping both deny the connection.
+		default:
+			return m, fmt.Sprintf("option %s is not supported", opt)
+		}
+	}
+	if m.action == "" {
+		return m, "rule without an ACCEPT, DROP or REJECT target"
+	}
+	return m, ""
+}
+
+// iptablesPorts converts an iptables port list ("80,443", "1024:65535") into
+// rule port entries.
+func iptablesPorts(value string) []string {
+	var out []string
+	for _, entry := range strings.Split(value, ",") {
+		out = append(out, strings.Replace(entry, ":", "-", 1))
+	}
+	return out
+}
+
+// splitArgs splits an iptables-save line into arguments, honouring the double
+// quotes and backslash escapes it uses for comments.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("missing chain")
+	}
+	return args, nil
+}
@@ -0,0 +1,91 @@
+package ruleio
+
+import (
+	"strings"
+	"testing"
+)
+
+const iptablesDump = `# Generated by iptables-save v1.8.7
+*nat
+:PREROUTING ACCEPT [0:0]
+-A PREROUTING -p tcp --dport 80 -j REDIRECT --to-ports 8080
+COMMIT
+*filter
+:INPUT DROP [0:0]
+:FORWARD DROP [0:0]
+:OUTPUT ACCEPT [0:0]
+-A INPUT -i lo -j ACCEPT
+-A INPUT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT
+-A INPUT -s 10.0.0.0/8 -p tcp -m multiport --dports 80,443 -m comment --comment "web from lan" -j ACCEPT
+-A INPUT -p udp -m udp --dport 60000:61000 -j ACCEPT
+-A INPUT ! -s 192.168.0.0/16 -p tcp --dport 3306 -j DROP
+-A FORWARD -j ACCEPT
+-A OUTPUT -d 1.2.3.4/32 -p tcp -m tcp --dport 25 -m owner --uid-owner mail -j REJECT --reject-with icmp-port-unreachable
+-A OUTPUT -j LOG
+COMMIT
+`
+
+func TestParseIptablesSave(t *testing.T) {
+	res := parseIptablesSave(iptablesDump)
+
+	var got []string
+	for _, r := range res.Rules {
+		got = append(got, r.Name)
+	}
+	if want := "input-3,web from lan,input-5,output-1"; strings.Join(got, ",") != want {
+		t.Fatalf("rules = %v, want %s", got, want)
+	}
+	ssh := res.Rules[0]
+	if ssh.Direction != "inbound" || ssh.Action != "allow" || ssh.Protocol != "tcp" || len(ssh.Ports) != 1 || ssh.Ports[0] != 22 {
+		t.Errorf("ssh = %+v", ssh)
+	}
+	web := res.Rules[1]
+	if len(web.RemoteAddresses) != 1 || web.RemoteAddresses[0] != "10.0.0.0/8" || len(web.Ports) != 2 {
+		t.Errorf("web = %+v", web)
+	}
+	if high := res.Rules[2]; len(high.LocalPorts) != 1 || high.LocalPorts[0] != "60000-61000" {
+		t.Errorf("port range = %+v", high)
+	}
+	mail := res.Rules[3]
+	if mail.Action != "deny" || mail.User != "mail" || mail.RemoteAddresses[0] != "1.2.3.4/32" || mail.Ports[0] != 25 {
+		t.Errorf("mail = %+v", mail)
+	}
+
+	reasons := make(map[int]string)
+	for _, issue := range res.Issues {
+		reasons[issue.Line] = issue.Reason
+	}
+	for line, want := range map[int]string{
+		4:  "nat table",
+		7:  "default policy DROP",
+		10: "option -i",
+		11: "match conntrack",
+		15: "negated",
+		16: "chain FORWARD",
+		18: "target LOG",
+	} {
+		if !strings.Contains(reasons[line], want) {
+			t.Errorf("line %d: issue %q, want it to mention %q", line, reasons[line], want)
+		}
+	}
+	if len(res.Issues) != 7 {
+		t.Errorf("issues = %+v", res.Issues)
+	}
+}
+
+func TestParseIptablesSave_ManagedRules(t *testing.T) {
+	dump := `*filter
+-A INPUT -j FIREWALL-IN
+-A FIREWALL-IN -s 10.0.0.1/32 -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:ssh:abcd" -j ACCEPT
+-A FIREWALL-IN -s 10.0.0.2/32 -p tcp -m tcp --dport 22 -m comment --comment "firewall-rule:ssh:abcd" -j ACCEPT
+COMMIT
+`
+	res := parseIptablesSave(dump)
+	if len(res.Rules) != 1 || res.Rules[0].Name != "ssh" {
+		t.Fatalf("rules = %+v", res.Rules)
+	}
+	if len(res.Issues) != 1 || res.Issues[0].Line != 4 {
+		t.Errorf("issues = %+v", res.Issues)
+	}
+}
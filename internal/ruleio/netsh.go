@@ -0,0 +1,166 @@
+package ruleio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"strings"
+
+	"github.com/vhPedroGitHub/firewall/internal/platform/ruleset"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// netshBlock is one rule of a netsh listing: its fields and where it starts.
+type netshBlock struct {
+	line   int
+	text   string
+	fields map[string]string
+}
+
+// parseNetsh translates the output of `netsh advfirewall firewall show rule
+// name=all`, optionally with verbose, which adds the program. Disabled rules
+// and rules restricted in ways the rule model lacks (services, ICMP, special
+// address keywords such as LocalSubnet, ...) are reported instead. Windows
+// rule names need not be unique, so repeats get a numeric suffix.
+func parseNetsh(output string) *Result {
+	var blocks []netshBlock
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		key, value, found := strings.Cut(text, ":")
+		if !found || strings.HasPrefix(text, "---") {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "Rule Name" {
+			blocks = append(blocks, netshBlock{line: line, text: text, fields: map[string]string{}})
+			continue
+		}
+		if len(blocks) > 0 {
+			blocks[len(blocks)-1].fields[key] = value
+		}
+	}
+
+	res := &Result{}
+	taken := names{}
+	for _, b := range blocks {
+		r, reason := netshRule(b.fields)
+		if reason != "" {
+			res.Issues = append(res.Issues, Issue{Line: b.line, Text: b.text, Reason: reason})
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(b.text, "Rule Name:"))
+		if tagged, _, ok := ruleset.ParseTag(b.fields["Description"]); ok {
+			name = tagged
+		}
+		r.Name = taken.unique(name)
+		if err := rules.Validate(r); err != nil {
+			res.Issues = append(res.Issues, Issue{Line: b.line, Text: b.text, Reason: err.Error()})
+			continue
+		}
+		res.Rules = append(res.Rules, r)
+	}
+	return res
+}
+
+// netshRule maps the fields of one netsh rule. A non-empty reason explains
+// why it cannot be translated.
+func netshRule(f map[string]string) (r rules.Rule, reason string) {
+	if strings.EqualFold(f["Enabled"], "No") {
+		return r, "rule is disabled"
+	}
+	switch strings.ToLower(f["Direction"]) {
+	case "in":
+		r.Direction = "inbound"
+	case "out":
+		r.Direction = "outbound"
+	default:
+		return r, fmt.Sprintf("direction %q is not supported", f["Direction"])
+	}
+	switch strings.ToLower(f["Action"]) {
+	case "allow":
+		r.Action = "allow"
+	case "block":
+		r.Action = "deny"
+	default:
+		return r, fmt.Sprintf("action %q is not supported", f["Action"])
+	}
+	switch p := strings.ToLower(f["Protocol"]); p {
+	case "tcp", "udp", "any":
+		r.Protocol = p
+	default:
+		return r, fmt.Sprintf("protocol %q is not supported", f["Protocol"])
+	}
+	if s, ok := f["Service"]; ok && !isAny(s) {
+		return r, fmt.Sprintf("service restriction %q is not supported", s)
+	}
+
+	r.Application = "any"
+	if p, ok := f["Program"]; ok && !isAny(p) {
+		r.Application = p
+	}
+
+	var local, remote []string
+	for _, end := range []struct {
+		key  string
+		list *[]string
+	}{{"LocalPort", &local}, {"RemotePort", &remote}} {
+		v := f[end.key]
+		if isAny(v) {
+			continue
+		}
+		for _, entry := range splitList(v) {
+			if _, err := rules.ParsePort(entry); err != nil {
+				return r, fmt.Sprintf("%s %q is not supported", end.key, entry)
+			}
+			*end.list = append(*end.list, entry)
+		}
+	}
+	setPorts(&r, local, remote)
+
+	for _, end := range []struct {
+		key  string
+		list *[]string
+	}{{"LocalIP", &r.LocalAddresses}, {"RemoteIP", &r.RemoteAddresses}} {
+		v := f[end.key]
+		if isAny(v) {
+			continue
+		}
+		for _, entry := range splitList(v) {
+			addr, ok := netshAddress(entry)
+			if !ok {
+				return r, fmt.Sprintf("%s %q is not supported", end.key, entry)
+			}
+			*end.list = append(*end.list, addr)
+		}
+	}
+	return r, ""
+}
+
+// netshAddress converts a netsh address entry, which writes subnets with a
+// dotted mask ("10.0.0.0/255.0.0.0"), into a rule address entry.
+func netshAddress(entry string) (string, bool) {
+	if ip, mask, found := strings.Cut(entry, "/"); found && strings.Contains(mask, ".") {
+		m, err := netip.ParseAddr(mask)
+		if err != nil || !m.Is4() {
+			return "", false
+		}
+		a := m.As4()
+		v := binary.BigEndian.Uint32(a[:])
+		ones := bits.OnesCount32(v)
+		if v != ^uint32(0)<<(32-ones) {
+			return "", false // not a contiguous mask
+		}
+		entry = fmt.Sprintf("%s/%d", ip, ones)
+	}
+	if _, err := rules.ParseAddress(entry); err != nil {
+		return "", false
+	}
+	return entry, true
+}
+
+func isAny(v string) bool {
+	return v == "" || strings.EqualFold(v, "Any")
+}
@@ -0,0 +1,87 @@
+package ruleio
+
+import (
+	"strings"
+	"testing"
+)
+
+const netshOutput = `
+Rule Name:                            Allow Web
+----------------------------------------------------------------------
+Enabled:                              Yes
+Direction:                            Out
+Profiles:                             Domain,Private,Public
+Grouping:
+LocalIP:                              Any
+RemoteIP:                             10.0.0.0/255.0.0.0,192.168.1.5
+Protocol:                             TCP
+LocalPort:                            Any
+RemotePort:                           80,443
+Edge traversal:                       No
+Program:                              C:\Program Files\Browser\browser.exe
+Action:                               Allow
+
+Rule Name:                            Allow Web
+----------------------------------------------------------------------
+Enabled:                              Yes
+Direction:                            In
+LocalIP:                              Any
+RemoteIP:                             Any
+Protocol:                             UDP
+LocalPort:                            5000-5100
+RemotePort:                           Any
+Action:                               Block
+
+Rule Name:                            Core Networking - DHCP
+----------------------------------------------------------------------
+Enabled:                              Yes
+Direction:                            In
+LocalIP:                              Any
+RemoteIP:                             LocalSubnet
+Protocol:                             UDP
+LocalPort:                            68
+RemotePort:                           67
+Action:                               Allow
+
+Rule Name:                            Old rule
+----------------------------------------------------------------------
+Enabled:                              No
+Direction:                            In
+Protocol:                             Any
+Action:                               Allow
+
+Rule Name:                            Ping
+----------------------------------------------------------------------
+Enabled:                              Yes
+Direction:                            In
+Protocol:                             ICMPv4
+Action:                               Allow
+Ok.
+`
+
+func TestParseNetsh(t *testing.T) {
+	res := parseNetsh(netshOutput)
+	if len(res.Rules) != 2 {
+		t.Fatalf("rules = %+v", res.Rules)
+	}
+	web := res.Rules[0]
+	if web.Name != "Allow Web" || web.Direction != "outbound" || web.Application != `C:\Program Files\Browser\browser.exe` ||
+		strings.Join(web.RemoteAddresses, ",") != "10.0.0.0/8,192.168.1.5" || len(web.Ports) != 2 {
+		t.Errorf("web = %+v", web)
+	}
+	block := res.Rules[1]
+	if block.Name != "Allow Web-2" || block.Action != "deny" || block.Application != "any" || strings.Join(block.LocalPorts, ",") != "5000-5100" {
+		t.Errorf("block = %+v", block)
+	}
+
+	var reasons []string
+	for _, issue := range res.Issues {
+		reasons = append(reasons, issue.Reason)
+	}
+	got := strings.Join(reasons, "; ")
+	for _, want := range []string{`RemoteIP "LocalSubnet"`, "disabled", `protocol "ICMPv4"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("issues %q do not mention %q", got, want)
+		}
+	}
+}
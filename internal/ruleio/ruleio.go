@@ -0,0 +1,175 @@
+// Package ruleio reads and writes rules in bulk: JSON and YAML policy
+// documents, CSV, and translations of iptables-save and netsh dumps.
+package ruleio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/vhPedroGitHub/firewall/internal/policy"
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+// Format names a bulk rule format.
+type Format string
+
+const (
+	JSON         Format = "json"
+	YAML         Format = "yaml"
+	CSV          Format = "csv"
+	IptablesSave Format = "iptables-save" // import only
+	Netsh        Format = "netsh"         // import only; "show rule name=all [verbose]" output
+)
+
+// ParseFormat validates a format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSON, YAML, CSV, IptablesSave, Netsh:
+		return f, nil
+	case "yml":
+		return YAML, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want json, yaml, csv, iptables-save or netsh)", s)
+}
+
+// FormatFromPath infers a format from a file extension.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".csv":
+		return CSV, nil
+	}
+	return "", fmt.Errorf("cannot tell the format of %q; pass --format", path)
+}
+
+// Issue is an entry of an import that could not be mapped to a rule.
+type Issue struct {
+	Line   int // line of the entry in the input, 0 when not known
+	Text   string
+	Reason string
+}
+
+// Result holds the rules read by Import and the entries it had to leave out.
+type Result struct {
+	Rules  []rules.Rule
+	Issues []Issue
+}
+
+// Export writes rules in a JSON, YAML or CSV format. JSON and YAML produce a
+// policy document that "firewall apply" accepts as well. Expiry and session
+// settings are not exported.
+func Export(w io.Writer, f Format, list []rules.Rule) error {
+	doc := policy.Document{Version: policy.Version, Rules: make([]policy.RuleSpec, 0, len(list))}
+	for _, r := range list {
+		doc.Rules = append(doc.Rules, policy.FromRule(r))
+	}
+	switch f {
+	case JSON:
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case YAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	case CSV:
+		return writeCSV(w, doc.Rules)
+	}
+	return fmt.Errorf("cannot export rules as %s", f)
+}
+
+// Import reads rules in any format. JSON, YAML and CSV input must be valid as
+// a whole; iptables-save and netsh entries that have no rule equivalent are
+// reported as issues and left out.
+func Import(data []byte, f Format) (*Result, error) {
+	switch f {
+	case JSON, YAML:
+		doc, err := policy.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		return resolve(doc)
+	case CSV:
+		specs, err := readCSV(data)
+		if err != nil {
+			return nil, err
+		}
+		return resolve(&policy.Document{Version: policy.Version, Rules: specs})
+	case IptablesSave:
+		return parseIptablesSave(string(data)), nil
+	case Netsh:
+		return parseNetsh(string(data)), nil
+	}
+	return nil, fmt.Errorf("cannot import rules from %s", f)
+}
+
+// resolve validates the rules of a document. Profiles have no place in a rule
+// import and are reported.
+func resolve(doc *policy.Document) (*Result, error) {
+	list, _, err := (&policy.Document{Rules: doc.Rules}).Resolve()
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Rules: list}
+	for _, p := range doc.Profiles {
+		res.Issues = append(res.Issues, Issue{Text: "profile " + p.Name, Reason: `profiles are not imported; use "firewall apply"`})
+	}
+	return res, nil
+}
+
+// names hands out unique rule names, suffixing repeats with -2, -3, ...
+type names map[string]bool
+
+func (n names) unique(name string) string {
+	candidate := name
+	for i := 2; n[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	n[candidate] = true
+	return candidate
+}
+
+// setPorts stores the port entries of each end on r. The service end, local
+// for inbound rules and remote for outbound ones, goes to Ports when it lists
+// plain port numbers only.
+func setPorts(r *rules.Rule, local, remote []string) {
+	service := &remote
+	if r.Direction == "inbound" {
+		service = &local
+	}
+	if nums, ok := plainPorts(*service); ok {
+		r.Ports = nums
+		*service = nil
+	}
+	r.LocalPorts, r.RemotePorts = local, remote
+}
+
+func plainPorts(list []string) ([]int, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	out := make([]int, 0, len(list))
+	for _, entry := range list {
+		n, err := strconv.Atoi(entry)
+		if err != nil || strconv.Itoa(n) != entry {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, true
+}
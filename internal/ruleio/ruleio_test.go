@@ -0,0 +1,66 @@
+package ruleio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/rules"
+)
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	sched, err := rules.ParseSchedule("mon-fri 09:00-17:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []rules.Rule{
+		{Name: "web", Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{80, 443}, RemoteAddresses: []string{"10.0.0.0/8", "192.168.1.1"}},
+		{Name: "ssh", Application: "/usr/sbin/sshd", Action: "deny", Protocol: "tcp", Direction: "inbound", LocalPorts: []string{"ssh"}, RemotePorts: []string{"1024-65535"}, Priority: 5, Schedule: sched},
+		{Name: "dns", Application: "any", Action: "allow", Protocol: "any", Direction: "outbound", User: "root"},
+	}
+	for _, f := range []Format{JSON, YAML, CSV} {
+		var buf bytes.Buffer
+		if err := Export(&buf, f, list); err != nil {
+			t.Fatalf("%s: Export: %v", f, err)
+		}
+		res, err := Import(buf.Bytes(), f)
+		if err != nil {
+			t.Fatalf("%s: Import: %v\n%s", f, err, buf.String())
+		}
+		if len(res.Rules) != len(list) || len(res.Issues) != 0 {
+			t.Fatalf("%s: imported %d rule(s), issues %v", f, len(res.Rules), res.Issues)
+		}
+		for i := range list {
+			if !rules.Equal(list[i], res.Rules[i]) {
+				t.Errorf("%s: rule %d = %+v, want %+v", f, i, res.Rules[i], list[i])
+			}
+		}
+	}
+}
+
+func TestImport_CSV(t *testing.T) {
+	data := "application,name,ports\nany,web,\"80,443\"\n"
+	res, err := Import([]byte(data), CSV)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if r := res.Rules[0]; r.Name != "web" || r.Protocol != "tcp" || len(r.Ports) != 2 {
+		t.Errorf("rule = %+v", r)
+	}
+	for _, bad := range []string{"name,app\nweb,any\n", "name\nweb\n", "name,application,ports\nweb,any,http\n"} {
+		if _, err := Import([]byte(bad), CSV); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, want := range map[string]Format{"a.json": JSON, "a.YML": YAML, "dir/a.csv": CSV} {
+		if got, err := FormatFromPath(path); err != nil || got != want {
+			t.Errorf("FormatFromPath(%q) = %q, %v", path, got, err)
+		}
+	}
+	if _, err := FormatFromPath("rules.txt"); err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("unknown extension error = %v", err)
+	}
+}
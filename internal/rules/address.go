@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// AddressRange is a parsed entry of Rule.RemoteAddresses or
+// Rule.LocalAddresses: an inclusive range of addresses within one family.
+// Entries are written as a single IP ("1.2.3.4"), a CIDR ("10.0.0.0/8",
+// "2001:db8::/32") or a range ("10.0.0.1-10.0.0.20").
+type AddressRange struct {
+	From netip.Addr
+	To   netip.Addr
+}
+
+// ParseAddress parses a single address entry. Entries are rendered verbatim
+// into backend commands, so surrounding whitespace is rejected.
+func ParseAddress(entry string) (AddressRange, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return AddressRange{}, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		prefix = prefix.Masked()
+		return AddressRange{From: prefix.Addr(), To: lastAddr(prefix)}, nil
+	}
+
+	if from, to, found := strings.Cut(entry, "-"); found {
+		lo, err := netip.ParseAddr(from)
+		if err != nil {
+			return AddressRange{}, fmt.Errorf("invalid range start in %q: %w", entry, err)
+		}
+		hi, err := netip.ParseAddr(to)
+		if err != nil {
+			return AddressRange{}, fmt.Errorf("invalid range end in %q: %w", entry, err)
+		}
+		if lo.Is4() != hi.Is4() {
+			return AddressRange{}, fmt.Errorf("range %q mixes IPv4 and IPv6", entry)
+		}
+		if hi.Less(lo) {
+			return AddressRange{}, fmt.Errorf("range %q ends before it starts", entry)
+		}
+		return AddressRange{From: lo, To: hi}, nil
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return AddressRange{}, fmt.Errorf("invalid address %q: %w", entry, err)
+	}
+	return AddressRange{From: addr, To: addr}, nil
+}
+
+// Is6 reports whether the range holds IPv6 addresses.
+func (a AddressRange) Is6() bool {
+	return a.From.Is6()
+}
+
+// Contains reports whether addr falls within the range. IPv4-mapped IPv6
+// addresses are compared as IPv4.
+func (a AddressRange) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.Is4() != a.From.Is4() {
+		return false
+	}
+	return !addr.Less(a.From) && !a.To.Less(addr)
+}
+
+// IsRange reports whether an entry uses the "from-to" form, which some
+// backends need to express differently from addresses and CIDRs.
+func IsRange(entry string) bool {
+	return strings.Contains(entry, "-")
+}
+
+// IsIPv6Entry reports whether an address entry belongs to the IPv6 family.
+func IsIPv6Entry(entry string) bool {
+	a, err := ParseAddress(entry)
+	return err == nil && a.Is6()
+}
+
+// MatchAddress reports whether addr matches any entry in list. An empty list
+// matches every address; an unparsable addr matches only an empty list.
+func MatchAddress(list []string, addr string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	// Drop an IPv6 zone such as fe80::1%eth0
+	if idx := strings.LastIndex(addr, "%"); idx > 0 {
+		addr = addr[:idx]
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	for _, entry := range list {
+		r, err := ParseAddress(entry)
+		if err != nil {
+			continue
+		}
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastAddr returns the highest address in a masked prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	bits := p.Bits()
+	for i := range b {
+		hostBits := len(b)*8 - bits - (len(b)-1-i)*8
+		switch {
+		case hostBits >= 8:
+			b[i] = 0xff
+		case hostBits > 0:
+			b[i] |= byte(1<<hostBits - 1)
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	cases := []struct {
+		entry    string
+		from, to string
+	}{
+		{"1.2.3.4", "1.2.3.4", "1.2.3.4"},
+		{"10.1.2.3/8", "10.0.0.0", "10.255.255.255"},
+		{"192.168.0.0/23", "192.168.0.0", "192.168.1.255"},
+		{"10.0.0.1-10.0.0.20", "10.0.0.1", "10.0.0.20"},
+		{"2001:db8::/32", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{"fe80::1-fe80::ff", "fe80::1", "fe80::ff"},
+	}
+	for _, c := range cases {
+		got, err := ParseAddress(c.entry)
+		if err != nil {
+			t.Errorf("ParseAddress(%q): %v", c.entry, err)
+			continue
+		}
+		if got.From.String() != c.from || got.To.String() != c.to {
+			t.Errorf("ParseAddress(%q) = %s-%s, want %s-%s", c.entry, got.From, got.To, c.from, c.to)
+		}
+	}
+
+	for _, bad := range []string{"", "host.example", "10.0.0.0/33", "10.0.0.20-10.0.0.1", "10.0.0.1-::1", " 1.2.3.4"} {
+		if _, err := ParseAddress(bad); err == nil {
+			t.Errorf("ParseAddress(%q) should fail", bad)
+		}
+	}
+}
+
+func TestAddressRangeContains(t *testing.T) {
+	r, _ := ParseAddress("10.0.0.0/24")
+	if !r.Contains(netip.MustParseAddr("10.0.0.7")) || !r.Contains(netip.MustParseAddr("::ffff:10.0.0.7")) {
+		t.Fatalf("expected 10.0.0.7 to match")
+	}
+	if r.Contains(netip.MustParseAddr("10.0.1.0")) || r.Contains(netip.MustParseAddr("::1")) {
+		t.Fatalf("unexpected match")
+	}
+}
+
+func TestMatchAddress(t *testing.T) {
+	list := []string{"192.168.1.10-192.168.1.20", "2001:db8::/32"}
+	if !MatchAddress(nil, "anything") {
+		t.Fatalf("an empty list should match every address")
+	}
+	for _, addr := range []string{"192.168.1.15", "2001:db8::5", "2001:db8::5%eth0"} {
+		if !MatchAddress(list, addr) {
+			t.Errorf("MatchAddress(%q) = false, want true", addr)
+		}
+	}
+	for _, addr := range []string{"192.168.1.21", "::1", "not-an-ip"} {
+		if MatchAddress(list, addr) {
+			t.Errorf("MatchAddress(%q) = true, want false", addr)
+		}
+	}
+}
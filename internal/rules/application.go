@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// AnyApplication is the Rule.Application value that matches every program.
+const AnyApplication = "any"
+
+// regexPrefix marks a Rule.Application written as a regular expression.
+const regexPrefix = "re:"
+
+// Kinds of application pattern. Sort ranks exact paths above the pattern
+// kinds, which rank equally, and those above AppAny.
+const (
+	AppAny = iota
+	AppRegex
+	AppGlob
+	AppPrefix
+	AppExact
+)
+
+// AppPattern is a parsed Rule.Application. The value is one of:
+//
+//   - "any": every application
+//   - a path ending in a separator ("/usr/lib/jvm/"): everything under it
+//   - a glob ("/opt/app-*/bin/app"): * and ? do not cross separators
+//   - "re:" followed by a regular expression matched against the full path
+//   - anything else: an exact path (or program name), compared case-insensitively
+type AppPattern struct {
+	Kind  int
+	Value string
+	re    *regexp.Regexp
+}
+
+// patterns caches parsed application values, which matching and sorting
+// parse over and over; regular expressions are costly to compile.
+var patterns sync.Map // string -> parsedApplication
+
+type parsedApplication struct {
+	pattern AppPattern
+	err     error
+}
+
+// ParseApplication parses a Rule.Application value. An empty value is treated
+// as any application.
+func ParseApplication(app string) (AppPattern, error) {
+	if cached, ok := patterns.Load(app); ok {
+		p := cached.(parsedApplication)
+		return p.pattern, p.err
+	}
+	p, err := parseApplication(app)
+	patterns.Store(app, parsedApplication{pattern: p, err: err})
+	return p, err
+}
+
+func parseApplication(app string) (AppPattern, error) {
+	switch {
+	case app == "" || strings.EqualFold(app, AnyApplication):
+		return AppPattern{Kind: AppAny, Value: app}, nil
+	case strings.HasPrefix(app, regexPrefix):
+		// The expression must match the whole path, not just part of it
+		re, err := regexp.Compile(`^(?:` + strings.TrimPrefix(app, regexPrefix) + `)$`)
+		if err != nil {
+			return AppPattern{}, fmt.Errorf("invalid application regex %q: %w", app, err)
+		}
+		return AppPattern{Kind: AppRegex, Value: app, re: re}, nil
+	case strings.HasSuffix(app, "/") || strings.HasSuffix(app, `\`):
+		return AppPattern{Kind: AppPrefix, Value: app}, nil
+	case strings.ContainsAny(app, "*?["):
+		if _, err := path.Match(slashed(app), ""); err != nil {
+			return AppPattern{}, fmt.Errorf("invalid application glob %q: %w", app, err)
+		}
+		return AppPattern{Kind: AppGlob, Value: app}, nil
+	default:
+		return AppPattern{Kind: AppExact, Value: app}, nil
+	}
+}
+
+// Match reports whether an executable path matches the pattern.
+func (p AppPattern) Match(exe string) bool {
+	switch p.Kind {
+	case AppAny:
+		return true
+	case AppRegex:
+		return p.re.MatchString(exe)
+	case AppPrefix:
+		return strings.HasPrefix(strings.ToLower(slashed(exe)), strings.ToLower(slashed(p.Value)))
+	case AppGlob:
+		ok, _ := path.Match(strings.ToLower(slashed(p.Value)), strings.ToLower(slashed(exe)))
+		return ok
+	default:
+		return strings.EqualFold(p.Value, exe)
+	}
+}
+
+// MatchApplication reports whether exe matches a Rule.Application value.
+// Values that do not parse match nothing.
+func MatchApplication(app, exe string) bool {
+	p, err := ParseApplication(app)
+	return err == nil && p.Match(exe)
+}
+
+// slashed normalises Windows separators so paths and patterns compare alike.
+func slashed(s string) string {
+	return strings.ReplaceAll(s, `\`, "/")
+}
@@ -0,0 +1,66 @@
+package rules
+
+import "testing"
+
+func TestParseApplication(t *testing.T) {
+	cases := []struct {
+		app  string
+		kind int
+	}{
+		{"", AppAny},
+		{"any", AppAny},
+		{"/usr/bin/curl", AppExact},
+		{"postgres", AppExact},
+		{"/usr/lib/jvm/", AppPrefix},
+		{`C:\Program Files\App\`, AppPrefix},
+		{"/opt/app-*/bin/app", AppGlob},
+		{`re:^/opt/app-[0-9.]+/bin/app$`, AppRegex},
+	}
+	for _, c := range cases {
+		p, err := ParseApplication(c.app)
+		if err != nil {
+			t.Errorf("ParseApplication(%q): %v", c.app, err)
+			continue
+		}
+		if p.Kind != c.kind {
+			t.Errorf("ParseApplication(%q).Kind = %d, want %d", c.app, p.Kind, c.kind)
+		}
+	}
+
+	for _, bad := range []string{"re:(", "/opt/app-[/bin/app"} {
+		if _, err := ParseApplication(bad); err == nil {
+			t.Errorf("ParseApplication(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMatchApplication(t *testing.T) {
+	cases := []struct {
+		app, exe string
+		want     bool
+	}{
+		{"any", "/usr/bin/anything", true},
+		{"/usr/bin/curl", "/usr/bin/curl", true},
+		{`C:\App\app.exe`, `c:\app\APP.exe`, true},
+		{"/usr/bin/curl", "/usr/bin/curl2", false},
+		{"/usr/lib/jvm/", "/usr/lib/jvm/java-17/bin/java", true},
+		{"/usr/lib/jvm/", "/usr/lib/jvmx/java", false},
+		{`C:\Program Files\App\`, `C:\Program Files\App\bin\app.exe`, true},
+		{"/opt/app-*/bin/app", "/opt/app-1.2.3/bin/app", true},
+		{"/opt/app-*/bin/app", "/opt/app-1.2.3/lib/bin/app", false},
+		{`C:\Apps\*\app.exe`, `C:\Apps\v2\app.exe`, true},
+		{`re:^/opt/app-[0-9.]+/bin/app$`, "/opt/app-1.2.3/bin/app", true},
+		{`re:^/opt/app-[0-9.]+/bin/app$`, "/opt/app-beta/bin/app", false},
+		{"re:(", "/anything", false},
+		// Expressions match the whole path.
+		{"re:/usr/bin/fire", "/tmp/usr/bin/firefoxevil", false},
+		{"re:/usr/bin/fire", "/usr/bin/firefox", false},
+		{"re:/usr/bin/fire.*", "/usr/bin/firefox", true},
+		{"re:/usr/bin/(curl|wget)", "/usr/bin/wget", true},
+	}
+	for _, c := range cases {
+		if got := MatchApplication(c.app, c.exe); got != c.want {
+			t.Errorf("MatchApplication(%q, %q) = %v, want %v", c.app, c.exe, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Default policies for connections no rule matches.
+const (
+	PolicyPrompt = "prompt" // ask the user, or deny when prompts are off; nothing is installed in the kernel
+	PolicyAllow  = "allow"
+	PolicyDeny   = "deny"
+)
+
+// CatchAllPrefix names the rules that enforce a default policy; see CatchAll.
+const CatchAllPrefix = "default-policy-"
+
+// CatchAllPriority orders catch-all rules after every other rule.
+const CatchAllPriority = math.MaxInt32
+
+// DefaultPolicy says what happens to connections no rule matches, per
+// direction. An empty field is unset and falls back to the next layer: a
+// profile's parents, then the configuration, then PolicyPrompt.
+type DefaultPolicy struct {
+	Inbound  string `json:"inbound,omitempty"`
+	Outbound string `json:"outbound,omitempty"`
+}
+
+// ValidatePolicy checks a single policy value; empty means unset.
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case "", PolicyPrompt, PolicyAllow, PolicyDeny:
+		return nil
+	default:
+		return fmt.Errorf("invalid default policy %q: must be prompt, allow or deny", policy)
+	}
+}
+
+// Validate checks both directions.
+func (p DefaultPolicy) Validate() error {
+	if err := ValidatePolicy(p.Inbound); err != nil {
+		return fmt.Errorf("inbound: %w", err)
+	}
+	if err := ValidatePolicy(p.Outbound); err != nil {
+		return fmt.Errorf("outbound: %w", err)
+	}
+	return nil
+}
+
+// IsZero reports whether neither direction is set.
+func (p DefaultPolicy) IsZero() bool {
+	return p.Inbound == "" && p.Outbound == ""
+}
+
+// Or fills the directions p leaves unset from fallback.
+func (p DefaultPolicy) Or(fallback DefaultPolicy) DefaultPolicy {
+	if p.Inbound == "" {
+		p.Inbound = fallback.Inbound
+	}
+	if p.Outbound == "" {
+		p.Outbound = fallback.Outbound
+	}
+	return p
+}
+
+// For returns the policy for a direction, PolicyPrompt when unset.
+func (p DefaultPolicy) For(direction string) string {
+	policy := p.Outbound
+	if direction == "inbound" {
+		policy = p.Inbound
+	}
+	if policy == "" {
+		return PolicyPrompt
+	}
+	return policy
+}
+
+// String renders the policy as "inbound=deny,outbound=prompt", the form
+// ParseDefaultPolicy reads; unset directions are left out.
+func (p DefaultPolicy) String() string {
+	var parts []string
+	if p.Inbound != "" {
+		parts = append(parts, "inbound="+p.Inbound)
+	}
+	if p.Outbound != "" {
+		parts = append(parts, "outbound="+p.Outbound)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseDefaultPolicy parses "inbound=deny,outbound=allow"; either direction
+// may be left out, and a bare policy ("deny") sets both.
+func ParseDefaultPolicy(s string) (DefaultPolicy, error) {
+	var p DefaultPolicy
+	if s = strings.TrimSpace(s); s == "" {
+		return p, nil
+	}
+	if !strings.Contains(s, "=") {
+		p = DefaultPolicy{Inbound: s, Outbound: s}
+		return p, p.Validate()
+	}
+	for _, part := range strings.Split(s, ",") {
+		dir, policy, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch dir {
+		case "inbound":
+			p.Inbound = policy
+		case "outbound":
+			p.Outbound = policy
+		default:
+			return DefaultPolicy{}, fmt.Errorf("invalid default policy %q: expected inbound=... or outbound=...", part)
+		}
+	}
+	return p, p.Validate()
+}
+
+// CatchAll returns the rules that enforce the policy once every other rule
+// has been evaluated: one per direction whose policy is allow or deny, named
+// CatchAllPrefix plus the direction. Prompting cannot be expressed as a rule,
+// so a direction left to prompt gets none.
+func (p DefaultPolicy) CatchAll() []Rule {
+	var out []Rule
+	for _, dir := range []string{"inbound", "outbound"} {
+		policy := p.For(dir)
+		if policy == PolicyPrompt {
+			continue
+		}
+		out = append(out, Rule{
+			Name:        CatchAllPrefix + dir,
+			Application: AnyApplication,
+			Action:      policy,
+			Protocol:    "any",
+			Direction:   dir,
+			Priority:    CatchAllPriority,
+		})
+	}
+	return out
+}
+
+// IsCatchAll reports whether r is a rule made by CatchAll; Validate reserves
+// their names.
+func IsCatchAll(r Rule) bool {
+	return strings.HasPrefix(r.Name, CatchAllPrefix)
+}
@@ -0,0 +1,63 @@
+package rules
+
+import "testing"
+
+func TestParseDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DefaultPolicy
+		wantErr bool
+	}{
+		{"", DefaultPolicy{}, false},
+		{"deny", DefaultPolicy{Inbound: "deny", Outbound: "deny"}, false},
+		{"inbound=deny,outbound=prompt", DefaultPolicy{Inbound: "deny", Outbound: "prompt"}, false},
+		{"outbound=allow", DefaultPolicy{Outbound: "allow"}, false},
+		{"inbound=block", DefaultPolicy{}, true},
+		{"sideways=deny", DefaultPolicy{}, true},
+		{"reject", DefaultPolicy{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDefaultPolicy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDefaultPolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseDefaultPolicy(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if got := (DefaultPolicy{Inbound: "deny", Outbound: "prompt"}).String(); got != "inbound=deny,outbound=prompt" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestDefaultPolicy_CatchAll(t *testing.T) {
+	p := DefaultPolicy{Inbound: "deny"}.Or(DefaultPolicy{Inbound: "allow", Outbound: "allow"})
+	if p.For("inbound") != PolicyDeny || p.For("outbound") != PolicyAllow || (DefaultPolicy{}).For("inbound") != PolicyPrompt {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+
+	list := p.CatchAll()
+	if len(list) != 2 {
+		t.Fatalf("CatchAll() = %+v", list)
+	}
+	for _, r := range list {
+		if err := Validate(r); err == nil {
+			t.Errorf("catch-all %q should carry a reserved name", r.Name)
+		}
+		if !IsCatchAll(r) || r.Application != AnyApplication || r.Protocol != "any" || r.Action != p.For(r.Direction) {
+			t.Errorf("unexpected catch-all %+v", r)
+		}
+	}
+
+	// Catch-alls are evaluated after every other rule.
+	all := append(list, Rule{Name: "late", Application: "any", Protocol: "any", Direction: "inbound", Priority: 1000})
+	Sort(all)
+	if all[0].Name != "late" {
+		t.Errorf("order = %v", names(all))
+	}
+
+	if got := (DefaultPolicy{Inbound: "prompt"}).CatchAll(); len(got) != 0 {
+		t.Errorf("prompting needs no catch-all, got %+v", got)
+	}
+}
@@ -0,0 +1,247 @@
+package rules
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+// Operations recorded in rule_history.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	OpRename = "rename"
+)
+
+// Sources of a rule change.
+const (
+	SourceCLI     = "cli"
+	SourceGUI     = "gui"
+	SourceMonitor = "monitor"
+)
+
+// Audit identifies who made a change and through which front end.
+type Audit struct {
+	Actor  string // user name; defaults to the user running the process
+	Source string // SourceCLI, SourceGUI, SourceMonitor or another label
+}
+
+// HistoryStore is implemented by stores that keep an audit trail of rule
+// changes.
+type HistoryStore interface {
+	History(ctx context.Context, name string, limit int) ([]Change, error)
+	Revert(ctx context.Context, revision int64) ([]Change, error)
+}
+
+type auditKey struct{}
+
+// WithAudit returns a context whose rule changes are attributed to a. Empty
+// fields fall back to the store's defaults.
+func WithAudit(ctx context.Context, a Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, a)
+}
+
+// SetSource sets the source recorded for changes whose context names none.
+func (s *SQLiteStore) SetSource(source string) {
+	s.source = source
+}
+
+// audit resolves the attribution of a change made with ctx.
+func (s *SQLiteStore) audit(ctx context.Context) Audit {
+	a, _ := ctx.Value(auditKey{}).(Audit)
+	if a.Source == "" {
+		a.Source = s.source
+	}
+	if a.Actor == "" {
+		a.Actor = processUser()
+	}
+	return a
+}
+
+var (
+	processUserOnce sync.Once
+	processUserName string
+)
+
+// processUser returns the name of the user running the process.
+func processUser() string {
+	processUserOnce.Do(func() {
+		if u, err := user.Current(); err == nil && u.Username != "" {
+			processUserName = u.Username
+			return
+		}
+		for _, env := range []string{"USER", "USERNAME"} {
+			if v := os.Getenv(env); v != "" {
+				processUserName = v
+				return
+			}
+		}
+		processUserName = "unknown"
+	})
+	return processUserName
+}
+
+// Change is one entry of the rule audit trail. Old is nil for a create and
+// New is nil for a delete; a rename records the rule under both names.
+type Change struct {
+	Revision  int64
+	Rule      string // name of the rule after the change
+	Operation string
+	Old       *Rule
+	New       *Rule
+	Actor     string
+	Source    string
+	At        time.Time
+}
+
+// recordChange appends an entry to rule_history.
+func recordChange(ctx context.Context, q storage.DBTX, audit Audit, op, name string, old, new *Rule) error {
+	oldValue, err := encodeRule(old)
+	if err != nil {
+		return err
+	}
+	newValue, err := encodeRule(new)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `INSERT INTO rule_history (rule_name, operation, old_value, new_value, actor, source, changed_at) VALUES (?,?,?,?,?,?,?)`,
+		name, op, oldValue, newValue, audit.Actor, audit.Source, time.Now().Unix())
+	return err
+}
+
+func encodeRule(r *Rule) (sql.NullString, error) {
+	if r == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func decodeRule(v sql.NullString) (*Rule, error) {
+	if !v.Valid {
+		return nil, nil
+	}
+	var r Rule
+	if err := json.Unmarshal([]byte(v.String), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// History lists recorded changes, newest first. A non-empty name limits it to
+// changes made to that rule under either its old or new name; limit caps the
+// number of entries when positive.
+func (s *SQLiteStore) History(ctx context.Context, name string, limit int) ([]Change, error) {
+	query := `SELECT revision, rule_name, operation, old_value, new_value, actor, source, changed_at FROM rule_history`
+	var args []any
+	if name != "" {
+		query += ` WHERE rule_name = ? OR (operation = 'rename' AND json_extract(old_value, '$.Name') = ?)`
+		args = append(args, name, name)
+	}
+	query += ` ORDER BY revision DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	return queryChanges(ctx, s.conn.Q(), query, args...)
+}
+
+func queryChanges(ctx context.Context, q storage.DBTX, query string, args ...any) ([]Change, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Change
+	for rows.Next() {
+		var c Change
+		var oldValue, newValue sql.NullString
+		var at int64
+		if err := rows.Scan(&c.Revision, &c.Rule, &c.Operation, &oldValue, &newValue, &c.Actor, &c.Source, &at); err != nil {
+			return nil, err
+		}
+		if c.Old, err = decodeRule(oldValue); err != nil {
+			return nil, fmt.Errorf("revision %d: invalid old value: %w", c.Revision, err)
+		}
+		if c.New, err = decodeRule(newValue); err != nil {
+			return nil, fmt.Errorf("revision %d: invalid new value: %w", c.Revision, err)
+		}
+		c.At = time.Unix(at, 0).UTC()
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Revert restores the rules to their state right after revision, undoing every
+// later change newest first in one transaction; revision 0 undoes the whole
+// history. The undo steps are recorded as changes of their own, so a revert can
+// itself be reverted. Profile memberships lost when a rule was deleted are not
+// restored. It returns the changes that were undone.
+func (s *SQLiteStore) Revert(ctx context.Context, revision int64) ([]Change, error) {
+	if revision < 0 {
+		return nil, fmt.Errorf("invalid revision %d", revision)
+	}
+	audit := s.audit(ctx)
+	var undone []Change
+	err := s.conn.Write(ctx, func(q storage.DBTX) error {
+		if revision > 0 {
+			var n int
+			if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM rule_history WHERE revision = ?`, revision).Scan(&n); err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("revision %d not found", revision)
+			}
+		}
+		later, err := queryChanges(ctx, q, `SELECT revision, rule_name, operation, old_value, new_value, actor, source, changed_at
+FROM rule_history WHERE revision > ? ORDER BY revision DESC`, revision)
+		if err != nil {
+			return err
+		}
+		for _, c := range later {
+			if err := undo(ctx, q, audit, c); err != nil {
+				return fmt.Errorf("undo revision %d (%s %s): %w", c.Revision, c.Operation, c.Rule, err)
+			}
+		}
+		undone = later
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return undone, nil
+}
+
+// undo applies the inverse of a recorded change.
+func undo(ctx context.Context, q storage.DBTX, audit Audit, c Change) error {
+	switch c.Operation {
+	case OpCreate:
+		found, err := deleteRule(ctx, q, audit, c.Rule)
+		if err == nil && !found {
+			err = fmt.Errorf("rule %q not found", c.Rule)
+		}
+		return err
+	case OpUpdate, OpDelete:
+		if c.Old == nil {
+			return fmt.Errorf("no previous value recorded")
+		}
+		return saveRule(ctx, q, audit, *c.Old)
+	case OpRename:
+		if c.Old == nil {
+			return fmt.Errorf("no previous value recorded")
+		}
+		return renameRule(ctx, q, audit, c.Rule, c.Old.Name)
+	}
+	return fmt.Errorf("unknown operation %q", c.Operation)
+}
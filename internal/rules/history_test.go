@@ -0,0 +1,92 @@
+package rules
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+func TestHistoryAndRevert(t *testing.T) {
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	store.SetSource(SourceCLI)
+	ctx := context.Background()
+
+	web := Rule{Name: "web", Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}
+	if err := store.SaveRule(web); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	checkpoint, err := store.History(ctx, "", 1)
+	if err != nil || len(checkpoint) != 1 || checkpoint[0].Operation != OpCreate {
+		t.Fatalf("history after create = %+v, %v", checkpoint, err)
+	}
+
+	if err := store.SaveRule(web); err != nil {
+		t.Fatalf("save unchanged: %v", err)
+	}
+	if again, _ := store.History(ctx, "", 0); len(again) != 1 {
+		t.Fatalf("saving an unchanged rule should not record history, got %+v", again)
+	}
+
+	web.Action = "deny"
+	monitorCtx := WithAudit(ctx, Audit{Actor: "alice", Source: SourceMonitor})
+	if err := store.SaveRuleContext(monitorCtx, web); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := store.RenameRule(ctx, "web", "https"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	ssh := Rule{Name: "ssh", Application: "any", Action: "allow", Protocol: "tcp", Direction: "inbound", Ports: []int{22}}
+	if err := store.SaveRule(ssh); err != nil {
+		t.Fatalf("save ssh: %v", err)
+	}
+	if err := store.DeleteRule("https"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	all, err := store.History(ctx, "", 0)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	var ops []string
+	for _, c := range all {
+		ops = append(ops, c.Operation)
+	}
+	if want := []string{OpDelete, OpCreate, OpRename, OpUpdate, OpCreate}; len(ops) != len(want) || ops[0] != want[0] || ops[2] != want[2] || ops[3] != want[3] {
+		t.Fatalf("operations = %v, want %v", ops, want)
+	}
+	update := all[3]
+	if update.Actor != "alice" || update.Source != SourceMonitor || update.Old.Action != "allow" || update.New.Action != "deny" {
+		t.Errorf("unexpected update entry: %+v", update)
+	}
+	if all[4].Source != SourceCLI || all[4].Actor == "" {
+		t.Errorf("default attribution not applied: %+v", all[4])
+	}
+	if named, _ := store.History(ctx, "web", 0); len(named) != 3 {
+		t.Errorf("expected create, update and rename for web, got %d entries", len(named))
+	}
+
+	undone, err := store.Revert(ctx, checkpoint[0].Revision)
+	if err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	if len(undone) != 4 {
+		t.Errorf("expected 4 changes undone, got %d", len(undone))
+	}
+	list, _ := store.ListRules()
+	if len(list) != 1 || list[0].Name != "web" || list[0].Action != "allow" || len(list[0].Ports) != 1 || list[0].Ports[0] != 443 {
+		t.Fatalf("rules after revert = %+v", list)
+	}
+
+	if _, err := store.Revert(ctx, 999); err == nil {
+		t.Error("expected an error for an unknown revision")
+	}
+}
@@ -0,0 +1,50 @@
+package rules
+
+import (
+	"context"
+	"time"
+)
+
+// Expired reports whether the rule's expiry time has passed.
+func (r Rule) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// InEffect reports whether the rule applies at now: it has not expired and
+// now falls inside its schedule, if it has one.
+func (r Rule) InEffect(now time.Time) bool {
+	return !r.Expired(now) && (r.Schedule == nil || r.Schedule.Contains(now))
+}
+
+// Active drops rules that are not in effect at now, keeping the order of the rest.
+func Active(list []Rule, now time.Time) []Rule {
+	out := make([]Rule, 0, len(list))
+	for _, r := range list {
+		if r.InEffect(now) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Purge deletes every stored rule for which match returns true and returns
+// their names. Stores that support DeleteRules remove them in one batch.
+func Purge(store Store, match func(Rule) bool) ([]string, error) {
+	list, err := store.ListRules()
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	for _, r := range list {
+		if match(r) {
+			purged = append(purged, r.Name)
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	if err := DeleteAll(context.Background(), store, purged); err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
@@ -0,0 +1,72 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/storage"
+)
+
+func TestExpiredAndActive(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	list := []Rule{
+		{Name: "permanent"},
+		{Name: "past", ExpiresAt: now.Add(-time.Minute)},
+		{Name: "future", ExpiresAt: now.Add(time.Minute)},
+		{Name: "now", ExpiresAt: now},
+	}
+
+	active := Active(list, now)
+	if len(active) != 2 || active[0].Name != "permanent" || active[1].Name != "future" {
+		t.Fatalf("Active() = %+v", active)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+
+	expires := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	for _, r := range []Rule{
+		{Name: "keep", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound",
+			Schedule: &Schedule{Windows: []TimeWindow{{Start: 60, End: 120}}, Location: "UTC"}},
+		{Name: "old", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound", ExpiresAt: expires},
+		{Name: "session", Application: "app", Action: "deny", Protocol: "any", Direction: "outbound", Session: true},
+	} {
+		if err := store.SaveRule(r); err != nil {
+			t.Fatalf("save %s: %v", r.Name, err)
+		}
+	}
+
+	list, _ := store.ListRules()
+	for _, r := range list {
+		if r.Name == "old" && !r.ExpiresAt.Equal(expires) {
+			t.Errorf("ExpiresAt round trip = %v, want %v", r.ExpiresAt, expires)
+		}
+		if r.Name == "session" && !r.Session {
+			t.Errorf("Session flag lost in round trip")
+		}
+		if r.Name == "keep" && (r.Schedule == nil || r.Schedule.String() != "01:00-02:00 UTC") {
+			t.Errorf("Schedule round trip = %v", r.Schedule)
+		}
+	}
+
+	purged, err := Purge(store, func(r Rule) bool { return r.Expired(time.Now()) })
+	if err != nil || len(purged) != 1 || purged[0] != "old" {
+		t.Fatalf("Purge(expired) = %v, %v", purged, err)
+	}
+	purged, err = Purge(store, func(r Rule) bool { return r.Session })
+	if err != nil || len(purged) != 1 || purged[0] != "session" {
+		t.Fatalf("Purge(session) = %v, %v", purged, err)
+	}
+	if list, _ := store.ListRules(); len(list) != 1 || list[0].Name != "keep" {
+		t.Fatalf("remaining rules = %+v", list)
+	}
+}
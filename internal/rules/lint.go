@@ -0,0 +1,317 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Severities of lint findings.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Kinds of lint findings.
+const (
+	// LintShadowed: an earlier rule with the opposite action matches every
+	// connection the rule matches, so the rule never decides anything.
+	LintShadowed = "shadowed"
+	// LintRedundant: an earlier rule with the same action matches every
+	// connection the rule matches, so removing it changes nothing.
+	LintRedundant = "redundant"
+	// LintContradictory: another rule matches exactly the same connections
+	// with the opposite action; only evaluation order picks the winner.
+	LintContradictory = "contradictory"
+	// LintDead: the rule can never match, e.g. it expired or names an
+	// executable that does not exist.
+	LintDead = "dead"
+)
+
+// Finding is one problem reported by Lint.
+type Finding struct {
+	Severity string
+	Kind     string
+	Rule     string
+	Other    string // the rule it conflicts with, if any
+	Message  string
+}
+
+// LintOptions tune Lint. The zero value checks against the current time and
+// the local file system.
+type LintOptions struct {
+	Now    time.Time
+	Exists func(path string) bool // reports whether an executable exists
+}
+
+// Lint analyses a rule set in evaluation order and reports rules that are
+// shadowed, redundant, contradictory or dead. A rule is only reported as
+// covered when a single earlier rule matches everything it matches; coverage
+// by several rules together is not detected. Findings are ordered by rule in
+// evaluation order.
+func Lint(list []Rule, opts LintOptions) []Finding {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Exists == nil {
+		opts.Exists = func(p string) bool {
+			_, err := os.Stat(p)
+			return err == nil
+		}
+	}
+
+	ordered := append([]Rule(nil), list...)
+	Sort(ordered)
+
+	var out []Finding
+	var live []Rule
+	for _, r := range ordered {
+		if dead := deadReason(r, opts); dead != "" {
+			severity := SeverityWarning
+			if r.Expired(opts.Now) {
+				severity = SeverityInfo
+			}
+			out = append(out, Finding{Severity: severity, Kind: LintDead, Rule: r.Name, Message: dead})
+			continue
+		}
+		for _, earlier := range live {
+			if !Covers(earlier, r) {
+				continue
+			}
+			out = append(out, coverage(earlier, r))
+			break
+		}
+		live = append(live, r)
+	}
+	return out
+}
+
+// deadReason explains why a rule can never match, or returns "".
+func deadReason(r Rule, opts LintOptions) string {
+	if r.Expired(opts.Now) {
+		return fmt.Sprintf("expired at %s and waiting to be purged", r.ExpiresAt.Format(time.RFC3339))
+	}
+	if app, err := ParseApplication(r.Application); err == nil && app.Kind == AppExact &&
+		filepath.IsAbs(r.Application) && !opts.Exists(r.Application) {
+		return fmt.Sprintf("application %s does not exist", r.Application)
+	}
+	return ""
+}
+
+// coverage describes a rule matched entirely by an earlier one.
+func coverage(earlier, r Rule) Finding {
+	f := Finding{Rule: r.Name, Other: earlier.Name}
+	same := Covers(r, earlier)
+	switch {
+	case earlier.Action == r.Action && same:
+		f.Severity, f.Kind = SeverityWarning, LintRedundant
+		f.Message = fmt.Sprintf("duplicates %q", earlier.Name)
+	case earlier.Action == r.Action:
+		f.Severity, f.Kind = SeverityInfo, LintRedundant
+		f.Message = fmt.Sprintf("already covered by %q", earlier.Name)
+	case same:
+		f.Severity, f.Kind = SeverityError, LintContradictory
+		f.Message = fmt.Sprintf("matches the same connections as %q, which %s them first", earlier.Name, actionVerb(earlier.Action))
+	default:
+		f.Kind = LintShadowed
+		f.Severity = SeverityWarning
+		if r.Action == "deny" {
+			// Traffic meant to be blocked gets through.
+			f.Severity = SeverityError
+		}
+		f.Message = fmt.Sprintf("never applies: %q %s all its connections first", earlier.Name, actionVerb(earlier.Action))
+	}
+	return f
+}
+
+// actionVerb conjugates a rule action for messages: "allows" or "denies".
+func actionVerb(action string) string {
+	if action == "deny" {
+		return "denies"
+	}
+	return "allows"
+}
+
+// Covers reports whether every connection b matches is also matched by a.
+// It is conservative: when coverage cannot be decided, such as for two
+// different regular expressions, it reports false. Identity pins do not
+// matter, since a matching rule whose pin fails still ends evaluation.
+func Covers(a, b Rule) bool {
+	if a.Direction != b.Direction {
+		return false
+	}
+	if a.Protocol != "any" && a.Protocol != b.Protocol {
+		return false
+	}
+	if (a.User != "" && a.User != b.User) || (a.Group != "" && a.Group != b.Group) {
+		return false
+	}
+	if a.Schedule != nil && (b.Schedule == nil || a.Schedule.String() != b.Schedule.String()) {
+		return false
+	}
+	return coversApplication(a.Application, b.Application) &&
+		coversAddresses(a.RemoteAddresses, b.RemoteAddresses) &&
+		coversAddresses(a.LocalAddresses, b.LocalAddresses) &&
+		coversPorts(a.LocalPortRanges(), b.LocalPortRanges()) &&
+		coversPorts(a.RemotePortRanges(), b.RemotePortRanges())
+}
+
+// Overlaps reports whether some connection could match both a and b. It errs
+// the other way from Covers: when overlap cannot be ruled out, such as for two
+// patterns, it reports true. Owners and schedules are not considered.
+func Overlaps(a, b Rule) bool {
+	if a.Direction != b.Direction {
+		return false
+	}
+	if a.Protocol != "any" && b.Protocol != "any" && a.Protocol != b.Protocol {
+		return false
+	}
+	return overlapsApplication(a.Application, b.Application) &&
+		overlapsAddresses(a.RemoteAddresses, b.RemoteAddresses) &&
+		overlapsAddresses(a.LocalAddresses, b.LocalAddresses) &&
+		overlapsPorts(a.LocalPortRanges(), b.LocalPortRanges()) &&
+		overlapsPorts(a.RemotePortRanges(), b.RemotePortRanges())
+}
+
+func overlapsApplication(a, b string) bool {
+	pa, errA := ParseApplication(a)
+	pb, errB := ParseApplication(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	switch {
+	case pa.Kind == AppExact:
+		return pb.Match(pa.Value)
+	case pb.Kind == AppExact:
+		return pa.Match(pb.Value)
+	}
+	return true
+}
+
+// overlapsAddresses reports whether an address lies in both lists; an empty
+// list matches any address.
+func overlapsAddresses(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, ea := range a {
+		ra, err := ParseAddress(ea)
+		if err != nil {
+			return true
+		}
+		for _, eb := range b {
+			rb, err := ParseAddress(eb)
+			if err != nil || ra.Contains(rb.From) || rb.Contains(ra.From) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// overlapsPorts reports whether a port lies in both lists; an empty list
+// matches any port.
+func overlapsPorts(a, b []PortRange) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, ra := range a {
+		for _, rb := range b {
+			if ra.From <= rb.To && rb.From <= ra.To {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// coversApplication reports whether every executable matching pattern b also
+// matches pattern a.
+func coversApplication(a, b string) bool {
+	pa, errA := ParseApplication(a)
+	pb, errB := ParseApplication(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if pa.Kind == AppAny {
+		return true
+	}
+	switch pb.Kind {
+	case AppExact:
+		return pa.Match(pb.Value)
+	case AppPrefix, AppGlob:
+		if pa.Kind == AppPrefix {
+			// Everything a prefix or glob matches starts with its literal part.
+			literal := pb.Value
+			if i := strings.IndexAny(literal, "*?["); i >= 0 {
+				literal = literal[:i]
+			}
+			return strings.HasPrefix(strings.ToLower(slashed(literal)), strings.ToLower(slashed(pa.Value)))
+		}
+		return pa.Kind == pb.Kind && strings.EqualFold(slashed(pa.Value), slashed(pb.Value))
+	case AppRegex:
+		return pa.Kind == AppRegex && pa.Value == pb.Value
+	}
+	return false
+}
+
+// coversAddresses reports whether every entry of b lies within one entry of
+// a. An empty list matches any address.
+func coversAddresses(a, b []string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, eb := range b {
+		rb, err := ParseAddress(eb)
+		if err != nil {
+			return false
+		}
+		covered := false
+		for _, ea := range a {
+			ra, err := ParseAddress(ea)
+			if err == nil && ra.Contains(rb.From) && ra.Contains(rb.To) && sameFamily(ra.From, rb.From) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFamily(a, b netip.Addr) bool {
+	return a.Is4() == b.Is4()
+}
+
+// coversPorts reports whether every range of b lies within one range of a.
+// An empty list matches any port.
+func coversPorts(a, b []PortRange) bool {
+	if len(a) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, rb := range b {
+		covered := false
+		for _, ra := range a {
+			if ra.From <= rb.From && rb.To <= ra.To {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
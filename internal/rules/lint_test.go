@@ -0,0 +1,137 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Rule
+		want bool
+	}{
+		{"any app and protocol",
+			Rule{Application: "any", Protocol: "any", Direction: "outbound"},
+			Rule{Application: "/usr/bin/curl", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}, true},
+		{"other direction",
+			Rule{Application: "any", Protocol: "any", Direction: "inbound"},
+			Rule{Application: "any", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}, false},
+		{"port range",
+			Rule{Application: "any", Protocol: "tcp", Direction: "outbound", RemotePorts: []string{"1-1024"}},
+			Rule{Application: "any", Protocol: "tcp", Direction: "outbound", Ports: []int{80, 443}}, true},
+		{"port outside range",
+			Rule{Application: "any", Protocol: "tcp", Direction: "outbound", Ports: []int{80}},
+			Rule{Application: "any", Protocol: "tcp", Direction: "outbound", Ports: []int{80, 443}}, false},
+		{"prefix over glob",
+			Rule{Application: "/opt/", Protocol: "any", Direction: "outbound"},
+			Rule{Application: "/opt/app-*/bin/app", Protocol: "any", Direction: "outbound"}, true},
+		{"glob over exact",
+			Rule{Application: "/opt/app-*/bin/app", Protocol: "any", Direction: "outbound"},
+			Rule{Application: "/opt/app-2/bin/app", Protocol: "any", Direction: "outbound"}, true},
+		{"exact over prefix",
+			Rule{Application: "/opt/app", Protocol: "any", Direction: "outbound"},
+			Rule{Application: "/opt/", Protocol: "any", Direction: "outbound"}, false},
+		{"subnet",
+			Rule{Application: "any", Protocol: "any", Direction: "outbound", RemoteAddresses: []string{"10.0.0.0/8"}},
+			Rule{Application: "any", Protocol: "any", Direction: "outbound", RemoteAddresses: []string{"10.1.2.3", "10.0.0.1-10.0.0.9"}}, true},
+		{"any address not covered by subnet",
+			Rule{Application: "any", Protocol: "any", Direction: "outbound", RemoteAddresses: []string{"10.0.0.0/8"}},
+			Rule{Application: "any", Protocol: "any", Direction: "outbound"}, false},
+		{"user restriction",
+			Rule{Application: "any", Protocol: "any", Direction: "outbound", User: "alice"},
+			Rule{Application: "any", Protocol: "any", Direction: "outbound"}, false},
+	}
+	for _, tt := range tests {
+		if got := Covers(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: Covers = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	base := Rule{Name: "a", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}
+	with := func(f func(*Rule)) Rule {
+		r := base
+		r.Name = "b"
+		f(&r)
+		return r
+	}
+	tests := []struct {
+		name string
+		b    Rule
+		want bool
+	}{
+		{"same", with(func(r *Rule) {}), true},
+		{"any application", with(func(r *Rule) { r.Application = "any"; r.Protocol = "any"; r.Ports = nil }), true},
+		{"other application", with(func(r *Rule) { r.Application = "/usr/bin/wget" }), false},
+		{"matching pattern", with(func(r *Rule) { r.Application = "/usr/bin/" }), true},
+		{"other direction", with(func(r *Rule) { r.Direction = "inbound" }), false},
+		{"other protocol", with(func(r *Rule) { r.Protocol = "udp" }), false},
+		{"port range", with(func(r *Rule) { r.Ports = nil; r.RemotePorts = []string{"400-500"} }), true},
+		{"other port", with(func(r *Rule) { r.Ports = []int{80} }), false},
+		{"addresses", with(func(r *Rule) { r.RemoteAddresses = []string{"10.0.0.0/8"} }), true},
+	}
+	for _, tt := range tests {
+		if got := Overlaps(base, tt.b); got != tt.want {
+			t.Errorf("%s: Overlaps = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	a := with(func(r *Rule) { r.RemoteAddresses = []string{"10.0.0.0/8"} })
+	b := with(func(r *Rule) { r.RemoteAddresses = []string{"192.168.0.1-192.168.0.9", "10.1.2.3"} })
+	c := with(func(r *Rule) { r.RemoteAddresses = []string{"192.168.0.0/16", "2001:db8::1"} })
+	if !Overlaps(a, b) || Overlaps(a, c) {
+		t.Error("address overlap not detected correctly")
+	}
+}
+
+func TestLint(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	list := []Rule{
+		{Name: "allow-web", Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{80, 443}, Priority: -1},
+		{Name: "block-https", Application: "/usr/bin/curl", Action: "deny", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "auto_curl_tcp_443", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "auto_curl_outbound", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "ssh-in", Application: "any", Action: "allow", Protocol: "tcp", Direction: "inbound", Ports: []int{22}},
+		{Name: "ssh-block", Application: "any", Action: "deny", Protocol: "tcp", Direction: "inbound", Ports: []int{22}},
+		{Name: "gone", Application: "/opt/gone/bin/gone", Action: "allow", Protocol: "any", Direction: "outbound"},
+		{Name: "old", Application: "any", Action: "allow", Protocol: "udp", Direction: "outbound", Ports: []int{53}, ExpiresAt: now.Add(-time.Hour)},
+	}
+	exists := func(path string) bool { return path == "/usr/bin/curl" }
+
+	got := make(map[string]Finding)
+	for _, f := range Lint(list, LintOptions{Now: now, Exists: exists}) {
+		got[f.Rule] = f
+	}
+
+	want := map[string]struct{ severity, kind, other string }{
+		"block-https":        {SeverityError, LintShadowed, "allow-web"},
+		"auto_curl_outbound": {SeverityInfo, LintRedundant, "allow-web"},
+		"auto_curl_tcp_443":  {SeverityInfo, LintRedundant, "allow-web"},
+		"ssh-in":             {SeverityError, LintContradictory, "ssh-block"},
+		"gone":               {SeverityWarning, LintDead, ""},
+		"old":                {SeverityInfo, LintDead, ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("findings = %+v, want %d", got, len(want))
+	}
+	for name, w := range want {
+		f, ok := got[name]
+		if !ok || f.Severity != w.severity || f.Kind != w.kind || f.Other != w.other {
+			t.Errorf("%s: finding = %+v, want %+v", name, f, w)
+		}
+	}
+}
+
+func TestLint_Duplicates(t *testing.T) {
+	list := []Rule{
+		{Name: "auto_curl_tcp_443", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "auto_curl_outbound", Application: "/usr/bin/curl", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+	}
+	findings := Lint(list, LintOptions{Exists: func(string) bool { return true }})
+	if len(findings) != 1 || findings[0].Rule != "auto_curl_tcp_443" || findings[0].Kind != LintRedundant ||
+		findings[0].Severity != SeverityWarning || findings[0].Other != "auto_curl_outbound" {
+		t.Fatalf("findings = %+v", findings)
+	}
+}
@@ -0,0 +1,71 @@
+package rules
+
+import "sort"
+
+// Evaluation model
+//
+// Rules are evaluated first-match: the first rule in evaluation order that
+// matches a connection decides it. Evaluation order is ascending Priority, so
+// lower numbers win. Among rules of equal priority the more specific rule comes
+// first: an exact application path beats a directory prefix, glob or regex,
+// which beat "any", and then rules restricting more dimensions come first. The
+// name breaks any remaining tie so the order never depends on how rules were
+// stored. The connection handler follows this order and the Linux renderers
+// install rules in it. Windows Firewall ignores rule order and lets a block
+// rule win over any allow rule it overlaps, so there a deny rule also
+// overrides allow rules evaluated before it; PlanRuleset warns about them.
+
+// Sort orders rules in place by evaluation order.
+func Sort(list []Rule) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return Less(list[i], list[j])
+	})
+}
+
+// Less reports whether a is evaluated before b.
+func Less(a, b Rule) bool {
+	if a.Priority != b.Priority {
+		return a.Priority < b.Priority
+	}
+	if ka, kb := appKind(a), appKind(b); ka != kb {
+		return ka > kb
+	}
+	if sa, sb := specificity(a), specificity(b); sa != sb {
+		return sa > sb
+	}
+	return a.Name < b.Name
+}
+
+// appKind ranks how specifically a rule names its application.
+func appKind(r Rule) int {
+	p, err := ParseApplication(r.Application)
+	if err != nil {
+		return AppAny
+	}
+	// Patterns of different kinds are equally specific
+	if p.Kind != AppExact && p.Kind != AppAny {
+		return AppRegex
+	}
+	return p.Kind
+}
+
+// specificity counts the dimensions, other than the application, a rule restricts.
+func specificity(r Rule) int {
+	n := 0
+	if r.Protocol != "" && r.Protocol != "any" {
+		n++
+	}
+	if len(r.Ports) > 0 || len(r.LocalPorts) > 0 || len(r.RemotePorts) > 0 {
+		n++
+	}
+	if len(r.RemoteAddresses) > 0 {
+		n++
+	}
+	if len(r.LocalAddresses) > 0 {
+		n++
+	}
+	if r.User != "" || r.Group != "" {
+		n++
+	}
+	return n
+}
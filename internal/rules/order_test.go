@@ -0,0 +1,47 @@
+package rules
+
+import "testing"
+
+func TestSort(t *testing.T) {
+	list := []Rule{
+		{Name: "aaa-allow", Application: "", Protocol: "any"},
+		{Name: "block-all", Application: "", Protocol: "any", Priority: -10},
+		{Name: "web", Application: "/usr/bin/curl", Protocol: "tcp", Ports: []int{443}},
+		{Name: "curl", Application: "/usr/bin/curl", Protocol: "any"},
+		{Name: "late", Application: "/usr/bin/curl", Protocol: "tcp", Ports: []int{80}, Priority: 100},
+	}
+
+	Sort(list)
+
+	want := []string{"block-all", "web", "curl", "aaa-allow", "late"}
+	for i, name := range want {
+		if list[i].Name != name {
+			t.Fatalf("order = %v, want %v", names(list), want)
+		}
+	}
+}
+
+func TestSort_ExactApplicationBeforePatterns(t *testing.T) {
+	list := []Rule{
+		{Name: "a-any", Application: "any", Protocol: "tcp", Ports: []int{443}},
+		{Name: "b-prefix", Application: "/opt/", Protocol: "tcp", Ports: []int{443}},
+		{Name: "c-exact", Application: "/opt/app/bin/app", Protocol: "any"},
+	}
+
+	Sort(list)
+
+	want := []string{"c-exact", "b-prefix", "a-any"}
+	for i, name := range want {
+		if list[i].Name != name {
+			t.Fatalf("order = %v, want %v", names(list), want)
+		}
+	}
+}
+
+func names(list []Rule) []string {
+	out := make([]string, len(list))
+	for i, r := range list {
+		out[i] = r.Name
+	}
+	return out
+}
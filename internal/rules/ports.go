@@ -0,0 +1,158 @@
+package rules
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//go:embed services.txt
+var servicesTable string
+
+// services maps well-known service names (and their aliases) to ports.
+var services = parseServices(servicesTable)
+
+// PortRange is a parsed entry of Rule.LocalPorts or Rule.RemotePorts: an
+// inclusive range of ports. Entries are written as a port ("443"), a range
+// ("1024-65535") or a service name from the embedded table ("https").
+type PortRange struct {
+	From int
+	To   int
+}
+
+// ParsePort parses a single port entry, resolving service names.
+func ParsePort(entry string) (PortRange, error) {
+	if port, ok := LookupService(entry); ok {
+		return PortRange{From: port, To: port}, nil
+	}
+
+	if from, to, found := strings.Cut(entry, "-"); found {
+		lo, err := parsePortNumber(from)
+		if err != nil {
+			return PortRange{}, fmt.Errorf("invalid port range %q: %w", entry, err)
+		}
+		hi, err := parsePortNumber(to)
+		if err != nil {
+			return PortRange{}, fmt.Errorf("invalid port range %q: %w", entry, err)
+		}
+		if hi < lo {
+			return PortRange{}, fmt.Errorf("port range %q ends before it starts", entry)
+		}
+		return PortRange{From: lo, To: hi}, nil
+	}
+
+	port, err := parsePortNumber(entry)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port %q: %w", entry, err)
+	}
+	return PortRange{From: port, To: port}, nil
+}
+
+// Contains reports whether port falls within the range.
+func (p PortRange) Contains(port int) bool {
+	return port >= p.From && port <= p.To
+}
+
+// String formats the range as "443" or "1024-65535".
+func (p PortRange) String() string {
+	if p.From == p.To {
+		return strconv.Itoa(p.From)
+	}
+	return fmt.Sprintf("%d-%d", p.From, p.To)
+}
+
+// LookupService resolves a well-known service name such as "https" or "dns".
+func LookupService(name string) (int, bool) {
+	port, ok := services[strings.ToLower(name)]
+	return port, ok
+}
+
+// MatchPort reports whether port falls in any of the ranges. An empty list
+// matches every port.
+func MatchPort(list []PortRange, port int) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, p := range list {
+		if p.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalPortRanges returns the ports matched on the local end of a connection.
+// The legacy Ports list names the local port of inbound rules.
+func (r Rule) LocalPortRanges() []PortRange {
+	if r.Direction == "inbound" && len(r.Ports) > 0 {
+		return intPortRanges(r.Ports)
+	}
+	return parsePortList(r.LocalPorts)
+}
+
+// RemotePortRanges returns the ports matched on the remote end of a
+// connection. The legacy Ports list names the remote port of outbound rules.
+func (r Rule) RemotePortRanges() []PortRange {
+	if r.Direction != "inbound" && len(r.Ports) > 0 {
+		return intPortRanges(r.Ports)
+	}
+	return parsePortList(r.RemotePorts)
+}
+
+// parsePortList parses entries already checked by Validate, skipping any that
+// do not parse.
+func parsePortList(list []string) []PortRange {
+	var out []PortRange
+	for _, entry := range list {
+		if p, err := ParsePort(entry); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func intPortRanges(ports []int) []PortRange {
+	out := make([]PortRange, len(ports))
+	for i, p := range ports {
+		out[i] = PortRange{From: p, To: p}
+	}
+	return out
+}
+
+func parsePortNumber(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("port %d out of range", port)
+	}
+	return port, nil
+}
+
+// parseServices reads the embedded services table.
+func parseServices(table string) map[string]int {
+	out := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		port, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		out[fields[0]] = port
+		for _, alias := range fields[2:] {
+			out[alias] = port
+		}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package rules
+
+import "testing"
+
+func TestParsePort(t *testing.T) {
+	cases := []struct {
+		entry    string
+		from, to int
+	}{
+		{"443", 443, 443},
+		{"1024-65535", 1024, 65535},
+		{"https", 443, 443},
+		{"DNS", 53, 53},
+		{"domain", 53, 53},
+	}
+	for _, c := range cases {
+		got, err := ParsePort(c.entry)
+		if err != nil {
+			t.Errorf("ParsePort(%q): %v", c.entry, err)
+			continue
+		}
+		if got.From != c.from || got.To != c.to {
+			t.Errorf("ParsePort(%q) = %+v, want %d-%d", c.entry, got, c.from, c.to)
+		}
+	}
+
+	for _, bad := range []string{"", "0", "65536", "7000-6000", "1-", "gopher"} {
+		if _, err := ParsePort(bad); err == nil {
+			t.Errorf("ParsePort(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRulePortRanges(t *testing.T) {
+	out := Rule{Direction: "outbound", Ports: []int{443}, LocalPorts: []string{"1024-65535"}}
+	if got := out.RemotePortRanges(); len(got) != 1 || got[0].From != 443 {
+		t.Errorf("outbound Ports should be remote ports, got %v", got)
+	}
+	if got := out.LocalPortRanges(); len(got) != 1 || got[0].String() != "1024-65535" {
+		t.Errorf("unexpected local ports %v", got)
+	}
+
+	in := Rule{Direction: "inbound", Ports: []int{22}}
+	if got := in.LocalPortRanges(); len(got) != 1 || got[0].From != 22 || in.RemotePortRanges() != nil {
+		t.Errorf("inbound Ports should be local ports, got %v", got)
+	}
+
+	if !MatchPort(nil, 1) || !MatchPort(out.LocalPortRanges(), 50000) || MatchPort(out.LocalPortRanges(), 80) {
+		t.Errorf("unexpected MatchPort result")
+	}
+}
@@ -1,15 +1,73 @@
 package rules
 
-import "fmt"
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Rule represents a single firewall rule configuration.
 type Rule struct {
 	Name        string
-	Application string
+	Application string // exact path, "any", directory prefix, glob or "re:" regex; see ParseApplication
 	Action      string // allow or deny
 	Protocol    string // tcp, udp, any
-	Ports       []int
+	Ports       []int  // service port: the local port of inbound rules, the remote port of outbound ones
 	Direction   string // inbound or outbound
+	User        string // optional socket owner (name or uid); Linux outbound only
+	Group       string // optional socket group (name or gid); Linux outbound only
+	Priority    int    // evaluation order, lowest first; see Sort
+
+	// Optional executable identity pins. A connection whose executable does not
+	// match is treated as coming from an unknown application.
+	SHA256  string // hex SHA-256 of the executable; exact application paths only
+	Package string // package that must own the executable (Linux dpkg/rpm)
+
+	// Temporary rules. An expired rule is ignored and removed by the janitor;
+	// a session rule is removed when the firewall session (GUI or monitor) ends.
+	ExpiresAt time.Time // zero means the rule never expires
+	Session   bool
+
+	// Optional schedule; outside it the rule is ignored as if it were absent.
+	Schedule *Schedule
+
+	// Address restrictions; each entry is an IP, CIDR or "from-to" range and an
+	// empty list matches any address.
+	RemoteAddresses []string
+	LocalAddresses  []string
+
+	// Port restrictions per end of the connection; each entry is a port, a
+	// "from-to" range or a service name, and an empty list matches any port.
+	LocalPorts  []string
+	RemotePorts []string
+}
+
+// Pinned reports whether the rule pins its executable's identity.
+func (r Rule) Pinned() bool {
+	return r.SHA256 != "" || r.Package != ""
+}
+
+// Equal reports whether two rules have the same definition. Empty and missing
+// lists are alike and expiry times are compared as instants.
+func Equal(a, b Rule) bool {
+	x, errA := json.Marshal(normalize(a))
+	y, errB := json.Marshal(normalize(b))
+	return errA == nil && errB == nil && string(x) == string(y)
+}
+
+func normalize(r Rule) Rule {
+	if len(r.Ports) == 0 {
+		r.Ports = nil
+	}
+	for _, list := range []*[]string{&r.RemoteAddresses, &r.LocalAddresses, &r.LocalPorts, &r.RemotePorts} {
+		if len(*list) == 0 {
+			*list = nil
+		}
+	}
+	r.ExpiresAt = r.ExpiresAt.UTC()
+	return r
 }
 
 // Validate performs basic rule validation; expand with richer checks later.
@@ -17,9 +75,36 @@ func Validate(r Rule) error {
 	if r.Name == "" {
 		return fmt.Errorf("name is required")
 	}
+	if strings.HasPrefix(r.Name, CatchAllPrefix) {
+		return fmt.Errorf("rule names starting with %q are reserved for default policies", CatchAllPrefix)
+	}
 	if r.Application == "" {
 		return fmt.Errorf("application is required")
 	}
+	if r.Priority >= CatchAllPriority {
+		return fmt.Errorf("priority must be below %d, which orders default policies last", CatchAllPriority)
+	}
+	app, err := ParseApplication(r.Application)
+	if err != nil {
+		return err
+	}
+	if r.SHA256 != "" {
+		if app.Kind != AppExact {
+			return fmt.Errorf("sha256 pinning requires an exact application path")
+		}
+		if _, err := hex.DecodeString(r.SHA256); err != nil || len(r.SHA256) != 64 {
+			return fmt.Errorf("invalid sha256: %q", r.SHA256)
+		}
+	}
+	if r.Package != "" && (app.Kind == AppAny || strings.ContainsAny(r.Package, " \t/")) {
+		return fmt.Errorf("invalid package pin %q for application %q", r.Package, r.Application)
+	}
+
+	if r.Schedule != nil {
+		if err := r.Schedule.validate(); err != nil {
+			return err
+		}
+	}
 
 	switch r.Action {
 	case "allow", "deny":
@@ -39,8 +124,35 @@ func Validate(r Rule) error {
 		return fmt.Errorf("invalid direction: %s", r.Direction)
 	}
 
+	if (r.User != "" || r.Group != "") && r.Direction != "outbound" {
+		return fmt.Errorf("user/group matching is only supported for outbound rules")
+	}
+	if strings.ContainsAny(r.User+r.Group, " \t\"':") {
+		return fmt.Errorf("invalid user or group: %q/%q", r.User, r.Group)
+	}
+
+	for _, entry := range append(append([]string{}, r.RemoteAddresses...), r.LocalAddresses...) {
+		if _, err := ParseAddress(entry); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range append(append([]string{}, r.LocalPorts...), r.RemotePorts...) {
+		if _, err := ParsePort(entry); err != nil {
+			return err
+		}
+	}
+	if len(r.Ports) > 0 {
+		if r.Direction == "inbound" && len(r.LocalPorts) > 0 {
+			return fmt.Errorf("ports and local ports both set the local port of an inbound rule")
+		}
+		if r.Direction == "outbound" && len(r.RemotePorts) > 0 {
+			return fmt.Errorf("ports and remote ports both set the remote port of an outbound rule")
+		}
+	}
+
 	if r.Protocol != "any" {
-		if len(r.Ports) == 0 {
+		if len(r.Ports) == 0 && len(r.LocalPorts) == 0 && len(r.RemotePorts) == 0 {
 			return fmt.Errorf("ports required for protocol %s", r.Protocol)
 		}
 		for _, p := range r.Ports {
@@ -48,6 +160,8 @@ func Validate(r Rule) error {
 				return fmt.Errorf("invalid port: %d", p)
 			}
 		}
+	} else if len(r.LocalPorts) > 0 || len(r.RemotePorts) > 0 {
+		return fmt.Errorf("port lists require protocol tcp or udp")
 	}
 
 	return nil
@@ -43,3 +43,97 @@ func TestValidate_ProtocolAnyAllowsNoPorts(t *testing.T) {
 		t.Fatalf("expected success, got %v", err)
 	}
 }
+
+func TestValidate_RejectsCatchAllPriority(t *testing.T) {
+	r := Rule{Name: "x", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound", Priority: CatchAllPriority - 1}
+	if err := Validate(r); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	r.Priority = CatchAllPriority
+	if err := Validate(r); err == nil {
+		t.Fatalf("expected error for a priority that ties with the default policy")
+	}
+}
+
+func TestValidate_OwnerMatchOutboundOnly(t *testing.T) {
+	r := Rule{Name: "x", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound", User: "postgres", Group: "999"}
+	if err := Validate(r); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	r.Direction = "inbound"
+	if err := Validate(r); err == nil {
+		t.Fatalf("expected error for inbound owner match")
+	}
+}
+
+func TestValidate_RejectsInvalidOwner(t *testing.T) {
+	r := Rule{Name: "x", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound", User: `bad "user"`}
+	if err := Validate(r); err == nil {
+		t.Fatalf("expected error for invalid user")
+	}
+}
+
+func TestValidate_Addresses(t *testing.T) {
+	r := Rule{Name: "x", Application: "app", Action: "allow", Protocol: "any", Direction: "outbound",
+		RemoteAddresses: []string{"1.2.3.4", "10.0.0.0/8", "192.168.1.10-192.168.1.20", "2001:db8::/32"}}
+	if err := Validate(r); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	r.LocalAddresses = []string{"10.0.0.1-2001:db8::1"}
+	if err := Validate(r); err == nil {
+		t.Fatalf("expected error for mixed-family range")
+	}
+}
+
+func TestValidate_PortLists(t *testing.T) {
+	r := Rule{Name: "x", Application: "app", Action: "allow", Protocol: "tcp", Direction: "outbound",
+		RemotePorts: []string{"https", "6000-7000"}}
+	if err := Validate(r); err != nil {
+		t.Fatalf("expected port lists to satisfy tcp, got %v", err)
+	}
+
+	bad := r
+	bad.Ports = []int{80}
+	if err := Validate(bad); err == nil {
+		t.Fatalf("expected error for ports and remote ports on an outbound rule")
+	}
+
+	bad = r
+	bad.RemotePorts = []string{"nosuchservice"}
+	if err := Validate(bad); err == nil {
+		t.Fatalf("expected error for unknown service")
+	}
+
+	bad = r
+	bad.Protocol = "any"
+	if err := Validate(bad); err == nil {
+		t.Fatalf("expected error for port lists with protocol any")
+	}
+}
+
+func TestValidate_RejectsBadApplicationPattern(t *testing.T) {
+	r := Rule{Name: "x", Application: "re:(", Action: "allow", Protocol: "any", Direction: "outbound"}
+	if err := Validate(r); err == nil {
+		t.Fatalf("expected error for invalid regex")
+	}
+}
+
+func TestValidate_IdentityPins(t *testing.T) {
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	r := Rule{Name: "x", Application: "/usr/bin/curl", Action: "allow", Protocol: "any", Direction: "outbound", SHA256: sum, Package: "curl"}
+	if err := Validate(r); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	bad := r
+	bad.SHA256 = "abc"
+	if err := Validate(bad); err == nil {
+		t.Fatalf("expected error for short sha256")
+	}
+
+	bad = r
+	bad.Application = "/usr/bin/"
+	if err := Validate(bad); err == nil {
+		t.Fatalf("expected error for sha256 on a pattern")
+	}
+}
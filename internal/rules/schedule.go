@@ -0,0 +1,265 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule limits when a rule or profile is in effect. It is written as up to
+// three space-separated parts, each optional but in this order: weekdays
+// ("mon-fri", "sat,sun"), time windows ("09:00-12:00,13:00-17:00") and an IANA
+// time zone ("Europe/Madrid"). No weekdays means every day, no windows the
+// whole day and no zone local time. A window whose end is not after its start
+// runs past midnight and belongs to the day it starts on.
+type Schedule struct {
+	Days     []time.Weekday
+	Windows  []TimeWindow
+	Location string
+
+	loc *time.Location
+}
+
+// TimeWindow is a daily interval in minutes after midnight; End may be 1440.
+type TimeWindow struct {
+	Start int
+	End   int
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSchedule parses the textual form described on Schedule.
+func ParseSchedule(raw string) (*Schedule, error) {
+	s := &Schedule{}
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	for i, field := range fields {
+		switch {
+		case strings.Contains(field, ":") && s.Windows == nil && s.Location == "":
+			windows, err := parseWindows(field)
+			if err != nil {
+				return nil, err
+			}
+			s.Windows = windows
+		case i == 0:
+			days, err := parseWeekdays(field)
+			if err != nil {
+				return nil, err
+			}
+			s.Days = days
+		case s.Location == "" && i == len(fields)-1:
+			s.Location = field
+		default:
+			return nil, fmt.Errorf("invalid schedule %q", raw)
+		}
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func parseWeekdays(raw string) ([]time.Weekday, error) {
+	var seen [7]bool
+	for _, part := range strings.Split(strings.ToLower(raw), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdayIndex(from)
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayIndex(to); !ok {
+				return nil, fmt.Errorf("invalid weekday %q", to)
+			}
+		}
+		// Ranges wrap around the end of the week, so "fri-mon" works.
+		for d := first; ; d = (d + 1) % 7 {
+			seen[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	var out []time.Weekday
+	for d, on := range seen {
+		if on {
+			out = append(out, time.Weekday(d))
+		}
+	}
+	return out, nil
+}
+
+func weekdayIndex(name string) (int, bool) {
+	for i, n := range weekdayNames {
+		if name == n {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func parseWindows(raw string) ([]TimeWindow, error) {
+	var out []TimeWindow
+	for _, part := range strings.Split(raw, ",") {
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time window %q", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end || start == 24*60 {
+			return nil, fmt.Errorf("invalid time window %q", part)
+		}
+		out = append(out, TimeWindow{Start: start, End: end})
+	}
+	return out, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight; "24:00" is allowed.
+func parseClock(raw string) (int, error) {
+	h, m, ok := strings.Cut(raw, ":")
+	hour, err1 := strconv.Atoi(h)
+	minute, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hour < 0 || minute < 0 || minute > 59 ||
+		hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", raw)
+	}
+	return hour*60 + minute, nil
+}
+
+// load resolves the schedule's time zone.
+func (s *Schedule) load() error {
+	if s.Location == "" {
+		s.loc = time.Local
+		return nil
+	}
+	loc, err := time.LoadLocation(s.Location)
+	if err != nil {
+		return fmt.Errorf("invalid schedule time zone %q: %w", s.Location, err)
+	}
+	s.loc = loc
+	return nil
+}
+
+// validate checks a schedule built in code rather than parsed.
+func (s *Schedule) validate() error {
+	for _, d := range s.Days {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("invalid schedule weekday %d", d)
+		}
+	}
+	for _, w := range s.Windows {
+		if w.Start < 0 || w.Start >= 24*60 || w.End <= 0 || w.End > 24*60 || w.Start == w.End {
+			return fmt.Errorf("invalid schedule window %d-%d", w.Start, w.End)
+		}
+	}
+	return s.load()
+}
+
+// Contains reports whether t falls inside the schedule.
+func (s *Schedule) Contains(t time.Time) bool {
+	if s.loc == nil {
+		if err := s.load(); err != nil {
+			return false
+		}
+	}
+	t = t.In(s.loc)
+	day := t.Weekday()
+	minute := t.Hour()*60 + t.Minute()
+	if len(s.Windows) == 0 {
+		return s.onDay(day)
+	}
+	for _, w := range s.Windows {
+		if w.Start < w.End {
+			if s.onDay(day) && minute >= w.Start && minute < w.End {
+				return true
+			}
+			continue
+		}
+		if (s.onDay(day) && minute >= w.Start) || (s.onDay((day+6)%7) && minute < w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schedule) onDay(d time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, day := range s.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the schedule in the form accepted by ParseSchedule.
+func (s Schedule) String() string {
+	var parts []string
+	if len(s.Days) > 0 {
+		days := make([]string, len(s.Days))
+		for i, d := range s.Days {
+			days[i] = weekdayNames[d]
+		}
+		parts = append(parts, strings.Join(days, ","))
+	}
+	if len(s.Windows) > 0 {
+		windows := make([]string, len(s.Windows))
+		for i, w := range s.Windows {
+			windows[i] = fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+		}
+		parts = append(parts, strings.Join(windows, ","))
+	}
+	if s.Location != "" {
+		parts = append(parts, s.Location)
+	}
+	if len(parts) == 0 {
+		// Every day, all day.
+		return strings.Join(weekdayNames, ",")
+	}
+	return strings.Join(parts, " ")
+}
+
+// MarshalText stores schedules in their textual form, so exported rules and
+// profiles stay readable.
+func (s Schedule) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses the textual form written by MarshalText.
+func (s *Schedule) UnmarshalText(text []byte) error {
+	parsed, err := ParseSchedule(string(text))
+	if err != nil {
+		return err
+	}
+	*s = *parsed
+	return nil
+}
+
+// scheduleString is the store encoding of an optional schedule.
+func scheduleString(s *Schedule) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
+
+// ScheduleFromString is the inverse of the store encoding: empty means none.
+func ScheduleFromString(raw string) (*Schedule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	return ParseSchedule(raw)
+}
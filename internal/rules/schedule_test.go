@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "mon-fri 09:00-17:00", want: "mon,tue,wed,thu,fri 09:00-17:00"},
+		{raw: "fri-mon", want: "sun,mon,fri,sat"},
+		{raw: "22:00-06:00,12:00-13:00 UTC", want: "22:00-06:00,12:00-13:00 UTC"},
+		{raw: "sat,sun 00:00-24:00 Europe/Madrid", want: "sun,sat 00:00-24:00 Europe/Madrid"},
+		{raw: "", wantErr: true},
+		{raw: "someday", wantErr: true},
+		{raw: "mon 09:00-09:00", wantErr: true},
+		{raw: "mon 25:00-26:00", wantErr: true},
+		{raw: "mon 09:00-17:00 Not/AZone", wantErr: true},
+		{raw: "mon 09:00-17:00 UTC extra", wantErr: true},
+	}
+	for _, tc := range cases {
+		s, err := ParseSchedule(tc.raw)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseSchedule(%q) expected error, got %v", tc.raw, s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) unexpected error: %v", tc.raw, err)
+			continue
+		}
+		if got := s.String(); got != tc.want {
+			t.Errorf("ParseSchedule(%q).String() = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestScheduleContains(t *testing.T) {
+	work, _ := ParseSchedule("mon-fri 09:00-17:00 UTC")
+	night, _ := ParseSchedule("fri 22:00-06:00 UTC")
+	at := func(day, hour, minute int) time.Time {
+		// 2024-04-01 is a Monday.
+		return time.Date(2024, 4, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name string
+		s    *Schedule
+		t    time.Time
+		want bool
+	}{
+		{"work starts", work, at(1, 9, 0), true},
+		{"work ends", work, at(1, 17, 0), false},
+		{"saturday", work, at(6, 12, 0), false},
+		{"before midnight", night, at(5, 23, 0), true},
+		{"after midnight belongs to friday", night, at(6, 5, 59), true},
+		{"thursday night", night, at(4, 23, 0), false},
+		{"08:30 UTC in another zone", work, time.Date(2024, 4, 1, 10, 30, 0, 0, time.FixedZone("X", 2*3600)), false},
+	}
+	for _, tc := range cases {
+		if got := tc.s.Contains(tc.t); got != tc.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tc.name, tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestScheduleJSON(t *testing.T) {
+	s, _ := ParseSchedule("mon-fri 09:00-17:00 UTC")
+	r := Rule{Name: "games", Schedule: s}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var back Rule
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if back.Schedule == nil || back.Schedule.String() != s.String() {
+		t.Errorf("schedule did not round trip: %s", data)
+	}
+}
+
+func TestInEffect(t *testing.T) {
+	s, _ := ParseSchedule("09:00-17:00 UTC")
+	r := Rule{Name: "office", Schedule: s}
+
+	if !r.InEffect(time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Error("rule should be in effect inside its schedule")
+	}
+	if got := Active([]Rule{r}, time.Date(2024, 4, 1, 18, 0, 0, 0, time.UTC)); len(got) != 0 {
+		t.Errorf("rule outside its schedule should be dropped, got %+v", got)
+	}
+}
@@ -1,10 +1,14 @@
 package rules
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 // Store defines minimal persistence operations for firewall rules.
@@ -14,37 +18,106 @@ type Store interface {
 	DeleteRule(name string) error
 }
 
-// SQLiteStore is a sqlite-backed implementation of Store.
+// ContextStore adds context-aware variants of the Store operations and bulk
+// writes that either apply completely or not at all.
+type ContextStore interface {
+	Store
+	ListRulesContext(ctx context.Context) ([]Rule, error)
+	SaveRuleContext(ctx context.Context, rule Rule) error
+	DeleteRuleContext(ctx context.Context, name string) error
+	SaveRules(ctx context.Context, list []Rule) error
+	DeleteRules(ctx context.Context, names []string) error
+}
+
+// SaveAll saves list with SaveRules when the store supports it, so the batch
+// applies completely or not at all; other stores save one rule at a time.
+func SaveAll(ctx context.Context, store Store, list []Rule) error {
+	if cs, ok := store.(ContextStore); ok {
+		return cs.SaveRules(ctx, list)
+	}
+	for _, r := range list {
+		if err := store.SaveRule(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAll is the deleting counterpart of SaveAll.
+func DeleteAll(ctx context.Context, store Store, names []string) error {
+	if cs, ok := store.(ContextStore); ok {
+		return cs.DeleteRules(ctx, names)
+	}
+	for _, name := range names {
+		if err := store.DeleteRule(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SQLiteStore is a sqlite-backed implementation of ContextStore. Ports live in
+// the rule_ports child table, which follows renames and deletions of their rule.
 type SQLiteStore struct {
-	db *sql.DB
+	conn   storage.Conn
+	source string // recorded in rule_history when the context names none
 }
 
-// NewSQLiteStore wires a sqlite-backed rule store; caller owns DB lifecycle.
+// NewSQLiteStore wires a sqlite-backed rule store; caller owns DB lifecycle
+// and must open it with storage.Open.
 func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
 	if err := initSchema(db); err != nil {
 		return nil, err
 	}
-	return &SQLiteStore{db: db}, nil
+	s := &SQLiteStore{conn: storage.Conn{DB: db}}
+	if err := s.resolveServicePorts(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
+// initSchema brings the shared database schema up to date.
 func initSchema(db *sql.DB) error {
-	schema := `
-CREATE TABLE IF NOT EXISTS rules (
-	name TEXT PRIMARY KEY,
-	application TEXT NOT NULL,
-	action TEXT NOT NULL,
-	protocol TEXT NOT NULL,
-	direction TEXT NOT NULL,
-	ports TEXT NOT NULL
-);
-`
-	_, err := db.Exec(schema)
+	_, err := storage.Migrate(db)
 	return err
 }
 
-// ListRules lists rules from sqlite.
+// WithTx returns a view of the store whose reads and writes run in tx, which
+// the caller commits or rolls back.
+func (s *SQLiteStore) WithTx(tx *sql.Tx) *SQLiteStore {
+	return &SQLiteStore{conn: storage.Conn{DB: s.conn.DB, Tx: tx}, source: s.source}
+}
+
+const ruleColumns = `name, application, action, protocol, direction, owner_user, owner_group, remote_addresses, local_addresses, priority, sha256, package, expires_at, session, schedule`
+
+// Port list sides in rule_ports.
+const (
+	sideService = "service" // Rule.Ports
+	sideLocal   = "local"
+	sideRemote  = "remote"
+)
+
+// ListRules lists rules from sqlite in evaluation order.
 func (s *SQLiteStore) ListRules() ([]Rule, error) {
-	rows, err := s.db.Query(`SELECT name, application, action, protocol, direction, ports FROM rules ORDER BY name`)
+	return s.ListRulesContext(context.Background())
+}
+
+// ListRulesContext is ListRules with a context.
+func (s *SQLiteStore) ListRulesContext(ctx context.Context) ([]Rule, error) {
+	return queryRules(ctx, s.conn.Q(), `SELECT `+ruleColumns+` FROM rules ORDER BY priority, name`)
+}
+
+// FindRulesByPort lists, in evaluation order, the rules naming port on either
+// end, directly, through a range or through a service name. Rules without any
+// port restriction are not included.
+func (s *SQLiteStore) FindRulesByPort(ctx context.Context, port int) ([]Rule, error) {
+	return queryRules(ctx, s.conn.Q(), `SELECT `+ruleColumns+` FROM rules
+WHERE name IN (SELECT rule_name FROM rule_ports WHERE port_from <= ? AND port_to >= ?)
+ORDER BY priority, name`, port, port)
+}
+
+func queryRules(ctx context.Context, q storage.DBTX, query string, args ...any) ([]Rule, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -53,67 +126,318 @@ func (s *SQLiteStore) ListRules() ([]Rule, error) {
 	var out []Rule
 	for rows.Next() {
 		var r Rule
-		var ports string
-		if err := rows.Scan(&r.Name, &r.Application, &r.Action, &r.Protocol, &r.Direction, &ports); err != nil {
+		var remote, local, schedule string
+		var expiresAt int64
+		if err := rows.Scan(&r.Name, &r.Application, &r.Action, &r.Protocol, &r.Direction, &r.User, &r.Group, &remote, &local, &r.Priority, &r.SHA256, &r.Package, &expiresAt, &r.Session, &schedule); err != nil {
 			return nil, err
 		}
-		parsed, err := parsePorts(ports)
-		if err != nil {
-			return nil, fmt.Errorf("invalid stored ports for %s: %w", r.Name, err)
+		if expiresAt != 0 {
+			r.ExpiresAt = time.Unix(expiresAt, 0).UTC()
 		}
-		r.Ports = parsed
+		if r.Schedule, err = ScheduleFromString(schedule); err != nil {
+			return nil, fmt.Errorf("invalid stored schedule for %s: %w", r.Name, err)
+		}
+		r.RemoteAddresses = splitList(remote)
+		r.LocalAddresses = splitList(local)
 		out = append(out, r)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
+
+	if err := loadPorts(ctx, q, out); err != nil {
+		return nil, err
+	}
+	Sort(out)
 	return out, nil
 }
 
+// portsBatch is how many rule names loadPorts binds per query, well below
+// SQLite's limit on host parameters.
+const portsBatch = 500
+
+// loadPorts fills in the port lists of rules from rule_ports, reading only the
+// rows of the given rules.
+func loadPorts(ctx context.Context, q storage.DBTX, list []Rule) error {
+	byName := make(map[string]*Rule, len(list))
+	names := make([]any, len(list))
+	for i := range list {
+		byName[list[i].Name] = &list[i]
+		names[i] = list[i].Name
+	}
+
+	for len(names) > 0 {
+		batch := names[:min(len(names), portsBatch)]
+		names = names[len(batch):]
+		if err := loadPortsBatch(ctx, q, byName, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadPortsBatch(ctx context.Context, q storage.DBTX, byName map[string]*Rule, names []any) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	rows, err := q.QueryContext(ctx, `SELECT rule_name, side, spec FROM rule_ports WHERE rule_name IN (`+placeholders+`)
+ORDER BY rule_name, side, position`, names...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, side, spec string
+		if err := rows.Scan(&name, &side, &spec); err != nil {
+			return err
+		}
+		r := byName[name]
+		if r == nil {
+			continue
+		}
+		switch side {
+		case sideService:
+			port, err := strconv.Atoi(spec)
+			if err != nil {
+				return fmt.Errorf("invalid stored ports for %s: %w", name, err)
+			}
+			r.Ports = append(r.Ports, port)
+		case sideLocal:
+			r.LocalPorts = append(r.LocalPorts, spec)
+		case sideRemote:
+			r.RemotePorts = append(r.RemotePorts, spec)
+		}
+	}
+	return rows.Err()
+}
+
 // SaveRule validates and persists a rule (upsert).
 func (s *SQLiteStore) SaveRule(rule Rule) error {
-	if err := Validate(rule); err != nil {
+	return s.SaveRuleContext(context.Background(), rule)
+}
+
+// SaveRuleContext is SaveRule with a context.
+func (s *SQLiteStore) SaveRuleContext(ctx context.Context, rule Rule) error {
+	return s.SaveRules(ctx, []Rule{rule})
+}
+
+// SaveRules validates and persists several rules in one transaction: if any
+// of them is invalid or fails to save, none is saved.
+func (s *SQLiteStore) SaveRules(ctx context.Context, list []Rule) error {
+	for _, r := range list {
+		if err := Validate(r); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+	}
+	audit := s.audit(ctx)
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		for _, r := range list {
+			if err := saveRule(ctx, q, audit, r); err != nil {
+				return fmt.Errorf("save rule %q: %w", r.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// saveRule writes a validated rule and its ports and records the change. The
+// row is updated in place rather than replaced so profile memberships survive.
+func saveRule(ctx context.Context, q storage.DBTX, audit Audit, rule Rule) error {
+	old, err := getRule(ctx, q, rule.Name)
+	if err != nil {
 		return err
 	}
-	ports := joinPorts(rule.Ports)
-	_, err := s.db.Exec(`INSERT OR REPLACE INTO rules (name, application, action, protocol, direction, ports) VALUES (?,?,?,?,?,?)`,
-		rule.Name, rule.Application, rule.Action, rule.Protocol, rule.Direction, ports)
-	return err
+	_, err = q.ExecContext(ctx, `INSERT INTO rules (`+ruleColumns+`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+ON CONFLICT(name) DO UPDATE SET application = excluded.application, action = excluded.action,
+	protocol = excluded.protocol, direction = excluded.direction, owner_user = excluded.owner_user,
+	owner_group = excluded.owner_group, remote_addresses = excluded.remote_addresses,
+	local_addresses = excluded.local_addresses, priority = excluded.priority, sha256 = excluded.sha256,
+	package = excluded.package, expires_at = excluded.expires_at, session = excluded.session,
+	schedule = excluded.schedule`,
+		rule.Name, rule.Application, rule.Action, rule.Protocol, rule.Direction, rule.User, rule.Group,
+		strings.Join(rule.RemoteAddresses, ","), strings.Join(rule.LocalAddresses, ","), rule.Priority,
+		rule.SHA256, rule.Package, unixOrZero(rule.ExpiresAt), rule.Session, scheduleString(rule.Schedule))
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.ExecContext(ctx, `DELETE FROM rule_ports WHERE rule_name = ?`, rule.Name); err != nil {
+		return err
+	}
+	insert := func(side string, position int, spec string, rng PortRange) error {
+		_, err := q.ExecContext(ctx, `INSERT INTO rule_ports (rule_name, side, position, spec, port_from, port_to) VALUES (?,?,?,?,?,?)`,
+			rule.Name, side, position, spec, rng.From, rng.To)
+		return err
+	}
+	for i, p := range rule.Ports {
+		if err := insert(sideService, i, strconv.Itoa(p), PortRange{From: p, To: p}); err != nil {
+			return err
+		}
+	}
+	for side, list := range map[string][]string{sideLocal: rule.LocalPorts, sideRemote: rule.RemotePorts} {
+		for i, spec := range list {
+			rng, err := ParsePort(spec)
+			if err != nil {
+				return err
+			}
+			if err := insert(side, i, spec, rng); err != nil {
+				return err
+			}
+		}
+	}
+	op := OpUpdate
+	if old == nil {
+		op = OpCreate
+	} else if Equal(*old, rule) {
+		// Saving an unchanged rule is not worth a history entry.
+		return nil
+	}
+	return recordChange(ctx, q, audit, op, rule.Name, old, &rule)
 }
 
-// DeleteRule removes a rule by name.
-func (s *SQLiteStore) DeleteRule(name string) error {
-	_, err := s.db.Exec(`DELETE FROM rules WHERE name = ?`, name)
-	return err
+// getRule loads one rule, returning nil when it does not exist.
+func getRule(ctx context.Context, q storage.DBTX, name string) (*Rule, error) {
+	list, err := queryRules(ctx, q, `SELECT `+ruleColumns+` FROM rules WHERE name = ?`, name)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return &list[0], nil
 }
 
-func joinPorts(ports []int) string {
-	if len(ports) == 0 {
-		return ""
+// deleteRule removes a rule and records the change; it reports whether the
+// rule existed.
+func deleteRule(ctx context.Context, q storage.DBTX, audit Audit, name string) (bool, error) {
+	old, err := getRule(ctx, q, name)
+	if err != nil || old == nil {
+		return false, err
 	}
-	parts := make([]string, 0, len(ports))
-	for _, p := range ports {
-		parts = append(parts, strconv.Itoa(p))
+	if _, err := q.ExecContext(ctx, `DELETE FROM rules WHERE name = ?`, name); err != nil {
+		return false, err
 	}
-	return strings.Join(parts, ",")
+	return true, recordChange(ctx, q, audit, OpDelete, name, old, nil)
 }
 
-func parsePorts(raw string) ([]int, error) {
-	if strings.TrimSpace(raw) == "" {
-		return nil, nil
+// renameRule renames a rule and records the change.
+func renameRule(ctx context.Context, q storage.DBTX, audit Audit, oldName, newName string) error {
+	old, err := getRule(ctx, q, oldName)
+	if err != nil {
+		return err
 	}
-	chunks := strings.Split(raw, ",")
-	out := make([]int, 0, len(chunks))
-	for _, c := range chunks {
-		c = strings.TrimSpace(c)
-		if c == "" {
-			continue
+	if old == nil {
+		return fmt.Errorf("rule %q not found", oldName)
+	}
+	if _, err := q.ExecContext(ctx, `UPDATE rules SET name = ? WHERE name = ?`, newName, oldName); err != nil {
+		return fmt.Errorf("rename %q to %q: %w", oldName, newName, err)
+	}
+	renamed := *old
+	renamed.Name = newName
+	return recordChange(ctx, q, audit, OpRename, newName, old, &renamed)
+}
+
+// DeleteRule removes a rule by name; its ports and profile memberships go with
+// it. Deleting a rule that does not exist is not an error.
+func (s *SQLiteStore) DeleteRule(name string) error {
+	return s.DeleteRuleContext(context.Background(), name)
+}
+
+// DeleteRuleContext is DeleteRule with a context.
+func (s *SQLiteStore) DeleteRuleContext(ctx context.Context, name string) error {
+	audit := s.audit(ctx)
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		_, err := deleteRule(ctx, q, audit, name)
+		return err
+	})
+}
+
+// DeleteRules removes several rules in one transaction. Unlike DeleteRule it
+// fails, deleting nothing, when any of them does not exist.
+func (s *SQLiteStore) DeleteRules(ctx context.Context, names []string) error {
+	audit := s.audit(ctx)
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		for _, name := range names {
+			found, err := deleteRule(ctx, q, audit, name)
+			if err != nil {
+				return fmt.Errorf("delete rule %q: %w", name, err)
+			}
+			if !found {
+				return fmt.Errorf("rule %q not found", name)
+			}
 		}
-		v, err := strconv.Atoi(c)
+		return nil
+	})
+}
+
+// RenameRule renames a rule; its ports and profile memberships follow.
+func (s *SQLiteStore) RenameRule(ctx context.Context, oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("name is required")
+	}
+	audit := s.audit(ctx)
+	return s.conn.Write(ctx, func(q storage.DBTX) error {
+		return renameRule(ctx, q, audit, oldName, newName)
+	})
+}
+
+// Changes returns a counter that moves whenever the database's rules or
+// profiles change; see storage.Changes.
+func (s *SQLiteStore) Changes() (int64, error) {
+	return storage.Changes(context.Background(), s.conn.Q())
+}
+
+// resolveServicePorts fills in the numeric range of service names that the
+// normalizing migration could not resolve in SQL.
+func (s *SQLiteStore) resolveServicePorts(ctx context.Context) error {
+	type pending struct {
+		name, side string
+		position   int
+		spec       string
+	}
+	q := s.conn.Q()
+	rows, err := q.QueryContext(ctx, `SELECT rule_name, side, position, spec FROM rule_ports WHERE port_from IS NULL`)
+	if err != nil {
+		return err
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.name, &p.side, &p.position, &p.spec); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range list {
+		rng, err := ParsePort(p.spec)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("invalid stored port %q for %s: %w", p.spec, p.name, err)
+		}
+		if _, err := q.ExecContext(ctx, `UPDATE rule_ports SET port_from = ?, port_to = ? WHERE rule_name = ? AND side = ? AND position = ?`,
+			rng.From, rng.To, p.name, p.side, p.position); err != nil {
+			return err
 		}
-		out = append(out, v)
 	}
-	return out, nil
+	return nil
+}
+
+// unixOrZero stores a time as Unix seconds, keeping the zero time as 0.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// splitList parses a comma-separated column into its entries.
+func splitList(raw string) []string {
+	var out []string
+	for _, c := range strings.Split(raw, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
 }
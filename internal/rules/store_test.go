@@ -1,14 +1,15 @@
 package rules
 
 import (
-	"database/sql"
+	"context"
+	"fmt"
 	"testing"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 func TestSQLiteStore_CRUD(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
+	db, err := storage.Open(":memory:")
 	if err != nil {
 		t.Fatalf("open: %v", err)
 	}
@@ -26,6 +27,10 @@ func TestSQLiteStore_CRUD(t *testing.T) {
 		Protocol:    "tcp",
 		Direction:   "outbound",
 		Ports:       []int{80, 443},
+		User:        "app",
+
+		RemoteAddresses: []string{"10.0.0.0/8", "2001:db8::1"},
+		LocalPorts:      []string{"1024-65535"},
 	}
 
 	if err := store.SaveRule(rule); err != nil {
@@ -39,7 +44,13 @@ func TestSQLiteStore_CRUD(t *testing.T) {
 	if len(got) != 1 {
 		t.Fatalf("expected 1 rule, got %d", len(got))
 	}
-	if got[0].Name != rule.Name || len(got[0].Ports) != len(rule.Ports) {
+	if got[0].Name != rule.Name || len(got[0].Ports) != len(rule.Ports) || got[0].User != rule.User {
+		t.Fatalf("unexpected rule: %+v", got[0])
+	}
+	if len(got[0].RemoteAddresses) != 2 || got[0].RemoteAddresses[1] != "2001:db8::1" || got[0].LocalAddresses != nil {
+		t.Fatalf("unexpected addresses: %+v", got[0])
+	}
+	if len(got[0].LocalPorts) != 1 || got[0].LocalPorts[0] != "1024-65535" || got[0].RemotePorts != nil {
 		t.Fatalf("unexpected rule: %+v", got[0])
 	}
 
@@ -55,14 +66,120 @@ func TestSQLiteStore_CRUD(t *testing.T) {
 	}
 }
 
-func TestPortHelpers(t *testing.T) {
-	ports := []int{80, 443}
-	joined := joinPorts(ports)
-	parsed, err := parsePorts(joined)
+func TestSQLiteStore_LoadsPortsInBatches(t *testing.T) {
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+
+	list := make([]Rule, portsBatch+10)
+	for i := range list {
+		list[i] = Rule{Name: fmt.Sprintf("r%04d", i), Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{1000 + i}}
+	}
+	if err := store.SaveRules(context.Background(), list); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, err := store.ListRules()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	for _, r := range got {
+		var i int
+		fmt.Sscanf(r.Name, "r%04d", &i)
+		if len(r.Ports) != 1 || r.Ports[0] != 1000+i {
+			t.Fatalf("rule %s has ports %v", r.Name, r.Ports)
+		}
+	}
+}
+
+func TestSQLiteStore_FindRulesByPort(t *testing.T) {
+	db, err := storage.Open(":memory:")
 	if err != nil {
-		t.Fatalf("parsePorts: %v", err)
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+
+	for _, r := range []Rule{
+		{Name: "ssh", Application: "any", Action: "allow", Protocol: "tcp", Direction: "inbound", Ports: []int{22}},
+		{Name: "high", Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", RemotePorts: []string{"20-25"}},
+		{Name: "by-name", Application: "any", Action: "deny", Protocol: "tcp", Direction: "outbound", RemotePorts: []string{"ssh"}},
+		{Name: "web", Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}},
+		{Name: "all", Application: "any", Action: "allow", Protocol: "any", Direction: "outbound"},
+	} {
+		if err := store.SaveRule(r); err != nil {
+			t.Fatalf("save %s: %v", r.Name, err)
+		}
+	}
+
+	got, err := store.FindRulesByPort(context.Background(), 22)
+	if err != nil {
+		t.Fatalf("FindRulesByPort: %v", err)
+	}
+	var names []string
+	for _, r := range got {
+		names = append(names, r.Name)
+	}
+	if len(names) != 3 || names[0] != "by-name" || names[1] != "high" || names[2] != "ssh" {
+		t.Fatalf("FindRulesByPort(22) = %v", names)
+	}
+	if len(got[2].Ports) != 1 || got[2].Ports[0] != 22 {
+		t.Errorf("ports not loaded: %+v", got[2])
+	}
+
+	if err := store.RenameRule(context.Background(), "missing", "x"); err == nil {
+		t.Error("expected an error renaming a missing rule")
+	}
+	if err := store.RenameRule(context.Background(), "ssh", "web"); err == nil {
+		t.Error("expected an error renaming onto an existing rule")
+	}
+}
+
+func TestSQLiteStore_BulkWritesAreAtomic(t *testing.T) {
+	db, err := storage.Open(":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	ctx := context.Background()
+	rule := func(name string) Rule {
+		return Rule{Name: name, Application: "any", Action: "allow", Protocol: "tcp", Direction: "outbound", Ports: []int{443}}
+	}
+
+	bad := rule("bad")
+	bad.Action = "maybe"
+	if err := store.SaveRules(ctx, []Rule{rule("a"), bad}); err == nil {
+		t.Fatal("expected SaveRules to reject an invalid rule")
+	}
+	if got, _ := store.ListRules(); len(got) != 0 {
+		t.Fatalf("failed SaveRules must save nothing, got %d rules", len(got))
+	}
+
+	if err := store.SaveRules(ctx, []Rule{rule("a"), rule("b")}); err != nil {
+		t.Fatalf("SaveRules: %v", err)
+	}
+	if err := store.DeleteRules(ctx, []string{"a", "missing"}); err == nil {
+		t.Fatal("expected DeleteRules to fail on a missing rule")
+	}
+	if got, _ := store.ListRules(); len(got) != 2 {
+		t.Fatalf("failed DeleteRules must delete nothing, got %d rules", len(got))
+	}
+	if err := store.DeleteRules(ctx, []string{"a", "b"}); err != nil {
+		t.Fatalf("DeleteRules: %v", err)
 	}
-	if len(parsed) != len(ports) || parsed[0] != 80 || parsed[1] != 443 {
-		t.Fatalf("unexpected parsed ports: %v", parsed)
+	if got, _ := store.ListRules(); len(got) != 0 {
+		t.Fatalf("expected no rules, got %d", len(got))
 	}
 }
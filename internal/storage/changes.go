@@ -0,0 +1,12 @@
+package storage
+
+import "context"
+
+// Changes returns the change counter of the rule and profile tables. Every
+// committed change moves it, from any connection or process, so a reader can
+// keep what it loaded for as long as the counter stays put.
+func Changes(ctx context.Context, q DBTX) (int64, error) {
+	var n int64
+	err := q.QueryRowContext(ctx, `SELECT value FROM change_counter WHERE id = 1`).Scan(&n)
+	return n, err
+}
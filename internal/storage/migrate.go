@@ -0,0 +1,235 @@
+// Package storage owns the sqlite schema shared by the rule and profile
+// stores. The schema is built by ordered up-migrations embedded in the binary;
+// the versions applied so far are recorded in the schema_version table.
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vhPedroGitHub/firewall/internal/logging"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one schema change, loaded from migrations/NNNN_name.sql.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Applied is a migration recorded in schema_version.
+type Applied struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// Result describes what Migrate did.
+type Result struct {
+	From    int
+	To      int
+	Applied []Migration
+	Backup  string // path of the copy taken before migrating, if any
+}
+
+// Migrations returns every embedded migration in version order.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i := range out {
+		if out[i].Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be consecutive: found %d at position %d", out[i].Version, i+1)
+		}
+	}
+	return out, nil
+}
+
+// Status returns the migrations already applied to db and those still pending.
+func Status(db *sql.DB) (applied []Applied, pending []Migration, err error) {
+	all, err := Migrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ensureVersionTable(db); err != nil {
+		return nil, nil, err
+	}
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_version ORDER BY version`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	done := make(map[int]bool)
+	for rows.Next() {
+		var a Applied
+		var at int64
+		if err := rows.Scan(&a.Version, &a.Name, &at); err != nil {
+			return nil, nil, err
+		}
+		a.AppliedAt = time.Unix(at, 0).UTC()
+		applied = append(applied, a)
+		done[a.Version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if n := len(applied); n > 0 && applied[n-1].Version > len(all) {
+		return applied, nil, fmt.Errorf("database schema version %d is newer than this build supports (%d)", applied[n-1].Version, len(all))
+	}
+	for _, m := range all {
+		if !done[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return applied, pending, nil
+}
+
+// Migrate applies every pending migration, each in its own transaction. The
+// database must have been opened with Open. A file-backed database that
+// already holds data is first copied next to itself so a failed upgrade can be
+// rolled back by hand.
+func Migrate(db *sql.DB) (Result, error) {
+	if err := requireForeignKeys(db); err != nil {
+		return Result{}, err
+	}
+	applied, pending, err := Status(db)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{}
+	if n := len(applied); n > 0 {
+		res.From = applied[n-1].Version
+	}
+	res.To = res.From
+	if len(pending) == 0 {
+		return res, nil
+	}
+
+	populated, err := hasTables(db, "rules", "profiles")
+	if err != nil {
+		return res, err
+	}
+	if populated {
+		if res.Backup, err = Backup(db, res.From); err != nil {
+			return res, fmt.Errorf("backup before migrating: %w", err)
+		}
+	}
+
+	for _, m := range pending {
+		if err := apply(db, m); err != nil {
+			logging.LogEvent("error", "db-migrate", fmt.Sprintf("Migration %04d_%s failed: %v", m.Version, m.Name, err), map[string]interface{}{
+				"version": m.Version,
+				"backup":  res.Backup,
+			})
+			return res, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		res.Applied = append(res.Applied, m)
+		res.To = m.Version
+	}
+	logging.LogEvent("info", "db-migrate", fmt.Sprintf("Database schema migrated from version %d to %d", res.From, res.To), map[string]interface{}{
+		"from":   res.From,
+		"to":     res.To,
+		"backup": res.Backup,
+	})
+	return res, nil
+}
+
+func apply(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?,?,?)`,
+		m.Version, m.Name, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Backup copies a file-backed database to "<file>.v<version>-<timestamp>.bak"
+// and returns the copy's path; in-memory databases are not copied.
+func Backup(db *sql.DB, version int) (string, error) {
+	file, err := databaseFile(db)
+	if err != nil || file == "" {
+		return "", err
+	}
+	dest := fmt.Sprintf("%s.v%d-%s.bak", file, version, time.Now().UTC().Format("20060102T150405"))
+	if _, err := db.Exec(`VACUUM INTO ?`, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// databaseFile returns the path of db's main database file, empty when it
+// lives in memory.
+func databaseFile(db *sql.DB) (string, error) {
+	rows, err := db.Query(`PRAGMA database_list`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return "", err
+		}
+		if name == "main" {
+			return file, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+func ensureVersionTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+)`)
+	return err
+}
+
+// hasTables reports whether any of the named tables exist.
+func hasTables(db *sql.DB, names ...string) (bool, error) {
+	for _, name := range names {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n); err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	all, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(all) == 0 || all[0].Version != 1 || all[0].Name != "initial" {
+		t.Fatalf("unexpected migrations: %+v", all)
+	}
+}
+
+func TestMigrate_FreshDatabase(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "fresh.db"))
+
+	res, err := Migrate(db)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	all, _ := Migrations()
+	if res.From != 0 || res.To != len(all) || len(res.Applied) != len(all) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if res.Backup != "" {
+		t.Errorf("an empty database should not be backed up, got %s", res.Backup)
+	}
+
+	res, err = Migrate(db)
+	if err != nil || len(res.Applied) != 0 || res.To != len(all) {
+		t.Errorf("second Migrate should be a no-op: %+v, %v", res, err)
+	}
+}
+
+func TestMigrate_AdoptsLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db := openTestDB(t, path)
+
+	// The schema of the first release, before any column was added.
+	if _, err := db.Exec(`
+CREATE TABLE rules (name TEXT PRIMARY KEY, application TEXT NOT NULL, action TEXT NOT NULL, protocol TEXT NOT NULL, direction TEXT NOT NULL, ports TEXT NOT NULL);
+CREATE TABLE profiles (name TEXT PRIMARY KEY, description TEXT NOT NULL, active INTEGER NOT NULL DEFAULT 0, rules TEXT NOT NULL);
+INSERT INTO rules VALUES ('web', '/usr/bin/curl', 'allow', 'tcp', 'outbound', '80,443');
+INSERT INTO profiles VALUES ('work', 'Work', 1, '["web","gone"]');
+`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	res, err := Migrate(db)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if res.Backup == "" {
+		t.Fatal("expected a backup of the legacy database")
+	}
+	if _, err := os.Stat(res.Backup); err != nil {
+		t.Errorf("backup missing: %v", err)
+	}
+
+	var priority int
+	var schedule string
+	if err := db.QueryRow(`SELECT priority, schedule FROM rules WHERE name = 'web'`).Scan(&priority, &schedule); err != nil {
+		t.Fatalf("new columns not added: %v", err)
+	}
+	if err := db.QueryRow(`SELECT schedule FROM profiles`).Err(); err != nil {
+		t.Fatalf("profile column not added: %v", err)
+	}
+
+	// Comma lists become rule_ports rows; service names wait for the rule store.
+	rows, err := db.Query(`SELECT side, spec, port_from, port_to FROM rule_ports WHERE rule_name = 'web' ORDER BY side, position`)
+	if err != nil {
+		t.Fatalf("query ports: %v", err)
+	}
+	var got []string
+	for rows.Next() {
+		var side, spec string
+		var from, to sql.NullInt64
+		if err := rows.Scan(&side, &spec, &from, &to); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s:%s:%v-%v", side, spec, from.Int64, to.Int64))
+	}
+	rows.Close()
+	want := []string{"service:80:80-80", "service:443:443-443"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("rule_ports = %v, want %v", got, want)
+	}
+
+	// Memberships of rules that no longer exist are dropped.
+	var members []string
+	rows, err = db.Query(`SELECT rule_name FROM profile_rules WHERE profile_name = 'work'`)
+	if err != nil {
+		t.Fatalf("query members: %v", err)
+	}
+	for rows.Next() {
+		var name string
+		_ = rows.Scan(&name)
+		members = append(members, name)
+	}
+	rows.Close()
+	if len(members) != 1 || members[0] != "web" {
+		t.Errorf("profile_rules = %v, want [web]", members)
+	}
+
+	backup := openTestDB(t, res.Backup)
+	var n int
+	if err := backup.QueryRow(`SELECT COUNT(*) FROM rules`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("backup should hold the original rows: %d, %v", n, err)
+	}
+}
+
+func TestStatus_RejectsNewerSchema(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "newer.db"))
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (999, 'future', 0)`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, _, err := Status(db); err == nil {
+		t.Error("expected an error for a schema newer than the binary")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.db")
+	db := openTestDB(t, path)
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	before, err := Changes(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Changes: %v", err)
+	}
+
+	// A write through another handle, as from another process, moves it too.
+	other := openTestDB(t, path)
+	if _, err := other.Exec(`INSERT INTO profiles (name, description) VALUES ('work', '')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	after, err := Changes(context.Background(), db)
+	if err != nil || after == before {
+		t.Errorf("counter did not move: %d -> %d, %v", before, after, err)
+	}
+}
@@ -0,0 +1,17 @@
+-- Baseline schema, as created by releases before schema versioning. Their
+-- databases already have these tables and pick up from the next migration.
+CREATE TABLE IF NOT EXISTS rules (
+	name TEXT PRIMARY KEY,
+	application TEXT NOT NULL,
+	action TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	direction TEXT NOT NULL,
+	ports TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS profiles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL,
+	active INTEGER NOT NULL DEFAULT 0,
+	rules TEXT NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Socket owner a rule is restricted to (user name or uid); empty matches any.
+
+ALTER TABLE rules ADD COLUMN owner_user TEXT NOT NULL DEFAULT '';
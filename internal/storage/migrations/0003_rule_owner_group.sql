@@ -0,0 +1,3 @@
+-- Socket group a rule is restricted to (group name or gid); empty matches any.
+
+ALTER TABLE rules ADD COLUMN owner_group TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Remote IPs, CIDRs and ranges, comma-separated; empty matches any address.
+
+ALTER TABLE rules ADD COLUMN remote_addresses TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Local IPs, CIDRs and ranges, comma-separated; empty matches any address.
+
+ALTER TABLE rules ADD COLUMN local_addresses TEXT NOT NULL DEFAULT '';
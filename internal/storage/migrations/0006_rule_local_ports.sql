@@ -0,0 +1,3 @@
+-- Local ports, ranges and service names, comma-separated; empty matches any.
+
+ALTER TABLE rules ADD COLUMN local_ports TEXT NOT NULL DEFAULT '';
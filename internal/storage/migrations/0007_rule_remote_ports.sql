@@ -0,0 +1,3 @@
+-- Remote ports, ranges and service names, comma-separated; empty matches any.
+
+ALTER TABLE rules ADD COLUMN remote_ports TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Evaluation order, lowest first.
+
+ALTER TABLE rules ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Hex SHA-256 the executable must have; empty matches any binary at the path.
+
+ALTER TABLE rules ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Package that must own the executable; empty skips the check.
+
+ALTER TABLE rules ADD COLUMN package TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Unix time a temporary rule expires at; 0 means it never expires.
+
+ALTER TABLE rules ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
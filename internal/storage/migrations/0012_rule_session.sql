@@ -0,0 +1,3 @@
+-- Non-zero for rules removed when the firewall session ends.
+
+ALTER TABLE rules ADD COLUMN session INTEGER NOT NULL DEFAULT 0;
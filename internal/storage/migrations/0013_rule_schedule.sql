@@ -0,0 +1,3 @@
+-- Schedule outside which the rule is ignored; empty means always.
+
+ALTER TABLE rules ADD COLUMN schedule TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Schedule during which the scheduler activates the profile; empty means none.
+
+ALTER TABLE profiles ADD COLUMN schedule TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,61 @@
+-- Move rule ports and profile membership out of the comma- and JSON-encoded
+-- columns into child tables, so references follow renames and deletions.
+
+CREATE TABLE rule_ports (
+	rule_name TEXT NOT NULL REFERENCES rules(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	side TEXT NOT NULL CHECK (side IN ('service', 'local', 'remote')),
+	position INTEGER NOT NULL,
+	spec TEXT NOT NULL,
+	port_from INTEGER,
+	port_to INTEGER,
+	PRIMARY KEY (rule_name, side, position)
+);
+CREATE INDEX rule_ports_range ON rule_ports (port_from, port_to);
+
+CREATE TABLE profile_rules (
+	profile_name TEXT NOT NULL REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	rule_name TEXT NOT NULL REFERENCES rules(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (profile_name, rule_name)
+);
+CREATE INDEX profile_rules_rule ON profile_rules (rule_name);
+
+-- Split the comma lists. Numbers and ranges are resolved here; service names
+-- keep a NULL range until the rule store resolves them on open.
+WITH RECURSIVE
+src(rule_name, side, list) AS (
+	SELECT name, 'service', ports FROM rules WHERE ports != ''
+	UNION ALL SELECT name, 'local', local_ports FROM rules WHERE local_ports != ''
+	UNION ALL SELECT name, 'remote', remote_ports FROM rules WHERE remote_ports != ''
+),
+split(rule_name, side, position, spec, rest) AS (
+	SELECT rule_name, side, -1, '', list || ',' FROM src
+	UNION ALL
+	SELECT rule_name, side, position + 1,
+		trim(substr(rest, 1, instr(rest, ',') - 1)),
+		substr(rest, instr(rest, ',') + 1)
+	FROM split WHERE rest != ''
+)
+INSERT INTO rule_ports (rule_name, side, position, spec, port_from, port_to)
+SELECT rule_name, side, position, spec,
+	CASE
+		WHEN spec NOT GLOB '*[^0-9]*' THEN CAST(spec AS INTEGER)
+		WHEN spec GLOB '[0-9]*-[0-9]*' THEN CAST(substr(spec, 1, instr(spec, '-') - 1) AS INTEGER)
+	END,
+	CASE
+		WHEN spec NOT GLOB '*[^0-9]*' THEN CAST(spec AS INTEGER)
+		WHEN spec GLOB '[0-9]*-[0-9]*' THEN CAST(substr(spec, instr(spec, '-') + 1) AS INTEGER)
+	END
+FROM split WHERE position >= 0 AND spec != '';
+
+-- Memberships naming rules that no longer exist are dropped.
+INSERT INTO profile_rules (profile_name, rule_name, position)
+SELECT p.name, j.value, MIN(j.key)
+FROM profiles p, json_each(p.rules) j
+WHERE j.value IN (SELECT name FROM rules)
+GROUP BY p.name, j.value;
+
+ALTER TABLE rules DROP COLUMN ports;
+ALTER TABLE rules DROP COLUMN local_ports;
+ALTER TABLE rules DROP COLUMN remote_ports;
+ALTER TABLE profiles DROP COLUMN rules;
@@ -0,0 +1,15 @@
+-- Audit trail of rule changes. Entries outlive their rule, so rule_name is not
+-- a foreign key. Values are the rule's JSON encoding, NULL where there is
+-- none (before a create, after a delete).
+
+CREATE TABLE rule_history (
+	revision INTEGER PRIMARY KEY AUTOINCREMENT,
+	rule_name TEXT NOT NULL,
+	operation TEXT NOT NULL CHECK (operation IN ('create', 'update', 'delete', 'rename')),
+	old_value TEXT,
+	new_value TEXT,
+	actor TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL DEFAULT '',
+	changed_at INTEGER NOT NULL
+);
+CREATE INDEX rule_history_rule ON rule_history (rule_name);
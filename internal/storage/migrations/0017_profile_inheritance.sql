@@ -0,0 +1,18 @@
+-- Profile inheritance: the parents a profile extends, in order, and the
+-- inherited rules it drops. A parent cannot be deleted while it is extended.
+
+CREATE TABLE profile_parents (
+	profile_name TEXT NOT NULL REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	parent_name TEXT NOT NULL REFERENCES profiles(name) ON DELETE RESTRICT ON UPDATE CASCADE,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (profile_name, parent_name)
+);
+CREATE INDEX profile_parents_parent ON profile_parents (parent_name);
+
+CREATE TABLE profile_exclusions (
+	profile_name TEXT NOT NULL REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	rule_name TEXT NOT NULL REFERENCES rules(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	position INTEGER NOT NULL,
+	PRIMARY KEY (profile_name, rule_name)
+);
+CREATE INDEX profile_exclusions_rule ON profile_exclusions (rule_name);
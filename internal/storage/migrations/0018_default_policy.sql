@@ -0,0 +1,5 @@
+-- Per-profile default policy for connections no rule matches, per direction:
+-- prompt, allow or deny, or empty to inherit it.
+
+ALTER TABLE profiles ADD COLUMN inbound_policy TEXT NOT NULL DEFAULT '';
+ALTER TABLE profiles ADD COLUMN outbound_policy TEXT NOT NULL DEFAULT '';
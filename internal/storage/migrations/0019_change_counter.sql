@@ -0,0 +1,33 @@
+-- A counter every change to the rule and profile tables moves, whichever
+-- connection or process makes it, so long-running readers such as the
+-- connection monitor can keep what they loaded until it does.
+
+CREATE TABLE change_counter (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	value INTEGER NOT NULL
+);
+INSERT INTO change_counter (id, value) VALUES (1, 0);
+
+CREATE TRIGGER rules_insert_counted AFTER INSERT ON rules BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER rules_update_counted AFTER UPDATE ON rules BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER rules_delete_counted AFTER DELETE ON rules BEGIN UPDATE change_counter SET value = value + 1; END;
+
+CREATE TRIGGER rule_ports_insert_counted AFTER INSERT ON rule_ports BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER rule_ports_update_counted AFTER UPDATE ON rule_ports BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER rule_ports_delete_counted AFTER DELETE ON rule_ports BEGIN UPDATE change_counter SET value = value + 1; END;
+
+CREATE TRIGGER profiles_insert_counted AFTER INSERT ON profiles BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profiles_update_counted AFTER UPDATE ON profiles BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profiles_delete_counted AFTER DELETE ON profiles BEGIN UPDATE change_counter SET value = value + 1; END;
+
+CREATE TRIGGER profile_rules_insert_counted AFTER INSERT ON profile_rules BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profile_rules_update_counted AFTER UPDATE ON profile_rules BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profile_rules_delete_counted AFTER DELETE ON profile_rules BEGIN UPDATE change_counter SET value = value + 1; END;
+
+CREATE TRIGGER profile_parents_insert_counted AFTER INSERT ON profile_parents BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profile_parents_update_counted AFTER UPDATE ON profile_parents BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profile_parents_delete_counted AFTER DELETE ON profile_parents BEGIN UPDATE change_counter SET value = value + 1; END;
+
+CREATE TRIGGER profile_exclusions_insert_counted AFTER INSERT ON profile_exclusions BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profile_exclusions_update_counted AFTER UPDATE ON profile_exclusions BEGIN UPDATE change_counter SET value = value + 1; END;
+CREATE TRIGGER profile_exclusions_delete_counted AFTER DELETE ON profile_exclusions BEGIN UPDATE change_counter SET value = value + 1; END;
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open opens a sqlite database with foreign key enforcement switched on for
+// every connection, which the cascades between rules, their ports and profile
+// memberships rely on. An in-memory database is limited to one connection,
+// since each connection would otherwise get a database of its own.
+func Open(path string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite3", path+sep+"_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" || strings.Contains(path, "mode=memory") {
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// requireForeignKeys fails when db does not enforce foreign keys, i.e. when it
+// was not opened with Open.
+func requireForeignKeys(db *sql.DB) error {
+	var on int
+	if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&on); err != nil {
+		return err
+	}
+	if on != 1 {
+		return fmt.Errorf("foreign keys are not enforced; open the database with storage.Open")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is the part of *sql.DB and *sql.Tx the stores use, so the same store
+// code runs on its own or inside a caller's transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Conn is a store's handle on the database: the database itself, where every
+// write gets a transaction of its own, or a transaction opened by the caller.
+type Conn struct {
+	DB *sql.DB
+	Tx *sql.Tx
+}
+
+// Q returns the handle queries should run on.
+func (c Conn) Q() DBTX {
+	if c.Tx != nil {
+		return c.Tx
+	}
+	return c.DB
+}
+
+// Write runs fn inside the caller's transaction if there is one, otherwise in
+// a new transaction committed when fn succeeds.
+func (c Conn) Write(ctx context.Context, fn func(q DBTX) error) error {
+	if c.Tx != nil {
+		return fn(c.Tx)
+	}
+	return InTx(ctx, c.DB, func(tx *sql.Tx) error { return fn(tx) })
+}
+
+// InTx runs fn in a transaction that is committed when fn returns nil and
+// rolled back when it returns an error or panics.
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
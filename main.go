@@ -1,11 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"database/sql"
 	"embed"
 	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/wailsapp/wails/v2"
@@ -16,9 +17,13 @@ import (
 	"github.com/vhPedroGitHub/firewall/internal/config"
 	"github.com/vhPedroGitHub/firewall/internal/logging"
 	"github.com/vhPedroGitHub/firewall/internal/monitor"
+	"github.com/vhPedroGitHub/firewall/internal/platform"
+	"github.com/vhPedroGitHub/firewall/internal/policy"
 	"github.com/vhPedroGitHub/firewall/internal/profiles"
+	"github.com/vhPedroGitHub/firewall/internal/ruleio"
 	"github.com/vhPedroGitHub/firewall/internal/rules"
 	"github.com/vhPedroGitHub/firewall/internal/stats"
+	"github.com/vhPedroGitHub/firewall/internal/storage"
 )
 
 //go:embed all:cmd/gui/frontend/dist
@@ -32,8 +37,28 @@ func main() {
 		cfg = config.Default()
 	}
 
+	if err := platform.Configure(platform.Options{
+		LinuxBackend:  cfg.Platform.LinuxBackend,
+		LinuxAppMatch: cfg.Platform.LinuxAppMatch,
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if err := monitor.Configure(monitor.Options{
+		Mode:           cfg.Monitor.Mode,
+		QueueNum:       cfg.Monitor.QueueNum,
+		Timeout:        time.Duration(cfg.Monitor.TimeoutSeconds) * time.Second,
+		TimeoutVerdict: cfg.Monitor.TimeoutVerdict,
+	}); err != nil {
+		log.Fatal(err)
+	}
+	if err := app.Configure(app.Options{
+		DefaultPolicy: rules.DefaultPolicy{Inbound: cfg.DefaultPolicy.Inbound, Outbound: cfg.DefaultPolicy.Outbound},
+	}); err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize sqlite store
-	db, err := sql.Open("sqlite3", cfg.DBPath)
+	db, err := storage.Open(cfg.DBPath)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -43,6 +68,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	ruleStore.SetSource(rules.SourceGUI)
 
 	profileStore, err := profiles.NewSQLiteStore(db)
 	if err != nil {
@@ -57,8 +83,9 @@ func main() {
 
 	// Create app service
 	svc := &AppService{
-		Service:      app.Service{Store: ruleStore},
+		Service:      app.Service{Store: ruleStore, Profiles: profileStore},
 		profileStore: profileStore,
+		bundles:      app.UnitOfWork{DB: db, Rules: ruleStore, Profiles: profileStore},
 	}
 
 	// Create Wails application
@@ -71,6 +98,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        svc.startup,
+		OnShutdown:       svc.shutdown,
 		Bind: []interface{}{
 			svc,
 		},
@@ -86,11 +114,35 @@ type AppService struct {
 	ctx          context.Context
 	Service      app.Service
 	profileStore profiles.Store
+	bundles      app.UnitOfWork
 	monitorSvc   *monitor.Service
+	stopJanitor  func()
+	stopSchedule func()
 }
 
+// startup begins a firewall session: session rules left by a previous run are
+// cleared, the janitor starts removing expired rules and the scheduler starts
+// applying rule and profile schedules.
 func (a *AppService) startup(ctx context.Context) {
 	a.ctx = ctx
+	if _, err := a.Service.EndSession(); err != nil {
+		log.Printf("Failed to clear previous session rules: %v", err)
+	}
+	a.stopJanitor = a.Service.StartJanitor(app.JanitorInterval)
+	a.stopSchedule = app.NewScheduler(&a.Service).Start()
+}
+
+// shutdown ends the session, removing its session-scoped rules.
+func (a *AppService) shutdown(ctx context.Context) {
+	if a.stopJanitor != nil {
+		a.stopJanitor()
+	}
+	if a.stopSchedule != nil {
+		a.stopSchedule()
+	}
+	if _, err := a.Service.EndSession(); err != nil {
+		log.Printf("Failed to remove session rules: %v", err)
+	}
 }
 
 // Wails-exported methods for frontend
@@ -111,6 +163,32 @@ func (a *AppService) ApplyRule(r rules.Rule) error {
 	return a.Service.ApplyRule(r)
 }
 
+// RuleHistory lists recorded rule changes, newest first; name and limit are
+// optional filters.
+func (a *AppService) RuleHistory(name string, limit int) ([]rules.Change, error) {
+	return a.Service.RuleHistory(a.ctx, name, limit)
+}
+
+// RevertRules restores the rules as they were at revision and re-applies them
+// to the OS firewall.
+func (a *AppService) RevertRules(revision int64) error {
+	if _, err := a.Service.RevertRules(a.ctx, revision); err != nil {
+		return err
+	}
+	_, err := a.Service.Sync()
+	return err
+}
+
+// PlanSync returns the pending platform changes without applying them.
+func (a *AppService) PlanSync() (*platform.Plan, error) {
+	return a.Service.PlanSync()
+}
+
+// Sync reconciles the OS firewall with the desired rule set.
+func (a *AppService) Sync() (*platform.Plan, error) {
+	return a.Service.Sync()
+}
+
 func (a *AppService) ListProfiles() ([]profiles.Profile, error) {
 	return a.profileStore.ListProfiles()
 }
@@ -119,8 +197,105 @@ func (a *AppService) CreateProfile(p profiles.Profile) error {
 	return a.profileStore.SaveProfile(p)
 }
 
+// EffectiveRules lists the rules a profile enforces, inherited ones included,
+// with the profile each comes from.
+func (a *AppService) EffectiveRules(name string) ([]profiles.EffectiveRule, error) {
+	return a.Service.EffectiveRules(name)
+}
+
+// LintRules reports shadowed, redundant, contradictory and dead rules among
+// all rules, or among those a profile enforces when name is set.
+func (a *AppService) LintRules(name string) ([]rules.Finding, error) {
+	return a.Service.LintRules(name)
+}
+
+// TestConnection simulates a connection against the enforced rules and
+// returns the decision with the rule and profile behind it.
+func (a *AppService) TestConnection(event monitor.ConnectionEvent) (*app.ConnectionTrace, error) {
+	return a.Service.TraceConnection(event)
+}
+
+// DefaultPolicy returns the policy in force for connections no rule matches,
+// per direction.
+func (a *AppService) DefaultPolicy() (rules.DefaultPolicy, error) {
+	return a.Service.DefaultPolicy()
+}
+
+// ExportRules renders every persistent rule as "json", "yaml" or "csv" for
+// the frontend to save.
+func (a *AppService) ExportRules(format string) (string, error) {
+	f, err := ruleio.ParseFormat(format)
+	if err != nil {
+		return "", err
+	}
+	list, err := a.Service.ListRules()
+	if err != nil {
+		return "", err
+	}
+	var persistent []rules.Rule
+	for _, r := range list {
+		if !r.Session && r.ExpiresAt.IsZero() {
+			persistent = append(persistent, r)
+		}
+	}
+	var buf bytes.Buffer
+	if err := ruleio.Export(&buf, f, persistent); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RuleImport is the outcome of ImportRules: the change planned for each rule
+// and the entries that could not be mapped to a rule.
+type RuleImport struct {
+	Changes []policy.Change
+	Issues  []ruleio.Issue
+}
+
+// ImportRules imports rules from file contents in any ruleio format; with
+// dryRun nothing is written.
+func (a *AppService) ImportRules(data string, format string, dryRun bool) (*RuleImport, error) {
+	f, err := ruleio.ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	res, err := ruleio.Import([]byte(data), f)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := a.Service.ImportRules(context.Background(), res.Rules, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return &RuleImport{Changes: changes, Issues: res.Issues}, nil
+}
+
+// ExportProfiles packs the named profiles, the profiles they extend and their
+// rules into a bundle the frontend can save to a file.
+func (a *AppService) ExportProfiles(names []string) (*profiles.Bundle, error) {
+	return a.Service.ExportBundle(names)
+}
+
+// ImportProfiles imports a bundle read from a file, resolving conflicts with
+// strategy ("skip", "overwrite" or "rename"). With dryRun it only returns the
+// preview.
+func (a *AppService) ImportProfiles(data string, strategy string, dryRun bool) (*profiles.ImportPlan, error) {
+	st, err := profiles.ParseStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	b, err := profiles.ParseBundle([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	return a.bundles.ImportBundle(context.Background(), b, st, dryRun)
+}
+
+// ActivateProfile switches to the named profile and reconciles the OS
+// firewall with its rules, restoring the previous profile if that fails.
 func (a *AppService) ActivateProfile(name string) error {
-	return a.profileStore.SetActiveProfile(name)
+	_, err := a.Service.ActivateProfile(name)
+	return err
 }
 
 func (a *AppService) GetStats() (map[string]int64, error) {
@@ -142,6 +317,11 @@ func (a *AppService) StartMonitoring() error {
 		if err != nil {
 			return fmt.Errorf("failed to create monitor service: %w", err)
 		}
+		a.monitorSvc.SetScope(&a.Service)
+	}
+	// New processes are bound as they start, against the rule set bound here
+	if _, err := a.Service.BindApplications(); err != nil {
+		log.Printf("Failed to bind application processes: %v", err)
 	}
 	return a.monitorSvc.Start()
 }